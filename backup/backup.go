@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"concert-manager/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Bump whenever the archive layout changes, and keep Read able to load the older versions.
+// Version 2 added the owner of each record, version 1 archives belong to the default user
+const ArchiveVersion = 2
+
+// Everything in the database for every user, with events pointing at their artists and venue by ID
+type Archive struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Venues    []data.Venue  `json:"venues"`
+	Artists   []data.Artist `json:"artists"`
+	Events    []Event       `json:"events"`
+}
+
+type Event struct {
+	Id        string   `json:"id"`
+	MainActId string   `json:"mainActId,omitempty"`
+	OpenerIds []string `json:"openerIds"`
+	VenueId   string   `json:"venueId"`
+	Date      string   `json:"date"`
+	Purchased bool     `json:"purchased"`
+	TmId      string   `json:"tmId"`
+	UserId    string   `json:"userId,omitempty"`
+}
+
+type Summary struct {
+	Venues  int `json:"venues"`
+	Artists int `json:"artists"`
+	Events  int `json:"events"`
+}
+
+type database interface {
+	RunTransaction(context.Context, func(context.Context) error) error
+	ListVenues(context.Context) ([]data.Venue, error)
+	AddVenue(context.Context, data.Venue) (string, error)
+	ListArtists(context.Context) ([]data.Artist, error)
+	AddArtist(context.Context, data.Artist) (string, error)
+	ListEvents(context.Context) ([]data.Event, error)
+	AddEvent(context.Context, data.Event) (string, error)
+}
+
+type Backup struct {
+	Database database
+}
+
+func (b *Backup) Export(ctx context.Context) (*Archive, error) {
+	log.Debug("Starting database export")
+	ctx = db.WithAllUsers(ctx)
+	venues, err := b.Database.ListVenues(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export venues, %v", err)
+	}
+	artists, err := b.Database.ListArtists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export artists, %v", err)
+	}
+	events, err := b.Database.ListEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export events, %v", err)
+	}
+
+	archive := Archive{
+		Version:   ArchiveVersion,
+		CreatedAt: time.Now().UTC(),
+		Venues:    venues,
+		Artists:   artists,
+		Events:    []Event{},
+	}
+	for _, e := range events {
+		event := Event{
+			Id:        e.Id,
+			MainActId: e.MainAct.Id,
+			OpenerIds: []string{},
+			VenueId:   e.Venue.Id,
+			Date:      e.Date,
+			Purchased: e.Purchased,
+			TmId:      e.TmId,
+			UserId:    e.UserId,
+		}
+		for _, opener := range e.Openers {
+			event.OpenerIds = append(event.OpenerIds, opener.Id)
+		}
+		archive.Events = append(archive.Events, event)
+	}
+
+	log.Infof("Exported %d venues, %d artists and %d events", len(venues), len(artists), len(events))
+	return &archive, nil
+}
+
+func (b *Backup) Write(ctx context.Context, w io.Writer) error {
+	archive, err := b.Export(ctx)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(archive)
+}
+
+func Read(r io.Reader) (Archive, error) {
+	var archive Archive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return Archive{}, fmt.Errorf("invalid archive, %v", err)
+	}
+	if archive.Version < 1 || archive.Version > ArchiveVersion {
+		return Archive{}, fmt.Errorf("unsupported archive version %d, expected at most %d", archive.Version, ArchiveVersion)
+	}
+	return archive, nil
+}
+
+// Adds every record of the archive to the database in a single transaction. The backend assigns
+// new IDs, and records that already exist are reused, so restoring the same archive twice is harmless.
+// Each record is added for the user that owned it, unless the database shares every artist and venue
+func (b *Backup) Restore(ctx context.Context, archive Archive) (Summary, error) {
+	log.Debugf("Starting restore of archive version %d from %v", archive.Version, archive.CreatedAt)
+	venues := map[string]data.Venue{}
+	for _, venue := range archive.Venues {
+		venues[venue.Id] = venue
+	}
+	artists := map[string]data.Artist{}
+	for _, artist := range archive.Artists {
+		artists[artist.Id] = artist
+	}
+
+	events := []data.Event{}
+	for _, e := range archive.Events {
+		event, err := resolveEvent(e, venues, artists)
+		if err != nil {
+			log.Errorf("Archive event %v can't be restored, %v", e.Id, err)
+			return Summary{}, fmt.Errorf("invalid archive event %s, %v", e.Id, err)
+		}
+		events = append(events, event)
+	}
+
+	err := b.Database.RunTransaction(ctx, func(ctx context.Context) error {
+		for _, venue := range archive.Venues {
+			venue.Id = ""
+			if _, err := b.Database.AddVenue(db.WithUser(ctx, venue.UserId), venue); err != nil {
+				return fmt.Errorf("failed to restore venue %v, %v", venue, err)
+			}
+		}
+		for _, artist := range archive.Artists {
+			artist.Id = ""
+			if _, err := b.Database.AddArtist(db.WithUser(ctx, artist.UserId), artist); err != nil {
+				return fmt.Errorf("failed to restore artist %v, %v", artist, err)
+			}
+		}
+		for _, event := range events {
+			if _, err := b.Database.AddEvent(db.WithUser(ctx, event.UserId), event); err != nil {
+				return fmt.Errorf("failed to restore event %v, %v", event, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to restore archive, nothing was restored,", err)
+		return Summary{}, err
+	}
+
+	summary := Summary{Venues: len(archive.Venues), Artists: len(archive.Artists), Events: len(events)}
+	log.Infof("Restored %d venues, %d artists and %d events", summary.Venues, summary.Artists, summary.Events)
+	return summary, nil
+}
+
+func resolveEvent(e Event, venues map[string]data.Venue, artists map[string]data.Artist) (data.Event, error) {
+	venue, ok := venues[e.VenueId]
+	if !ok {
+		return data.Event{}, fmt.Errorf("venue %s is not in the archive", e.VenueId)
+	}
+	venue.Id = ""
+
+	var mainAct data.Artist
+	if e.MainActId != "" {
+		if mainAct, ok = artists[e.MainActId]; !ok {
+			return data.Event{}, fmt.Errorf("artist %s is not in the archive", e.MainActId)
+		}
+		mainAct.Id = ""
+	}
+	openers := []data.Artist{}
+	for _, openerId := range e.OpenerIds {
+		opener, ok := artists[openerId]
+		if !ok {
+			return data.Event{}, fmt.Errorf("artist %s is not in the archive", openerId)
+		}
+		opener.Id = ""
+		openers = append(openers, opener)
+	}
+
+	event := data.Event{
+		MainAct:   mainAct,
+		Openers:   openers,
+		Venue:     venue,
+		Date:      e.Date,
+		Purchased: e.Purchased,
+		TmId:      e.TmId,
+		UserId:    e.UserId,
+	}
+	if !event.Populated() {
+		return data.Event{}, errors.New("event is missing required fields")
+	}
+	if !util.ValidDate(event.Date) {
+		return data.Event{}, fmt.Errorf("date %s is invalid", event.Date)
+	}
+	return event, nil
+}
@@ -0,0 +1,184 @@
+package backup
+
+import (
+	"bytes"
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestDatabase() *db.DatabaseRepository {
+	conn := memory.Setup()
+	return &db.DatabaseRepository{
+		VenueRepo:  &memory.VenueRepo{Connection: conn},
+		ArtistRepo: &memory.ArtistRepo{Connection: conn},
+		EventRepo:  &memory.EventRepo{Connection: conn},
+		Transactor: conn,
+	}
+}
+
+var testEvents = []data.Event{
+	{
+		MainAct:   data.Artist{Name: "Khruangbin", Genre: "Psychedelic"},
+		Openers:   []data.Artist{{Name: "Men I Trust", Genre: "Indie"}},
+		Venue:     data.Venue{Name: "The Eastern", City: "Atlanta", State: "GA"},
+		Date:      "6/14/2023",
+		Purchased: true,
+		TmId:      "tm123",
+	},
+	{
+		Openers: []data.Artist{{Name: "Men I Trust", Genre: "Indie"}},
+		Venue:   data.Venue{Name: "Terminal West", City: "Atlanta", State: "GA"},
+		Date:    "7/1/2023",
+	},
+}
+
+func seed(t *testing.T, database *db.DatabaseRepository) {
+	ctx := context.Background()
+	for _, event := range testEvents {
+		for _, artist := range append([]data.Artist{event.MainAct}, event.Openers...) {
+			if artist.Populated() {
+				if _, err := database.AddArtist(ctx, artist); err != nil {
+					t.Fatal("unexpected error:", err)
+				}
+			}
+		}
+		if _, err := database.AddVenue(ctx, event.Venue); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if _, err := database.AddEvent(ctx, event); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	// an artist without any events should survive the round trip too
+	if _, err := database.AddArtist(ctx, data.Artist{Name: "Hermanos Gutiérrez", Genre: "Instrumental"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	source := newTestDatabase()
+	seed(t, source)
+
+	var buf bytes.Buffer
+	if err := (&Backup{Database: source}).Write(context.Background(), &buf); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	archive, err := Read(&buf)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	target := newTestDatabase()
+	summary, err := (&Backup{Database: target}).Restore(context.Background(), archive)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	expected := Summary{Venues: 2, Artists: 3, Events: 2}
+	if summary != expected {
+		t.Errorf("Incorrect summary, expected: %+v, actual: %+v", expected, summary)
+	}
+
+	events, err := target.ListEvents(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(events) != len(testEvents) {
+		t.Fatalf("Incorrect number of restored events, expected: %v, actual: %v", len(testEvents), events)
+	}
+	for _, expected := range testEvents {
+		idx := slices.IndexFunc(events, expected.Equals)
+		if idx == -1 {
+			t.Errorf("Event %v was not restored", expected)
+			continue
+		}
+		actual := events[idx]
+		if len(actual.Openers) != len(expected.Openers) || actual.Purchased != expected.Purchased || actual.TmId != expected.TmId {
+			t.Errorf("Restored event doesn't match, expected: %v, actual: %v", expected, actual)
+		}
+	}
+	if artists, _ := target.ListArtists(context.Background()); len(artists) != 3 {
+		t.Errorf("Incorrect restored artists: %v", artists)
+	}
+}
+
+func TestRestoreDanglingReference(t *testing.T) {
+	archive := Archive{
+		Version: ArchiveVersion,
+		Venues:  []data.Venue{{Name: "The Eastern", City: "Atlanta", State: "GA", Id: "v1"}},
+		Events:  []Event{{Id: "e1", MainActId: "missing", VenueId: "v1", Date: "6/14/2023"}},
+	}
+
+	target := newTestDatabase()
+	if _, err := (&Backup{Database: target}).Restore(context.Background(), archive); err == nil {
+		t.Fatal("expected error")
+	}
+	if venues, _ := target.ListVenues(context.Background()); len(venues) != 0 {
+		t.Errorf("Nothing should be restored from an invalid archive: %v", venues)
+	}
+}
+
+func TestRestoreInvalidDate(t *testing.T) {
+	archive := Archive{
+		Version: ArchiveVersion,
+		Artists: []data.Artist{{Name: "Khruangbin", Genre: "Psychedelic", Id: "a1"}},
+		Venues:  []data.Venue{{Name: "The Eastern", City: "Atlanta", State: "GA", Id: "v1"}},
+		Events:  []Event{{Id: "e1", MainActId: "a1", VenueId: "v1", Date: "2023-06-14"}},
+	}
+
+	target := newTestDatabase()
+	if _, err := (&Backup{Database: target}).Restore(context.Background(), archive); err == nil {
+		t.Fatal("expected error")
+	}
+	if artists, _ := target.ListArtists(context.Background()); len(artists) != 0 {
+		t.Errorf("Nothing should be restored from an invalid archive: %v", artists)
+	}
+}
+
+func TestReadUnsupportedVersion(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestRoundTripKeepsOwners(t *testing.T) {
+	source := newTestDatabase()
+	alice := db.WithUser(context.Background(), "alice")
+	for _, ctx := range []context.Context{context.Background(), alice} {
+		if _, err := source.AddArtist(ctx, testEvents[0].MainAct); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if _, err := source.AddVenue(ctx, testEvents[0].Venue); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if _, err := source.AddEvent(ctx, data.Event{MainAct: testEvents[0].MainAct, Venue: testEvents[0].Venue, Date: "6/14/2023"}); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	archive, err := (&Backup{Database: source}).Export(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(archive.Events) != 2 {
+		t.Fatalf("Events of every user should be exported, actual: %+v", archive.Events)
+	}
+
+	target := newTestDatabase()
+	if _, err := (&Backup{Database: target}).Restore(context.Background(), *archive); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, ctx := range []context.Context{context.Background(), alice} {
+		events, err := target.ListEvents(ctx)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if len(events) != 1 || events[0].UserId != db.User(ctx) {
+			t.Errorf("Each user should get their own event back, user: %v, actual: %+v", db.User(ctx), events)
+		}
+	}
+}
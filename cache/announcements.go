@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/util"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type AnnouncementKind string
+
+const (
+	Announced     AnnouncementKind = "announced"
+	Removed       AnnouncementKind = "removed"
+	Rescheduled   AnnouncementKind = "rescheduled"
+	LineupChanged AnnouncementKind = "lineupChanged"
+)
+
+// How long announcements are kept after they were found
+const announcementRetention = 60 * 24 * time.Hour
+
+// An upcoming event that was announced, removed or changed between two refreshes of its location
+type Announcement struct {
+	Kind     AnnouncementKind  `json:"kind"`
+	Location Location          `json:"location"`
+	Event    data.EventDetails `json:"event"`
+	// the event as it was before, for reschedules and lineup changes
+	Previous *data.EventDetails `json:"previous,omitempty"`
+	At       time.Time          `json:"at"`
+}
+
+// Compares the events of a location before and after a refresh, matching them by their Ticketmaster ID.
+// Events without one can't be told apart from new events, so they are left out. Events that disappear
+// after their date passed were only dropped from the listings, so they aren't announced as removed
+func diffUpcoming(loc Location, before []data.EventDetails, after []data.EventDetails, at time.Time) []Announcement {
+	previous := map[string]data.EventDetails{}
+	for _, d := range before {
+		if d.Event.TmId != "" {
+			previous[d.Event.TmId] = d
+		}
+	}
+
+	announcements := []Announcement{}
+	announce := func(kind AnnouncementKind, d data.EventDetails, old *data.EventDetails) {
+		announcement := Announcement{Kind: kind, Location: loc, Event: util.CloneEventDetail(d), At: at}
+		if old != nil {
+			cloned := util.CloneEventDetail(*old)
+			announcement.Previous = &cloned
+		}
+		announcements = append(announcements, announcement)
+	}
+
+	seen := map[string]bool{}
+	for _, d := range after {
+		id := d.Event.TmId
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		old, ok := previous[id]
+		if !ok {
+			announce(Announced, d, nil)
+			continue
+		}
+		if old.Event.Date != d.Event.Date {
+			announce(Rescheduled, d, &old)
+		}
+		if !slices.Equal(lineup(old.Event), lineup(d.Event)) {
+			announce(LineupChanged, d, &old)
+		}
+	}
+	for _, d := range before {
+		id := d.Event.TmId
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if util.ValidDate(d.Event.Date) && util.PastDate(d.Event.Date) {
+			continue
+		}
+		announce(Removed, d, nil)
+	}
+	return announcements
+}
+
+// The names of the main act and openers, ignoring case since listings aren't consistent about it
+func lineup(e data.Event) []string {
+	names := []string{strings.ToLower(e.MainAct.Name)}
+	for _, opener := range e.Openers {
+		names = append(names, strings.ToLower(opener.Name))
+	}
+	return names
+}
+
+// Announcements found for the location after the given time, newest first
+func (c *UpcomingEventCache) AnnouncementsSince(loc Location, since time.Time) []Announcement {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	found := []Announcement{}
+	for _, announcement := range c.announcements {
+		if announcement.Location.key() == loc.key() && announcement.At.After(since) {
+			found = append(found, cloneAnnouncement(announcement))
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].At.After(found[j].At)
+	})
+	return found
+}
+
+// Adds announcements to the feed, and drops those older than the retention. Must be called with the mutex held
+func (c *UpcomingEventCache) announce(announcements []Announcement, now time.Time) {
+	cutoff := now.Add(-announcementRetention)
+	c.announcements = slices.DeleteFunc(c.announcements, func(a Announcement) bool {
+		return a.At.Before(cutoff)
+	})
+	c.announcements = append(c.announcements, announcements...)
+}
+
+func cloneAnnouncement(a Announcement) Announcement {
+	a.Event = util.CloneEventDetail(a.Event)
+	if a.Previous != nil {
+		previous := util.CloneEventDetail(*a.Previous)
+		a.Previous = &previous
+	}
+	return a
+}
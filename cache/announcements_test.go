@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/finder"
+	"concert-manager/util"
+	"testing"
+	"time"
+)
+
+func upcomingEvent(tmId string, date string, artists ...string) data.EventDetails {
+	event := data.Event{MainAct: data.Artist{Name: artists[0]}, Venue: data.Venue{Name: "The Eastern"}, Date: date, TmId: tmId}
+	for _, opener := range artists[1:] {
+		event.Openers = append(event.Openers, data.Artist{Name: opener})
+	}
+	return data.EventDetails{Name: artists[0], Event: event}
+}
+
+var (
+	nextMonth = util.Date(time.Now().AddDate(0, 1, 0))
+	nextYear  = util.Date(time.Now().AddDate(1, 0, 0))
+)
+
+func TestDiffUpcoming(t *testing.T) {
+	before := []data.EventDetails{
+		upcomingEvent("moved", nextMonth, "Khruangbin"),
+		upcomingEvent("lineup", nextMonth, "Men I Trust"),
+		upcomingEvent("passed", "6/14/2023", "Hermanos Gutiérrez"),
+		upcomingEvent("cancelled", nextMonth, "Crumb"),
+		upcomingEvent("same", nextMonth, "Vulfpeck", "Cory Wong"),
+		upcomingEvent("", nextMonth, "Unknown"),
+	}
+	after := []data.EventDetails{
+		upcomingEvent("moved", nextYear, "Khruangbin"),
+		upcomingEvent("lineup", nextMonth, "Men I Trust", "Good Morning"),
+		upcomingEvent("same", nextMonth, "VULFPECK", "Cory Wong"),
+		upcomingEvent("new", nextYear, "Parcels"),
+		upcomingEvent("", nextYear, "Unknown"),
+	}
+
+	announcements := diffUpcoming(DefaultLocation(), before, after, time.Now())
+	expected := map[string]AnnouncementKind{"moved": Rescheduled, "lineup": LineupChanged, "new": Announced, "cancelled": Removed}
+	if len(announcements) != len(expected) {
+		t.Fatalf("Incorrect announcements, expected: %v, actual: %+v", expected, announcements)
+	}
+	for _, announcement := range announcements {
+		if kind := expected[announcement.Event.Event.TmId]; kind != announcement.Kind {
+			t.Errorf("Incorrect announcement, expected: %v, actual: %+v", kind, announcement)
+		}
+		if announcement.Kind == Rescheduled && (announcement.Previous == nil || announcement.Previous.Event.Date != nextMonth) {
+			t.Errorf("Rescheduled event should keep its previous date, actual: %+v", announcement.Previous)
+		}
+	}
+}
+
+// Returns each of the results in turn, one per search
+type sequenceFinder struct {
+	results [][]data.EventDetails
+}
+
+func (f *sequenceFinder) FindAllEvents(finder.FindEventRequest) ([]data.EventDetails, error) {
+	result := f.results[0]
+	if len(f.results) > 1 {
+		f.results = f.results[1:]
+	}
+	return result, nil
+}
+
+func TestAnnouncementFeed(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewUpcomingEventCache()
+	if err := cache.PersistIn(dir); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	cache.Finder = &sequenceFinder{results: [][]data.EventDetails{
+		{upcomingEvent("first", nextMonth, "Khruangbin")},
+		{upcomingEvent("first", nextMonth, "Khruangbin"), upcomingEvent("second", nextMonth, "Crumb")},
+	}}
+	loc := DefaultLocation()
+	start := time.Now().Add(-time.Second)
+
+	if err := cache.RefreshUpcomingEvents(loc); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if announcements := cache.AnnouncementsSince(loc, start); len(announcements) != 0 {
+		t.Errorf("The first events found shouldn't be announced, actual: %+v", announcements)
+	}
+	if err := cache.RefreshUpcomingEvents(loc); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	announcements := cache.AnnouncementsSince(loc, start)
+	if len(announcements) != 1 || announcements[0].Kind != Announced || announcements[0].Event.Event.TmId != "second" {
+		t.Errorf("Expected the new event to be announced, actual: %+v", announcements)
+	}
+	if other := cache.AnnouncementsSince(Location{City: "Nashville", StateCode: "TN"}, start); len(other) != 0 {
+		t.Errorf("Announcements should be kept per location, actual: %+v", other)
+	}
+	if later := cache.AnnouncementsSince(loc, time.Now().Add(time.Second)); len(later) != 0 {
+		t.Errorf("Announcements found before since should be left out, actual: %+v", later)
+	}
+
+	restarted := NewUpcomingEventCache()
+	if err := restarted.PersistIn(dir); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if persisted := restarted.AnnouncementsSince(loc, start); len(persisted) != 1 {
+		t.Errorf("Announcements should be persisted, actual: %+v", persisted)
+	}
+}
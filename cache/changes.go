@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"sync"
+	"time"
+)
+
+type ChangeKind string
+
+const (
+	EventAdded    ChangeKind = "eventAdded"
+	EventUpdated  ChangeKind = "eventUpdated"
+	EventDeleted  ChangeKind = "eventDeleted"
+	ArtistAdded   ChangeKind = "artistAdded"
+	ArtistUpdated ChangeKind = "artistUpdated"
+	ArtistDeleted ChangeKind = "artistDeleted"
+	VenueAdded    ChangeKind = "venueAdded"
+	VenueUpdated  ChangeKind = "venueUpdated"
+	VenueDeleted  ChangeKind = "venueDeleted"
+	// All the saved events, artists or venues were loaded from the database again
+	EventsReloaded  ChangeKind = "eventsReloaded"
+	ArtistsReloaded ChangeKind = "artistsReloaded"
+	VenuesReloaded  ChangeKind = "venuesReloaded"
+	// The upcoming events of the location were found again
+	UpcomingRefreshed ChangeKind = "upcomingRefreshed"
+	// The upcoming events of the location were ranked again
+	RecommendationsRefreshed ChangeKind = "recommendationsRefreshed"
+	// The subscriber fell behind and some changes were dropped, so anything it holds may be stale
+	ChangesMissed ChangeKind = "changesMissed"
+)
+
+// Something that changed in a cache. Only the record of the kind is set, and none for reloads
+type Change struct {
+	Kind     ChangeKind   `json:"kind"`
+	User     string       `json:"user,omitempty"`
+	Id       string       `json:"id,omitempty"`
+	Event    *data.Event  `json:"event,omitempty"`
+	Artist   *data.Artist `json:"artist,omitempty"`
+	Venue    *data.Venue  `json:"venue,omitempty"`
+	Location *Location    `json:"location,omitempty"`
+	At       time.Time    `json:"at"`
+}
+
+// How many changes a subscriber can fall behind by before changes are dropped for it
+const changeBuffer = 64
+
+// Fans changes out to subscribers. Publishing never waits on a subscriber, one that falls behind
+// misses changes instead and is told so with ChangesMissed once it catches up
+type publisher struct {
+	mutex       sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	changes chan Change
+	missed  bool
+}
+
+// Returns the channel changes are delivered on, and a function that cancels the subscription and closes the channel
+func (p *publisher) subscribe() (<-chan Change, func()) {
+	s := &subscriber{changes: make(chan Change, changeBuffer)}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.subscribers == nil {
+		p.subscribers = make(map[*subscriber]struct{})
+	}
+	p.subscribers[s] = struct{}{}
+
+	var once sync.Once
+	return s.changes, func() {
+		once.Do(func() {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			delete(p.subscribers, s)
+			close(s.changes)
+		})
+	}
+}
+
+func (p *publisher) publish(changes ...Change) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for s := range p.subscribers {
+		for _, change := range changes {
+			if s.missed {
+				if !trySend(s.changes, Change{Kind: ChangesMissed, User: change.User, At: change.At}) {
+					break
+				}
+				s.missed = false
+			}
+			if !trySend(s.changes, change) {
+				s.missed = true
+				break
+			}
+		}
+	}
+}
+
+func trySend(changes chan Change, change Change) bool {
+	select {
+	case changes <- change:
+		return true
+	default:
+		return false
+	}
+}
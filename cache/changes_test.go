@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"concert-manager/finder"
+	"context"
+	"testing"
+)
+
+// Collects every change delivered so far, without waiting for more
+func drain(changes <-chan Change) []Change {
+	drained := []Change{}
+	for {
+		select {
+		case change := <-changes:
+			drained = append(drained, change)
+		default:
+			return drained
+		}
+	}
+}
+
+func kinds(changes []Change) []ChangeKind {
+	kinds := []ChangeKind{}
+	for _, change := range changes {
+		kinds = append(kinds, change.Kind)
+	}
+	return kinds
+}
+
+func TestSavedEventChanges(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	changes, cancel := cache.Subscribe()
+	ctx := context.Background()
+
+	saved, err := cache.AddSavedEvent(ctx, testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	added := drain(changes)
+	expected := []ChangeKind{ArtistAdded, ArtistAdded, VenueAdded, EventAdded}
+	if len(added) != len(expected) {
+		t.Fatalf("Incorrect changes, expected: %v, actual: %v", expected, kinds(added))
+	}
+	for i, change := range added {
+		if change.Kind != expected[i] || change.User != db.DefaultUser {
+			t.Errorf("Incorrect change, expected: %v, actual: %+v", expected[i], change)
+		}
+	}
+	if event := added[3].Event; added[3].Id != saved.Id || event == nil || !event.Equals(testEvent) {
+		t.Errorf("Added event change should carry the event, actual: %+v", added[3])
+	}
+	// subscribers read the cache once they get the change, so it has to be published by then
+	if _, ok := cache.GetSavedEvent(added[3].Id); !ok {
+		t.Error("Change was delivered before the cache was published")
+	}
+
+	if err := cache.DeleteSavedEvent(ctx, saved.Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshArtists(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if actual := kinds(drain(changes)); len(actual) != 2 || actual[0] != EventDeleted || actual[1] != ArtistsReloaded {
+		t.Errorf("Incorrect changes, expected: %v, actual: %v", []ChangeKind{EventDeleted, ArtistsReloaded}, actual)
+	}
+
+	cancel()
+	if _, open := <-changes; open {
+		t.Error("Cancelling should close the channel")
+	}
+	cancel()
+}
+
+func TestRolledBackChangesAreNotPublished(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return failingEventRepo{r} })
+	changes, cancel := cache.Subscribe()
+	defer cancel()
+
+	if _, err := cache.AddSavedEvent(context.Background(), testEvent); err == nil {
+		t.Fatal("expected an error")
+	}
+	if actual := drain(changes); len(actual) != 0 {
+		t.Errorf("Changes of a failed transaction should not be published, actual: %v", kinds(actual))
+	}
+}
+
+func TestSlowSubscriberMissesChanges(t *testing.T) {
+	p := &publisher{}
+	changes, cancel := p.subscribe()
+	defer cancel()
+
+	for i := 0; i < changeBuffer+10; i++ {
+		p.publish(Change{Kind: EventAdded})
+	}
+	if delivered := drain(changes); len(delivered) != changeBuffer {
+		t.Errorf("Expected a full buffer of changes, actual: %d", len(delivered))
+	}
+	p.publish(Change{Kind: EventDeleted})
+	if actual := kinds(drain(changes)); len(actual) != 2 || actual[0] != ChangesMissed || actual[1] != EventDeleted {
+		t.Errorf("Subscriber should be told it missed changes, actual: %v", actual)
+	}
+}
+
+type stubFinder struct{}
+
+func (stubFinder) FindAllEvents(finder.FindEventRequest) ([]data.EventDetails, error) {
+	return []data.EventDetails{{Event: testEvent}}, nil
+}
+
+func TestUpcomingRefreshChanges(t *testing.T) {
+	cache := NewUpcomingEventCache()
+	cache.Finder = stubFinder{}
+	changes, cancel := cache.Subscribe()
+	defer cancel()
+
+	loc := Location{City: "Nashville", StateCode: "TN"}
+	if err := cache.RefreshUpcomingEvents(loc); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	refreshed := drain(changes)
+	if len(refreshed) != 1 || refreshed[0].Kind != UpcomingRefreshed || *refreshed[0].Location != loc {
+		t.Errorf("Refresh should be published with its location, actual: %+v", refreshed)
+	}
+}
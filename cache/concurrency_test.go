@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// These tests are most useful with the race detector, go test -race ./cache
+
+func newConcurrentEvent(i int) data.Event {
+	event := testEvent
+	event.Date = fmt.Sprintf("6/%d/2023", i%28+1)
+	event.MainAct = data.Artist{Name: fmt.Sprintf("Artist %d", i), Genre: "Rock"}
+	return event
+}
+
+// The server and the terminal UI share the cache of the default user from separate goroutines
+func TestConcurrentServerAndTUI(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	ctx := context.Background()
+	const writes = 20
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	// the server saves events and edits the artists they brought along
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			saved, err := cache.AddSavedEvent(ctx, newConcurrentEvent(i))
+			if err != nil {
+				t.Error("unexpected error:", err)
+				return
+			}
+			artist := saved.MainAct
+			artist.Genre = "Indie Rock"
+			if err := cache.UpdateArtist(ctx, artist.Id, artist); err != nil {
+				t.Error("unexpected error:", err)
+			}
+			if _, err := cache.QuerySavedEvents(data.EventQuery{}); err != nil {
+				t.Error("unexpected error:", err)
+			}
+		}
+	}()
+	// the terminal UI marks events as purchased and deletes them as it browses
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			events := cache.GetSavedEvents()
+			if len(events) == 0 {
+				continue
+			}
+			event := events[len(events)-1]
+			event.Purchased = true
+			if err := cache.UpdateSavedEvent(ctx, event.Id, event); err != nil {
+				t.Error("unexpected error:", err)
+			}
+			if i%5 == 0 {
+				if err := cache.DeleteSavedEvent(ctx, events[0].Id); err != nil {
+					t.Error("unexpected error:", err)
+				}
+			}
+		}
+	}()
+	// both keep reading while the others write, and never see an event that is only partly saved
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes*5; i++ {
+			for _, event := range cache.GetSavedEvents() {
+				if event.Id == "" || event.MainAct.Id == "" || event.Venue.Id == "" {
+					t.Errorf("Read an event that was only partly saved: %+v", event)
+				}
+			}
+			cache.GetPassedSavedEvents()
+			cache.GetArtists()
+			cache.GetVenues()
+			cache.FindDuplicateArtists()
+		}
+	}()
+	wg.Wait()
+
+	// the cache should end up the way a fresh load from the database sees it
+	reloaded := &SavedEventCache{Database: cache.Database}
+	reloaded.LoadCaches()
+	if len(reloaded.GetSavedEvents()) != len(cache.GetSavedEvents()) || len(reloaded.GetArtists()) != len(cache.GetArtists()) {
+		t.Errorf("Cache drifted from the database, cached: %d events and %d artists, database: %d events and %d artists",
+			len(cache.GetSavedEvents()), len(cache.GetArtists()), len(reloaded.GetSavedEvents()), len(reloaded.GetArtists()))
+	}
+}
+
+// Catalog changes of one user refresh the caches of the others, which must not deadlock
+// while those users are making changes of their own
+func TestConcurrentUsers(t *testing.T) {
+	caches := newTestUserCaches()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for _, user := range []string{"alice", "bob", db.DefaultUser} {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			cache, err := caches.For(user)
+			if err != nil {
+				t.Error("unexpected error:", err)
+				return
+			}
+			for i := 0; i < 10; i++ {
+				if _, err := cache.AddSavedEvent(ctx, newConcurrentEvent(i)); err != nil {
+					t.Error("unexpected error:", err)
+				}
+				cache.GetArtists()
+			}
+		}(user)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			if err := caches.RefreshAll(); err != nil {
+				t.Error("unexpected error:", err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	for _, user := range []string{"alice", "bob", db.DefaultUser} {
+		cache, err := caches.For(user)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if len(cache.GetSavedEvents()) != 10 || len(cache.GetArtists()) != 11 {
+			t.Errorf("Incorrect cache contents for %s, events: %d, artists: %d",
+				user, len(cache.GetSavedEvents()), len(cache.GetArtists()))
+		}
+	}
+}
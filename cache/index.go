@@ -0,0 +1,446 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/util"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+// The identity Event.Equals compares
+type eventKey struct {
+	mainAct artistKey
+	venue   venueKey
+	date    string
+}
+
+// The identity Artist.Equals compares
+type artistKey struct {
+	name  string
+	genre string
+}
+
+// The identity Venue.Equals compares
+type venueKey struct {
+	name  string
+	city  string
+	state string
+}
+
+func keyOfEvent(e data.Event) eventKey {
+	return eventKey{mainAct: keyOfArtist(e.MainAct), venue: keyOfVenue(e.Venue), date: e.Date}
+}
+
+func keyOfArtist(a data.Artist) artistKey {
+	return artistKey{name: a.Name, genre: a.Genre}
+}
+
+func keyOfVenue(v data.Venue) venueKey {
+	return venueKey{name: v.Name, city: v.City, state: v.State}
+}
+
+// The saved events, artists and venues of a cache, indexed by position. The indexes are updated
+// along with each change rather than rebuilt, so a bulk change costs no more than its single
+// changes would. Records are only changed through the methods here, so the indexes can't go stale
+type records struct {
+	savedEvents []data.Event
+	artists     []data.Artist
+	venues      []data.Venue
+
+	eventIds  map[string]int
+	artistIds map[string]int
+	venueIds  map[string]int
+	// the positions of the records with each identity, in order, the first one is what lookups find
+	eventKeys    map[eventKey][]int
+	artistKeys   map[artistKey][]int
+	venueKeys    map[venueKey][]int
+	artistEvents map[string][]int
+	venueEvents  map[string][]int
+	// every event with a valid date, ordered by date and then by position
+	eventsByDate []int
+	// what changed since the cache was last published
+	changes []Change
+}
+
+func newRecords(savedEvents []data.Event, artists []data.Artist, venues []data.Venue) *records {
+	r := &records{savedEvents: savedEvents, artists: artists, venues: venues}
+	r.indexEvents()
+	r.indexArtists()
+	r.indexVenues()
+	return r
+}
+
+// A copy that shares nothing with the original, so either one can change without affecting the other.
+// The indexes are copied rather than rebuilt, since the copy is made every time the cache is published
+func (r *records) clone() *records {
+	return &records{
+		savedEvents:  util.CloneEvents(r.savedEvents),
+		artists:      util.CloneArtists(r.artists),
+		venues:       util.CloneVenues(r.venues),
+		eventIds:     maps.Clone(r.eventIds),
+		artistIds:    maps.Clone(r.artistIds),
+		venueIds:     maps.Clone(r.venueIds),
+		eventKeys:    clonePositions(r.eventKeys),
+		artistKeys:   clonePositions(r.artistKeys),
+		venueKeys:    clonePositions(r.venueKeys),
+		artistEvents: clonePositions(r.artistEvents),
+		venueEvents:  clonePositions(r.venueEvents),
+		eventsByDate: slices.Clone(r.eventsByDate),
+		changes:      slices.Clone(r.changes),
+	}
+}
+
+func (r *records) changed(change Change) {
+	change.At = time.Now().UTC()
+	r.changes = append(r.changes, change)
+}
+
+func clonePositions[K comparable](index map[K][]int) map[K][]int {
+	clone := make(map[K][]int, len(index))
+	for key, positions := range index {
+		clone[key] = slices.Clone(positions)
+	}
+	return clone
+}
+
+// Positions under a key are kept in order
+func addPosition[K comparable](index map[K][]int, key K, i int) {
+	n, found := slices.BinarySearch(index[key], i)
+	if !found {
+		index[key] = slices.Insert(index[key], n, i)
+	}
+}
+
+func removePosition[K comparable](index map[K][]int, key K, i int) {
+	if n, found := slices.BinarySearch(index[key], i); found {
+		index[key] = slices.Delete(index[key], n, n+1)
+		if len(index[key]) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+// Moves the positions after a removed record down by one, which keeps them in order
+func shiftPositions[K comparable](index map[K][]int, removed int) {
+	for _, positions := range index {
+		for n, i := range positions {
+			if i > removed {
+				positions[n] = i - 1
+			}
+		}
+	}
+}
+
+func shiftIds(ids map[string]int, removed int) {
+	for id, i := range ids {
+		if i > removed {
+			ids[id] = i - 1
+		}
+	}
+}
+
+// The artists of an event, each only once
+func eventArtistIds(event data.Event) []string {
+	artistIds := []string{event.MainAct.Id}
+	for _, opener := range event.Openers {
+		if !slices.Contains(artistIds, opener.Id) {
+			artistIds = append(artistIds, opener.Id)
+		}
+	}
+	return artistIds
+}
+
+// Whether the event at position a comes before the event at position b in eventsByDate
+func (r *records) dateOrder(a int, b int) bool {
+	aTime, bTime := util.Timestamp(r.savedEvents[a].Date), util.Timestamp(r.savedEvents[b].Date)
+	if aTime.Equal(bTime) {
+		return a < b
+	}
+	return aTime.Before(bTime)
+}
+
+func (r *records) indexEvents() {
+	r.eventIds = make(map[string]int, len(r.savedEvents))
+	r.eventKeys = make(map[eventKey][]int, len(r.savedEvents))
+	r.artistEvents = make(map[string][]int)
+	r.venueEvents = make(map[string][]int)
+	r.eventsByDate = []int{}
+	for i, event := range r.savedEvents {
+		r.indexEvent(i)
+		if util.ValidDate(event.Date) {
+			r.eventsByDate = append(r.eventsByDate, i)
+		}
+	}
+	sort.Slice(r.eventsByDate, func(a, b int) bool { return r.dateOrder(r.eventsByDate[a], r.eventsByDate[b]) })
+}
+
+// Adds the event at position i to every index except eventsByDate
+func (r *records) indexEvent(i int) {
+	event := r.savedEvents[i]
+	r.eventIds[event.Id] = i
+	addPosition(r.eventKeys, keyOfEvent(event), i)
+	for _, id := range eventArtistIds(event) {
+		addPosition(r.artistEvents, id, i)
+	}
+	addPosition(r.venueEvents, event.Venue.Id, i)
+}
+
+// Removes the event at position i from the indexes, which must be done before the event changes
+func (r *records) unindexEvent(i int) {
+	event := r.savedEvents[i]
+	if r.eventIds[event.Id] == i {
+		delete(r.eventIds, event.Id)
+	}
+	removePosition(r.eventKeys, keyOfEvent(event), i)
+	for _, id := range eventArtistIds(event) {
+		removePosition(r.artistEvents, id, i)
+	}
+	removePosition(r.venueEvents, event.Venue.Id, i)
+	if util.ValidDate(event.Date) {
+		n := sort.Search(len(r.eventsByDate), func(n int) bool { return !r.dateOrder(r.eventsByDate[n], i) })
+		if n < len(r.eventsByDate) && r.eventsByDate[n] == i {
+			r.eventsByDate = slices.Delete(r.eventsByDate, n, n+1)
+		}
+	}
+}
+
+func (r *records) indexEventDate(i int) {
+	if util.ValidDate(r.savedEvents[i].Date) {
+		n := sort.Search(len(r.eventsByDate), func(n int) bool { return r.dateOrder(i, r.eventsByDate[n]) })
+		r.eventsByDate = slices.Insert(r.eventsByDate, n, i)
+	}
+}
+
+func (r *records) indexArtists() {
+	r.artistIds = make(map[string]int, len(r.artists))
+	r.artistKeys = make(map[artistKey][]int, len(r.artists))
+	for i := range r.artists {
+		r.indexArtist(i)
+	}
+}
+
+func (r *records) indexArtist(i int) {
+	r.artistIds[r.artists[i].Id] = i
+	addPosition(r.artistKeys, keyOfArtist(r.artists[i]), i)
+}
+
+func (r *records) unindexArtist(i int) {
+	if r.artistIds[r.artists[i].Id] == i {
+		delete(r.artistIds, r.artists[i].Id)
+	}
+	removePosition(r.artistKeys, keyOfArtist(r.artists[i]), i)
+}
+
+func (r *records) indexVenues() {
+	r.venueIds = make(map[string]int, len(r.venues))
+	r.venueKeys = make(map[venueKey][]int, len(r.venues))
+	for i := range r.venues {
+		r.indexVenue(i)
+	}
+}
+
+func (r *records) indexVenue(i int) {
+	r.venueIds[r.venues[i].Id] = i
+	addPosition(r.venueKeys, keyOfVenue(r.venues[i]), i)
+}
+
+func (r *records) unindexVenue(i int) {
+	if r.venueIds[r.venues[i].Id] == i {
+		delete(r.venueIds, r.venues[i].Id)
+	}
+	removePosition(r.venueKeys, keyOfVenue(r.venues[i]), i)
+}
+
+func (r *records) setEvents(savedEvents []data.Event) {
+	r.savedEvents = savedEvents
+	r.indexEvents()
+	r.changed(Change{Kind: EventsReloaded})
+}
+
+func (r *records) setArtists(artists []data.Artist) {
+	r.artists = artists
+	r.indexArtists()
+	r.changed(Change{Kind: ArtistsReloaded})
+}
+
+func (r *records) setVenues(venues []data.Venue) {
+	r.venues = venues
+	r.indexVenues()
+	r.changed(Change{Kind: VenuesReloaded})
+}
+
+// Replaces the event with the same ID, or adds it when there is none
+func (r *records) putEvent(event data.Event) {
+	kind := EventAdded
+	i, ok := r.eventIds[event.Id]
+	if ok {
+		r.unindexEvent(i)
+		r.savedEvents[i] = util.CloneEvent(event)
+		kind = EventUpdated
+	} else {
+		i = len(r.savedEvents)
+		r.savedEvents = append(r.savedEvents, util.CloneEvent(event))
+	}
+	r.indexEvent(i)
+	r.indexEventDate(i)
+	changed := util.CloneEvent(event)
+	r.changed(Change{Kind: kind, Id: event.Id, Event: &changed})
+}
+
+// Later events move down a position, so removing costs a pass over the indexes but never a sort
+func (r *records) removeEvent(id string) {
+	if i, ok := r.eventIds[id]; ok {
+		removed := util.CloneEvent(r.savedEvents[i])
+		r.unindexEvent(i)
+		r.savedEvents = slices.Delete(r.savedEvents, i, i+1)
+		shiftIds(r.eventIds, i)
+		shiftPositions(r.eventKeys, i)
+		shiftPositions(r.artistEvents, i)
+		shiftPositions(r.venueEvents, i)
+		for n, position := range r.eventsByDate {
+			if position > i {
+				r.eventsByDate[n] = position - 1
+			}
+		}
+		r.changed(Change{Kind: EventDeleted, Id: id, Event: &removed})
+	}
+}
+
+// Replaces the artist with the same ID, or adds it when there is none
+func (r *records) putArtist(artist data.Artist) {
+	kind := ArtistAdded
+	i, ok := r.artistIds[artist.Id]
+	if ok {
+		r.unindexArtist(i)
+		r.artists[i] = util.CloneArtist(artist)
+		kind = ArtistUpdated
+	} else {
+		i = len(r.artists)
+		r.artists = append(r.artists, util.CloneArtist(artist))
+	}
+	r.indexArtist(i)
+	changed := util.CloneArtist(artist)
+	r.changed(Change{Kind: kind, Id: artist.Id, Artist: &changed})
+}
+
+func (r *records) removeArtist(id string) {
+	if i, ok := r.artistIds[id]; ok {
+		removed := util.CloneArtist(r.artists[i])
+		r.unindexArtist(i)
+		r.artists = slices.Delete(r.artists, i, i+1)
+		shiftIds(r.artistIds, i)
+		shiftPositions(r.artistKeys, i)
+		r.changed(Change{Kind: ArtistDeleted, Id: id, Artist: &removed})
+	}
+}
+
+// Replaces the venue with the same ID, or adds it when there is none
+func (r *records) putVenue(venue data.Venue) {
+	kind := VenueAdded
+	i, ok := r.venueIds[venue.Id]
+	if ok {
+		r.unindexVenue(i)
+		r.venues[i] = util.CloneVenue(venue)
+		kind = VenueUpdated
+	} else {
+		i = len(r.venues)
+		r.venues = append(r.venues, util.CloneVenue(venue))
+	}
+	r.indexVenue(i)
+	changed := util.CloneVenue(venue)
+	r.changed(Change{Kind: kind, Id: venue.Id, Venue: &changed})
+}
+
+func (r *records) removeVenue(id string) {
+	if i, ok := r.venueIds[id]; ok {
+		removed := util.CloneVenue(r.venues[i])
+		r.unindexVenue(i)
+		r.venues = slices.Delete(r.venues, i, i+1)
+		shiftIds(r.venueIds, i)
+		shiftPositions(r.venueKeys, i)
+		r.changed(Change{Kind: VenueDeleted, Id: id, Venue: &removed})
+	}
+}
+
+func (r *records) eventById(id string) (data.Event, bool) {
+	if i, ok := r.eventIds[id]; ok {
+		return util.CloneEvent(r.savedEvents[i]), true
+	}
+	return data.Event{}, false
+}
+
+func (r *records) artistById(id string) (data.Artist, bool) {
+	if i, ok := r.artistIds[id]; ok {
+		return util.CloneArtist(r.artists[i]), true
+	}
+	return data.Artist{}, false
+}
+
+func (r *records) venueById(id string) (data.Venue, bool) {
+	if i, ok := r.venueIds[id]; ok {
+		return util.CloneVenue(r.venues[i]), true
+	}
+	return data.Venue{}, false
+}
+
+// The cached event that Equals the given one
+func (r *records) findEvent(event data.Event) (data.Event, bool) {
+	if positions, ok := r.eventKeys[keyOfEvent(event)]; ok {
+		return util.CloneEvent(r.savedEvents[positions[0]]), true
+	}
+	return data.Event{}, false
+}
+
+// The cached artist that Equals the given one
+func (r *records) findArtist(artist data.Artist) (data.Artist, bool) {
+	if positions, ok := r.artistKeys[keyOfArtist(artist)]; ok {
+		return util.CloneArtist(r.artists[positions[0]]), true
+	}
+	return data.Artist{}, false
+}
+
+// The cached venue that Equals the given one
+func (r *records) findVenue(venue data.Venue) (data.Venue, bool) {
+	if positions, ok := r.venueKeys[keyOfVenue(venue)]; ok {
+		return util.CloneVenue(r.venues[positions[0]]), true
+	}
+	return data.Venue{}, false
+}
+
+func (r *records) eventsAt(positions []int) []data.Event {
+	events := []data.Event{}
+	for _, i := range positions {
+		events = append(events, util.CloneEvent(r.savedEvents[i]))
+	}
+	return events
+}
+
+// Events with the artist as their main act or as one of their openers
+func (r *records) eventsForArtist(id string) []data.Event {
+	return r.eventsAt(r.artistEvents[id])
+}
+
+func (r *records) eventsAtVenue(id string) []data.Event {
+	return r.eventsAt(r.venueEvents[id])
+}
+
+// Events on or after from and on or before to, ordered by date. A zero time leaves that end open
+func (r *records) eventsBetween(from time.Time, to time.Time) []data.Event {
+	timestamp := func(n int) time.Time {
+		return util.Timestamp(r.savedEvents[r.eventsByDate[n]].Date)
+	}
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(len(r.eventsByDate), func(n int) bool { return !timestamp(n).Before(from) })
+	}
+	end := len(r.eventsByDate)
+	if !to.IsZero() {
+		end = sort.Search(len(r.eventsByDate), func(n int) bool { return timestamp(n).After(to) })
+	}
+	if start >= end {
+		return []data.Event{}
+	}
+	return r.eventsAt(r.eventsByDate[start:end])
+}
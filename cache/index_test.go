@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"concert-manager/util"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func eventIds(events []data.Event) []string {
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
+
+func TestIndexedLookups(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	ctx := context.Background()
+
+	later := testEvent
+	later.Date = "8/2/2023"
+	later.MainAct = data.Artist{Name: "Men I Trust", Genre: "Indie"}
+	later.Openers = []data.Artist{}
+	savedLater, err := cache.AddSavedEvent(ctx, later)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	saved, err := cache.AddSavedEvent(ctx, testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if event, ok := cache.GetSavedEvent(saved.Id); !ok || !event.Equals(testEvent) {
+		t.Errorf("Incorrect event for ID %v, actual: %+v", saved.Id, event)
+	}
+	if _, ok := cache.GetSavedEvent("missing"); ok {
+		t.Error("Expected no event for an unknown ID")
+	}
+
+	// the opener of one event is the main act of the other
+	if ids := eventIds(cache.EventsForArtist(savedLater.MainAct.Id)); len(ids) != 2 {
+		t.Errorf("Expected both events for the artist, actual: %v", ids)
+	}
+	if ids := eventIds(cache.EventsForArtist(saved.MainAct.Id)); len(ids) != 1 || ids[0] != saved.Id {
+		t.Errorf("Expected only the main act's event, actual: %v", ids)
+	}
+	if ids := eventIds(cache.EventsAtVenue(saved.Venue.Id)); len(ids) != 2 {
+		t.Errorf("Expected both events at the venue, actual: %v", ids)
+	}
+
+	between := cache.EventsBetween(time.Time{}, time.Time{})
+	if ids := eventIds(between); len(ids) != 2 || ids[0] != saved.Id || ids[1] != savedLater.Id {
+		t.Errorf("Events should be ordered by date, actual: %v", ids)
+	}
+	between = cache.EventsBetween(util.Timestamp("6/14/2023"), util.Timestamp("7/31/2023"))
+	if ids := eventIds(between); len(ids) != 1 || ids[0] != saved.Id {
+		t.Errorf("Range should include its first day and exclude later events, actual: %v", ids)
+	}
+	if between := cache.EventsBetween(util.Timestamp("8/2/2023"), time.Time{}); len(between) != 1 {
+		t.Errorf("Range should include its last day, actual: %v", eventIds(between))
+	}
+
+	// the indexes follow changes to the cache
+	moved := *saved
+	moved.Date = "9/1/2023"
+	if err := cache.UpdateSavedEvent(ctx, saved.Id, moved); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.DeleteSavedEvent(ctx, savedLater.Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ids := eventIds(cache.EventsBetween(util.Timestamp("9/1/2023"), util.Timestamp("9/1/2023"))); len(ids) != 1 {
+		t.Errorf("Updated event should be found by its new date, actual: %v", ids)
+	}
+	if ids := eventIds(cache.EventsAtVenue(saved.Venue.Id)); len(ids) != 1 || ids[0] != saved.Id {
+		t.Errorf("Deleted event should be removed from the venue index, actual: %v", ids)
+	}
+	if _, ok := cache.GetSavedEvent(savedLater.Id); ok {
+		t.Error("Deleted event should be removed from the ID index")
+	}
+}
+
+func TestIndexesMatchRebuild(t *testing.T) {
+	r := newRecords(nil, nil, nil)
+	dates := []string{"6/14/2023", "8/2/2023", "6/14/2023", "not a date", "1/5/2024"}
+	for i := 0; i < 20; i++ {
+		event := util.CloneEvent(testEvent)
+		event.Id = fmt.Sprint("event", i)
+		event.Date = dates[i%len(dates)]
+		event.MainAct.Id = fmt.Sprint("artist", i%3)
+		event.Openers[0].Id = fmt.Sprint("artist", i%4)
+		event.Venue.Id = fmt.Sprint("venue", i%2)
+		r.putEvent(event)
+		r.putArtist(data.Artist{Id: fmt.Sprint("artist", i), Name: fmt.Sprint("Artist ", i%5)})
+		r.putVenue(data.Venue{Id: fmt.Sprint("venue", i), Name: "The Eastern", City: "Atlanta", State: "GA"})
+	}
+	for i := 0; i < 20; i += 3 {
+		moved, _ := r.eventById(fmt.Sprint("event", i))
+		moved.Date = dates[(i+1)%len(dates)]
+		moved.Venue.Id = "venue2"
+		r.putEvent(moved)
+		r.removeEvent(fmt.Sprint("event", i+1))
+		r.removeArtist(fmt.Sprint("artist", i))
+		r.removeVenue(fmt.Sprint("venue", i+2))
+	}
+
+	rebuilt := newRecords(r.savedEvents, r.artists, r.venues)
+	for _, records := range []*records{r, r.clone()} {
+		if !reflect.DeepEqual(records.eventIds, rebuilt.eventIds) || !reflect.DeepEqual(records.eventKeys, rebuilt.eventKeys) ||
+			!reflect.DeepEqual(records.artistEvents, rebuilt.artistEvents) || !reflect.DeepEqual(records.venueEvents, rebuilt.venueEvents) ||
+			!reflect.DeepEqual(records.eventsByDate, rebuilt.eventsByDate) {
+			t.Errorf("Event indexes differ from a rebuild, actual: %+v, expected: %+v", records, rebuilt)
+		}
+		if !reflect.DeepEqual(records.artistIds, rebuilt.artistIds) || !reflect.DeepEqual(records.artistKeys, rebuilt.artistKeys) {
+			t.Errorf("Artist indexes differ from a rebuild, actual: %v %v, expected: %v %v",
+				records.artistIds, records.artistKeys, rebuilt.artistIds, rebuilt.artistKeys)
+		}
+		if !reflect.DeepEqual(records.venueIds, rebuilt.venueIds) || !reflect.DeepEqual(records.venueKeys, rebuilt.venueKeys) {
+			t.Errorf("Venue indexes differ from a rebuild, actual: %v %v, expected: %v %v",
+				records.venueIds, records.venueKeys, rebuilt.venueIds, rebuilt.venueKeys)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"concert-manager/util"
+	"context"
+	"fmt"
+)
+
+// Ticketmaster names differ by more than a typo, but lenient matching groups unrelated short names
+const duplicateTolerance = util.ModerateTolerance
+
+func (c *SavedEventCache) FindDuplicateArtists() [][]data.Artist {
+	log.Debug("Finding duplicate artists in cache")
+	return util.FindDuplicateArtists(c.GetArtists(), duplicateTolerance)
+}
+
+func (c *SavedEventCache) FindDuplicateVenues() [][]data.Venue {
+	log.Debug("Finding duplicate venues in cache")
+	return util.FindDuplicateVenues(c.GetVenues(), duplicateTolerance)
+}
+
+// Moves every event of the duplicates over to the surviving artist and deletes the duplicates
+func (c *SavedEventCache) MergeArtists(ctx context.Context, survivorId string, duplicateIds []string) error {
+	log.Debugf("Merging artists %v into %v", duplicateIds, survivorId)
+	defer c.lock()()
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		opts := DeleteOptions{Mode: DeleteReassign, ReassignTo: survivorId}
+		for _, id := range duplicateIds {
+			if err := c.deleteArtist(ctx, id, opts); err != nil {
+				return fmt.Errorf("failed to merge artist %s, %w", id, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Merged %d artists into %v", len(duplicateIds), survivorId)
+	c.notifyCatalogChanged()
+	return nil
+}
+
+// Moves every event of the duplicates over to the surviving venue and deletes the duplicates
+func (c *SavedEventCache) MergeVenues(ctx context.Context, survivorId string, duplicateIds []string) error {
+	log.Debugf("Merging venues %v into %v", duplicateIds, survivorId)
+	defer c.lock()()
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		opts := DeleteOptions{Mode: DeleteReassign, ReassignTo: survivorId}
+		for _, id := range duplicateIds {
+			if err := c.deleteVenue(ctx, id, opts); err != nil {
+				return fmt.Errorf("failed to merge venue %s, %w", id, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Merged %d venues into %v", len(duplicateIds), survivorId)
+	c.notifyCatalogChanged()
+	return nil
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"context"
+	"testing"
+)
+
+func TestMergeVenues(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	first := testEvent
+	first.Venue = data.Venue{Name: "The Masquerade - Altar", City: "Atlanta", State: "GA"}
+	second := testEvent
+	second.Venue = data.Venue{Name: "Masquerade Altar", City: "Atlanta", State: "GA"}
+	second.Date = "6/15/2023"
+	saved, err := cache.AddSavedEvents(context.Background(), []data.Event{first, second})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	groups := cache.FindDuplicateVenues()
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Fatalf("Expected one group of duplicate venues, actual: %v", groups)
+	}
+	survivor := saved[0].Venue
+	if err := cache.MergeVenues(context.Background(), survivor.Id, []string{saved[1].Venue.Id}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, event := range cache.GetSavedEvents() {
+		if event.Venue != survivor {
+			t.Errorf("Event was not moved to the surviving venue %v: %v", survivor, event)
+		}
+	}
+	if venues := cache.GetVenues(); len(venues) != 1 || venues[0] != survivor {
+		t.Errorf("Duplicate venue was not deleted: %v", venues)
+	}
+}
+
+func TestMergeVenuesConflictRollback(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	first := testEvent
+	first.Venue = data.Venue{Name: "The Masquerade - Altar", City: "Atlanta", State: "GA"}
+	second := testEvent
+	second.Venue = data.Venue{Name: "Masquerade Altar", City: "Atlanta", State: "GA"}
+	saved, err := cache.AddSavedEvents(context.Background(), []data.Event{first, second})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// both events are on the same date, so moving them to one venue conflicts
+	if err := cache.MergeVenues(context.Background(), saved[0].Venue.Id, []string{saved[1].Venue.Id}); err == nil {
+		t.Fatal("expected error")
+	}
+	if venues := cache.GetVenues(); len(venues) != 2 {
+		t.Errorf("Failed merge should keep both venues: %v", venues)
+	}
+	if err := cache.RefreshVenues(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if venues := cache.GetVenues(); len(venues) != 2 {
+		t.Errorf("Failed merge should keep both venues in the database: %v", venues)
+	}
+}
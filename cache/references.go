@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// How deleting an artist or venue treats the saved events that still reference it
+type DeleteMode int
+
+const (
+	// Refuses to delete while any saved event references the record
+	DeleteRestrict DeleteMode = iota
+	// Deletes every saved event that references the record along with it
+	DeleteCascade
+	// Points every referencing saved event at another record before deleting
+	DeleteReassign
+)
+
+// The zero value refuses to delete records that are still referenced
+type DeleteOptions struct {
+	Mode       DeleteMode
+	ReassignTo string
+}
+
+// Returned when a delete is blocked by saved events that still reference the record. Events only holds
+// those of the user, the saved events of other users are only counted
+type ReferenceError struct {
+	Entity     string
+	Id         string
+	Events     []data.Event
+	OtherUsers int
+}
+
+func (e *ReferenceError) Error() string {
+	if e.OtherUsers > 0 {
+		return fmt.Sprintf("%s %s is still referenced by %d saved events, and %d saved events of other users",
+			e.Entity, e.Id, len(e.Events), e.OtherUsers)
+	}
+	return fmt.Sprintf("%s %s is still referenced by %d saved events", e.Entity, e.Id, len(e.Events))
+}
+
+// Shared artists and venues can be referenced by the saved events of other users, which aren't cached here
+func (c *SavedEventCache) otherUserReferences(ctx context.Context, query data.EventQuery) ([]data.Event, error) {
+	ctx = db.WithAllUsers(ctx)
+	others := []data.Event{}
+	for {
+		page, err := c.Database.QueryEvents(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range page.Events {
+			if event.UserId != c.user() {
+				others = append(others, event)
+			}
+		}
+		if page.NextCursor == "" {
+			return others, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func referencesArtist(id string) func(data.Event) bool {
+	return func(e data.Event) bool {
+		return e.MainAct.Id == id || slices.ContainsFunc(e.Openers, func(o data.Artist) bool {
+			return o.Id == id
+		})
+	}
+}
+
+func referencesVenue(id string) func(data.Event) bool {
+	return func(e data.Event) bool {
+		return e.Venue.Id == id
+	}
+}
+
+// Swaps the artist with the given ID for the replacement, without listing the replacement twice
+func replaceArtist(event data.Event, id string, replacement data.Artist) data.Event {
+	if event.MainAct.Id == id {
+		event.MainAct = replacement
+	}
+	openers := []data.Artist{}
+	for _, opener := range event.Openers {
+		if opener.Id == id {
+			opener = replacement
+		}
+		duplicate := opener.Id == event.MainAct.Id || slices.ContainsFunc(openers, func(o data.Artist) bool {
+			return o.Id == opener.Id
+		})
+		if !duplicate {
+			openers = append(openers, opener)
+		}
+	}
+	event.Openers = openers
+	return event
+}
+
+// Cascades to or reassigns the referencing events, then runs deleteRecord. The events of other users are
+// never deleted, and are only reassigned to a shared record, since they can't see private ones.
+// Must be called within a transaction
+func (c *SavedEventCache) resolveReferences(ctx context.Context, entity string, id string, opts DeleteOptions,
+	references []data.Event, others []data.Event, sharedReplacement bool,
+	reassign func(data.Event) data.Event, deleteRecord func(context.Context) error) error {
+	if opts.Mode != DeleteRestrict && opts.Mode != DeleteCascade && opts.Mode != DeleteReassign {
+		return fmt.Errorf("unknown delete mode %d", opts.Mode)
+	}
+	blocked := opts.Mode == DeleteRestrict && len(references) > 0 ||
+		len(others) > 0 && (opts.Mode != DeleteReassign || !sharedReplacement)
+	if blocked {
+		log.Errorf("Refusing to delete %s %v, still referenced by %d saved events and %d of other users",
+			entity, id, len(references), len(others))
+		return &ReferenceError{Entity: entity, Id: id, Events: references, OtherUsers: len(others)}
+	}
+
+	for _, event := range references {
+		if opts.Mode == DeleteCascade {
+			if err := c.Database.DeleteEvent(ctx, event.Id); err != nil {
+				return err
+			}
+			c.working.removeEvent(event.Id)
+			log.Debugf("Deleted saved event %v referencing %s %v", event.Id, entity, id)
+			continue
+		}
+
+		updated := reassign(event)
+		if err := c.Database.UpdateEvent(ctx, event.Id, updated); err != nil {
+			return err
+		}
+		updated.Version++
+		c.working.putEvent(updated)
+		log.Debugf("Reassigned saved event %v away from %s %v", event.Id, entity, id)
+	}
+	// the caches of the other users reload their events once they're told the catalog changed
+	for _, event := range others {
+		if err := c.Database.UpdateEvent(db.WithAllUsers(ctx), event.Id, reassign(event)); err != nil {
+			return err
+		}
+		log.Debugf("Reassigned saved event %v of user %v away from %s %v", event.Id, event.UserId, entity, id)
+	}
+	return deleteRecord(ctx)
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"context"
+	"errors"
+	"testing"
+)
+
+func newReferenceTestCache(t *testing.T) (*SavedEventCache, *data.Event) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	saved, err := cache.AddSavedEvent(context.Background(), testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return cache, saved
+}
+
+func TestDeleteArtistReferenced(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+
+	err := cache.DeleteArtist(context.Background(), saved.Openers[0].Id, DeleteOptions{})
+	var refErr *ReferenceError
+	if !errors.As(err, &refErr) {
+		t.Fatal("expected reference error, actual:", err)
+	}
+	if len(refErr.Events) != 1 || refErr.Events[0].Id != saved.Id {
+		t.Errorf("Incorrect blocking events, expected: %v, actual: %v", saved.Id, refErr.Events)
+	}
+	if len(cache.GetArtists()) != 2 {
+		t.Errorf("Referenced artist was deleted: %v", cache.GetArtists())
+	}
+}
+
+func TestDeleteArtistUnreferenced(t *testing.T) {
+	cache, _ := newReferenceTestCache(t)
+	artist, err := cache.AddArtist(context.Background(), data.Artist{Name: "Hermanos Gutiérrez", Genre: "Instrumental"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := cache.DeleteArtist(context.Background(), artist.Id, DeleteOptions{}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(cache.GetArtists()) != 2 {
+		t.Errorf("Incorrect artists after delete: %v", cache.GetArtists())
+	}
+}
+
+func TestDeleteArtistCascade(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+
+	if err := cache.DeleteArtist(context.Background(), saved.MainAct.Id, DeleteOptions{Mode: DeleteCascade}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := cache.GetSavedEvents(); len(events) != 0 {
+		t.Errorf("Referencing events were not deleted: %v", events)
+	}
+	if len(cache.GetArtists()) != 1 {
+		t.Errorf("Incorrect artists after delete: %v", cache.GetArtists())
+	}
+}
+
+func TestDeleteArtistReassign(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+
+	opts := DeleteOptions{Mode: DeleteReassign, ReassignTo: saved.MainAct.Id}
+	if err := cache.DeleteArtist(context.Background(), saved.Openers[0].Id, opts); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	events := cache.GetSavedEvents()
+	if len(events) != 1 || events[0].MainAct.Id != saved.MainAct.Id || len(events[0].Openers) != 0 {
+		t.Errorf("Event should only list the reassigned artist once: %v", events)
+	}
+}
+
+func TestDeleteArtistReassignToSelf(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+
+	opts := DeleteOptions{Mode: DeleteReassign, ReassignTo: saved.MainAct.Id}
+	if err := cache.DeleteArtist(context.Background(), saved.MainAct.Id, opts); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestDeleteVenueReassign(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+	venue, err := cache.AddVenue(context.Background(), data.Venue{Name: "Terminal West", City: "Atlanta", State: "GA"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := cache.DeleteVenue(context.Background(), saved.Venue.Id, DeleteOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := cache.DeleteVenue(context.Background(), saved.Venue.Id, DeleteOptions{Mode: DeleteReassign, ReassignTo: venue.Id}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := cache.GetSavedEvents(); len(events) != 1 || events[0].Venue != *venue {
+		t.Errorf("Event was not moved to venue %v: %v", venue, events)
+	}
+	if venues := cache.GetVenues(); len(venues) != 1 || venues[0] != *venue {
+		t.Errorf("Incorrect venues after delete: %v", venues)
+	}
+}
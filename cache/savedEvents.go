@@ -2,16 +2,24 @@ package cache
 
 import (
 	"concert-manager/data"
+	"concert-manager/db"
 	"concert-manager/log"
 	"concert-manager/util"
 	"context"
 	"errors"
+	"fmt"
 	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Database interface {
+	RunTransaction(context.Context, func(context.Context) error) error
 	ListEvents(context.Context) ([]data.Event, error)
+	QueryEvents(context.Context, data.EventQuery) (data.EventPage, error)
 	AddEvent(context.Context, data.Event) (string, error)
+	UpdateEvent(context.Context, string, data.Event) error
 	DeleteEvent(context.Context, string) error
 	ListArtists(context.Context) ([]data.Artist, error)
 	AddArtist(context.Context, data.Artist) (string, error)
@@ -21,281 +29,632 @@ type Database interface {
 	AddVenue(context.Context, data.Venue) (string, error)
 	UpdateVenue(context.Context, string, data.Venue) error
 	DeleteVenue(context.Context, string) error
+	ListIntegrityIssues(context.Context) ([]data.IntegrityIssue, error)
+	RepairEvent(context.Context, string) error
+	ListDeletedEvents(context.Context) ([]data.Event, error)
+	RestoreEvent(context.Context, string) error
+	PurgeEvent(context.Context, string) error
+	ListDeletedArtists(context.Context) ([]data.Artist, error)
+	RestoreArtist(context.Context, string) error
+	PurgeArtist(context.Context, string) error
+	ListDeletedVenues(context.Context) ([]data.Venue, error)
+	RestoreVenue(context.Context, string) error
+	PurgeVenue(context.Context, string) error
 }
 
+// Safe for concurrent use. Changes are made one at a time to a working copy of the cache, which is
+// published as a new snapshot once the change is done, so readers never wait on the database and
+// never see a change that is only partly made
 type SavedEventCache struct {
 	Database       Database
-	savedEvents    []data.Event
-	artists        []data.Artist
-	venues         []data.Venue
+	// The user whose events are cached, the default user when empty
+	User           string
+	// held for the whole of a change, including its database calls
+	writeMutex     sync.Mutex
+	// the working copy, only used while holding writeMutex
+	working        *records
+	catalogDirty   bool
+	// what readers see, replaced after every change and never modified in place
+	published      atomic.Pointer[records]
+	changes        publisher
+	// called after artists or venues were changed, since other users may see them too
+	catalogChanged func(user string)
 }
 
 func (c *SavedEventCache) LoadCaches() {
-	log.Info("Initializing saved event cache")
-	savedEvents, err := c.Database.ListEvents(context.Background())
+	if err := c.load(); err != nil {
+		log.Fatal("Failed to initialize saved event cache:", err)
+	}
+}
+
+func (c *SavedEventCache) load() error {
+	defer c.lock()()
+	log.Info("Initializing saved event cache for user", c.user())
+	ctx := c.scope(context.Background())
+	savedEvents, err := c.Database.ListEvents(ctx)
 	if err != nil {
-		log.Fatal("Failed to initialize events:", err)
+		return fmt.Errorf("failed to initialize events, %w", err)
 	}
-	c.savedEvents = savedEvents
+	c.working.setEvents(savedEvents)
 	log.Info("Successfully initialized saved events")
 
-	artists, err := c.Database.ListArtists(context.Background())
+	artists, err := c.Database.ListArtists(ctx)
 	if err != nil {
-		log.Fatal("Failed to initialize artists:", err)
+		return fmt.Errorf("failed to initialize artists, %w", err)
 	}
-	c.artists = artists
+	c.working.setArtists(artists)
 	log.Info("Successfully initialized artists")
 
-	venues, err := c.Database.ListVenues(context.Background())
+	venues, err := c.Database.ListVenues(ctx)
 	if err != nil {
-		log.Fatal("Failed to initialize venues:", err)
+		return fmt.Errorf("failed to initialize venues, %w", err)
 	}
-	c.venues = venues
+	c.working.setVenues(venues)
 	log.Info("Successfully initialized venues")
 
 	log.Info("Finished initializing saved event cache")
+	return nil
+}
+
+func (c *SavedEventCache) user() string {
+	return db.User(db.WithUser(context.Background(), c.User))
+}
+
+// Every database call goes through the user of the cache, whichever user the caller's context is for
+func (c *SavedEventCache) scope(ctx context.Context) context.Context {
+	return db.WithUser(ctx, c.user())
+}
+
+// Locks the cache for a change, returning the unlock, which publishes the working copy to readers.
+// Other users are told about catalog changes only after unlocking, since their caches may be
+// changing and waiting on this one at the same time
+func (c *SavedEventCache) lock() func() {
+	c.writeMutex.Lock()
+	if c.working == nil {
+		c.working = newRecords(nil, nil, nil)
+	}
+	return func() {
+		changes := c.working.changes
+		c.working.changes = nil
+		c.published.Store(c.working.clone())
+		// published while still locked, so subscribers get the changes in the order they were made
+		for i := range changes {
+			changes[i].User = c.user()
+		}
+		c.changes.publish(changes...)
+		catalogChanged := c.catalogDirty
+		c.catalogDirty = false
+		c.writeMutex.Unlock()
+
+		if catalogChanged && c.catalogChanged != nil {
+			c.catalogChanged(c.user())
+		}
+	}
+}
+
+// Delivers every change to the cache once it can be read, until the returned cancel is called
+func (c *SavedEventCache) Subscribe() (<-chan Change, func()) {
+	return c.changes.subscribe()
+}
+
+// The latest published contents, which are empty before the cache is loaded
+func (c *SavedEventCache) snapshot() *records {
+	if published := c.published.Load(); published != nil {
+		return published
+	}
+	return newRecords(nil, nil, nil)
+}
+
+// Must be called while holding the lock, other users are notified once it's released
+func (c *SavedEventCache) notifyCatalogChanged() {
+	c.catalogDirty = true
 }
 
 func (c *SavedEventCache) RefreshSavedEvents() error {
+	defer c.lock()()
     log.Info("Refreshing saved event cache")
-	savedEvents, err := c.Database.ListEvents(context.Background())
+	savedEvents, err := c.Database.ListEvents(c.scope(context.Background()))
 	if err != nil {
 		return err
 	}
-	c.savedEvents = savedEvents
+	c.working.setEvents(savedEvents)
 	log.Info("Successfully refreshed saved events")
 	return nil
 }
 
 func (c *SavedEventCache) RefreshArtists() error {
+	defer c.lock()()
+	return c.refreshArtists()
+}
+
+func (c *SavedEventCache) refreshArtists() error {
 	log.Info("Refreshing artists cache")
-	artists, err := c.Database.ListArtists(context.Background())
+	artists, err := c.Database.ListArtists(c.scope(context.Background()))
 	if err != nil {
 		return err
 	}
-	c.artists = artists
+	c.working.setArtists(artists)
 	log.Info("Successfully refreshed artists")
 	return nil
 }
 
 func (c *SavedEventCache) RefreshVenues() error {
+	defer c.lock()()
+	return c.refreshVenues()
+}
+
+func (c *SavedEventCache) refreshVenues() error {
 	log.Info("Refreshing venues cache")
-	venues, err := c.Database.ListVenues(context.Background())
+	venues, err := c.Database.ListVenues(c.scope(context.Background()))
 	if err != nil {
 		return err
 	}
-	c.venues = venues
+	c.working.setVenues(venues)
 	log.Info("Successfully refreshed venues cache")
 	return nil
 }
 
-func (c SavedEventCache) GetSavedEvents() []data.Event {
+func (c *SavedEventCache) GetSavedEvents() []data.Event {
 	log.Debug("Retrieving saved events from cache")
-	if c.savedEvents == nil {
-		return []data.Event{}
-	}
-	return util.CloneEvents(c.savedEvents)
+	return util.CloneEvents(c.snapshot().savedEvents)
 }
 
-func (c SavedEventCache) GetPassedSavedEvents() []data.Event {
+// Passed events that were neither purchased nor archived, which still need to be sorted out
+func (c *SavedEventCache) GetPassedSavedEvents() []data.Event {
 	log.Debug("Retrieving passed saved events from cache")
-	if c.savedEvents == nil {
-		return []data.Event{}
-	}
-
 	passedEvents := []data.Event{}
-	for _, event := range c.GetSavedEvents() {
-		if util.PastDate(event.Date) && !event.Purchased {
+	for _, event := range c.snapshot().savedEvents {
+		if util.PastDate(event.Date) && !event.Purchased && event.ArchivedAt == nil {
 			passedEvents = append(passedEvents, util.CloneEvent(event))
 		}
 	}
 	return passedEvents
 }
 
-func (c *SavedEventCache) AddSavedEvent(event data.Event) (*data.Event, error) {
+func (c *SavedEventCache) GetSavedEvent(id string) (data.Event, bool) {
+	log.Debug("Retrieving saved event from cache", id)
+	return c.snapshot().eventById(id)
+}
+
+// Events with the artist as their main act or as one of their openers
+func (c *SavedEventCache) EventsForArtist(artistId string) []data.Event {
+	log.Debug("Retrieving saved events for artist from cache", artistId)
+	return c.snapshot().eventsForArtist(artistId)
+}
+
+func (c *SavedEventCache) EventsAtVenue(venueId string) []data.Event {
+	log.Debug("Retrieving saved events at venue from cache", venueId)
+	return c.snapshot().eventsAtVenue(venueId)
+}
+
+// Events from the start of from through the end of to, ordered by date. Either can be the zero
+// time to leave that end open, and events without a valid date are never included
+func (c *SavedEventCache) EventsBetween(from time.Time, to time.Time) []data.Event {
+	log.Debugf("Retrieving saved events between %v and %v from cache", from, to)
+	return c.snapshot().eventsBetween(from, to)
+}
+
+// Filtering happens in the database, so pages include events saved by other instances of the app
+func (c *SavedEventCache) QuerySavedEvents(query data.EventQuery) (data.EventPage, error) {
+	log.Debug("Querying saved events from database", query)
+	return c.Database.QueryEvents(c.scope(context.Background()), query)
+}
+
+func (c *SavedEventCache) AddSavedEvent(ctx context.Context, event data.Event) (*data.Event, error) {
 	log.Debug("Adding saved event to cache", event)
-	existingIdx := slices.IndexFunc(c.savedEvents, event.Equals)
-	if existingIdx >= 0 {
+	defer c.lock()()
+	var savedEvent *data.Event
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		savedEvent, err = c.addSavedEvent(ctx, event)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.notifyCatalogChanged()
+	return savedEvent, nil
+}
+
+// Either all the events (and their new artists and venues) are saved, or none of them are
+func (c *SavedEventCache) AddSavedEvents(ctx context.Context, events []data.Event) ([]data.Event, error) {
+	log.Debugf("Adding %d saved events to cache", len(events))
+	defer c.lock()()
+	savedEvents := []data.Event{}
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		for i, event := range events {
+			savedEvent, err := c.addSavedEvent(ctx, event)
+			if err != nil {
+				log.Errorf("Failed to add event %d of %d, %+v, %v", i+1, len(events), event, err)
+				return fmt.Errorf("failed to add event %d, %w", i+1, err)
+			}
+			savedEvents = append(savedEvents, *savedEvent)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.notifyCatalogChanged()
+	return savedEvents, nil
+}
+
+func (c *SavedEventCache) addSavedEvent(ctx context.Context, event data.Event) (*data.Event, error) {
+	if existing, ok := c.working.findEvent(event); ok {
 		log.Debugf("Skipping adding event %v because it already existed in the cache", event)
-		existing := util.CloneEvent(c.savedEvents[existingIdx])
 		return &existing, nil
 	}
+
+	event.Openers = slices.Clone(event.Openers)
+	if err := c.addEventReferences(ctx, &event); err != nil {
+		return nil, err
+	}
+
+	id, err := c.Database.AddEvent(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Id = id
+	event.Version = 1
+	event.UserId = c.user()
+	c.working.putEvent(event)
+	log.Debug("Added saved event to cache", event)
+	return &event, nil
+}
+
+func (c *SavedEventCache) UpdateSavedEvent(ctx context.Context, id string, event data.Event) error {
+	log.Debugf("Updating saved event in cache, id=%v, %v", id, event)
+	defer c.lock()()
+	cached, ok := c.working.eventById(id)
+	if !ok {
+		log.Errorf("Unable to find event %v when updating cache", id)
+		return errors.New("event is not cached")
+	}
+
+	event.Openers = slices.Clone(event.Openers)
+	// archiving isn't something clients send, so replacing an archived event keeps it archived
+	if event.ArchivedAt == nil {
+		event.ArchivedAt = cached.ArchivedAt
+	}
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		if err := c.addEventReferences(ctx, &event); err != nil {
+			return err
+		}
+		return c.Database.UpdateEvent(ctx, id, event)
+	})
+	if err != nil {
+		return err
+	}
+	c.notifyCatalogChanged()
+
+	event.Id = id
+	event.Version = nextVersion(event.Version, cached.Version)
+	event.UserId = cached.UserId
+	c.working.putEvent(event)
+	log.Debug("Updated saved event in cache", event)
+	return nil
+}
+
+// creates any of the event's artists and venue that don't exist yet and fills in their IDs
+func (c *SavedEventCache) addEventReferences(ctx context.Context, event *data.Event) error {
 	if event.MainAct.Populated() {
-		artist, err := c.AddArtist(event.MainAct)
+		artist, err := c.addArtist(ctx, event.MainAct)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		event.MainAct.Id = artist.Id
+		event.MainAct.Version = artist.Version
 	}
 	for i, opener := range event.Openers {
-		artist, err := c.AddArtist(opener)
+		artist, err := c.addArtist(ctx, opener)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		event.Openers[i].Id = artist.Id
+		event.Openers[i].Version = artist.Version
 	}
-	venue, err := c.AddVenue(event.Venue)
+	venue, err := c.addVenue(ctx, event.Venue)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	event.Venue.Id = venue.Id
+	event.Venue.Version = venue.Version
+	return nil
+}
+
+// The version a successful update left in the database. Updates without a version
+// aren't checked, so they build on the cached one
+func nextVersion(updated int, cached int) int {
+	return max(updated, cached) + 1
+}
 
-	id, err := c.Database.AddEvent(context.Background(), event)
+// Runs f as a single database transaction, must be called while holding the lock. Cache changes made by f are reverted if the transaction
+// fails, so the cache never holds records that were rolled back in the database. Transactions the
+// database asks to retry run once more, starting over from the cache as it was before the first attempt
+func (c *SavedEventCache) runTransaction(ctx context.Context, f func(context.Context) error) error {
+	before := c.working.clone()
+
+	err := c.Database.RunTransaction(c.scope(ctx), f)
+	if errors.Is(err, db.ErrRetryTransaction) {
+		log.Info("Retrying transaction,", err)
+		c.working = before.clone()
+		err = c.Database.RunTransaction(c.scope(ctx), f)
+	}
 	if err != nil {
-		return nil, err
+		log.Debug("Reverting cache changes after failed transaction,", err)
+		c.working = before
+		return err
 	}
-
-	event.Id = id
-	c.savedEvents = append(c.savedEvents, util.CloneEvent(event))
-	log.Debug("Added saved event to cache", event)
-	return &event, nil
+	return nil
 }
 
-func (c *SavedEventCache) DeleteSavedEvent(id string) error {
+func (c *SavedEventCache) DeleteSavedEvent(ctx context.Context, id string) error {
 	log.Debug("Deleting saved event from cache", id)
-	eventIdx := slices.IndexFunc(c.savedEvents, func(e data.Event) bool {
-		return e.Id == id
-	})
-	if eventIdx == -1 {
+	defer c.lock()()
+	if _, ok := c.working.eventById(id); !ok {
 		log.Errorf("Unable to find event %v when deleting from cache", id)
 		return errors.New("event is not cached")
 	}
 
-	if err := c.Database.DeleteEvent(context.Background(), id); err != nil {
+	if err := c.Database.DeleteEvent(c.scope(ctx), id); err != nil {
 		return err
 	}
 
-	c.savedEvents = slices.Delete(c.savedEvents, eventIdx, eventIdx+1)
+	c.working.removeEvent(id)
 	log.Debug("Deleted saved event from cache", id)
 	return nil
 }
 
-func (c SavedEventCache) GetArtists() []data.Artist {
+// Invalid events are never cached, so the issues always come from the database
+func (c *SavedEventCache) GetIntegrityIssues() ([]data.IntegrityIssue, error) {
+	log.Debug("Retrieving integrity issues from database")
+	return c.Database.ListIntegrityIssues(c.scope(context.Background()))
+}
+
+func (c *SavedEventCache) RepairEvent(ctx context.Context, id string) error {
+	log.Debug("Repairing invalid event", id)
+	if err := c.Database.RepairEvent(c.scope(ctx), id); err != nil {
+		return err
+	}
+	return c.RefreshSavedEvents()
+}
+
+// Invalid events could never be restored, so they skip the trash
+func (c *SavedEventCache) DeleteInvalidEvent(ctx context.Context, id string) error {
+	log.Debug("Deleting invalid event", id)
+	defer c.lock()()
+	err := c.Database.RunTransaction(c.scope(ctx), func(ctx context.Context) error {
+		if err := c.Database.DeleteEvent(ctx, id); err != nil {
+			return err
+		}
+		return c.Database.PurgeEvent(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+	c.working.removeEvent(id)
+	log.Debug("Deleted invalid event", id)
+	return nil
+}
+
+func (c *SavedEventCache) GetArtists() []data.Artist {
 	log.Debug("Retrieving artists from cache")
-	return slices.Clone(c.artists)
+	return util.CloneArtists(c.snapshot().artists)
 }
 
-func (c *SavedEventCache) AddArtist(artist data.Artist) (*data.Artist, error) {
+func (c *SavedEventCache) AddArtist(ctx context.Context, artist data.Artist) (*data.Artist, error) {
 	log.Debug("Adding artist to cache", artist)
-	existingIdx := slices.IndexFunc(c.artists, artist.Equals)
-	if existingIdx >= 0 {
-		existing := util.CloneArtist(c.artists[existingIdx])
+	defer c.lock()()
+	added, err := c.addArtist(c.scope(ctx), artist)
+	if err != nil {
+		return nil, err
+	}
+	c.notifyCatalogChanged()
+	return added, nil
+}
+
+func (c *SavedEventCache) addArtist(ctx context.Context, artist data.Artist) (*data.Artist, error) {
+	if existing, ok := c.working.findArtist(artist); ok {
 		log.Debugf("Skipping adding artist %v because it already existed in the cache", artist)
 		return &existing, nil
 	}
 
-	id, err := c.Database.AddArtist(context.Background(), artist)
+	id, err := c.Database.AddArtist(ctx, artist)
 	if err != nil {
 		return nil, err
 	}
+	// the database matched it to a cached artist that was since changed
+	if existing, ok := c.working.artistById(id); ok {
+		return &existing, nil
+	}
 
 	artist.Id = id
-	c.artists = append(c.artists, util.CloneArtist(artist))
+	artist.Version = 1
+	c.working.putArtist(artist)
 	log.Debug("Added artist to cache", artist)
 	return &artist, nil
 }
 
-func (c *SavedEventCache) UpdateArtist(id string, artist data.Artist) error {
+func (c *SavedEventCache) UpdateArtist(ctx context.Context, id string, artist data.Artist) error {
 	log.Debugf("Updating artist in cache, id=%v, %v", id, artist)
-	artistIdx := slices.IndexFunc(c.artists, func(a data.Artist) bool {
-		return a.Id == id
-	})
-	if artistIdx == -1 {
+	defer c.lock()()
+	cached, ok := c.working.artistById(id)
+	if !ok {
 		log.Errorf("Unable to find artist %v when updating cache", id)
 		return errors.New("artist is not cached")
 	}
 
-	err := c.Database.UpdateArtist(context.Background(), id, artist)
+	err := c.Database.UpdateArtist(c.scope(ctx), id, artist)
 	if err != nil {
 		return err
 	}
 
 	artist.Id = id
-	c.artists = slices.Replace(c.artists, artistIdx, artistIdx+1, artist)
+	artist.Version = nextVersion(artist.Version, cached.Version)
+	artist.UserId = cached.UserId
+	c.working.putArtist(artist)
 	log.Debug("Updated artist in cache", artist)
+	c.notifyCatalogChanged()
 	return nil
 }
 
-func (c *SavedEventCache) DeleteArtist(id string) error {
+// Saved events referencing the artist block the delete unless opts allow cascading or reassigning them
+func (c *SavedEventCache) DeleteArtist(ctx context.Context, id string, opts DeleteOptions) error {
 	log.Debug("Deleting artist from cache", id)
-	artistIdx := slices.IndexFunc(c.artists, func(a data.Artist) bool {
-		return a.Id == id
+	defer c.lock()()
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		return c.deleteArtist(ctx, id, opts)
 	})
-	if artistIdx == -1 {
+	if err != nil {
+		return err
+	}
+	log.Debug("Deleted artist from cache", id)
+	c.notifyCatalogChanged()
+	return nil
+}
+
+func (c *SavedEventCache) deleteArtist(ctx context.Context, id string, opts DeleteOptions) error {
+	if _, ok := c.working.artistById(id); !ok {
 		log.Errorf("Unable to find artist %v when deleting from cache", id)
 		return errors.New("artist is not cached")
 	}
 
-	if err := c.Database.DeleteArtist(context.Background(), id); err != nil {
-		return err
+	var replacement data.Artist
+	if opts.Mode == DeleteReassign {
+		var ok bool
+		replacement, ok = c.working.artistById(opts.ReassignTo)
+		if !ok || opts.ReassignTo == id {
+			log.Errorf("Unable to reassign events from artist %v to %v", id, opts.ReassignTo)
+			return errors.New("artist to reassign events to must be another cached artist")
+		}
 	}
 
-	c.artists = slices.Delete(c.artists, artistIdx, artistIdx+1)
-	log.Debug("Deleted artist from cache", id)
-	return nil
+	others, err := c.otherUserReferences(ctx, data.EventQuery{ArtistId: id})
+	if err != nil {
+		return err
+	}
+	references := c.working.eventsForArtist(id)
+	reassign := func(e data.Event) data.Event {
+		return replaceArtist(e, id, replacement)
+	}
+	shared := replacement.UserId == db.SharedOwner
+	return c.resolveReferences(ctx, "artist", id, opts, references, others, shared, reassign, func(ctx context.Context) error {
+		if err := c.Database.DeleteArtist(ctx, id); err != nil {
+			return err
+		}
+		c.working.removeArtist(id)
+		return nil
+	})
 }
 
-func (c SavedEventCache) GetVenues() []data.Venue {
+func (c *SavedEventCache) GetVenues() []data.Venue {
 	log.Debug("Retrieving venues from cache")
-	return util.CloneVenues(c.venues)
+	return util.CloneVenues(c.snapshot().venues)
 }
 
-func (c *SavedEventCache) AddVenue(venue data.Venue) (*data.Venue, error) {
+func (c *SavedEventCache) AddVenue(ctx context.Context, venue data.Venue) (*data.Venue, error) {
 	log.Debug("Adding venue to cache", venue)
-	existingIdx := slices.IndexFunc(c.venues, venue.Equals)
-	if existingIdx >= 0 {
-		existing := util.CloneVenue(c.venues[existingIdx])
+	defer c.lock()()
+	added, err := c.addVenue(c.scope(ctx), venue)
+	if err != nil {
+		return nil, err
+	}
+	c.notifyCatalogChanged()
+	return added, nil
+}
+
+func (c *SavedEventCache) addVenue(ctx context.Context, venue data.Venue) (*data.Venue, error) {
+	if existing, ok := c.working.findVenue(venue); ok {
 		log.Debugf("Skipping adding venue %v because it already existed in the cache", venue)
 		return &existing, nil
 	}
 
-	id, err := c.Database.AddVenue(context.Background(), venue)
+	id, err := c.Database.AddVenue(ctx, venue)
 	if err != nil {
 		return nil, err
 	}
+	// the database matched it to a cached venue that was since changed
+	if existing, ok := c.working.venueById(id); ok {
+		return &existing, nil
+	}
 
 	venue.Id = id
-	c.venues = append(c.venues, util.CloneVenue(venue))
+	venue.Version = 1
+	c.working.putVenue(venue)
 	log.Debug("Added venue to cache", venue)
 	return &venue, nil
 }
 
-func (c *SavedEventCache) UpdateVenue(id string, venue data.Venue) error {
+func (c *SavedEventCache) UpdateVenue(ctx context.Context, id string, venue data.Venue) error {
 	log.Debugf("Updating venue in cache, id=%v, %v", id, venue)
-	venueIdx := slices.IndexFunc(c.venues, func(a data.Venue) bool {
-		return a.Id == id
-	})
-	if venueIdx == -1 {
+	defer c.lock()()
+	cached, ok := c.working.venueById(id)
+	if !ok {
 		log.Errorf("Unable to find venue %v when updating cache", id)
 		return errors.New("venue is not cached")
 	}
 
-	err := c.Database.UpdateVenue(context.Background(), id, venue)
+	err := c.Database.UpdateVenue(c.scope(ctx), id, venue)
 	if err != nil {
 		return err
 	}
 
 	venue.Id = id
-	c.venues = slices.Replace(c.venues, venueIdx, venueIdx+1, venue)
+	venue.Version = nextVersion(venue.Version, cached.Version)
+	venue.UserId = cached.UserId
+	c.working.putVenue(venue)
 	log.Debug("Updated venue in cache", venue)
+	c.notifyCatalogChanged()
 	return nil
 }
 
-func (c *SavedEventCache) DeleteVenue(id string) error {
+// Saved events at the venue block the delete unless opts allow cascading or reassigning them
+func (c *SavedEventCache) DeleteVenue(ctx context.Context, id string, opts DeleteOptions) error {
 	log.Debug("Deleting venue from cache", id)
-	venueIdx := slices.IndexFunc(c.venues, func(v data.Venue) bool {
-		return v.Id == id
+	defer c.lock()()
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		return c.deleteVenue(ctx, id, opts)
 	})
-	if venueIdx == -1 {
+	if err != nil {
+		return err
+	}
+	log.Debug("Deleted venue from cache", id)
+	c.notifyCatalogChanged()
+	return nil
+}
+
+func (c *SavedEventCache) deleteVenue(ctx context.Context, id string, opts DeleteOptions) error {
+	if _, ok := c.working.venueById(id); !ok {
 		log.Errorf("Unable to find venue %v when deleting from cache", id)
 		return errors.New("venue is not cached")
 	}
 
-	if err := c.Database.DeleteVenue(context.Background(), id); err != nil {
-		return err
+	var replacement data.Venue
+	if opts.Mode == DeleteReassign {
+		var ok bool
+		replacement, ok = c.working.venueById(opts.ReassignTo)
+		if !ok || opts.ReassignTo == id {
+			log.Errorf("Unable to reassign events from venue %v to %v", id, opts.ReassignTo)
+			return errors.New("venue to reassign events to must be another cached venue")
+		}
 	}
 
-	c.venues = slices.Delete(c.venues, venueIdx, venueIdx+1)
-	log.Debug("Deleted venue from cache", id)
-	return nil
+	others, err := c.otherUserReferences(ctx, data.EventQuery{VenueId: id})
+	if err != nil {
+		return err
+	}
+	references := c.working.eventsAtVenue(id)
+	reassign := func(e data.Event) data.Event {
+		e.Venue = replacement
+		return e
+	}
+	shared := replacement.UserId == db.SharedOwner
+	return c.resolveReferences(ctx, "venue", id, opts, references, others, shared, reassign, func(ctx context.Context) error {
+		if err := c.Database.DeleteVenue(ctx, id); err != nil {
+			return err
+		}
+		c.working.removeVenue(id)
+		return nil
+	})
 }
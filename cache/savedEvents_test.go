@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"context"
+	"errors"
+	"testing"
+)
+
+type failingEventRepo struct {
+	*memory.EventRepo
+}
+
+func (failingEventRepo) Add(context.Context, data.Event) (string, error) {
+	return "", errors.New("failed to add event")
+}
+
+func newTestCache(eventRepo func(*memory.EventRepo) db.EventRepo) *SavedEventCache {
+	conn := memory.Setup()
+	database := &db.DatabaseRepository{
+		VenueRepo:  &memory.VenueRepo{Connection: conn},
+		ArtistRepo: &memory.ArtistRepo{Connection: conn},
+		EventRepo:  eventRepo(&memory.EventRepo{Connection: conn}),
+		Transactor: conn,
+	}
+	cache := &SavedEventCache{Database: database}
+	cache.LoadCaches()
+	return cache
+}
+
+var testEvent = data.Event{
+	MainAct: data.Artist{Name: "Khruangbin", Genre: "Psychedelic"},
+	Openers: []data.Artist{{Name: "Men I Trust", Genre: "Indie"}},
+	Venue:   data.Venue{Name: "The Eastern", City: "Atlanta", State: "GA"},
+	Date:    "6/14/2023",
+}
+
+func TestAddSavedEvent(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+
+	saved, err := cache.AddSavedEvent(context.Background(), testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if saved.Id == "" || saved.MainAct.Id == "" || saved.Openers[0].Id == "" || saved.Venue.Id == "" {
+		t.Errorf("Saved event is missing IDs: %+v", saved)
+	}
+	if testEvent.Openers[0].Id != "" {
+		t.Error("Adding an event modified the caller's openers")
+	}
+	if len(cache.GetSavedEvents()) != 1 || len(cache.GetArtists()) != 2 || len(cache.GetVenues()) != 1 {
+		t.Errorf("Incorrect cache contents, events: %v, artists: %v, venues: %v",
+			cache.GetSavedEvents(), cache.GetArtists(), cache.GetVenues())
+	}
+}
+
+func TestAddSavedEventRollback(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return failingEventRepo{r} })
+
+	if _, err := cache.AddSavedEvent(context.Background(), testEvent); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(cache.GetSavedEvents()) != 0 || len(cache.GetArtists()) != 0 || len(cache.GetVenues()) != 0 {
+		t.Errorf("Cache kept rolled back records, events: %v, artists: %v, venues: %v",
+			cache.GetSavedEvents(), cache.GetArtists(), cache.GetVenues())
+	}
+
+	// reload from the database to make sure nothing was committed there either
+	if err := cache.RefreshArtists(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshVenues(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(cache.GetArtists()) != 0 || len(cache.GetVenues()) != 0 {
+		t.Errorf("Database kept rolled back records, artists: %v, venues: %v", cache.GetArtists(), cache.GetVenues())
+	}
+}
+
+func TestAddSavedEventsRollback(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	invalid := testEvent
+	invalid.Date = ""
+
+	if _, err := cache.AddSavedEvents(context.Background(), []data.Event{testEvent, invalid}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := cache.GetSavedEvents(); len(events) != 0 {
+		t.Errorf("Events from a failed batch were saved: %v", events)
+	}
+}
+
+func TestRepairEvent(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	saved, err := cache.AddSavedEvent(context.Background(), testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	// skip the cache so the event is left with a dangling opener
+	if err := cache.Database.DeleteArtist(context.Background(), saved.Openers[0].Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := cache.GetSavedEvents(); len(events) != 0 {
+		t.Errorf("Invalid event should not be cached: %v", events)
+	}
+
+	issues, err := cache.GetIntegrityIssues()
+	if err != nil || len(issues) != 1 || issues[0].Id != saved.Id {
+		t.Fatalf("Expected an integrity issue for %v, actual: %v, err: %v", saved.Id, issues, err)
+	}
+	if err := cache.RepairEvent(context.Background(), saved.Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := cache.GetSavedEvents(); len(events) != 1 || len(events[0].Openers) != 0 {
+		t.Errorf("Repaired event should be cached without the opener: %v", events)
+	}
+}
+
+func TestUpdateArtistStaleVersion(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	artist, err := cache.AddArtist(context.Background(), testEvent.MainAct)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	updated := *artist
+	updated.Genre = "Funk"
+	if err := cache.UpdateArtist(context.Background(), artist.Id, updated); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	stale := *artist
+	stale.Genre = "Soul"
+	if err := cache.UpdateArtist(context.Background(), artist.Id, stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, actual: %v", err)
+	}
+	if artists := cache.GetArtists(); len(artists) != 1 || artists[0].Genre != "Funk" || artists[0].Version != 2 {
+		t.Errorf("Incorrect cached artists after a stale update: %v", artists)
+	}
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"concert-manager/util"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const trashPurgeInterval = 24 * time.Hour
+
+// Records in the trash are never cached, so the trash always comes from the database
+func (c *SavedEventCache) GetTrash() (data.Trash, error) {
+	log.Debug("Retrieving trash from database")
+	return c.getTrash(c.scope(context.Background()))
+}
+
+func (c *SavedEventCache) getTrash(ctx context.Context) (data.Trash, error) {
+	trash := data.Trash{}
+	var err error
+	if trash.Events, err = c.Database.ListDeletedEvents(ctx); err != nil {
+		return trash, err
+	}
+	if trash.Artists, err = c.Database.ListDeletedArtists(ctx); err != nil {
+		return trash, err
+	}
+	if trash.Venues, err = c.Database.ListDeletedVenues(ctx); err != nil {
+		return trash, err
+	}
+	return trash, nil
+}
+
+// Events can only be restored after the artists and venue they reference
+func (c *SavedEventCache) RestoreEvent(ctx context.Context, id string) error {
+	log.Debug("Restoring event from trash", id)
+	if err := c.Database.RestoreEvent(c.scope(ctx), id); err != nil {
+		return err
+	}
+	return c.RefreshSavedEvents()
+}
+
+func (c *SavedEventCache) RestoreArtist(ctx context.Context, id string) error {
+	log.Debug("Restoring artist from trash", id)
+	defer c.lock()()
+	if err := c.Database.RestoreArtist(c.scope(ctx), id); err != nil {
+		return err
+	}
+	if err := c.refreshArtists(); err != nil {
+		return err
+	}
+	c.notifyCatalogChanged()
+	return nil
+}
+
+func (c *SavedEventCache) RestoreVenue(ctx context.Context, id string) error {
+	log.Debug("Restoring venue from trash", id)
+	defer c.lock()()
+	if err := c.Database.RestoreVenue(c.scope(ctx), id); err != nil {
+		return err
+	}
+	if err := c.refreshVenues(); err != nil {
+		return err
+	}
+	c.notifyCatalogChanged()
+	return nil
+}
+
+func (c *SavedEventCache) PurgeEvent(ctx context.Context, id string) error {
+	log.Debug("Purging event from trash", id)
+	return c.Database.PurgeEvent(c.scope(ctx), id)
+}
+
+// Trashed events referencing the artist could never be restored without it, so they are purged too
+func (c *SavedEventCache) PurgeArtist(ctx context.Context, id string) error {
+	log.Debug("Purging artist from trash", id)
+	return c.purgeWithEvents(ctx, id, referencesArtist(id), c.Database.PurgeArtist)
+}
+
+// Trashed events at the venue could never be restored without it, so they are purged too
+func (c *SavedEventCache) PurgeVenue(ctx context.Context, id string) error {
+	log.Debug("Purging venue from trash", id)
+	return c.purgeWithEvents(ctx, id, referencesVenue(id), c.Database.PurgeVenue)
+}
+
+func (c *SavedEventCache) purgeWithEvents(ctx context.Context, id string, references func(data.Event) bool,
+	purge func(context.Context, string) error) error {
+	return c.Database.RunTransaction(c.scope(ctx), func(ctx context.Context) error {
+		events, err := c.Database.ListDeletedEvents(ctx)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if !references(event) {
+				continue
+			}
+			if err := c.Database.PurgeEvent(ctx, event.Id); err != nil {
+				return fmt.Errorf("failed to purge event %s referencing %s, %w", event.Id, id, err)
+			}
+			log.Debugf("Purged event %v referencing %v", event.Id, id)
+		}
+		return purge(ctx, id)
+	})
+}
+
+// Permanently removes everything that was moved to the trash before the cutoff. Artists and venues
+// are kept while an event that is still in the trash references them, so that event can be restored
+func (c *SavedEventCache) PurgeExpiredTrash(ctx context.Context, before time.Time) (int, error) {
+	log.Debug("Purging trash deleted before", before)
+	purged := 0
+	err := c.Database.RunTransaction(c.scope(ctx), func(ctx context.Context) error {
+		purged = 0
+		trash, err := c.getTrash(ctx)
+		if err != nil {
+			return err
+		}
+		expired := func(deletedAt *time.Time) bool {
+			return deletedAt != nil && deletedAt.Before(before)
+		}
+
+		kept := []data.Event{}
+		for _, event := range trash.Events {
+			if !expired(event.DeletedAt) {
+				kept = append(kept, event)
+				continue
+			}
+			if err := c.Database.PurgeEvent(ctx, event.Id); err != nil {
+				return fmt.Errorf("failed to purge event %s, %w", event.Id, err)
+			}
+			purged++
+		}
+		for _, artist := range trash.Artists {
+			if !expired(artist.DeletedAt) || slices.ContainsFunc(kept, referencesArtist(artist.Id)) {
+				continue
+			}
+			if err := c.Database.PurgeArtist(ctx, artist.Id); err != nil {
+				return fmt.Errorf("failed to purge artist %s, %w", artist.Id, err)
+			}
+			purged++
+		}
+		for _, venue := range trash.Venues {
+			if !expired(venue.DeletedAt) || slices.ContainsFunc(kept, referencesVenue(venue.Id)) {
+				continue
+			}
+			if err := c.Database.PurgeVenue(ctx, venue.Id); err != nil {
+				return fmt.Errorf("failed to purge venue %s, %w", venue.Id, err)
+			}
+			purged++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Purged %d records from the trash", purged)
+	return purged, nil
+}
+
+// Purges records of every user that have been in the trash for longer than the retention period,
+// once at startup and then once a day for as long as the process runs
+func (c *SavedEventCache) StartTrashPurger(retention time.Duration) {
+	log.Infof("Purging trash older than %v every %v", retention, trashPurgeInterval)
+	ctx := db.WithAllUsers(db.WithActor(context.Background(), db.ActorSystem))
+	go func() {
+		for {
+			if _, err := c.PurgeExpiredTrash(ctx, time.Now().Add(-retention)); err != nil {
+				log.Error("Failed to purge expired trash,", err)
+			}
+			time.Sleep(trashPurgeInterval)
+		}
+	}()
+}
+
+// Marks events that passed before the cutoff without being marked as attended as archived. They stay
+// saved as history, and since they never go to the trash the purger leaves them alone
+func (c *SavedEventCache) ArchivePassedEvents(ctx context.Context, before time.Time) (int, error) {
+	log.Debug("Archiving events that passed before", before)
+	defer c.lock()()
+	passed := []data.Event{}
+	for _, event := range c.working.savedEvents {
+		if event.ArchivedAt == nil && !event.Purchased && util.ValidDate(event.Date) && util.Timestamp(event.Date).Before(before) {
+			passed = append(passed, util.CloneEvent(event))
+		}
+	}
+	if len(passed) == 0 {
+		return 0, nil
+	}
+
+	archivedAt := time.Now().UTC()
+	err := c.runTransaction(ctx, func(ctx context.Context) error {
+		for _, event := range passed {
+			event.ArchivedAt = &archivedAt
+			if err := c.Database.UpdateEvent(ctx, event.Id, event); err != nil {
+				return fmt.Errorf("failed to archive event %s, %w", event.Id, err)
+			}
+			event.Version++
+			c.working.putEvent(event)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Archived %d passed events for user %v", len(passed), c.User)
+	return len(passed), nil
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"concert-manager/util"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRestoreEvent(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+	if err := cache.DeleteSavedEvent(context.Background(), saved.Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	trash, err := cache.GetTrash()
+	if err != nil || len(trash.Events) != 1 || trash.Events[0].Id != saved.Id {
+		t.Fatalf("Deleted event should be in the trash, actual: %+v, err: %v", trash, err)
+	}
+
+	if err := cache.RestoreEvent(context.Background(), saved.Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := cache.GetSavedEvents(); len(events) != 1 || events[0].Id != saved.Id {
+		t.Errorf("Restored event should be cached: %v", events)
+	}
+}
+
+func TestPurgeArtistWithTrashedEvents(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+	if err := cache.DeleteArtist(context.Background(), saved.Openers[0].Id, DeleteOptions{Mode: DeleteCascade}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := cache.PurgeArtist(context.Background(), saved.Openers[0].Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	trash, err := cache.GetTrash()
+	if err != nil || len(trash.Events) != 0 || len(trash.Artists) != 0 {
+		t.Errorf("Purging an artist should purge the trashed events referencing it, actual: %+v, err: %v", trash, err)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	cache, saved := newReferenceTestCache(t)
+	if err := cache.DeleteArtist(context.Background(), saved.Openers[0].Id, DeleteOptions{Mode: DeleteCascade}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	purged, err := cache.PurgeExpiredTrash(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil || purged != 0 {
+		t.Fatalf("Nothing should have expired yet, purged: %v, err: %v", purged, err)
+	}
+	purged, err = cache.PurgeExpiredTrash(context.Background(), time.Now().Add(time.Hour))
+	if err != nil || purged != 2 {
+		t.Fatalf("Expected the event and artist to be purged, purged: %v, err: %v", purged, err)
+	}
+	if trash, err := cache.GetTrash(); err != nil || len(trash.Events) != 0 || len(trash.Artists) != 0 {
+		t.Errorf("Expected an empty trash, actual: %+v, err: %v", trash, err)
+	}
+}
+
+func TestArchivePassedEvents(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	ctx := context.Background()
+	attended := testEvent
+	attended.Date, attended.Purchased = "6/15/2023", true
+	upcoming := testEvent
+	upcoming.Date = util.Date(time.Now().AddDate(0, 1, 0))
+	for _, event := range []data.Event{testEvent, attended, upcoming} {
+		if _, err := cache.AddSavedEvent(ctx, event); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	archived, err := cache.ArchivePassedEvents(ctx, util.Timestamp(testEvent.Date))
+	if err != nil || archived != 0 {
+		t.Fatalf("Events passed on the cutoff should be kept, archived: %v, err: %v", archived, err)
+	}
+	archived, err = cache.ArchivePassedEvents(ctx, time.Now())
+	if err != nil || archived != 1 {
+		t.Fatalf("Expected the passed event to be archived, archived: %v, err: %v", archived, err)
+	}
+	events := cache.GetSavedEvents()
+	if len(events) != 3 {
+		t.Fatalf("Archived events should stay saved, actual: %v", events)
+	}
+	for _, event := range events {
+		if archived := event.ArchivedAt != nil; archived != event.Equals(testEvent) {
+			t.Errorf("Only the passed event should be archived, actual: %+v", event)
+		}
+	}
+	if archived, err := cache.ArchivePassedEvents(ctx, time.Now()); err != nil || archived != 0 {
+		t.Errorf("Archived events should not be archived again, archived: %v, err: %v", archived, err)
+	}
+
+	// archived events aren't in the trash, so purging it can't remove them
+	if trash, err := cache.GetTrash(); err != nil || len(trash.Events) != 0 {
+		t.Errorf("Archived event should not be in the trash, actual: %+v, err: %v", trash, err)
+	}
+	if _, err := cache.PurgeExpiredTrash(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := cache.GetSavedEvents(); len(events) != 3 || !slices.ContainsFunc(events, func(e data.Event) bool {
+		return e.Equals(testEvent) && e.ArchivedAt != nil
+	}) {
+		t.Errorf("Archived event should survive purging the trash, actual: %v", events)
+	}
+}
+
+func TestArchivedEventsSetAside(t *testing.T) {
+	cache := newTestCache(func(r *memory.EventRepo) db.EventRepo { return r })
+	ctx := context.Background()
+	saved, err := cache.AddSavedEvent(ctx, testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if passed := cache.GetPassedSavedEvents(); len(passed) != 1 {
+		t.Fatalf("Expected the event to be passed before archiving, actual: %v", passed)
+	}
+	if _, err := cache.ArchivePassedEvents(ctx, time.Now()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if passed := cache.GetPassedSavedEvents(); len(passed) != 0 {
+		t.Errorf("Archived events shouldn't be listed as passed, actual: %v", passed)
+	}
+
+	// a full replacement doesn't send archivedAt
+	replacement := testEvent
+	replacement.Purchased = true
+	if err := cache.UpdateSavedEvent(ctx, saved.Id, replacement); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if event, ok := cache.GetSavedEvent(saved.Id); !ok || event.ArchivedAt == nil || !event.Purchased {
+		t.Errorf("Replacing an archived event should keep it archived, actual: %+v", event)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"concert-manager/util"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,12 +29,45 @@ type eventRanksData struct {
 	lastLoaded time.Time
 }
 
+// Upcoming events and recommendations for any number of locations, each cached under Location.key().
+// Each location is only refreshed once at a time, and everyone asking for it meanwhile shares the result
 type UpcomingEventCache struct {
-	Location       Location
-	Finder         Finder
-	Ranker         Ranker
-	upcomingEvents map[string]upcomingEventsData
-	eventRanks     map[string]eventRanksData
+	Finder          Finder
+	Ranker          Ranker
+	mutex           sync.Mutex
+	upcomingEvents  map[string]upcomingEventsData
+	eventRanks      map[string]eventRanksData
+	upcomingFlights map[string]*flight
+	rankFlights     map[string]*flight
+	changes         publisher
+	// what changed between refreshes, for every location
+	announcements []Announcement
+	// the location of each key, which the key itself has lost the case of
+	locations map[string]Location
+	// where refreshes are persisted, nothing is when empty
+	dir          string
+	persistMutex sync.Mutex
+}
+
+// A refresh in progress. Done is closed once the refresh was stored and published
+type flight struct {
+	done chan struct{}
+	err  error
+}
+
+// The upcoming events of a location as of when they were last found
+type UpcomingEvents struct {
+	Events     []data.EventDetails
+	LastLoaded time.Time
+	// set while the events are being found again, so they may be replaced soon
+	Refreshing bool
+}
+
+// The recommendations of a location as of when they were last ranked
+type RecommendedEvents struct {
+	Ranks      []data.EventRank
+	LastLoaded time.Time
+	Refreshing bool
 }
 
 const (
@@ -43,53 +77,129 @@ const (
 
 func NewUpcomingEventCache() *UpcomingEventCache {
 	cache := UpcomingEventCache{}
-	cache.Location = Location{City: defaultCity, StateCode: defaultStateCode}
 	cache.upcomingEvents = map[string]upcomingEventsData{}
 	cache.eventRanks = map[string]eventRanksData{}
+	cache.upcomingFlights = map[string]*flight{}
+	cache.rankFlights = map[string]*flight{}
+	cache.locations = map[string]Location{}
 	return &cache
 }
 
 var	upcomingEventTTL, _ = time.ParseDuration("24h")
 
-func (c *UpcomingEventCache) GetUpcomingEvents() []data.EventDetails {
-	key := c.Location.key()
-	if d, ok := c.upcomingEvents[key]; !ok {
-		c.doRefresh()
-	} else if isExpired(d.lastLoaded, upcomingEventTTL) {
-		go c.doRefresh()
-	}
-	return util.CloneEventDetails(c.upcomingEvents[key].events)
+func (c *UpcomingEventCache) GetUpcomingEvents(loc Location) []data.EventDetails {
+	return c.UpcomingEventsFor(loc, false).Events
 }
 
-func (c *UpcomingEventCache) doRefresh() {
-    err := c.RefreshUpcomingEvents()
-	if err != nil {
-		log.Error("Failed to refresh upcoming events", err)
+// Events that were never found are always waited on. Expired events are refreshed in the background and
+// returned in the meantime, unless wait is set
+func (c *UpcomingEventCache) UpcomingEventsFor(loc Location, wait bool) UpcomingEvents {
+	key := loc.key()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	d, ok := c.upcomingEvents[key]
+	if !ok || isExpired(d.lastLoaded, upcomingEventTTL) {
+		f := c.refreshUpcoming(loc)
+		if !ok || wait {
+			c.mutex.Unlock()
+			<-f.done
+			c.mutex.Lock()
+			d = c.upcomingEvents[key]
+		}
 	}
+	_, refreshing := c.upcomingFlights[key]
+	return UpcomingEvents{Events: util.CloneEventDetails(d.events), LastLoaded: d.lastLoaded, Refreshing: refreshing}
 }
 
-func (c *UpcomingEventCache) RefreshUpcomingEvents() error {
-	log.Info("Refreshing upcoming events")
-	loc := c.Location
-	key := c.Location.key()
-	request := finder.FindEventRequest{City: loc.City, State: loc.StateCode}
-	events, err := c.Finder.FindAllEvents(request)
-	if err != nil {
-		if _, ok := c.upcomingEvents[key]; !ok {
-			eventData := upcomingEventsData{events: []data.EventDetails{}, lastLoaded: time.Time{}}
-			c.upcomingEvents[key] = eventData
+// The upcoming events of the location, waiting for a refresh when they are missing or expired.
+// Fails when that refresh does, instead of returning the events that were there before it
+func (c *UpcomingEventCache) currentUpcomingEvents(loc Location) ([]data.EventDetails, error) {
+	key := loc.key()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	d, ok := c.upcomingEvents[key]
+	if !ok || isExpired(d.lastLoaded, upcomingEventTTL) {
+		f := c.refreshUpcoming(loc)
+		c.mutex.Unlock()
+		<-f.done
+		c.mutex.Lock()
+		if f.err != nil {
+			return nil, f.err
 		}
-		return err
+		d = c.upcomingEvents[key]
 	}
+	return util.CloneEventDetails(d.events), nil
+}
 
-	eventData := upcomingEventsData{events: events, lastLoaded: time.Now().Round(0)}
-	c.upcomingEvents[key] = eventData
-	return nil
+// Finds the upcoming events of the location again, or waits for the refresh already in progress
+func (c *UpcomingEventCache) RefreshUpcomingEvents(loc Location) error {
+	c.mutex.Lock()
+	f := c.refreshUpcoming(loc)
+	c.mutex.Unlock()
+	<-f.done
+	return f.err
 }
 
-func (c *UpcomingEventCache) Invalidate() {
-	c.upcomingEvents = map[string]upcomingEventsData{}
-	c.eventRanks = map[string]eventRanksData{}
+// Starts refreshing the location unless it already is, must be called with the mutex held
+func (c *UpcomingEventCache) refreshUpcoming(loc Location) *flight {
+	key := loc.key()
+	if f, ok := c.upcomingFlights[key]; ok {
+		return f
+	}
+	f := &flight{done: make(chan struct{})}
+	c.upcomingFlights[key] = f
+
+	go func() {
+		defer close(f.done)
+		log.Info("Refreshing upcoming events for", loc)
+		request := finder.FindEventRequest{City: loc.City, State: loc.StateCode}
+		events, err := c.Finder.FindAllEvents(request)
+
+		c.mutex.Lock()
+		delete(c.upcomingFlights, key)
+		if err != nil {
+			if _, ok := c.upcomingEvents[key]; !ok {
+				eventData := upcomingEventsData{events: []data.EventDetails{}, lastLoaded: time.Time{}}
+				c.upcomingEvents[key] = eventData
+			}
+			c.mutex.Unlock()
+			log.Errorf("Failed to refresh upcoming events for %s, %v", loc, err)
+			f.err = err
+			return
+		}
+		now := time.Now().Round(0)
+		// the first events found for a location aren't news, they were just never looked at before
+		announcements := []Announcement{}
+		if previous, ok := c.upcomingEvents[key]; ok && !previous.lastLoaded.IsZero() {
+			announcements = diffUpcoming(loc, previous.events, events, now)
+			c.announce(announcements, now)
+		}
+		eventData := upcomingEventsData{events: events, lastLoaded: now}
+		c.upcomingEvents[key] = eventData
+		c.locations[key] = loc
+		c.mutex.Unlock()
+
+		c.persistUpcoming()
+		if len(announcements) > 0 {
+			log.Infof("Found %d announcements for %s", len(announcements), loc)
+			c.persistAnnouncements()
+		}
+		c.changes.publish(Change{Kind: UpcomingRefreshed, Location: &loc, At: time.Now().UTC()})
+	}()
+	return f
+}
+
+// Delivers every refresh of upcoming events and recommendations, for any location, until the returned cancel is called
+func (c *UpcomingEventCache) Subscribe() (<-chan Change, func()) {
+	return c.changes.subscribe()
+}
+
+// Drops the upcoming events and recommendations of the location, so they are found again when next requested
+func (c *UpcomingEventCache) Invalidate(loc Location) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.upcomingEvents, loc.key())
+	delete(c.eventRanks, loc.key())
 }
 
 type Location struct {
@@ -97,14 +207,9 @@ type Location struct {
 	StateCode string
 }
 
-func (c UpcomingEventCache) GetLocation() Location {
-	return c.Location
-}
-
-func (c *UpcomingEventCache) ChangeLocation(city, stateCode string) {
-	loc := Location{City: city, StateCode: stateCode}
-	log.Debugf("Updating upcomingEventCache location from %s to %s", c.Location, loc)
-	c.Location = loc
+// Where upcoming events are found when no location is asked for
+func DefaultLocation() Location {
+	return Location{City: defaultCity, StateCode: defaultStateCode}
 }
 
 func (c Location) key() string {
@@ -139,34 +244,106 @@ func (t Threshold) Level() string {
 	}
 }
 
-func (c *UpcomingEventCache) GetRecommendedEvents(threshold Threshold) []data.EventRank {
-	key := c.Location.key()
-	if d, ok := c.eventRanks[key]; !ok {
-		c.LoadRecommendations()
-	} else if isExpired(d.lastLoaded, upcomingEventTTL) {
-		go c.LoadRecommendations()
+func (c *UpcomingEventCache) GetRecommendedEvents(loc Location, threshold Threshold) []data.EventRank {
+	return c.RecommendedEventsFor(loc, threshold, false).Ranks
+}
+
+// Recommendations ranked at or above the threshold, waited on the same way as UpcomingEventsFor
+func (c *UpcomingEventCache) RecommendedEventsFor(loc Location, threshold Threshold, wait bool) RecommendedEvents {
+	key := loc.key()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	d, ok := c.eventRanks[key]
+	if !ok || isExpired(d.lastLoaded, upcomingEventTTL) {
+		f := c.refreshRanks(loc)
+		if !ok || wait {
+			c.mutex.Unlock()
+			<-f.done
+			c.mutex.Lock()
+			d = c.eventRanks[key]
+		}
 	}
+	_, refreshing := c.rankFlights[key]
 
 	var events []data.EventRank
-	for _, event := range c.eventRanks[key].ranks {
+	for _, event := range d.ranks {
 		if event.Rank >= float64(threshold) {
 			events = append(events, util.CloneEventRank(event))
 		}
 	}
-	return events
+	return RecommendedEvents{Ranks: events, LastLoaded: d.lastLoaded, Refreshing: refreshing}
+}
+
+// Ranks the upcoming events of the location again, or waits for the ranking already in progress
+func (c *UpcomingEventCache) LoadRecommendations(loc Location) error {
+	c.mutex.Lock()
+	f := c.refreshRanks(loc)
+	c.mutex.Unlock()
+	<-f.done
+	return f.err
+}
+
+// Starts ranking the location unless it already is, must be called with the mutex held
+func (c *UpcomingEventCache) refreshRanks(loc Location) *flight {
+	key := loc.key()
+	if f, ok := c.rankFlights[key]; ok {
+		return f
+	}
+	f := &flight{done: make(chan struct{})}
+	c.rankFlights[key] = f
+
+	go func() {
+		defer close(f.done)
+		// ranking stale events would only have them ranked again once the refresh finishes, and ranking
+		// after a failed refresh would keep the ranks from being retried until they expire
+		events, err := c.currentUpcomingEvents(loc)
+		if err != nil {
+			c.mutex.Lock()
+			delete(c.rankFlights, key)
+			c.mutex.Unlock()
+			log.Errorf("Failed to rank upcoming events for %s, %v", loc, err)
+			f.err = err
+			return
+		}
+		rankedEvents := []data.EventRank{}
+		for _, event := range events {
+			rankedEvent := c.Ranker.Rank(event)
+			rankedEvents = append(rankedEvents, rankedEvent)
+		}
+
+		c.mutex.Lock()
+		delete(c.rankFlights, key)
+		ranksData := eventRanksData{ranks: rankedEvents, lastLoaded: time.Now()}
+		c.eventRanks[key] = ranksData
+		c.locations[key] = loc
+		c.mutex.Unlock()
+
+		c.persistRanks()
+		c.changes.publish(Change{Kind: RecommendationsRefreshed, Location: &loc, At: time.Now().UTC()})
+	}()
+	return f
 }
 
-func (c *UpcomingEventCache) LoadRecommendations() {
-	rankedEvents := []data.EventRank{}
-	events := c.GetUpcomingEvents()
-	for _, event := range events {
-		rankedEvent := c.Ranker.Rank(event)
-		rankedEvents = append(rankedEvents, rankedEvent)
+// Refreshes the upcoming events and recommendations of the location when they were last found longer
+// than maxAge ago, so they are ready before they expire. Returns whether anything was refreshed
+func (c *UpcomingEventCache) RefreshStale(loc Location, maxAge time.Duration) (bool, error) {
+	key := loc.key()
+	c.mutex.Lock()
+	upcoming, upcomingFound := c.upcomingEvents[key]
+	ranks, ranksFound := c.eventRanks[key]
+	c.mutex.Unlock()
+	staleUpcoming := !upcomingFound || isExpired(upcoming.lastLoaded, maxAge)
+	staleRanks := !ranksFound || isExpired(ranks.lastLoaded, maxAge)
+	if !staleUpcoming && !staleRanks {
+		return false, nil
 	}
 
-	key := c.Location.key()
-	ranksData := eventRanksData{ranks: rankedEvents, lastLoaded: time.Now()}
-	c.eventRanks[key] = ranksData
+	if staleUpcoming {
+		if err := c.RefreshUpcomingEvents(loc); err != nil {
+			return true, err
+		}
+	}
+	return true, c.LoadRecommendations(loc)
 }
 
 func isExpired(lastLoad time.Time, ttl time.Duration) bool {
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/finder"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Counts the searches, which each wait until release is closed
+type blockingFinder struct {
+	searches atomic.Int32
+	release  chan struct{}
+}
+
+func (f *blockingFinder) FindAllEvents(finder.FindEventRequest) ([]data.EventDetails, error) {
+	f.searches.Add(1)
+	<-f.release
+	return []data.EventDetails{{Event: testEvent}}, nil
+}
+
+func TestConcurrentRefreshesShareOneSearch(t *testing.T) {
+	search := &blockingFinder{release: make(chan struct{})}
+	cache := NewUpcomingEventCache()
+	cache.Finder = search
+	cache.Ranker = stubRanker{}
+	loc := DefaultLocation()
+
+	var wg sync.WaitGroup
+	results := make([][]data.EventDetails, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				results[i] = cache.GetUpcomingEvents(loc)
+			} else {
+				results[i] = cache.UpcomingEventsFor(loc, true).Events
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cache.GetRecommendedEvents(loc, NoThreshold)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(search.release)
+	wg.Wait()
+
+	if searches := search.searches.Load(); searches != 1 {
+		t.Errorf("Concurrent requests should share a single search, actual searches: %d", searches)
+	}
+	for _, events := range results {
+		if len(events) != 1 {
+			t.Errorf("Every request should get the searched events, actual: %+v", events)
+		}
+	}
+}
+
+func TestExpiredEventsServedWhileRefreshing(t *testing.T) {
+	search := &blockingFinder{release: make(chan struct{})}
+	cache := NewUpcomingEventCache()
+	cache.Finder = search
+	loc := DefaultLocation()
+	stale := data.EventDetails{Name: "stale"}
+	cache.upcomingEvents[loc.key()] = upcomingEventsData{
+		events:     []data.EventDetails{stale},
+		lastLoaded: time.Now().Add(-2 * upcomingEventTTL),
+	}
+
+	upcoming := cache.UpcomingEventsFor(loc, false)
+	if !upcoming.Refreshing || len(upcoming.Events) != 1 || upcoming.Events[0].Name != "stale" {
+		t.Errorf("Expected the stale events while refreshing, actual: %+v", upcoming)
+	}
+
+	waited := make(chan UpcomingEvents)
+	go func() { waited <- cache.UpcomingEventsFor(loc, true) }()
+	close(search.release)
+	upcoming = <-waited
+	if upcoming.Refreshing || len(upcoming.Events) != 1 || !upcoming.Events[0].Event.Equals(testEvent) {
+		t.Errorf("Waiting should get the refreshed events, actual: %+v", upcoming)
+	}
+	if searches := search.searches.Load(); searches != 1 {
+		t.Errorf("Waiting should share the refresh in progress, actual searches: %d", searches)
+	}
+}
+
+func TestRefreshStale(t *testing.T) {
+	search := &blockingFinder{release: make(chan struct{})}
+	close(search.release)
+	cache := NewUpcomingEventCache()
+	cache.Finder = search
+	cache.Ranker = stubRanker{}
+	loc := DefaultLocation()
+
+	for i, expected := range []bool{true, false} {
+		refreshed, err := cache.RefreshStale(loc, time.Hour)
+		if err != nil || refreshed != expected {
+			t.Errorf("Incorrect refresh %d, expected: %v, actual: %v, err: %v", i, expected, refreshed, err)
+		}
+	}
+	if searches := search.searches.Load(); searches != 1 {
+		t.Errorf("Fresh events shouldn't be searched again, actual searches: %d", searches)
+	}
+	if recs := cache.GetRecommendedEvents(loc, NoThreshold); len(recs) != 1 {
+		t.Errorf("Recommendations should be refreshed along with the events, actual: %+v", recs)
+	}
+}
+
+func TestFailedRefreshIsNotRanked(t *testing.T) {
+	cache := NewUpcomingEventCache()
+	cache.Finder = unreachableFinder{}
+	cache.Ranker = stubRanker{}
+	loc := DefaultLocation()
+
+	if err := cache.LoadRecommendations(loc); err == nil {
+		t.Error("Ranking should fail along with the upcoming events refresh")
+	}
+	if _, ok := cache.eventRanks[loc.key()]; ok {
+		t.Error("Ranks shouldn't be stored when the upcoming events couldn't be found")
+	}
+	if _, err := cache.RefreshStale(loc, time.Hour); err == nil {
+		t.Error("Refreshing should be retried and fail again")
+	}
+
+	cache.Finder = stubFinder{}
+	recs := cache.RecommendedEventsFor(loc, NoThreshold, false)
+	if len(recs.Ranks) != 1 || recs.LastLoaded.IsZero() {
+		t.Errorf("Ranks should be found once the refresh works, actual: %+v", recs)
+	}
+}
@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	upcomingDirEnv     = "CM_CACHE_DIR"
+	defaultUpcomingDir = "/.concert_manager/cache"
+	upcomingFile       = "upcoming.json"
+	recommendationFile = "recommendations.json"
+	announcementFile   = "announcements.json"
+)
+
+// What is written to disk for each location, keyed by Location.key()
+type persistedUpcoming struct {
+	Location   Location            `json:"location"`
+	Events     []data.EventDetails `json:"events"`
+	LastLoaded time.Time           `json:"lastLoaded"`
+}
+
+type persistedRanks struct {
+	Location   Location         `json:"location"`
+	Ranks      []data.EventRank `json:"ranks"`
+	LastLoaded time.Time        `json:"lastLoaded"`
+}
+
+// Persists upcoming events and recommendations in CM_CACHE_DIR, or ~/.concert_manager/cache by default
+func (c *UpcomingEventCache) Persist() error {
+	dir := os.Getenv(upcomingDirEnv)
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dir = homeDir + defaultUpcomingDir
+	}
+	return c.PersistIn(dir)
+}
+
+// Loads the upcoming events and recommendations last written to the directory, and writes every later
+// refresh there. Loaded locations keep when they were found, so they are refreshed once they expire,
+// and are still served when the refresh fails
+func (c *UpcomingEventCache) PersistIn(dir string) error {
+	log.Debug("Loading persisted upcoming events from", dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// set even when the files can't be read, so the next refresh replaces them
+	c.dir = dir
+	upcoming := map[string]persistedUpcoming{}
+	if err := readPersisted(filepath.Join(dir, upcomingFile), &upcoming); err != nil {
+		return fmt.Errorf("failed to read persisted upcoming events, %w", err)
+	}
+	ranks := map[string]persistedRanks{}
+	if err := readPersisted(filepath.Join(dir, recommendationFile), &ranks); err != nil {
+		return fmt.Errorf("failed to read persisted recommendations, %w", err)
+	}
+	announcements := []Announcement{}
+	if err := readPersisted(filepath.Join(dir, announcementFile), &announcements); err != nil {
+		return fmt.Errorf("failed to read persisted announcements, %w", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, p := range upcoming {
+		c.upcomingEvents[key] = upcomingEventsData{events: p.Events, lastLoaded: p.LastLoaded}
+		c.locations[key] = p.Location
+	}
+	for key, p := range ranks {
+		c.eventRanks[key] = eventRanksData{ranks: p.Ranks, lastLoaded: p.LastLoaded}
+		c.locations[key] = p.Location
+	}
+	c.announce(announcements, time.Now())
+	log.Infof("Loaded persisted upcoming events for %d locations and recommendations for %d", len(upcoming), len(ranks))
+	return nil
+}
+
+// Failing to persist only costs a refresh after the next restart, so errors are logged rather than returned
+func (c *UpcomingEventCache) persistUpcoming() {
+	if c.dir == "" {
+		return
+	}
+	// held while writing, so an older snapshot can't replace a newer one
+	c.persistMutex.Lock()
+	defer c.persistMutex.Unlock()
+	c.mutex.Lock()
+	upcoming := map[string]persistedUpcoming{}
+	for key, d := range c.upcomingEvents {
+		// failed refreshes leave empty placeholders that aren't worth keeping
+		if !d.lastLoaded.IsZero() {
+			upcoming[key] = persistedUpcoming{Location: c.locations[key], Events: d.events, LastLoaded: d.lastLoaded}
+		}
+	}
+	c.mutex.Unlock()
+	if err := writePersisted(filepath.Join(c.dir, upcomingFile), upcoming); err != nil {
+		log.Error("Failed to persist upcoming events,", err)
+	}
+}
+
+func (c *UpcomingEventCache) persistRanks() {
+	if c.dir == "" {
+		return
+	}
+	c.persistMutex.Lock()
+	defer c.persistMutex.Unlock()
+	c.mutex.Lock()
+	ranks := map[string]persistedRanks{}
+	for key, d := range c.eventRanks {
+		ranks[key] = persistedRanks{Location: c.locations[key], Ranks: d.ranks, LastLoaded: d.lastLoaded}
+	}
+	c.mutex.Unlock()
+	if err := writePersisted(filepath.Join(c.dir, recommendationFile), ranks); err != nil {
+		log.Error("Failed to persist recommendations,", err)
+	}
+}
+
+func (c *UpcomingEventCache) persistAnnouncements() {
+	if c.dir == "" {
+		return
+	}
+	c.persistMutex.Lock()
+	defer c.persistMutex.Unlock()
+	c.mutex.Lock()
+	announcements := slices.Clone(c.announcements)
+	c.mutex.Unlock()
+	if err := writePersisted(filepath.Join(c.dir, announcementFile), announcements); err != nil {
+		log.Error("Failed to persist announcements,", err)
+	}
+}
+
+func readPersisted(path string, v any) error {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, v)
+}
+
+// Writes to a temporary file that replaces the old one, so a crash never leaves a partial file behind
+func writePersisted(path string, v any) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := json.NewEncoder(file).Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/finder"
+	"errors"
+	"testing"
+	"time"
+)
+
+type unreachableFinder struct{}
+
+func (unreachableFinder) FindAllEvents(finder.FindEventRequest) ([]data.EventDetails, error) {
+	return nil, errors.New("unreachable")
+}
+
+type stubRanker struct{}
+
+func (stubRanker) Rank(event data.EventDetails) data.EventRank {
+	return data.EventRank{Event: event, Rank: 0.5}
+}
+
+func TestPersistedUpcomingEvents(t *testing.T) {
+	dir := t.TempDir()
+	loc := Location{City: "Nashville", StateCode: "TN"}
+	first := NewUpcomingEventCache()
+	first.Finder = stubFinder{}
+	first.Ranker = stubRanker{}
+	if err := first.PersistIn(dir); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := first.LoadRecommendations(loc); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	restarted := NewUpcomingEventCache()
+	restarted.Finder = unreachableFinder{}
+	restarted.Ranker = stubRanker{}
+	if err := restarted.PersistIn(dir); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if restoredLoc := restarted.locations[loc.key()]; restoredLoc != loc {
+		t.Errorf("Location should be restored, expected: %v, actual: %v", loc, restoredLoc)
+	}
+	events := restarted.GetUpcomingEvents(loc)
+	if len(events) != 1 || !events[0].Event.Equals(testEvent) {
+		t.Errorf("Persisted upcoming events should be loaded, actual: %+v", events)
+	}
+	recs := restarted.GetRecommendedEvents(loc, LowThreshold)
+	if len(recs) != 1 || recs[0].Rank != 0.5 {
+		t.Errorf("Persisted recommendations should be loaded, actual: %+v", recs)
+	}
+	if !first.upcomingEvents[loc.key()].lastLoaded.Equal(restarted.upcomingEvents[loc.key()].lastLoaded) {
+		t.Error("Persisted events should keep when they were loaded")
+	}
+}
+
+func TestExpiredPersistedEventsServedOffline(t *testing.T) {
+	dir := t.TempDir()
+	first := NewUpcomingEventCache()
+	if err := first.PersistIn(dir); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	loc := DefaultLocation()
+	key := loc.key()
+	first.upcomingEvents[key] = upcomingEventsData{
+		events:     []data.EventDetails{{Event: testEvent}},
+		lastLoaded: time.Now().Add(-2 * upcomingEventTTL),
+	}
+	first.locations[key] = loc
+	first.persistUpcoming()
+
+	restarted := NewUpcomingEventCache()
+	restarted.Finder = unreachableFinder{}
+	if err := restarted.PersistIn(dir); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := restarted.RefreshUpcomingEvents(loc); err == nil {
+		t.Fatal("expected an error")
+	}
+	if events := restarted.GetUpcomingEvents(loc); len(events) != 1 {
+		t.Errorf("Expired events should still be served when they can't be refreshed, actual: %+v", events)
+	}
+}
+
+func TestLocationsCachedSeparately(t *testing.T) {
+	cache := NewUpcomingEventCache()
+	cache.Finder = locationFinder{}
+	nashville := Location{City: "Nashville", StateCode: "TN"}
+
+	atlantaEvents := cache.GetUpcomingEvents(DefaultLocation())
+	nashvilleEvents := cache.GetUpcomingEvents(nashville)
+	if len(atlantaEvents) != 1 || atlantaEvents[0].Event.Venue.City != "Atlanta" {
+		t.Errorf("Expected the events of Atlanta, actual: %+v", atlantaEvents)
+	}
+	if len(nashvilleEvents) != 1 || nashvilleEvents[0].Event.Venue.City != "Nashville" {
+		t.Errorf("Expected the events of Nashville, actual: %+v", nashvilleEvents)
+	}
+
+	cache.Invalidate(nashville)
+	if _, ok := cache.upcomingEvents[DefaultLocation().key()]; !ok {
+		t.Error("Invalidating a location should keep the others")
+	}
+	if _, ok := cache.upcomingEvents[nashville.key()]; ok {
+		t.Error("Invalidated location should be dropped")
+	}
+}
+
+// Finds a single event at a venue in the requested city
+type locationFinder struct{}
+
+func (locationFinder) FindAllEvents(request finder.FindEventRequest) ([]data.EventDetails, error) {
+	event := data.Event{MainAct: data.Artist{Name: "Artist"}, Venue: data.Venue{Name: "Venue", City: request.City, State: request.State}}
+	return []data.EventDetails{{Event: event}}, nil
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Holds a SavedEventCache for every user, loading each one from the database the first time it's needed
+type UserCaches struct {
+	Database Database
+	mutex    sync.Mutex
+	caches   map[string]*SavedEventCache
+}
+
+func (u *UserCaches) For(user string) (*SavedEventCache, error) {
+	if user == "" {
+		user = db.DefaultUser
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if cache, ok := u.caches[user]; ok {
+		return cache, nil
+	}
+
+	cache := &SavedEventCache{Database: u.Database, User: user, catalogChanged: u.refreshCatalogs}
+	if err := cache.load(); err != nil {
+		log.Errorf("Failed to load saved event cache for user %v, %v", user, err)
+		return nil, err
+	}
+	if u.caches == nil {
+		u.caches = make(map[string]*SavedEventCache)
+	}
+	u.caches[user] = cache
+	return cache, nil
+}
+
+// Adds the events for the user of the context
+func (u *UserCaches) AddSavedEvents(ctx context.Context, events []data.Event) ([]data.Event, error) {
+	cache, err := u.For(db.User(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return cache.AddSavedEvents(ctx, events)
+}
+
+// Artists and venues can be shared between users, so a change made by one user reloads them for the others.
+// Their events are reloaded too, since a merge can reassign them
+func (u *UserCaches) refreshCatalogs(changedBy string) {
+	u.mutex.Lock()
+	others := []*SavedEventCache{}
+	for user, cache := range u.caches {
+		if user != changedBy {
+			others = append(others, cache)
+		}
+	}
+	u.mutex.Unlock()
+
+	for _, cache := range others {
+		if err := cache.RefreshArtists(); err != nil {
+			log.Errorf("Failed to refresh artists for user %v, %v", cache.User, err)
+		}
+		if err := cache.RefreshVenues(); err != nil {
+			log.Errorf("Failed to refresh venues for user %v, %v", cache.User, err)
+		}
+		if err := cache.RefreshSavedEvents(); err != nil {
+			log.Errorf("Failed to refresh saved events for user %v, %v", cache.User, err)
+		}
+	}
+}
+
+// Reloads every cache that was loaded so far, after changes made outside of the caches
+func (u *UserCaches) RefreshAll() error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for user, cache := range u.caches {
+		if err := cache.load(); err != nil {
+			return fmt.Errorf("failed to refresh cache for user %s, %w", user, err)
+		}
+	}
+	return nil
+}
+
+// Archives the passed events of every user whose cache was loaded so far
+func (u *UserCaches) ArchivePassedEvents(ctx context.Context, before time.Time) (int, error) {
+	u.mutex.Lock()
+	caches := []*SavedEventCache{}
+	for _, cache := range u.caches {
+		caches = append(caches, cache)
+	}
+	u.mutex.Unlock()
+
+	archived := 0
+	for _, cache := range caches {
+		count, err := cache.ArchivePassedEvents(ctx, before)
+		if err != nil {
+			return archived, fmt.Errorf("failed to archive passed events for user %s, %w", cache.User, err)
+		}
+		archived += count
+	}
+	return archived, nil
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestUserCaches() *UserCaches {
+	conn := memory.Setup()
+	return &UserCaches{Database: &db.DatabaseRepository{
+		VenueRepo:  &memory.VenueRepo{Connection: conn},
+		ArtistRepo: &memory.ArtistRepo{Connection: conn},
+		EventRepo:  &memory.EventRepo{Connection: conn},
+		Transactor: conn,
+	}}
+}
+
+func mustCacheFor(t *testing.T, caches *UserCaches, user string) *SavedEventCache {
+	t.Helper()
+	cache, err := caches.For(user)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return cache
+}
+
+func TestUserCachesSeparateEvents(t *testing.T) {
+	caches := newTestUserCaches()
+	alice := mustCacheFor(t, caches, "alice")
+	bob := mustCacheFor(t, caches, "bob")
+
+	saved, err := alice.AddSavedEvent(context.Background(), testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if saved.UserId != "alice" {
+		t.Errorf("Incorrect event owner, expected: %v, actual: %v", "alice", saved.UserId)
+	}
+	if events := bob.GetSavedEvents(); len(events) != 0 {
+		t.Errorf("Events of another user should not be cached: %v", events)
+	}
+	if len(bob.GetArtists()) != 2 || len(bob.GetVenues()) != 1 {
+		t.Errorf("Shared artists and venues should be cached for every user, artists: %v, venues: %v",
+			bob.GetArtists(), bob.GetVenues())
+	}
+	if mustCacheFor(t, caches, "alice") != alice {
+		t.Error("The cache of a user should only be loaded once")
+	}
+}
+
+func TestUserCachesAddForContextUser(t *testing.T) {
+	caches := newTestUserCaches()
+	ctx := db.WithUser(context.Background(), "alice")
+	if _, err := caches.AddSavedEvents(ctx, []data.Event{testEvent}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := mustCacheFor(t, caches, "alice").GetSavedEvents(); len(events) != 1 {
+		t.Errorf("Events should be added for the user of the context: %v", events)
+	}
+	if events := mustCacheFor(t, caches, db.DefaultUser).GetSavedEvents(); len(events) != 0 {
+		t.Errorf("Events should not be added for the default user: %v", events)
+	}
+}
+
+func TestDeleteSharedArtistReferencedByOtherUser(t *testing.T) {
+	caches := newTestUserCaches()
+	alice := mustCacheFor(t, caches, "alice")
+	bob := mustCacheFor(t, caches, "bob")
+	saved, err := alice.AddSavedEvent(context.Background(), testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	opts := DeleteOptions{Mode: DeleteCascade}
+	err = bob.DeleteArtist(context.Background(), saved.MainAct.Id, opts)
+	var refErr *ReferenceError
+	if !errors.As(err, &refErr) || refErr.OtherUsers != 1 || len(refErr.Events) != 0 {
+		t.Errorf("Expected a reference error counting the event of the other user, actual: %v", err)
+	}
+	if err := alice.DeleteArtist(context.Background(), saved.MainAct.Id, opts); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(bob.GetArtists()) != 1 {
+		t.Errorf("Deleted artist should be removed from the caches of other users: %v", bob.GetArtists())
+	}
+}
+
+func TestMergeArtistsReassignsOtherUsers(t *testing.T) {
+	caches := newTestUserCaches()
+	alice := mustCacheFor(t, caches, "alice")
+	bob := mustCacheFor(t, caches, "bob")
+	saved, err := alice.AddSavedEvent(context.Background(), testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	duplicate, err := bob.AddArtist(context.Background(), data.Artist{Name: "Khruangbín", Genre: "Psychedelic"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// bob can't see the event of alice, but merging the shared artist carries it along
+	if err := bob.MergeArtists(context.Background(), duplicate.Id, []string{saved.MainAct.Id}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	events := alice.GetSavedEvents()
+	if len(events) != 1 || events[0].MainAct.Id != duplicate.Id {
+		t.Errorf("Event of the other user should be moved to the surviving artist, actual: %v", events)
+	}
+	for _, artist := range alice.GetArtists() {
+		if artist.Id == saved.MainAct.Id {
+			t.Error("Merged artist should be removed from the caches of other users")
+		}
+	}
+}
+
+func TestMergeIntoPrivateArtistBlockedByOtherUsers(t *testing.T) {
+	caches := newTestUserCaches()
+	alice := mustCacheFor(t, caches, "alice")
+	bob := mustCacheFor(t, caches, "bob")
+	saved, err := alice.AddSavedEvent(context.Background(), testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	private, err := bob.AddArtist(context.Background(), data.Artist{Name: "Khruangbín", Genre: "Psychedelic", UserId: "bob"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = bob.MergeArtists(context.Background(), private.Id, []string{saved.MainAct.Id})
+	var refErr *ReferenceError
+	if !errors.As(err, &refErr) || refErr.OtherUsers != 1 {
+		t.Errorf("Events of other users can't be moved to a private artist, actual: %v", err)
+	}
+}
@@ -1,25 +1,45 @@
 package data
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type (
+	// Version counts the stored revisions of a record, starting at 1, and is bumped by every update.
+	// Updates made with an older version are rejected, while version 0 always overwrites.
+	// DeletedAt is only set on records in the trash. UserId is the owner of the record, which is
+	// empty for artists and venues shared by every user. It's assigned by the database, never by clients.
+	// ArchivedAt is set on passed events that were archived, which stay saved as history
 	Venue struct {
-		Name  string `json:"name"`
-		City  string `json:"city"`
-		State string `json:"state"`
-		Id    string `json:"id"`
+		Name      string     `json:"name"`
+		City      string     `json:"city"`
+		State     string     `json:"state"`
+		Id        string     `json:"id"`
+		Version   int        `json:"version"`
+		DeletedAt *time.Time `json:"deletedAt,omitempty"`
+		UserId    string     `json:"userId,omitempty"`
 	}
 	Artist struct {
-		Name  string `json:"name"`
-		Genre string `json:"genre"`
-		Id    string `json:"id"`
+		Name      string     `json:"name"`
+		Genre     string     `json:"genre"`
+		Id        string     `json:"id"`
+		Version   int        `json:"version"`
+		DeletedAt *time.Time `json:"deletedAt,omitempty"`
+		UserId    string     `json:"userId,omitempty"`
 	}
 	Event struct {
-		MainAct   Artist   `json:"mainAct"`
-		Openers   []Artist `json:"openers"`
-		Venue     Venue    `json:"venue"`
-		Date      string   `json:"date"`
-		Purchased bool     `json:"purchased"`
-		Id        string   `json:"id"`
-		TmId      string   `json:"tmId"`
+		MainAct    Artist     `json:"mainAct"`
+		Openers    []Artist   `json:"openers"`
+		Venue      Venue      `json:"venue"`
+		Date       string     `json:"date"`
+		Purchased  bool       `json:"purchased"`
+		Id         string     `json:"id"`
+		TmId       string     `json:"tmId"`
+		Version    int        `json:"version"`
+		DeletedAt  *time.Time `json:"deletedAt,omitempty"`
+		UserId     string     `json:"userId,omitempty"`
+		ArchivedAt *time.Time `json:"archivedAt,omitempty"`
 	}
 	EventDetails struct {
 		Name       string `json:"name"`
@@ -37,6 +57,47 @@ type (
 		Rank    float64  `json:"rank"`
 		Related []string `json:"related"`
 	}
+	// Filters for finding saved events, where empty fields match everything. The dates are
+	// inclusive and ArtistId matches both main acts and openers. Limit 0 returns a single page
+	EventQuery struct {
+		From      string
+		To        string
+		Purchased *bool
+		VenueId   string
+		ArtistId  string
+		Cursor    string
+		Limit     int
+	}
+	// Events are ordered by date. NextCursor is empty on the last page
+	EventPage struct {
+		Events     []Event `json:"events"`
+		NextCursor string  `json:"nextCursor"`
+	}
+	// Deleted records waiting to be restored or purged
+	Trash struct {
+		Venues  []Venue  `json:"venues"`
+		Artists []Artist `json:"artists"`
+		Events  []Event  `json:"events"`
+	}
+	// A single change to a stored record. Before is empty for created records and After for purged ones,
+	// otherwise they hold the JSON of the record on either side of the change
+	AuditEntry struct {
+		Id        string          `json:"id"`
+		Entity    string          `json:"entity"`
+		EntityId  string          `json:"entityId"`
+		Action    string          `json:"action"`
+		Actor     string          `json:"actor"`
+		Timestamp time.Time       `json:"timestamp"`
+		Before    json.RawMessage `json:"before,omitempty"`
+		After     json.RawMessage `json:"after,omitempty"`
+	}
+	// A stored record that couldn't be read back as valid data
+	IntegrityIssue struct {
+		Entity     string   `json:"entity"`
+		Id         string   `json:"id"`
+		Problems   []string `json:"problems"`
+		Repairable bool     `json:"repairable"`
+	}
 )
 
 func (v *Venue) Populated() bool {
@@ -61,6 +122,24 @@ func (e *Event) Populated() bool {
 	return populated && !invalidArtist && e.Venue.Populated() && e.Date != ""
 }
 
+// Describes the artists and venue of the event that are in the trash, which
+// have to be restored before the event itself can be
+func (e *Event) TrashedReferences() []string {
+	trashed := []string{}
+	if e.MainAct.DeletedAt != nil {
+		trashed = append(trashed, "main act "+e.MainAct.Id)
+	}
+	for _, opener := range e.Openers {
+		if opener.DeletedAt != nil {
+			trashed = append(trashed, "opener "+opener.Id)
+		}
+	}
+	if e.Venue.DeletedAt != nil {
+		trashed = append(trashed, "venue "+e.Venue.Id)
+	}
+	return trashed
+}
+
 func (e Event) Equals(o Event) bool {
 	return e.MainAct.Equals(o.MainAct) && e.Venue.Equals(o.Venue) && e.Date == o.Date
 }
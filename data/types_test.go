@@ -2,7 +2,6 @@ package data
 
 import (
 	"testing"
-	"time"
 )
 
 func TestVenuePopulatedValid(t *testing.T) {
@@ -36,7 +35,7 @@ func TestArtistPopulatedInvalid(t *testing.T) {
 func TestEventPopulatedValidOnlyMainAct(t *testing.T) {
     v := Venue{Name: "name", City: "city", State: "state"}
 	a := Artist{Name: "Name", Genre: "Genre"}
-	e := Event{MainAct: a, Venue: v, Date: time.Now()}
+	e := Event{MainAct: a, Venue: v, Date: "6/14/2023"}
 	if !e.Populated() {
 		t.Error("populated event marked as not populated")
 	}
@@ -45,7 +44,7 @@ func TestEventPopulatedValidOnlyMainAct(t *testing.T) {
 func TestEventPopulatedValidNoMainAct(t *testing.T) {
     v := Venue{Name: "name", City: "city", State: "state"}
 	a := Artist{Name: "Name", Genre: "Genre"}
-	e := Event{Openers: []Artist{a}, Venue: v, Date: time.Now()}
+	e := Event{Openers: []Artist{a}, Venue: v, Date: "6/14/2023"}
 	if !e.Populated() {
 		t.Error("populated event marked as not populated")
 	}
@@ -53,7 +52,7 @@ func TestEventPopulatedValidNoMainAct(t *testing.T) {
 
 func TestEventPopulatedInvalidNoArtists(t *testing.T) {
     v := Venue{Name: "name", City: "city", State: "state"}
-	e := Event{Venue: v, Date: time.Now()}
+	e := Event{Venue: v, Date: "6/14/2023"}
 	if e.Populated() {
 		t.Error("event with no artists marked as populated")
 	}
@@ -62,7 +61,7 @@ func TestEventPopulatedInvalidNoArtists(t *testing.T) {
 func TestEventPopulatedInvalidArtist(t *testing.T) {
     v := Venue{Name: "name", City: "city", State: "state"}
 	a := Artist{Genre: "Genre"}
-	e := Event{Openers: []Artist{a}, Venue: v, Date: time.Now()}
+	e := Event{Openers: []Artist{a}, Venue: v, Date: "6/14/2023"}
 	if e.Populated() {
 		t.Error("event with invalid artist marked as populated")
 	}
@@ -71,7 +70,7 @@ func TestEventPopulatedInvalidArtist(t *testing.T) {
 func TestEventPopulatedInvalidVenue(t *testing.T) {
     v := Venue{City: "city", State: "state"}
 	a := Artist{Name: "Name", Genre: "Genre"}
-	e := Event{Openers: []Artist{a}, Venue: v, Date: time.Now()}
+	e := Event{Openers: []Artist{a}, Venue: v, Date: "6/14/2023"}
 	if e.Populated() {
 		t.Error("event with invalid artist marked as populated")
 	}
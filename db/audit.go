@@ -0,0 +1,105 @@
+package db
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Actors for changes that don't come from an HTTP client
+const (
+	ActorTUI     = "tui"
+	ActorCLI     = "cli"
+	ActorSystem  = "system"
+	unknownActor = "unknown"
+)
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+	AuditRepair  = "repair"
+)
+
+type actorKey struct{}
+
+// Records who is making the changes with the context, so the audit log can attribute them
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return unknownActor
+}
+
+// The record a change was made to, along with its state on either side of the change.
+// Nothing is recorded for skipped changes, like adding a record that already existed
+type auditChange struct {
+	id     string
+	before any
+	after  any
+	skip   bool
+}
+
+// Makes the change and records it in the same transaction, so the log never disagrees with the data
+func (r *DatabaseRepository) audit(ctx context.Context, entity string, action string,
+	change func(context.Context) (auditChange, error)) error {
+	if r.AuditRepo == nil {
+		_, err := change(ctx)
+		return err
+	}
+
+	record := func(ctx context.Context) error {
+		c, err := change(ctx)
+		if err != nil || c.skip {
+			return err
+		}
+		entry := data.AuditEntry{
+			Entity:    entity,
+			EntityId:  c.id,
+			Action:    action,
+			Actor:     Actor(ctx),
+			Timestamp: time.Now().UTC(),
+		}
+		if entry.Before, err = snapshot(c.before); err != nil {
+			return err
+		}
+		if entry.After, err = snapshot(c.after); err != nil {
+			return err
+		}
+		return r.AuditRepo.Add(ctx, entry)
+	}
+	if r.Transactor == nil {
+		return record(ctx)
+	}
+	return r.Transactor.RunTransaction(ctx, record)
+}
+
+func snapshot(record any) (json.RawMessage, error) {
+	if record == nil {
+		return nil, nil
+	}
+	return json.Marshal(record)
+}
+
+// Entries are ordered from oldest to newest, an empty id lists the changes to every record of the entity
+func (r *DatabaseRepository) ListAuditEntries(ctx context.Context, entity string, id string) ([]data.AuditEntry, error) {
+	log.Debug("Request to list audit entries", entity, id)
+	if r.AuditRepo == nil {
+		log.Debug("No audit log configured, returning no entries")
+		return []data.AuditEntry{}, nil
+	}
+	entries, err := r.AuditRepo.Find(ctx, entity, id)
+	if err != nil {
+		log.Errorf("Error while listing audit entries for %s %v, %v\n", entity, id, err)
+		return nil, err
+	}
+	return entries, nil
+}
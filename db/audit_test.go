@@ -0,0 +1,84 @@
+package db
+
+import (
+	"concert-manager/data"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type auditRepo struct {
+	entries []data.AuditEntry
+}
+
+func (r *auditRepo) Add(_ context.Context, entry data.AuditEntry) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *auditRepo) Find(context.Context, string, string) ([]data.AuditEntry, error) {
+	return r.entries, nil
+}
+
+type venueRepoUpdateErr struct{ venueRepo }
+
+func (venueRepoUpdateErr) Update(context.Context, string, data.Venue) error {
+	return errors.New("failed to update venue")
+}
+
+func TestUpdateVenueAudited(t *testing.T) {
+	audit := &auditRepo{}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, AuditRepo: audit}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
+
+	ctx := WithActor(context.Background(), "http 127.0.0.1")
+	if err := interactor.UpdateVenue(ctx, "id", venue); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(audit.entries) != 1 {
+		t.Fatalf("Expected one audit entry, actual: %+v", audit.entries)
+	}
+	entry := audit.entries[0]
+	if entry.Entity != "venue" || entry.EntityId != "id" || entry.Action != AuditUpdate || entry.Actor != "http 127.0.0.1" {
+		t.Errorf("Incorrect audit entry: %+v", entry)
+	}
+	var before, after data.Venue
+	if err := json.Unmarshal(entry.Before, &before); err != nil || before.Version != 1 {
+		t.Errorf("Incorrect before snapshot %s, err: %v", entry.Before, err)
+	}
+	if err := json.Unmarshal(entry.After, &after); err != nil || after.Name != "name" || after.Version != 2 {
+		t.Errorf("Incorrect after snapshot %s, err: %v", entry.After, err)
+	}
+}
+
+func TestUpdateVenueFailedNotAudited(t *testing.T) {
+	audit := &auditRepo{}
+	interactor := &DatabaseRepository{VenueRepo: venueRepoUpdateErr{}, AuditRepo: audit}
+
+	if err := interactor.UpdateVenue(context.Background(), "id", data.Venue{Name: "name"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(audit.entries) != 0 {
+		t.Errorf("Failed update should not be audited: %+v", audit.entries)
+	}
+}
+
+func TestAddExistingVenueNotAudited(t *testing.T) {
+	audit := &auditRepo{}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, AuditRepo: audit}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
+
+	if _, err := interactor.AddVenue(context.Background(), venue); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(audit.entries) != 0 {
+		t.Errorf("Adding an existing venue should not be audited: %+v", audit.entries)
+	}
+}
+
+func TestActorDefault(t *testing.T) {
+	if actor := Actor(context.Background()); actor != unknownActor {
+		t.Errorf("Expected %v, actual: %v", unknownActor, actor)
+	}
+}
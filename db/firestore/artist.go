@@ -2,61 +2,86 @@ package firestore
 
 import (
 	"concert-manager/data"
+	"concert-manager/db"
 	"concert-manager/log"
 	"context"
+	"fmt"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
 )
 
 const artistCollection string = "artists"
-var artistFields = []string{"Name", "Genre"}
+var artistFields = []string{"Name", "Genre", "Version", "DeletedAt", "UserId"}
 
 type ArtistRepo struct {
 	Connection *Firestore
 }
 
 type ArtistEntity struct {
-	Name  string
-	Genre string
+	Name      string
+	Genre     string
+	Version   int
+	DeletedAt *time.Time
+	UserId    string
 }
 
 type Artist = data.Artist
 
+func (e ArtistEntity) updates() []firestore.Update {
+	return []firestore.Update{
+		{Path: "Name", Value: e.Name},
+		{Path: "Genre", Value: e.Genre},
+		{Path: "Version", Value: e.Version},
+	}
+}
+
 func (repo *ArtistRepo) Add(ctx context.Context, artist Artist) (string, error) {
 	log.Debug("Attempting to add artist", artist)
-	existingArtist, err := repo.findDocRef(ctx, artist.Name)
+	user := db.User(ctx)
+	existingArtist, err := repo.findDocRef(ctx, user, artist.Name)
 	if err == nil {
-		log.Debugf("Skipping adding artist because it already exists %+v, %v", artist, existingArtist.Ref.ID)
-		return existingArtist.Ref.ID, nil
+		log.Debugf("Skipping adding artist because it already exists %+v, %v", artist, existingArtist.ID)
+		return existingArtist.ID, nil
 	}
 	if err != iterator.Done {
 		log.Errorf("Error occurred while checking if artist %v already exists, %v", artist, err)
 		return "", err
 	}
 
-	artistEntity := ArtistEntity{artist.Name, artist.Genre}
-	artists := repo.Connection.Client.Collection(artistCollection)
-	docRef, _, err := artists.Add(ctx, artistEntity)
+	artistEntity := ArtistEntity{artist.Name, artist.Genre, 1, nil, user}
+	if artist.UserId == db.SharedOwner {
+		artistEntity.UserId = db.SharedOwner
+	}
+	docRef, err := repo.Connection.create(ctx, artistCollection, artistEntity)
 	if err != nil {
 		log.Errorf("Failed to add new artist %+v, %v", artist, err)
 		return "", err
 	}
+	if uow := getUnitOfWork(ctx); uow != nil {
+		uow.artists[artistKey{artistEntity.UserId, artist.Name}] = docRef
+	}
 	log.Infof("Created new artist %+v", docRef.ID)
 	return docRef.ID, nil
 }
 
 func (repo *ArtistRepo) Update(ctx context.Context, id string, artist Artist) error {
     log.Debug("Attempting to update artist", id, artist)
-	docId := repo.Connection.Client.Collection(artistCollection).Doc(id)
-	artistDoc, err := docId.Get(ctx)
+	artistDoc, err := repo.Connection.getLive(ctx, artistCollection, "artist", id)
 	if err != nil {
 		log.Errorf("Failed to find existing artist while updating %+v, %v", id, err)
 		return err
 	}
 
-	artistEntity := ArtistEntity{artist.Name, artist.Genre}
-	_, err = artistDoc.Ref.Set(ctx, artistEntity)
+	current := storedVersion(artistDoc)
+	if err := db.CheckVersion("artist", id, artist.Version, current); err != nil {
+		log.Errorf("Failed to update artist %v, %v", id, err)
+		return err
+	}
+
+	artistEntity := ArtistEntity{artist.Name, artist.Genre, current + 1, nil, owner(artistDoc)}
+	err = repo.Connection.replace(ctx, artistDoc, artistEntity.updates())
 	if err != nil {
 		log.Errorf("Failed to update artist %+v to %v, %v", id, artist, err)
 		return err
@@ -67,13 +92,12 @@ func (repo *ArtistRepo) Update(ctx context.Context, id string, artist Artist) er
 
 func (repo *ArtistRepo) Delete(ctx context.Context, id string) error {
 	log.Debug("Attempting to delete artist", id)
-	docId := repo.Connection.Client.Collection(artistCollection).Doc(id)
-	artistDoc, err := docId.Get(ctx)
+	artistDoc, err := repo.Connection.getLive(ctx, artistCollection, "artist", id)
 	if err != nil {
 		log.Errorf("Failed to find existing artist while deleting %+v, %v", id, err)
 		return err
 	}
-	_, err = artistDoc.Ref.Delete(ctx)
+	err = repo.Connection.trash(ctx, artistDoc)
 	if err != nil {
 		log.Error("Failed to delete artist", id, err)
 		return err
@@ -82,9 +106,52 @@ func (repo *ArtistRepo) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+func (repo *ArtistRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore artist", id)
+	artistDoc, err := repo.Connection.getDeleted(ctx, artistCollection, "artist", id)
+	if err != nil {
+		log.Errorf("Failed to find deleted artist while restoring %+v, %v", id, err)
+		return err
+	}
+	artist := toArtist(artistDoc)
+	existing, err := repo.findDocRef(ctx, artist.UserId, artist.Name)
+	if err == nil {
+		log.Errorf("Failed to restore artist %v, artist %v has the same name", id, existing.ID)
+		return fmt.Errorf("artist %s already exists with the same name", existing.ID)
+	}
+	if err != iterator.Done {
+		log.Errorf("Error occurred while checking for conflicting artists when restoring %v, %v", id, err)
+		return err
+	}
+
+	err = repo.Connection.restore(ctx, artistDoc)
+	if err != nil {
+		log.Error("Failed to restore artist", id, err)
+		return err
+	}
+	log.Infof("Successfully restored artist %+v", id)
+	return nil
+}
+
+func (repo *ArtistRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge artist", id)
+	artistDoc, err := repo.Connection.getDeleted(ctx, artistCollection, "artist", id)
+	if err != nil {
+		log.Errorf("Failed to find deleted artist while purging %+v, %v", id, err)
+		return err
+	}
+	err = repo.Connection.delete(ctx, artistDoc.Ref)
+	if err != nil {
+		log.Error("Failed to purge artist", id, err)
+		return err
+	}
+	log.Infof("Successfully purged artist %+v", id)
+	return nil
+}
+
 func (repo *ArtistRepo) Exists(ctx context.Context, artist Artist) (bool, error) {
 	log.Debug("Checking for existence of artist", artist)
-	doc, err := repo.findDocRef(ctx, artist.Name)
+	doc, err := repo.findDocRef(ctx, db.User(ctx), artist.Name)
 	if err == iterator.Done {
 		log.Debug("No existing artist found for", artist)
 		return false, nil
@@ -93,10 +160,24 @@ func (repo *ArtistRepo) Exists(ctx context.Context, artist Artist) (bool, error)
 		log.Errorf("Error while checking existence of artist %v, %v", artist, err)
 		return false, err
 	}
-	log.Debugf("Found artist %v with document ID %v", artist, doc.Ref.ID)
+	log.Debugf("Found artist %v with document ID %v", artist, doc.ID)
 	return true, nil
 }
 
+// also finds artists in the trash
+func (repo *ArtistRepo) FindById(ctx context.Context, id string) (Artist, error) {
+	log.Debug("Finding artist", id)
+	doc, err := repo.Connection.get(ctx, repo.Connection.Client.Collection(artistCollection).Doc(id))
+	if err != nil {
+		log.Errorf("Error while finding artist %v, %v", id, err)
+		return Artist{}, err
+	}
+	if !accessible(ctx, doc) {
+		return Artist{}, fmt.Errorf("artist %s not found", id)
+	}
+	return toArtist(doc), nil
+}
+
 func (repo *ArtistRepo) FindAll(ctx context.Context) ([]Artist, error) {
 	log.Debug("Finding all artists")
 	artistDocs, err := repo.Connection.Client.Collection(artistCollection).
@@ -109,32 +190,66 @@ func (repo *ArtistRepo) FindAll(ctx context.Context) ([]Artist, error) {
 	}
 
 	artists := []Artist{}
-	for _, a := range artistDocs {
-		artists = append(artists, toArtist(a))
+	for _, a := range toDocuments(artistDocs) {
+		if deletedAt(a) == nil && accessible(ctx, a) {
+			artists = append(artists, toArtist(a))
+		}
 	}
 	log.Debugf("Found %d artists", len(artists))
 	return artists, nil
 }
 
-func toArtist(doc *firestore.DocumentSnapshot) Artist {
+func (repo *ArtistRepo) FindDeleted(ctx context.Context) ([]Artist, error) {
+	log.Debug("Finding all deleted artists")
+	artistDocs, err := repo.Connection.Client.Collection(artistCollection).
+		Where("DeletedAt", "!=", nil).
+		Select(artistFields...).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Error("Error while finding all deleted artists,", err)
+		return nil, err
+	}
+
+	artists := []Artist{}
+	for _, doc := range toDocuments(artistDocs) {
+		if accessible(ctx, doc) {
+			artists = append(artists, toArtist(doc))
+		}
+	}
+	log.Debugf("Found %d deleted artists", len(artists))
+	return artists, nil
+}
+
+func toArtist(doc *document) Artist {
     artistData := doc.Data()
 	return Artist{
-		Name:  artistData["Name"].(string),
-		Genre: artistData["Genre"].(string),
-		Id:    doc.Ref.ID,
+		Name:    artistData["Name"].(string),
+		Genre:   artistData["Genre"].(string),
+		Id:      doc.Ref.ID,
+		Version:   storedVersion(doc),
+		DeletedAt: deletedAt(doc),
+		UserId:    owner(doc),
 	}
 }
 
-func (repo *ArtistRepo) findDocRef(ctx context.Context, name string) (*firestore.DocumentSnapshot, error) {
-	artist, err := repo.Connection.Client.Collection(artistCollection).
-		Select().
-		Where("Name", "==", name).
-		Documents(ctx).
-		Next()
+// only finds artists that are shared or belong to the user
+func (repo *ArtistRepo) findDocRef(ctx context.Context, user string, name string) (*firestore.DocumentRef, error) {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		for _, docOwner := range []string{user, db.SharedOwner} {
+			if docRef, ok := uow.artists[artistKey{docOwner, name}]; ok {
+				return docRef, nil
+			}
+		}
+	}
+	query := repo.Connection.Client.Collection(artistCollection).
+		Select("DeletedAt", "UserId").
+		Where("Name", "==", name)
+	artist, err := repo.Connection.findLive(ctx, query, user)
 	if err != nil {
 		return nil, err
 	}
-	return artist, nil
+	return artist.Ref, nil
 }
 
 func (repo *ArtistRepo) findAllDocs(ctx context.Context) (*map[string]Artist, error) {
@@ -147,7 +262,7 @@ func (repo *ArtistRepo) findAllDocs(ctx context.Context) (*map[string]Artist, er
 	}
 
 	artists := make(map[string]Artist)
-	for _, a := range artistDocs {
+	for _, a := range toDocuments(artistDocs) {
 		artists[a.Ref.ID] = toArtist(a)
 	}
 
@@ -0,0 +1,78 @@
+package firestore
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const auditCollection = "audit"
+
+type AuditRepo struct {
+	Connection *Firestore
+}
+
+// Snapshots are stored as JSON strings, so they keep the shape of the API types
+type AuditEntity struct {
+	Entity    string
+	EntityId  string
+	Action    string
+	Actor     string
+	Timestamp time.Time
+	Before    string
+	After     string
+}
+
+// Staged with the change it records when running in a transaction
+func (repo *AuditRepo) Add(ctx context.Context, entry data.AuditEntry) error {
+	log.Debugf("Recording %s of %s %v", entry.Action, entry.Entity, entry.EntityId)
+	entity := AuditEntity{entry.Entity, entry.EntityId, entry.Action, entry.Actor, entry.Timestamp,
+		string(entry.Before), string(entry.After)}
+	if _, err := repo.Connection.create(ctx, auditCollection, entity); err != nil {
+		log.Errorf("Failed to record %s of %s %v, %v", entry.Action, entry.Entity, entry.EntityId, err)
+		return err
+	}
+	return nil
+}
+
+// Filtering on both fields and ordering by time needs the audit indexes in firestore.indexes.json
+func (repo *AuditRepo) Find(ctx context.Context, entity string, id string) ([]data.AuditEntry, error) {
+	log.Debug("Finding audit entries", entity, id)
+	q := repo.Connection.Client.Collection(auditCollection).Where("Entity", "==", entity)
+	if id != "" {
+		q = q.Where("EntityId", "==", id)
+	}
+	docs, err := q.OrderBy("Timestamp", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		log.Error("Error while finding audit entries,", err)
+		return nil, err
+	}
+
+	entries := []data.AuditEntry{}
+	for _, doc := range docs {
+		var stored AuditEntity
+		if err := doc.DataTo(&stored); err != nil {
+			log.Errorf("Skipping unreadable audit entry %v, %v", doc.Ref.ID, err)
+			continue
+		}
+		entry := data.AuditEntry{
+			Id:        doc.Ref.ID,
+			Entity:    stored.Entity,
+			EntityId:  stored.EntityId,
+			Action:    stored.Action,
+			Actor:     stored.Actor,
+			Timestamp: stored.Timestamp,
+		}
+		if stored.Before != "" {
+			entry.Before = []byte(stored.Before)
+		}
+		if stored.After != "" {
+			entry.After = []byte(stored.After)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -2,9 +2,12 @@ package firestore
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"concert-manager/data"
+	"concert-manager/db"
 	"concert-manager/log"
 	"concert-manager/util"
 
@@ -14,7 +17,7 @@ import (
 
 const eventCollection string = "events"
 
-var eventFields = []string{"MainActRef", "OpenerRefs", "VenueRef", "Date", "Purchased"}
+var eventFields = []string{"MainActRef", "OpenerRefs", "VenueRef", "Date", "Purchased", "Version", "DeletedAt", "UserId", "ArchivedAt"}
 
 type EventRepo struct {
 	Connection *Firestore
@@ -29,77 +32,152 @@ type EventEntity struct {
 	Date       time.Time
 	Purchased  bool
 	TmId       string
+	// The main act and openers together, since queries can't match either field with array-contains
+	ArtistRefs []*firestore.DocumentRef
+	Version    int
+	DeletedAt  *time.Time
+	UserId     string
+	ArchivedAt *time.Time
 }
 
 type Event = data.Event
 
-func (repo *EventRepo) Add(ctx context.Context, event Event) (string, error) {
-	log.Debug("Attemping to add event", event)
-	var mainActDoc *firestore.DocumentSnapshot
-	var err error
-	if event.MainAct.Populated() {
-		mainActDoc, err = repo.ArtistRepo.findDocRef(ctx, event.MainAct.Name)
-		if err != nil {
-			log.Errorf("Failed to find existing artist %v while creating event %v", event.MainAct.Name, event)
-			return "", err
-		}
-		log.Debugf("Found existing artist %v with document ID %v while adding event",
-			event.MainAct.Name, mainActDoc.Ref.ID)
-	}
-	var mainActRef *firestore.DocumentRef
-	if mainActDoc != nil {
-		mainActRef = mainActDoc.Ref
-	}
-
-	openerRefs := []*firestore.DocumentRef{}
-	for _, opener := range event.Openers {
-		openerDoc, err := repo.ArtistRepo.findDocRef(ctx, opener.Name)
-		if err != nil {
-			log.Errorf("Failed to find existing opening artist %v while creating event %v", opener.Name, event)
-			return "", err
-		}
-		log.Debugf("Found existing artist %v with document ID %v while adding event",
-			opener.Name, openerDoc.Ref.ID)
-		openerRefs = append(openerRefs, openerDoc.Ref)
+func (e EventEntity) updates() []firestore.Update {
+	return []firestore.Update{
+		{Path: "MainActRef", Value: e.MainActRef},
+		{Path: "OpenerRefs", Value: e.OpenerRefs},
+		{Path: "VenueRef", Value: e.VenueRef},
+		{Path: "Date", Value: e.Date},
+		{Path: "Purchased", Value: e.Purchased},
+		{Path: "TmId", Value: e.TmId},
+		{Path: "ArtistRefs", Value: e.ArtistRefs},
+		{Path: "Version", Value: e.Version},
+		{Path: "ArchivedAt", Value: e.ArchivedAt},
 	}
+}
 
-	venueDoc, err := repo.VenueRepo.findDocRef(ctx, event.Venue.Name, event.Venue.City, event.Venue.State)
+func (repo *EventRepo) Add(ctx context.Context, event Event) (string, error) {
+	log.Debug("Attemping to add event", event)
+	eventEntity, err := repo.toEntity(ctx, db.User(ctx), event)
 	if err != nil {
-		log.Errorf("Failed to find existing venue %+v while creating event", event.Venue)
 		return "", err
 	}
-	log.Debugf("Found existing venue %v with document ID %v while adding event", event.Venue, venueDoc.Ref.ID)
 
-	existingEvent, err := repo.findEventDocRef(ctx, event.Date, venueDoc.Ref)
+	existingEvent, err := repo.findEventDocRef(ctx, eventEntity.UserId, event.Date, eventEntity.VenueRef)
 	if err == nil {
-		log.Debugf("Skipped adding event because it already existed as %+v, %v", event, existingEvent.Ref.ID)
-		return existingEvent.Ref.ID, nil
+		log.Debugf("Skipped adding event because it already existed as %+v, %v", event, existingEvent.ID)
+		return existingEvent.ID, nil
 	}
 	if err != iterator.Done {
 		log.Errorf("Error occurred while checking if artist %v already exists, %v", event, err)
 		return "", err
 	}
 
-	eventEntity := EventEntity{mainActRef, openerRefs, venueDoc.Ref, util.Timestamp(event.Date), event.Purchased, event.TmId}
-	events := repo.Connection.Client.Collection(eventCollection)
-	docRef, _, err := events.Add(ctx, eventEntity)
+	eventEntity.Version = 1
+	docRef, err := repo.Connection.create(ctx, eventCollection, eventEntity)
 	if err != nil {
 		log.Errorf("Failed to add event %+v, %v", event, err)
 		return "", err
 	}
+	if uow := getUnitOfWork(ctx); uow != nil {
+		uow.events[eventKey{eventEntity.UserId, util.Date(eventEntity.Date), eventEntity.VenueRef.ID}] = docRef
+	}
 	log.Infof("Created new event %+v", docRef.ID)
 	return docRef.ID, nil
 }
 
+// Requires that all the artists and the venue already exist
+func (repo *EventRepo) Update(ctx context.Context, id string, event Event) error {
+	log.Debug("Attempting to update event", id, event)
+	eventDoc, err := repo.Connection.getLive(ctx, eventCollection, "event", id)
+	if err != nil {
+		log.Errorf("Failed to find existing event while updating %+v, %v", id, err)
+		return err
+	}
+	current := storedVersion(eventDoc)
+	if err := db.CheckVersion("event", id, event.Version, current); err != nil {
+		log.Errorf("Failed to update event %v, %v", id, err)
+		return err
+	}
+
+	eventEntity, err := repo.toEntity(ctx, owner(eventDoc), event)
+	if err != nil {
+		return err
+	}
+
+	existingEvent, err := repo.findEventDocRef(ctx, eventEntity.UserId, event.Date, eventEntity.VenueRef)
+	if err == nil && existingEvent.ID != id {
+		log.Errorf("Failed to update event %v, another event %v exists for the same date and venue", id, existingEvent.ID)
+		return fmt.Errorf("event %s already exists for the same date and venue", existingEvent.ID)
+	}
+	if err != nil && err != iterator.Done {
+		log.Errorf("Error occurred while checking for conflicting events when updating %v, %v", id, err)
+		return err
+	}
+
+	eventEntity.Version = current + 1
+	err = repo.Connection.replace(ctx, eventDoc, eventEntity.updates())
+	if err != nil {
+		log.Errorf("Failed to update event %+v to %v, %v", id, event, err)
+		return err
+	}
+	log.Info("Successfully updated event", id)
+	return nil
+}
+
+// The references are resolved among the artists and venues the owner can see
+func (repo *EventRepo) toEntity(ctx context.Context, owner string, event Event) (EventEntity, error) {
+	var mainActRef *firestore.DocumentRef
+	var err error
+	if event.MainAct.Populated() {
+		mainActRef, err = repo.ArtistRepo.findDocRef(ctx, owner, event.MainAct.Name)
+		if err != nil {
+			log.Errorf("Failed to find existing artist %v for event %v", event.MainAct.Name, event)
+			return EventEntity{}, err
+		}
+		log.Debugf("Found existing artist %v with document ID %v for event",
+			event.MainAct.Name, mainActRef.ID)
+	}
+
+	openerRefs := []*firestore.DocumentRef{}
+	for _, opener := range event.Openers {
+		openerRef, err := repo.ArtistRepo.findDocRef(ctx, owner, opener.Name)
+		if err != nil {
+			log.Errorf("Failed to find existing opening artist %v for event %v", opener.Name, event)
+			return EventEntity{}, err
+		}
+		log.Debugf("Found existing artist %v with document ID %v for event",
+			opener.Name, openerRef.ID)
+		openerRefs = append(openerRefs, openerRef)
+	}
+
+	venueRef, err := repo.VenueRepo.findDocRef(ctx, owner, event.Venue.Name, event.Venue.City, event.Venue.State)
+	if err != nil {
+		log.Errorf("Failed to find existing venue %+v for event", event.Venue)
+		return EventEntity{}, err
+	}
+	log.Debugf("Found existing venue %v with document ID %v for event", event.Venue, venueRef.ID)
+
+	return EventEntity{mainActRef, openerRefs, venueRef, util.Timestamp(event.Date), event.Purchased, event.TmId,
+		artistRefs(mainActRef, openerRefs), 0, nil, owner, event.ArchivedAt}, nil
+}
+
+func artistRefs(mainActRef *firestore.DocumentRef, openerRefs []*firestore.DocumentRef) []*firestore.DocumentRef {
+	refs := []*firestore.DocumentRef{}
+	if mainActRef != nil {
+		refs = append(refs, mainActRef)
+	}
+	return append(refs, openerRefs...)
+}
+
 func (repo *EventRepo) Delete(ctx context.Context, id string) error {
 	log.Debug("Attemting to delete event", id)
-	docId := repo.Connection.Client.Collection(eventCollection).Doc(id)
-	eventDoc, err := docId.Get(ctx)
+	eventDoc, err := repo.Connection.getLive(ctx, eventCollection, "event", id)
 	if err != nil {
 		log.Errorf("Failed to find existing event while removing %+v", id)
 		return err
 	}
-	_, err = eventDoc.Ref.Delete(ctx)
+	err = repo.Connection.trash(ctx, eventDoc)
 	if err != nil {
 		log.Error("Failed to delete event", id, err)
 		return err
@@ -108,9 +186,102 @@ func (repo *EventRepo) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+func (repo *EventRepo) FindDeleted(ctx context.Context) ([]Event, error) {
+	log.Debug("Finding all deleted events")
+	eventSnaps, err := repo.Connection.Client.Collection(eventCollection).
+		Where("DeletedAt", "!=", nil).
+		Select(eventFields...).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Error("Error while finding all deleted events,", err)
+		return nil, err
+	}
+	eventDocs := toDocuments(eventSnaps)
+	artists, venues, err := repo.findReferencedDocs(ctx, eventDocs)
+	if err != nil {
+		log.Error("Error retrieving artists and venues while finding deleted events,", err)
+		return nil, err
+	}
+
+	events := []Event{}
+	for _, e := range eventDocs {
+		if !accessible(ctx, e) {
+			continue
+		}
+		inspection := inspectEvent(e, artists, venues)
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid deleted event %v, %v", e.Ref.ID, inspection.problems)
+			continue
+		}
+		events = append(events, inspection.event)
+	}
+	log.Debugf("Returning %d deleted events", len(events))
+	return events, nil
+}
+
+// Events can only be restored once their artists and venue are out of the trash
+func (repo *EventRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore event", id)
+	eventDoc, err := repo.Connection.getDeleted(ctx, eventCollection, "event", id)
+	if err != nil {
+		log.Errorf("Failed to find deleted event while restoring %+v, %v", id, err)
+		return err
+	}
+	artists, venues, err := repo.findReferencedDocs(ctx, []*document{eventDoc})
+	if err != nil {
+		log.Error("Error retrieving artists and venues while restoring event,", err)
+		return err
+	}
+
+	inspection := inspectEvent(eventDoc, artists, venues)
+	if len(inspection.problems) > 0 {
+		log.Errorf("Unable to restore invalid event %v, %v", id, inspection.problems)
+		return fmt.Errorf("event %s can't be restored, %v", id, inspection.problems)
+	}
+	if trashed := inspection.event.TrashedReferences(); len(trashed) > 0 {
+		log.Errorf("Unable to restore event %v before its references, %v", id, trashed)
+		return fmt.Errorf("event %s can't be restored until its %s are restored", id, strings.Join(trashed, ", "))
+	}
+	existingEvent, err := repo.findEventDocRef(ctx, inspection.event.UserId, inspection.event.Date, inspection.entity.VenueRef)
+	if err == nil {
+		log.Errorf("Failed to restore event %v, event %v exists for the same date and venue", id, existingEvent.ID)
+		return fmt.Errorf("event %s already exists for the same date and venue", existingEvent.ID)
+	}
+	if err != iterator.Done {
+		log.Errorf("Error occurred while checking for conflicting events when restoring %v, %v", id, err)
+		return err
+	}
+
+	err = repo.Connection.restore(ctx, eventDoc)
+	if err != nil {
+		log.Error("Failed to restore event", id, err)
+		return err
+	}
+	log.Infof("Successfully restored event %+v", id)
+	return nil
+}
+
+func (repo *EventRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge event", id)
+	eventDoc, err := repo.Connection.getDeleted(ctx, eventCollection, "event", id)
+	if err != nil {
+		log.Errorf("Failed to find deleted event while purging %+v, %v", id, err)
+		return err
+	}
+	err = repo.Connection.delete(ctx, eventDoc.Ref)
+	if err != nil {
+		log.Error("Failed to purge event", id, err)
+		return err
+	}
+	log.Infof("Successfully purged event %+v", id)
+	return nil
+}
+
 func (repo *EventRepo) Exists(ctx context.Context, event Event) (bool, error) {
 	log.Debug("Checking for existence of event", event)
-	venueDoc, err := repo.VenueRepo.findDocRef(ctx, event.Venue.Name, event.Venue.City, event.Venue.State)
+	user := db.User(ctx)
+	venueRef, err := repo.VenueRepo.findDocRef(ctx, user, event.Venue.Name, event.Venue.City, event.Venue.State)
 	if err == iterator.Done {
 		log.Debugf("No existing venue found while checking for event existence %+v", event)
 		return false, nil
@@ -119,9 +290,9 @@ func (repo *EventRepo) Exists(ctx context.Context, event Event) (bool, error) {
 		log.Errorf("Error while checking existence of event venue %v, %v", event.Venue, err)
 		return false, err
 	}
-	log.Debugf("Found existing venue %v with document ID %v while checking event existence", event.Venue, venueDoc.Ref.ID)
+	log.Debugf("Found existing venue %v with document ID %v while checking event existence", event.Venue, venueRef.ID)
 
-	doc, err := repo.findEventDocRef(ctx, event.Date, venueDoc.Ref)
+	doc, err := repo.findEventDocRef(ctx, user, event.Date, venueRef)
 	if err == iterator.Done {
 		log.Debug("No existing event found for", event)
 		return false, nil
@@ -130,13 +301,32 @@ func (repo *EventRepo) Exists(ctx context.Context, event Event) (bool, error) {
 		log.Errorf("Error while checking existence of event %v, %v", event, err)
 		return false, err
 	}
-	log.Debugf("Found event %v with document ID %v", event, doc.Ref.ID)
+	log.Debugf("Found event %v with document ID %v", event, doc.ID)
 	return true, nil
 }
 
+// Also finds events in the trash. Invalid events only hold the references that still exist
+func (repo *EventRepo) FindById(ctx context.Context, id string) (Event, error) {
+	log.Debug("Finding event", id)
+	eventDoc, err := repo.Connection.get(ctx, repo.Connection.Client.Collection(eventCollection).Doc(id))
+	if err != nil {
+		log.Errorf("Error while finding event %v, %v", id, err)
+		return Event{}, err
+	}
+	if !accessible(ctx, eventDoc) {
+		return Event{}, fmt.Errorf("event %s not found", id)
+	}
+	artists, venues, err := repo.findReferencedDocs(ctx, []*document{eventDoc})
+	if err != nil {
+		log.Errorf("Error retrieving artists and venues while finding event %v, %v", id, err)
+		return Event{}, err
+	}
+	return inspectEvent(eventDoc, artists, venues).event, nil
+}
+
 func (repo *EventRepo) FindAll(ctx context.Context) ([]Event, error) {
 	log.Debug("Finding all events")
-	eventDocs, err := repo.Connection.Client.Collection(eventCollection).
+	eventSnaps, err := repo.Connection.Client.Collection(eventCollection).
 		Select(eventFields...).
 		Documents(ctx).
 		GetAll()
@@ -144,6 +334,7 @@ func (repo *EventRepo) FindAll(ctx context.Context) ([]Event, error) {
 		log.Error("Error while finding all events,", err)
 		return nil, err
 	}
+	eventDocs := toDocuments(eventSnaps)
 	log.Debugf("Found %d events", len(eventDocs))
 
 	log.Debug("Finding all artists while finding all events")
@@ -162,55 +353,372 @@ func (repo *EventRepo) FindAll(ctx context.Context) ([]Event, error) {
 	}
 	log.Debugf("Found %d venues while retrieving all events", len(*venues))
 
-	// TODO: This logic could use better error handling for when the firestore event is invalid
-	// Currently, the whole app panics if the event data is invalid or the artist or venue is missing
-	// It would be better to log an error and ignore invalid events
 	events := []Event{}
+	for _, e := range eventDocs {
+		if deletedAt(e) != nil || !accessible(ctx, e) {
+			continue
+		}
+		inspection := inspectEvent(e, *artists, *venues)
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid event %v, %v", e.Ref.ID, inspection.problems)
+			continue
+		}
+		events = append(events, inspection.event)
+	}
+
+	log.Debugf("Returning %d constructed events", len(events))
+	return events, nil
+}
+
+// Filters combined with the date ordering need the composite indexes in firestore.indexes.json,
+// deployed with `firebase deploy --only firestore:indexes`. Events written before migrations 5 and 6
+// have no DeletedAt or UserId fields and won't match the trash and user filters, so the app doesn't
+// start until they run
+func (repo *EventRepo) Query(ctx context.Context, query data.EventQuery) (data.EventPage, error) {
+	log.Debugf("Querying events %+v", query)
+	client := repo.Connection.Client
+	q := client.Collection(eventCollection).Where("DeletedAt", "==", nil)
+	if !db.AllUsers(ctx) {
+		q = q.Where("UserId", "==", db.User(ctx))
+	}
+	if query.From != "" {
+		q = q.Where("Date", ">=", util.Timestamp(query.From))
+	}
+	if query.To != "" {
+		q = q.Where("Date", "<=", util.Timestamp(query.To))
+	}
+	if query.Purchased != nil {
+		q = q.Where("Purchased", "==", *query.Purchased)
+	}
+	if query.VenueId != "" {
+		q = q.Where("VenueRef", "==", client.Collection(venueCollection).Doc(query.VenueId))
+	}
+	if query.ArtistId != "" {
+		q = q.Where("ArtistRefs", "array-contains", client.Collection(artistCollection).Doc(query.ArtistId))
+	}
+	q = q.OrderBy("Date", firestore.Asc).OrderBy(firestore.DocumentID, firestore.Asc)
+	if query.Cursor != "" {
+		cursor, err := util.DecodeEventCursor(query.Cursor)
+		if err != nil {
+			return data.EventPage{}, err
+		}
+		q = q.StartAfter(cursor.Timestamp(), cursor.Id)
+	}
+	if query.Limit > 0 {
+		// one extra document shows whether there is another page
+		q = q.Limit(query.Limit + 1)
+	}
+
+	eventSnaps, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		log.Error("Error while querying events,", err)
+		return data.EventPage{}, err
+	}
+	eventDocs := toDocuments(eventSnaps)
+
+	page := data.EventPage{Events: []Event{}}
+	if query.Limit > 0 && len(eventDocs) > query.Limit {
+		eventDocs = eventDocs[:query.Limit]
+		last := eventDocs[len(eventDocs)-1]
+		date, ok := last.Data()["Date"].(time.Time)
+		if !ok {
+			return data.EventPage{}, fmt.Errorf("event %s has an invalid date and can't be paged past", last.Ref.ID)
+		}
+		page.NextCursor = util.NewEventCursor(date, last.Ref.ID).Encode()
+	}
+
+	artists, venues, err := repo.findReferencedDocs(ctx, eventDocs)
+	if err != nil {
+		log.Error("Error retrieving artists and venues while querying events,", err)
+		return data.EventPage{}, err
+	}
+	for _, e := range eventDocs {
+		inspection := inspectEvent(e, artists, venues)
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid event %v, %v", e.Ref.ID, inspection.problems)
+			continue
+		}
+		page.Events = append(page.Events, inspection.event)
+	}
+	log.Debugf("Returning %d queried events", len(page.Events))
+	return page, nil
+}
+
+// Gets only the artists and venues the events point to, instead of the whole collections
+func (repo *EventRepo) findReferencedDocs(ctx context.Context, eventDocs []*document) (map[string]Artist, map[string]Venue, error) {
+	artistRefs := map[string]*firestore.DocumentRef{}
+	venueRefs := map[string]*firestore.DocumentRef{}
 	for _, e := range eventDocs {
 		eventData := e.Data()
+		if ref, ok := eventData["MainActRef"].(*firestore.DocumentRef); ok {
+			artistRefs[ref.ID] = ref
+		}
+		if refs, ok := eventData["OpenerRefs"].([]interface{}); ok {
+			for _, openerRef := range refs {
+				if ref, ok := openerRef.(*firestore.DocumentRef); ok {
+					artistRefs[ref.ID] = ref
+				}
+			}
+		}
+		if ref, ok := eventData["VenueRef"].(*firestore.DocumentRef); ok {
+			venueRefs[ref.ID] = ref
+		}
+	}
+
+	refs := []*firestore.DocumentRef{}
+	for _, ref := range artistRefs {
+		refs = append(refs, ref)
+	}
+	for _, ref := range venueRefs {
+		refs = append(refs, ref)
+	}
+	artists := map[string]Artist{}
+	venues := map[string]Venue{}
+	if len(refs) == 0 {
+		return artists, venues, nil
+	}
+
+	docs, err := repo.Connection.Client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, snap := range docs {
+		if !snap.Exists() {
+			continue
+		}
+		doc := resolve(ctx, snap)
+		if doc == nil {
+			continue
+		}
+		switch doc.Ref.Parent.ID {
+		case artistCollection:
+			artists[doc.Ref.ID] = toArtist(doc)
+		case venueCollection:
+			venues[doc.Ref.ID] = toVenue(doc)
+		}
+	}
+	return artists, venues, nil
+}
+
+func (repo *EventRepo) FindIntegrityIssues(ctx context.Context) ([]data.IntegrityIssue, error) {
+	log.Debug("Checking integrity of all events")
+	eventSnaps, err := repo.Connection.Client.Collection(eventCollection).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Error("Error while finding all events to check integrity,", err)
+		return nil, err
+	}
+	eventDocs := toDocuments(eventSnaps)
+	artists, err := repo.ArtistRepo.findAllDocs(ctx)
+	if err != nil {
+		log.Error("Error retrieving artists while checking event integrity,", err)
+		return nil, err
+	}
+	venues, err := repo.VenueRepo.findAllDocs(ctx)
+	if err != nil {
+		log.Error("Error retrieving venues while checking event integrity,", err)
+		return nil, err
+	}
 
-		var mainAct Artist
-		if mainActRef, ok := eventData["MainActRef"].(*firestore.DocumentRef); ok {
-			mainAct = (*artists)[mainActRef.ID]
+	issues := []data.IntegrityIssue{}
+	for _, e := range eventDocs {
+		if deletedAt(e) != nil || !accessible(ctx, e) {
+			continue
 		}
-		venueRef := eventData["VenueRef"].(*firestore.DocumentRef)
-		venue := (*venues)[venueRef.ID]
+		inspection := inspectEvent(e, *artists, *venues)
+		if len(inspection.problems) > 0 {
+			issues = append(issues, inspection.issue(e.Ref.ID))
+		}
+	}
+	log.Debugf("Found %d events with integrity issues", len(issues))
+	return issues, nil
+}
+
+// Rewrites an invalid event without its dangling artist references and with
+// defaults for malformed fields. Events without a valid venue, date or any
+// remaining artist can't be repaired and have to be deleted instead.
+func (repo *EventRepo) Repair(ctx context.Context, id string) error {
+	log.Debug("Attempting to repair event", id)
+	eventDoc, err := repo.Connection.getLive(ctx, eventCollection, "event", id)
+	if err != nil {
+		log.Errorf("Failed to find existing event while repairing %+v, %v", id, err)
+		return err
+	}
+	artists, err := repo.ArtistRepo.findAllDocs(ctx)
+	if err != nil {
+		log.Error("Error retrieving artists while repairing event,", err)
+		return err
+	}
+	venues, err := repo.VenueRepo.findAllDocs(ctx)
+	if err != nil {
+		log.Error("Error retrieving venues while repairing event,", err)
+		return err
+	}
+
+	inspection := inspectEvent(eventDoc, *artists, *venues)
+	if len(inspection.problems) == 0 {
+		log.Debug("Skipped repairing event because it has no integrity issues", id)
+		return nil
+	}
+	if !inspection.repairable() {
+		log.Errorf("Unable to repair event %v, %v", id, inspection.problems)
+		return fmt.Errorf("event %s can't be repaired, %v", id, inspection.fatal)
+	}
+
+	inspection.entity.Version++
+	err = repo.Connection.replace(ctx, eventDoc, inspection.entity.updates())
+	if err != nil {
+		log.Errorf("Failed to repair event %v, %v", id, err)
+		return err
+	}
+	log.Info("Successfully repaired event", id)
+	return nil
+}
+
+type eventInspection struct {
+	event    Event
+	entity   EventEntity
+	problems []string
+	fatal    []string
+}
+
+func (i *eventInspection) repairable() bool {
+	return len(i.fatal) == 0
+}
 
-		openers := []Artist{}
-		if openerRefs, ok := eventData["OpenerRefs"].([]interface{}); ok {
-			for _, openerRef := range openerRefs {
-				openers = append(openers, (*artists)[openerRef.(*firestore.DocumentRef).ID])
+func (i *eventInspection) issue(id string) data.IntegrityIssue {
+	return data.IntegrityIssue{
+		Entity:     "event",
+		Id:         id,
+		Problems:   i.problems,
+		Repairable: i.repairable(),
+	}
+}
+
+func (i *eventInspection) problem(fatal bool, format string, args ...any) {
+	problem := fmt.Sprintf(format, args...)
+	i.problems = append(i.problems, problem)
+	if fatal {
+		i.fatal = append(i.fatal, problem)
+	}
+}
+
+// Reads an event document without trusting its shape. The returned event and
+// entity only hold the parts of the document that are valid. Trashed artists
+// and venues only count as valid for events that are in the trash too.
+func inspectEvent(doc *document, artists map[string]Artist, venues map[string]Venue) eventInspection {
+	i := eventInspection{}
+	eventData := doc.Data()
+	openers := []Artist{}
+	i.event.DeletedAt = deletedAt(doc)
+	i.entity.DeletedAt = i.event.DeletedAt
+	visible := func(refDeletedAt *time.Time) bool {
+		return refDeletedAt == nil || i.event.DeletedAt != nil
+	}
+
+	if mainActRef, found := eventData["MainActRef"]; found && mainActRef != nil {
+		ref, ok := mainActRef.(*firestore.DocumentRef)
+		if !ok {
+			i.problem(false, "main act reference is not a document reference")
+		} else if mainAct, ok := artists[ref.ID]; !ok || !visible(mainAct.DeletedAt) {
+			i.problem(false, "main act %s does not exist", ref.ID)
+		} else {
+			i.event.MainAct = mainAct
+			i.entity.MainActRef = ref
+		}
+	}
+
+	i.entity.OpenerRefs = []*firestore.DocumentRef{}
+	if openerRefs, found := eventData["OpenerRefs"]; found && openerRefs != nil {
+		refs, ok := openerRefs.([]interface{})
+		if !ok {
+			i.problem(false, "opener references are not a list")
+		}
+		for n, openerRef := range refs {
+			ref, ok := openerRef.(*firestore.DocumentRef)
+			if !ok {
+				i.problem(false, "opener reference %d is not a document reference", n)
+			} else if opener, ok := artists[ref.ID]; !ok || !visible(opener.DeletedAt) {
+				i.problem(false, "opener %s does not exist", ref.ID)
+			} else {
+				openers = append(openers, opener)
+				i.entity.OpenerRefs = append(i.entity.OpenerRefs, ref)
 			}
 		}
-		tmId := ""
-		if id, ok := eventData["TmId"].(string); ok {
-			tmId = id
+	}
+	i.event.Openers = openers
+	if i.entity.MainActRef == nil && len(openers) == 0 {
+		i.problem(true, "event has no valid artists")
+	}
+
+	if ref, ok := eventData["VenueRef"].(*firestore.DocumentRef); !ok {
+		i.problem(true, "venue reference is missing")
+	} else if venue, ok := venues[ref.ID]; !ok || !visible(venue.DeletedAt) {
+		i.problem(true, "venue %s does not exist", ref.ID)
+	} else {
+		i.event.Venue = venue
+		i.entity.VenueRef = ref
+	}
+
+	if date, ok := eventData["Date"].(time.Time); !ok {
+		i.problem(true, "date is missing or not a timestamp")
+	} else {
+		i.event.Date = util.Date(date)
+		i.entity.Date = date
+	}
+
+	if purchased, found := eventData["Purchased"]; found {
+		if p, ok := purchased.(bool); ok {
+			i.event.Purchased = p
+			i.entity.Purchased = p
+		} else {
+			i.problem(false, "purchased is not a boolean")
 		}
-		event := Event{
-			MainAct:   mainAct,
-			Openers:   openers,
-			Venue:     venue,
-			Date:      util.Date(eventData["Date"].(time.Time)),
-			Purchased: eventData["Purchased"].(bool),
-			TmId:      tmId,
-			Id:        e.Ref.ID,
+	}
+
+	if tmId, found := eventData["TmId"]; found {
+		if id, ok := tmId.(string); ok {
+			i.event.TmId = id
+			i.entity.TmId = id
+		} else {
+			i.problem(false, "ticketmaster ID is not a string")
 		}
-		events = append(events, event)
 	}
 
-	log.Debugf("Returning %d constructed events", len(events))
-	return events, nil
+	// events saved before archiving existed have no such field
+	if archivedAt, found := eventData["ArchivedAt"]; found && archivedAt != nil {
+		if at, ok := archivedAt.(time.Time); ok {
+			i.event.ArchivedAt = &at
+			i.entity.ArchivedAt = &at
+		} else {
+			i.problem(false, "archived at is not a timestamp")
+		}
+	}
+
+	i.entity.ArtistRefs = artistRefs(i.entity.MainActRef, i.entity.OpenerRefs)
+	i.entity.Version = storedVersion(doc)
+	i.event.Version = i.entity.Version
+	i.entity.UserId = owner(doc)
+	i.event.UserId = i.entity.UserId
+	i.event.Id = doc.Ref.ID
+	return i
 }
 
-func (repo *EventRepo) findEventDocRef(ctx context.Context, date string, venueRef *firestore.DocumentRef) (*firestore.DocumentSnapshot, error) {
-	event, err := repo.Connection.Client.Collection(eventCollection).
-		Select().
+// only finds events of the owner
+func (repo *EventRepo) findEventDocRef(ctx context.Context, owner string, date string, venueRef *firestore.DocumentRef) (*firestore.DocumentRef, error) {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		if docRef, ok := uow.events[eventKey{owner, util.Date(util.Timestamp(date)), venueRef.ID}]; ok {
+			return docRef, nil
+		}
+	}
+	query := repo.Connection.Client.Collection(eventCollection).
+		Select("DeletedAt", "UserId").
 		Where("Date", "==", util.Timestamp(date)).
-		Where("VenueRef", "==", venueRef).
-		Documents(ctx).
-		Next()
+		Where("VenueRef", "==", venueRef)
+	event, err := repo.Connection.findLive(ctx, query, owner)
 	if err != nil {
 		return nil, err
 	}
-	return event, nil
+	return event.Ref, nil
 }
@@ -0,0 +1,76 @@
+package firestore
+
+import (
+	"concert-manager/db"
+	"concert-manager/db/repotest"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const emulatorHostEnv = "FIRESTORE_EMULATOR_HOST"
+
+// Requires a running Firestore emulator, e.g. `gcloud emulators firestore start --host-port=localhost:8080`
+// with FIRESTORE_EMULATOR_HOST=localhost:8080 set for the test run
+func TestRepositoryConformance(t *testing.T) {
+	skipWithoutEmulator(t)
+
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		conn := newEmulatorConnection(t)
+		venueRepo := &VenueRepo{Connection: conn}
+		artistRepo := &ArtistRepo{Connection: conn}
+		return repotest.Repos{
+			VenueRepo:  venueRepo,
+			ArtistRepo: artistRepo,
+			EventRepo:  &EventRepo{Connection: conn, VenueRepo: venueRepo, ArtistRepo: artistRepo},
+			Transactor: conn,
+			AuditRepo:  &AuditRepo{Connection: conn},
+		}
+	})
+}
+
+func skipWithoutEmulator(t *testing.T) {
+	if os.Getenv(emulatorHostEnv) == "" {
+		t.Skipf("%s is not set, skipping Firestore emulator tests", emulatorHostEnv)
+	}
+}
+
+// the emulator keeps separate data for each project ID, so every test gets an empty database
+func newEmulatorConnection(t *testing.T) *Firestore {
+	t.Helper()
+	projectId := fmt.Sprintf("concert-manager-test-%d", time.Now().UnixNano())
+	client, err := firestore.NewClient(context.Background(), projectId)
+	if err != nil {
+		t.Fatal("failed to connect to the Firestore emulator:", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &Firestore{client}
+}
+
+func TestTransactionLookupRaceRetried(t *testing.T) {
+	skipWithoutEmulator(t)
+	conn := newEmulatorConnection(t)
+	artistRepo := &ArtistRepo{Connection: conn}
+	ctx := context.Background()
+
+	err := conn.RunTransaction(ctx, func(txCtx context.Context) error {
+		if _, err := artistRepo.Add(txCtx, Artist{Name: "Racing"}); err != nil {
+			return err
+		}
+		// written outside the transaction after its lookup found nothing
+		_, err := artistRepo.Add(ctx, Artist{Name: "Racing"})
+		return err
+	})
+	if !errors.Is(err, db.ErrRetryTransaction) {
+		t.Fatalf("Expected the transaction to be retried, actual: %v", err)
+	}
+	artists, err := artistRepo.FindAll(ctx)
+	if err != nil || len(artists) != 1 {
+		t.Errorf("Only the artist written outside the transaction should exist, actual: %+v, %v", artists, err)
+	}
+}
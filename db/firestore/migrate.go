@@ -0,0 +1,250 @@
+package firestore
+
+import (
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	metadataCollection = "metadata"
+	schemaDoc          = "schema"
+)
+
+// A schema change applied to existing documents. Up must be idempotent, because a crash after
+// it finishes but before the new version is stored runs it again on the next migration
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(context.Context, *Firestore) error
+}
+
+type schemaEntity struct {
+	Version   int
+	UpdatedAt time.Time
+}
+
+// Ordered by version, append new migrations to the end and never change released ones
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Backfill TmId on events saved before Ticketmaster IDs were stored",
+		Up: func(ctx context.Context, f *Firestore) error {
+			return f.backfillField(ctx, eventCollection, "TmId", "")
+		},
+	},
+	{
+		Version:     2,
+		Description: "Backfill OpenerRefs on events saved without any openers",
+		Up: func(ctx context.Context, f *Firestore) error {
+			return f.backfillField(ctx, eventCollection, "OpenerRefs", []*firestore.DocumentRef{})
+		},
+	},
+	{
+		Version:     3,
+		Description: "Combine MainActRef and OpenerRefs into ArtistRefs for querying events by artist",
+		Up:          backfillArtistRefs,
+	},
+	{
+		Version:     4,
+		Description: "Backfill Version on records saved before optimistic concurrency checks",
+		Up: func(ctx context.Context, f *Firestore) error {
+			for _, collection := range []string{artistCollection, venueCollection, eventCollection} {
+				if err := f.backfillField(ctx, collection, "Version", 1); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     5,
+		Description: "Backfill DeletedAt so queries can leave out records in the trash",
+		Up: func(ctx context.Context, f *Firestore) error {
+			for _, collection := range []string{artistCollection, venueCollection, eventCollection} {
+				if err := f.backfillField(ctx, collection, "DeletedAt", nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     6,
+		Description: "Backfill UserId, giving existing events to the default user and sharing existing artists and venues",
+		Up: func(ctx context.Context, f *Firestore) error {
+			if err := f.backfillField(ctx, eventCollection, "UserId", db.DefaultUser); err != nil {
+				return err
+			}
+			for _, collection := range []string{artistCollection, venueCollection} {
+				if err := f.backfillField(ctx, collection, "UserId", db.SharedOwner); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Version 0 is a database that predates schema versioning
+func (f *Firestore) SchemaVersion(ctx context.Context) (int, error) {
+	doc, err := f.Client.Collection(metadataCollection).Doc(schemaDoc).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var schema schemaEntity
+	if err := doc.DataTo(&schema); err != nil {
+		return 0, err
+	}
+	return schema.Version, nil
+}
+
+// The stored schema version, where a database without any records has nothing to migrate and is
+// stamped with the latest version, so a new database doesn't count as one that predates versioning
+func (f *Firestore) CheckSchemaVersion(ctx context.Context) (int, error) {
+	version, err := f.SchemaVersion(ctx)
+	if err != nil || version > 0 {
+		return version, err
+	}
+	for _, collection := range []string{artistCollection, venueCollection, eventCollection} {
+		docs, err := f.Client.Collection(collection).Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return 0, err
+		}
+		if len(docs) > 0 {
+			return 0, nil
+		}
+	}
+	latest := LatestSchemaVersion()
+	log.Infof("Database has no records, stamping it with schema version %d", latest)
+	_, err = f.Client.Collection(metadataCollection).Doc(schemaDoc).
+		Set(ctx, schemaEntity{Version: latest, UpdatedAt: time.Now().UTC()})
+	if err != nil {
+		return 0, err
+	}
+	return latest, nil
+}
+
+// Runs every migration newer than the stored schema version, returning the versions before and after
+func (f *Firestore) Migrate(ctx context.Context) (int, int, error) {
+	return f.migrate(ctx, migrations)
+}
+
+func (f *Firestore) migrate(ctx context.Context, migrations []Migration) (int, int, error) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			return 0, 0, fmt.Errorf("migration %d is out of order", migrations[i].Version)
+		}
+	}
+
+	from, err := f.SchemaVersion(ctx)
+	if err != nil {
+		log.Error("Failed to read schema version,", err)
+		return 0, 0, err
+	}
+	log.Infof("Database schema is at version %d", from)
+
+	current := from
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.Infof("Running migration %d: %s", m.Version, m.Description)
+		if err := m.Up(ctx, f); err != nil {
+			log.Errorf("Migration %d failed, schema left at version %d, %v", m.Version, current, err)
+			return from, current, fmt.Errorf("migration %d failed, %v", m.Version, err)
+		}
+		_, err := f.Client.Collection(metadataCollection).Doc(schemaDoc).
+			Set(ctx, schemaEntity{Version: m.Version, UpdatedAt: time.Now().UTC()})
+		if err != nil {
+			log.Errorf("Failed to store schema version %d, %v", m.Version, err)
+			return from, current, err
+		}
+		current = m.Version
+	}
+
+	log.Infof("Database schema migrated from version %d to %d", from, current)
+	return from, current, nil
+}
+
+// Sets the field on every document of the collection that doesn't have it yet
+func (f *Firestore) backfillField(ctx context.Context, collection string, field string, value any) error {
+	docs, err := f.Client.Collection(collection).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, doc := range docs {
+		if _, found := doc.Data()[field]; found {
+			continue
+		}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: field, Value: value}}); err != nil {
+			return fmt.Errorf("failed to backfill %s on %s, %v", field, doc.Ref.Path, err)
+		}
+		updated++
+	}
+	log.Infof("Backfilled %s on %d of %d %s documents", field, updated, len(docs), collection)
+	return nil
+}
+
+// Recomputed for every event, so running it again gives the same result
+func backfillArtistRefs(ctx context.Context, f *Firestore) error {
+	docs, err := f.Client.Collection(eventCollection).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		eventData := doc.Data()
+		mainActRef, _ := eventData["MainActRef"].(*firestore.DocumentRef)
+		openerRefs := []*firestore.DocumentRef{}
+		if refs, ok := eventData["OpenerRefs"].([]interface{}); ok {
+			for _, openerRef := range refs {
+				if ref, ok := openerRef.(*firestore.DocumentRef); ok {
+					openerRefs = append(openerRefs, ref)
+				}
+			}
+		}
+		update := []firestore.Update{{Path: "ArtistRefs", Value: artistRefs(mainActRef, openerRefs)}}
+		if _, err := doc.Ref.Update(ctx, update); err != nil {
+			return fmt.Errorf("failed to backfill ArtistRefs on %s, %v", doc.Ref.Path, err)
+		}
+	}
+	log.Infof("Backfilled ArtistRefs on %d events", len(docs))
+	return nil
+}
+
+// Copies every document to the new collection with the same ID, then deletes the original.
+// DocumentRef fields pointing into the old collection aren't rewritten, so a migration that
+// renames a referenced collection has to update those references itself
+func (f *Firestore) renameCollection(ctx context.Context, from string, to string) error {
+	docs, err := f.Client.Collection(from).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if _, err := f.Client.Collection(to).Doc(doc.Ref.ID).Set(ctx, doc.Data()); err != nil {
+			return fmt.Errorf("failed to copy %s to %s, %v", doc.Ref.Path, to, err)
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return fmt.Errorf("failed to delete %s after copying it, %v", doc.Ref.Path, err)
+		}
+	}
+	log.Infof("Renamed collection %s to %s, moved %d documents", from, to, len(docs))
+	return nil
+}
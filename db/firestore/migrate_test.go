@@ -0,0 +1,119 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	skipWithoutEmulator(t)
+	conn := newEmulatorConnection(t)
+	ctx := context.Background()
+
+	// an event the way it was stored before TmId existed
+	legacy, _, err := conn.Client.Collection(eventCollection).Add(ctx, map[string]any{
+		"Date":      time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		"Purchased": true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	from, to, err := conn.Migrate(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if from != 0 || to != LatestSchemaVersion() {
+		t.Errorf("Incorrect versions, expected: %v -> %v, actual: %v -> %v", 0, LatestSchemaVersion(), from, to)
+	}
+
+	doc, err := legacy.Get(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if tmId, ok := doc.Data()["TmId"].(string); !ok || tmId != "" {
+		t.Errorf("TmId was not backfilled: %v", doc.Data())
+	}
+	if _, ok := doc.Data()["OpenerRefs"]; !ok {
+		t.Errorf("OpenerRefs was not backfilled: %v", doc.Data())
+	}
+	if _, ok := doc.Data()["ArtistRefs"]; !ok {
+		t.Errorf("ArtistRefs was not backfilled: %v", doc.Data())
+	}
+
+	from, to, err = conn.Migrate(ctx)
+	if err != nil || from != to {
+		t.Errorf("Migrating an up to date database should do nothing, %v -> %v, err: %v", from, to, err)
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	skipWithoutEmulator(t)
+	ctx := context.Background()
+
+	empty := newEmulatorConnection(t)
+	if version, err := empty.CheckSchemaVersion(ctx); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("A new database should be at the latest version, actual: %v, err: %v", version, err)
+	}
+	if version, _ := empty.SchemaVersion(ctx); version != LatestSchemaVersion() {
+		t.Errorf("The latest version should be stored for a new database, actual: %v", version)
+	}
+
+	legacy := newEmulatorConnection(t)
+	if _, _, err := legacy.Client.Collection(artistCollection).Add(ctx, map[string]any{"Name": "Legacy"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if version, err := legacy.CheckSchemaVersion(ctx); err != nil || version != 0 {
+		t.Errorf("A database with unversioned records should need migrating, actual: %v, err: %v", version, err)
+	}
+}
+
+func TestMigrateStopsAtFailure(t *testing.T) {
+	skipWithoutEmulator(t)
+	conn := newEmulatorConnection(t)
+	ctx := context.Background()
+	noop := func(context.Context, *Firestore) error { return nil }
+	failing := func(context.Context, *Firestore) error { return errors.New("failed") }
+
+	_, to, err := conn.migrate(ctx, []Migration{{1, "first", noop}, {2, "second", failing}, {3, "third", noop}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if version, _ := conn.SchemaVersion(ctx); to != 1 || version != 1 {
+		t.Errorf("Schema should stay at the last successful migration, returned: %v, stored: %v", to, version)
+	}
+}
+
+func TestMigrateOutOfOrder(t *testing.T) {
+	noop := func(context.Context, *Firestore) error { return nil }
+	conn := &Firestore{}
+	if _, _, err := conn.migrate(context.Background(), []Migration{{2, "second", noop}, {1, "first", noop}}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestRenameCollection(t *testing.T) {
+	skipWithoutEmulator(t)
+	conn := newEmulatorConnection(t)
+	ctx := context.Background()
+	if _, err := conn.Client.Collection("old").Doc("doc").Set(ctx, map[string]any{"Name": "value"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// running twice shows the rename is idempotent
+	for i := 0; i < 2; i++ {
+		if err := conn.renameCollection(ctx, "old", "new"); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	doc, err := conn.Client.Collection("new").Doc("doc").Get(ctx)
+	if err != nil || doc.Data()["Name"] != "value" {
+		t.Errorf("Document was not moved, data: %v, err: %v", doc.Data(), err)
+	}
+	if old, _ := conn.Client.Collection("old").Documents(ctx).GetAll(); len(old) != 0 {
+		t.Errorf("Old collection still has %d documents", len(old))
+	}
+}
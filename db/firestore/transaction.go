@@ -0,0 +1,343 @@
+package firestore
+
+import (
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type unitOfWorkKey struct{}
+
+// Firestore transactions require all reads to happen before any writes, but adding a saved event
+// interleaves them (look up an artist, create it, look up the next one...). Instead, reads go to the
+// database as usual while writes are staged here and committed together in a single transaction.
+// Documents created in the unit of work are remembered so later lookups in the same unit can find them.
+// The lookups deciding whether a record already exists are run again in the transaction before any
+// write, so Firestore rejects the commit if a matching record is written concurrently
+type unitOfWork struct {
+	writes  []func(*firestore.Transaction) error
+	staged  map[string]*stagedDoc
+	lookups []lookup
+	artists map[artistKey]*firestore.DocumentRef
+	venues  map[venueKey]*firestore.DocumentRef
+	events  map[eventKey]*firestore.DocumentRef
+}
+
+// documents are remembered along with their owner, since a single unit can add records for several users
+type artistKey struct {
+	owner string
+	name  string
+}
+
+type venueKey struct {
+	owner string
+	name  string
+	city  string
+	state string
+}
+
+type eventKey struct {
+	owner   string
+	date    string
+	venueId string
+}
+
+// A query made in the unit of work and the live document it found for the user, nil if there was none
+type lookup struct {
+	query firestore.Query
+	user  string
+	found *firestore.DocumentRef
+}
+
+// Runs f so that every write made through the repositories with the given context either
+// commits together once f returns, or is discarded if f returns an error
+func (f *Firestore) RunTransaction(ctx context.Context, fn func(context.Context) error) error {
+	if getUnitOfWork(ctx) != nil {
+		return fn(ctx)
+	}
+
+	uow := &unitOfWork{
+		staged:  map[string]*stagedDoc{},
+		artists: map[artistKey]*firestore.DocumentRef{},
+		venues:  map[venueKey]*firestore.DocumentRef{},
+		events:  map[eventKey]*firestore.DocumentRef{},
+	}
+	if err := fn(context.WithValue(ctx, unitOfWorkKey{}, uow)); err != nil {
+		log.Debugf("Discarding %d staged writes due to error, %v", len(uow.writes), err)
+		return err
+	}
+	if len(uow.writes) == 0 {
+		return nil
+	}
+
+	log.Debugf("Committing %d staged writes", len(uow.writes))
+	err := f.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		for _, l := range uow.lookups {
+			doc, err := firstLive(tx.Documents(l.query), l.user)
+			if err != nil && err != iterator.Done {
+				return err
+			}
+			if !sameDoc(doc, l.found) {
+				return fmt.Errorf("%w, a record matching a lookup was written since it was made", db.ErrRetryTransaction)
+			}
+		}
+		for _, write := range uow.writes {
+			if err := write(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return versionConflict(err)
+}
+
+func getUnitOfWork(ctx context.Context) *unitOfWork {
+	uow, _ := ctx.Value(unitOfWorkKey{}).(*unitOfWork)
+	return uow
+}
+
+// Finds the first live document of the query visible to the user, or iterator.Done if there is none.
+// Lookups in a unit of work are remembered, so they can be checked again when it commits
+func (f *Firestore) findLive(ctx context.Context, query firestore.Query, user string) (*document, error) {
+	doc, err := firstLive(query.Documents(ctx), user)
+	if err != nil && err != iterator.Done {
+		return nil, err
+	}
+	if uow := getUnitOfWork(ctx); uow != nil {
+		l := lookup{query: query, user: user}
+		if doc != nil {
+			l.found = doc.Ref
+		}
+		uow.lookups = append(uow.lookups, l)
+	}
+	return doc, err
+}
+
+func sameDoc(doc *document, ref *firestore.DocumentRef) bool {
+	if doc == nil || ref == nil {
+		return doc == nil && ref == nil
+	}
+	return doc.Ref.ID == ref.ID
+}
+
+// A document as it's read through the repositories. In a unit of work it's the stored document with the
+// writes staged for it applied, so records changed earlier in the same unit are seen as they will be
+type document struct {
+	Ref        *firestore.DocumentRef
+	UpdateTime time.Time
+	data       map[string]any
+}
+
+func (d *document) Data() map[string]any {
+	return d.data
+}
+
+func toDocument(snap *firestore.DocumentSnapshot) *document {
+	return &document{Ref: snap.Ref, UpdateTime: snap.UpdateTime, data: snap.Data()}
+}
+
+func toDocuments(snaps []*firestore.DocumentSnapshot) []*document {
+	docs := make([]*document, len(snaps))
+	for i, snap := range snaps {
+		docs[i] = toDocument(snap)
+	}
+	return docs
+}
+
+// The writes staged for a single document, merged so that it's written once when the unit commits
+type stagedDoc struct {
+	ref *firestore.DocumentRef
+	// the document as it will be after the commit, nil once it's deleted
+	data         map[string]any
+	created      bool
+	replaced     bool
+	updates      []firestore.Update
+	precondition firestore.Precondition
+}
+
+func (s *stagedDoc) write(tx *firestore.Transaction) error {
+	switch {
+	case s.data == nil && s.created:
+		return nil
+	case s.data == nil:
+		return tx.Delete(s.ref)
+	case s.created:
+		return tx.Create(s.ref, s.data)
+	case s.replaced:
+		return tx.Set(s.ref, s.data)
+	default:
+		return tx.Update(s.ref, s.updates, s.precondition)
+	}
+}
+
+// Returns the staged writes of the document, adding them to the unit of work the first time
+func (uow *unitOfWork) stage(ref *firestore.DocumentRef) *stagedDoc {
+	if s, ok := uow.staged[ref.Path]; ok {
+		return s
+	}
+	s := &stagedDoc{ref: ref}
+	uow.staged[ref.Path] = s
+	uow.writes = append(uow.writes, s.write)
+	return s
+}
+
+// Reads the document, or how the unit of work in the context left it
+func (f *Firestore) get(ctx context.Context, ref *firestore.DocumentRef) (*document, error) {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		if s, ok := uow.staged[ref.Path]; ok {
+			if s.data == nil {
+				return nil, status.Errorf(codes.NotFound, "%s was deleted in this transaction", ref.Path)
+			}
+			return &document{Ref: ref, data: maps.Clone(s.data)}, nil
+		}
+	}
+	snap, err := ref.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toDocument(snap), nil
+}
+
+// The stored document, or how the unit of work in the context left it, nil if it was deleted there
+func resolve(ctx context.Context, snap *firestore.DocumentSnapshot) *document {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		if s, ok := uow.staged[snap.Ref.Path]; ok {
+			if s.data == nil {
+				return nil
+			}
+			return &document{Ref: snap.Ref, UpdateTime: snap.UpdateTime, data: maps.Clone(s.data)}
+		}
+	}
+	return toDocument(snap)
+}
+
+func (f *Firestore) create(ctx context.Context, collection string, entity any) (*firestore.DocumentRef, error) {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		docRef := f.Client.Collection(collection).NewDoc()
+		s := uow.stage(docRef)
+		s.created = true
+		s.data = storedValue(entity).(map[string]any)
+		return docRef, nil
+	}
+	docRef, _, err := f.Client.Collection(collection).Add(ctx, entity)
+	return docRef, err
+}
+
+func (f *Firestore) set(ctx context.Context, docRef *firestore.DocumentRef, entity any) error {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		s := uow.stage(docRef)
+		s.replaced = !s.created
+		s.data = storedValue(entity).(map[string]any)
+		return nil
+	}
+	_, err := docRef.Set(ctx, entity)
+	return err
+}
+
+func (f *Firestore) delete(ctx context.Context, docRef *firestore.DocumentRef) error {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		uow.stage(docRef).data = nil
+		return nil
+	}
+	_, err := docRef.Delete(ctx)
+	return err
+}
+
+// Writes the fields only if the document hasn't changed since the snapshot was read, so an update
+// racing with another one between checking the stored version and writing the new one fails.
+// Documents already written in the unit of work are checked against what was first read of them
+func (f *Firestore) replace(ctx context.Context, doc *document, updates []firestore.Update) error {
+	precondition := firestore.LastUpdateTime(doc.UpdateTime)
+	if uow := getUnitOfWork(ctx); uow != nil {
+		s := uow.stage(doc.Ref)
+		if s.data == nil {
+			s.data = doc.Data()
+			s.precondition = precondition
+		}
+		for _, update := range updates {
+			s.data[update.Path] = storedValue(update.Value)
+			i := slices.IndexFunc(s.updates, func(u firestore.Update) bool { return u.Path == update.Path })
+			if i >= 0 {
+				s.updates[i] = update
+			} else {
+				s.updates = append(s.updates, update)
+			}
+		}
+		return nil
+	}
+	_, err := doc.Ref.Update(ctx, updates, precondition)
+	return versionConflict(err)
+}
+
+// Converts a value the way Firestore stores it, so staged documents read like stored ones
+func storedValue(value any) any {
+	if value == nil {
+		return nil
+	}
+	switch v := value.(type) {
+	case *firestore.DocumentRef, time.Time:
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return storedValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		values := make([]any, rv.Len())
+		for i := range values {
+			values[i] = storedValue(rv.Index(i).Interface())
+		}
+		return values
+	case reflect.Map:
+		values := map[string]any{}
+		for _, key := range rv.MapKeys() {
+			values[key.String()] = storedValue(rv.MapIndex(key).Interface())
+		}
+		return values
+	case reflect.Struct:
+		values := map[string]any{}
+		for i := 0; i < rv.NumField(); i++ {
+			if field := rv.Type().Field(i); field.IsExported() {
+				values[field.Name] = storedValue(rv.Field(i).Interface())
+			}
+		}
+		return values
+	}
+	return value
+}
+
+// the only preconditions used are the ones set by replace
+func versionConflict(err error) error {
+	if status.Code(err) == codes.FailedPrecondition {
+		return fmt.Errorf("%w, %v", db.ErrVersionConflict, err)
+	}
+	return err
+}
+
+// Documents written before versioning count as version 0 until migration 4 backfills them
+func storedVersion(doc *document) int {
+	version, _ := doc.Data()["Version"].(int64)
+	return int(version)
+}
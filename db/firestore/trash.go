@@ -0,0 +1,66 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Deleted documents stay in their collection with DeletedAt set until they're purged.
+// Documents saved before the trash existed don't have the field at all until migration 5
+// backfills it, so lookups check it on the returned documents instead of filtering on it
+func deletedAt(doc *document) *time.Time {
+	deletedAt, ok := doc.Data()["DeletedAt"].(time.Time)
+	if !ok {
+		return nil
+	}
+	return &deletedAt
+}
+
+// Returns the first document outside of the trash that the user can see, or iterator.Done if there are none
+func firstLive(docs *firestore.DocumentIterator, user string) (*document, error) {
+	defer docs.Stop()
+	for {
+		snap, err := docs.Next()
+		if err != nil {
+			return nil, err
+		}
+		if doc := toDocument(snap); deletedAt(doc) == nil && visibleTo(doc, user) {
+			return doc, nil
+		}
+	}
+}
+
+func (f *Firestore) trash(ctx context.Context, doc *document) error {
+	return f.replace(ctx, doc, []firestore.Update{{Path: "DeletedAt", Value: time.Now().UTC()}})
+}
+
+func (f *Firestore) restore(ctx context.Context, doc *document) error {
+	return f.replace(ctx, doc, []firestore.Update{{Path: "DeletedAt", Value: nil}})
+}
+
+// Gets a document that isn't in the trash
+func (f *Firestore) getLive(ctx context.Context, collection string, entity string, id string) (*document, error) {
+	doc, err := f.get(ctx, f.Client.Collection(collection).Doc(id))
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt(doc) != nil || !accessible(ctx, doc) {
+		return nil, fmt.Errorf("%s %s not found", entity, id)
+	}
+	return doc, nil
+}
+
+// Gets a document that is in the trash
+func (f *Firestore) getDeleted(ctx context.Context, collection string, entity string, id string) (*document, error) {
+	doc, err := f.get(ctx, f.Client.Collection(collection).Doc(id))
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt(doc) == nil || !accessible(ctx, doc) {
+		return nil, fmt.Errorf("deleted %s %s not found", entity, id)
+	}
+	return doc, nil
+}
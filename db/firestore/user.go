@@ -0,0 +1,26 @@
+package firestore
+
+import (
+	"concert-manager/db"
+	"context"
+)
+
+// Documents saved before there were users don't have UserId until migration 6 backfills it.
+// Until then, events without one belong to the default user and artists and venues without one are shared
+func owner(doc *document) string {
+	userId, ok := doc.Data()["UserId"].(string)
+	if !ok && doc.Ref.Parent.ID == eventCollection {
+		return db.DefaultUser
+	}
+	return userId
+}
+
+// Events are only visible to their owner, while artists and venues can also be shared
+func visibleTo(doc *document, user string) bool {
+	docOwner := owner(doc)
+	return docOwner == user || docOwner == db.SharedOwner && doc.Ref.Parent.ID != eventCollection
+}
+
+func accessible(ctx context.Context, doc *document) bool {
+	return db.AllUsers(ctx) || visibleTo(doc, db.User(ctx))
+}
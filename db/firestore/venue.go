@@ -2,61 +2,86 @@ package firestore
 
 import (
 	"concert-manager/data"
+	"concert-manager/db"
 	"concert-manager/log"
 	"context"
+	"fmt"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
 )
 
 const venueCollection = "venues"
-var venueFields = []string{"Name", "City", "State"}
+var venueFields = []string{"Name", "City", "State", "Version", "DeletedAt", "UserId"}
 
 type VenueRepo struct {
 	Connection *Firestore
 }
 
 type VenueEntity struct {
-	Name    string
-	City    string
-	State   string
+	Name      string
+	City      string
+	State     string
+	Version   int
+	DeletedAt *time.Time
+	UserId    string
 }
 
 type Venue = data.Venue
 
+func (e VenueEntity) updates() []firestore.Update {
+	return []firestore.Update{
+		{Path: "Name", Value: e.Name},
+		{Path: "City", Value: e.City},
+		{Path: "State", Value: e.State},
+		{Path: "Version", Value: e.Version},
+	}
+}
+
 func (repo *VenueRepo) Add(ctx context.Context, venue Venue) (string, error) {
 	log.Debug("Attemping to add venue", venue)
-	existingVenue, err := repo.findDocRef(ctx, venue.Name, venue.City, venue.State)
+	user := db.User(ctx)
+	existingVenue, err := repo.findDocRef(ctx, user, venue.Name, venue.City, venue.State)
 	if err == nil {
-		log.Debugf("Skipping adding venue because it already exists %+v, %v", venue, existingVenue.Ref.ID)
-		return existingVenue.Ref.ID, nil
+		log.Debugf("Skipping adding venue because it already exists %+v, %v", venue, existingVenue.ID)
+		return existingVenue.ID, nil
 	}
 	if err != iterator.Done {
 		log.Errorf("Error occurred while checking if venue %v already exists, %v", venue, err)
 		return "", err
 	}
 
-	venueEntity := VenueEntity{venue.Name, venue.City, venue.State}
-	venues := repo.Connection.Client.Collection(venueCollection)
-	docRef, _, err := venues.Add(ctx, venueEntity)
+	venueEntity := VenueEntity{venue.Name, venue.City, venue.State, 1, nil, user}
+	if venue.UserId == db.SharedOwner {
+		venueEntity.UserId = db.SharedOwner
+	}
+	docRef, err := repo.Connection.create(ctx, venueCollection, venueEntity)
 	if err != nil {
 		log.Errorf("Failed to add new venue %+v, %v", venue, err)
 		return "", err
 	}
+	if uow := getUnitOfWork(ctx); uow != nil {
+		uow.venues[venueKey{venueEntity.UserId, venue.Name, venue.City, venue.State}] = docRef
+	}
 	log.Infof("Created new venue %+v", docRef.ID)
 	return docRef.ID, nil
 }
 
 func (repo *VenueRepo) Update(ctx context.Context, id string, venue Venue) error {
     log.Debug("Attempting to update venue", id, venue)
-	docId := repo.Connection.Client.Collection(venueCollection).Doc(id)
-	venueDoc, err := docId.Get(ctx)
+	venueDoc, err := repo.Connection.getLive(ctx, venueCollection, "venue", id)
 	if err != nil {
 		log.Errorf("Failed to find existing venue while updating %+v, %v", id, err)
 		return err
 	}
-	venueEntity := VenueEntity{venue.Name, venue.City, venue.State}
-	_, err = venueDoc.Ref.Set(ctx, venueEntity)
+	current := storedVersion(venueDoc)
+	if err := db.CheckVersion("venue", id, venue.Version, current); err != nil {
+		log.Errorf("Failed to update venue %v, %v", id, err)
+		return err
+	}
+	venueEntity := VenueEntity{venue.Name, venue.City, venue.State, current + 1, nil, owner(venueDoc)}
+	err = repo.Connection.replace(ctx, venueDoc, venueEntity.updates())
 	if err != nil {
 		log.Errorf("Failed to update venue %+v to %v, %v", id, venue, err)
 		return err
@@ -67,13 +92,12 @@ func (repo *VenueRepo) Update(ctx context.Context, id string, venue Venue) error
 
 func (repo *VenueRepo) Delete(ctx context.Context, id string) error {
 	log.Debug("Attemping to delete venue", id)
-	docId := repo.Connection.Client.Collection(venueCollection).Doc(id)
-	venueDoc, err := docId.Get(ctx)
+	venueDoc, err := repo.Connection.getLive(ctx, venueCollection, "venue", id)
 	if err != nil {
 		log.Errorf("Failed to find existing venue while deleting %+v, %v", id, err)
 		return err
 	}
-	_, err = venueDoc.Ref.Delete(ctx)
+	err = repo.Connection.trash(ctx, venueDoc)
 	if err != nil {
 		log.Error("Failed to delete venue", id, err)
 		return err
@@ -82,9 +106,52 @@ func (repo *VenueRepo) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+func (repo *VenueRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore venue", id)
+	venueDoc, err := repo.Connection.getDeleted(ctx, venueCollection, "venue", id)
+	if err != nil {
+		log.Errorf("Failed to find deleted venue while restoring %+v, %v", id, err)
+		return err
+	}
+	venue := toVenue(venueDoc)
+	existing, err := repo.findDocRef(ctx, venue.UserId, venue.Name, venue.City, venue.State)
+	if err == nil {
+		log.Errorf("Failed to restore venue %v, venue %v has the same name and location", id, existing.ID)
+		return fmt.Errorf("venue %s already exists with the same name and location", existing.ID)
+	}
+	if err != iterator.Done {
+		log.Errorf("Error occurred while checking for conflicting venues when restoring %v, %v", id, err)
+		return err
+	}
+
+	err = repo.Connection.restore(ctx, venueDoc)
+	if err != nil {
+		log.Error("Failed to restore venue", id, err)
+		return err
+	}
+	log.Infof("Successfully restored venue %+v", id)
+	return nil
+}
+
+func (repo *VenueRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge venue", id)
+	venueDoc, err := repo.Connection.getDeleted(ctx, venueCollection, "venue", id)
+	if err != nil {
+		log.Errorf("Failed to find deleted venue while purging %+v, %v", id, err)
+		return err
+	}
+	err = repo.Connection.delete(ctx, venueDoc.Ref)
+	if err != nil {
+		log.Error("Failed to purge venue", id, err)
+		return err
+	}
+	log.Infof("Successfully purged venue %+v", id)
+	return nil
+}
+
 func (repo *VenueRepo) Exists(ctx context.Context, venue Venue) (bool, error) {
 	log.Debug("Checking for existence of venue", venue)
-	doc, err := repo.findDocRef(ctx, venue.Name, venue.City, venue.State)
+	doc, err := repo.findDocRef(ctx, db.User(ctx), venue.Name, venue.City, venue.State)
 	if err == iterator.Done {
 		log.Debug("No existing venue found for", venue)
 		return false, nil
@@ -93,10 +160,24 @@ func (repo *VenueRepo) Exists(ctx context.Context, venue Venue) (bool, error) {
 		log.Errorf("Error while checking existence of venue %v, %v", venue, err)
 		return false, err
 	}
-	log.Debugf("Found venue %v with document ID %v", venue, doc.Ref.ID)
+	log.Debugf("Found venue %v with document ID %v", venue, doc.ID)
 	return true, nil
 }
 
+// also finds venues in the trash
+func (repo *VenueRepo) FindById(ctx context.Context, id string) (Venue, error) {
+	log.Debug("Finding venue", id)
+	doc, err := repo.Connection.get(ctx, repo.Connection.Client.Collection(venueCollection).Doc(id))
+	if err != nil {
+		log.Errorf("Error while finding venue %v, %v", id, err)
+		return Venue{}, err
+	}
+	if !accessible(ctx, doc) {
+		return Venue{}, fmt.Errorf("venue %s not found", id)
+	}
+	return toVenue(doc), nil
+}
+
 func (repo *VenueRepo) FindAll(ctx context.Context) ([]Venue, error) {
 	log.Debug("Finding all venues")
 	venueDocs, err := repo.Connection.Client.Collection(venueCollection).
@@ -109,31 +190,69 @@ func (repo *VenueRepo) FindAll(ctx context.Context) ([]Venue, error) {
 	}
 
 	venues := []Venue{}
-	for _, v := range venueDocs {
-		venues = append(venues, toVenue(v))
+	for _, v := range toDocuments(venueDocs) {
+		if deletedAt(v) == nil && accessible(ctx, v) {
+			venues = append(venues, toVenue(v))
+		}
 	}
 	log.Debugf("Found %d artists", len(venues))
 	return venues, nil
 }
 
-func toVenue(doc *firestore.DocumentSnapshot) Venue {
+func (repo *VenueRepo) FindDeleted(ctx context.Context) ([]Venue, error) {
+	log.Debug("Finding all deleted venues")
+	venueDocs, err := repo.Connection.Client.Collection(venueCollection).
+		Where("DeletedAt", "!=", nil).
+		Select(venueFields...).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Error("Error while finding all deleted venues,", err)
+		return nil, err
+	}
+
+	venues := []Venue{}
+	for _, doc := range toDocuments(venueDocs) {
+		if accessible(ctx, doc) {
+			venues = append(venues, toVenue(doc))
+		}
+	}
+	log.Debugf("Found %d deleted venues", len(venues))
+	return venues, nil
+}
+
+func toVenue(doc *document) Venue {
     venueData := doc.Data()
 	return Venue{
 		Name:    venueData["Name"].(string),
 		City:    venueData["City"].(string),
 		State:   venueData["State"].(string),
 		Id:      doc.Ref.ID,
+		Version:   storedVersion(doc),
+		DeletedAt: deletedAt(doc),
+		UserId:    owner(doc),
 	}
 }
 
-func (repo *VenueRepo) findDocRef(ctx context.Context, name string, city string, state string) (*firestore.DocumentSnapshot, error) {
-	return repo.Connection.Client.Collection(venueCollection).
-		Select().
+// only finds venues that are shared or belong to the user
+func (repo *VenueRepo) findDocRef(ctx context.Context, user string, name string, city string, state string) (*firestore.DocumentRef, error) {
+	if uow := getUnitOfWork(ctx); uow != nil {
+		for _, docOwner := range []string{user, db.SharedOwner} {
+			if docRef, ok := uow.venues[venueKey{docOwner, name, city, state}]; ok {
+				return docRef, nil
+			}
+		}
+	}
+	query := repo.Connection.Client.Collection(venueCollection).
+		Select("DeletedAt", "UserId").
 		Where("Name", "==", name).
 		Where("City", "==", city).
-		Where("State", "==", state).
-		Documents(ctx).
-		Next()
+		Where("State", "==", state)
+	venue, err := repo.Connection.findLive(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	return venue.Ref, nil
 }
 
 func (repo *VenueRepo) findAllDocs(ctx context.Context) (*map[string]Venue, error) {
@@ -146,7 +265,7 @@ func (repo *VenueRepo) findAllDocs(ctx context.Context) (*map[string]Venue, erro
 	}
 
 	venues := make(map[string]Venue)
-	for _, v := range venueDocs {
+	for _, v := range toDocuments(venueDocs) {
 		venues[v.Ref.ID] = toVenue(v)
 	}
 
@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"time"
+)
+
+type ArtistRepo struct {
+	Connection *Memory
+}
+
+type Artist = data.Artist
+
+func (repo *ArtistRepo) Add(ctx context.Context, artist Artist) (string, error) {
+	log.Debug("Attempting to add artist", artist)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	owner := db.User(ctx)
+	if id, ok := m.findArtistId(owner, artist.Name); ok {
+		log.Debugf("Skipping adding artist because it already exists %+v, %v", artist, id)
+		return id, nil
+	}
+
+	id := m.newId()
+	artist.Id = id
+	artist.Version = 1
+	if artist.UserId != db.SharedOwner {
+		artist.UserId = owner
+	}
+	m.artists[id] = artist
+	log.Infof("Created new artist %+v", id)
+	return id, nil
+}
+
+func (repo *ArtistRepo) Update(ctx context.Context, id string, artist Artist) error {
+	log.Debug("Attempting to update artist", id, artist)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	existing, ok := m.artists[id]
+	if !ok || existing.DeletedAt != nil || !db.CanAccessCatalog(ctx, existing.UserId) {
+		log.Errorf("Failed to find existing artist while updating %+v", id)
+		return notFound("artist", id)
+	}
+	if err := db.CheckVersion("artist", id, artist.Version, existing.Version); err != nil {
+		log.Errorf("Failed to update artist %v, %v", id, err)
+		return err
+	}
+	artist.Id = id
+	artist.Version = existing.Version + 1
+	artist.UserId = existing.UserId
+	m.artists[id] = artist
+	log.Info("Successfully updated artist", id)
+	return nil
+}
+
+func (repo *ArtistRepo) Delete(ctx context.Context, id string) error {
+	log.Debug("Attempting to delete artist", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	artist, ok := m.artists[id]
+	if !ok || artist.DeletedAt != nil || !db.CanAccessCatalog(ctx, artist.UserId) {
+		log.Errorf("Failed to find existing artist while deleting %+v", id)
+		return notFound("artist", id)
+	}
+	now := time.Now().UTC()
+	artist.DeletedAt = &now
+	m.artists[id] = artist
+	log.Infof("Successfully deleted artist %+v", id)
+	return nil
+}
+
+func (repo *ArtistRepo) FindDeleted(ctx context.Context) ([]Artist, error) {
+	log.Debug("Finding all deleted artists")
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	artists := []Artist{}
+	for _, r := range m.artists {
+		if r.DeletedAt != nil && db.CanAccessCatalog(ctx, r.UserId) {
+			artists = append(artists, r)
+		}
+	}
+	log.Debugf("Found %d deleted artists", len(artists))
+	return artists, nil
+}
+
+func (repo *ArtistRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore artist", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	artist, ok := m.artists[id]
+	if !ok || artist.DeletedAt == nil || !db.CanAccessCatalog(ctx, artist.UserId) {
+		log.Errorf("Failed to find deleted artist while restoring %+v", id)
+		return notFound("deleted artist", id)
+	}
+	if existingId, ok := m.findArtistId(artist.UserId, artist.Name); ok {
+		log.Errorf("Failed to restore artist %v, artist %v has the same name", id, existingId)
+		return fmt.Errorf("artist %s already exists with the same name", existingId)
+	}
+	artist.DeletedAt = nil
+	m.artists[id] = artist
+	log.Infof("Successfully restored artist %+v", id)
+	return nil
+}
+
+func (repo *ArtistRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge artist", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	if artist, ok := m.artists[id]; !ok || artist.DeletedAt == nil || !db.CanAccessCatalog(ctx, artist.UserId) {
+		log.Errorf("Failed to find deleted artist while purging %+v", id)
+		return notFound("deleted artist", id)
+	}
+	delete(m.artists, id)
+	log.Infof("Successfully purged artist %+v", id)
+	return nil
+}
+
+func (repo *ArtistRepo) Exists(ctx context.Context, artist Artist) (bool, error) {
+	log.Debug("Checking for existence of artist", artist)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	_, ok := m.findArtistId(db.User(ctx), artist.Name)
+	return ok, nil
+}
+
+// also finds artists in the trash
+func (repo *ArtistRepo) FindById(ctx context.Context, id string) (Artist, error) {
+	log.Debug("Finding artist", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	artist, ok := m.artists[id]
+	if !ok || !db.CanAccessCatalog(ctx, artist.UserId) {
+		return Artist{}, notFound("artist", id)
+	}
+	return artist, nil
+}
+
+func (repo *ArtistRepo) FindAll(ctx context.Context) ([]Artist, error) {
+	log.Debug("Finding all artists")
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	artists := []Artist{}
+	for _, a := range m.artists {
+		if a.DeletedAt == nil && db.CanAccessCatalog(ctx, a.UserId) {
+			artists = append(artists, a)
+		}
+	}
+	log.Debugf("Found %d artists", len(artists))
+	return artists, nil
+}
+
+// only finds records outside of the trash that are shared or belong to the owner,
+// must be called while holding the mutex
+func (m *Memory) findArtistId(owner string, name string) (string, bool) {
+	for id, a := range m.artists {
+		if a.Name == name && a.DeletedAt == nil &&
+			(a.UserId == db.SharedOwner || a.UserId == owner) {
+			return id, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"context"
+)
+
+type AuditRepo struct {
+	Connection *Memory
+}
+
+func (repo *AuditRepo) Add(ctx context.Context, entry data.AuditEntry) error {
+	log.Debugf("Recording %s of %s %v", entry.Action, entry.Entity, entry.EntityId)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	entry.Id = m.newId()
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+// entries are appended as they happen, so they are already in order
+func (repo *AuditRepo) Find(ctx context.Context, entity string, id string) ([]data.AuditEntry, error) {
+	log.Debug("Finding audit entries", entity, id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	entries := []data.AuditEntry{}
+	for _, entry := range m.audit {
+		if entry.Entity == entity && (id == "" || entry.EntityId == id) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
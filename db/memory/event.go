@@ -0,0 +1,431 @@
+package memory
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"concert-manager/util"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type EventRepo struct {
+	Connection *Memory
+}
+
+type Event = data.Event
+
+func (repo *EventRepo) Add(ctx context.Context, event Event) (string, error) {
+	log.Debug("Attempting to add event", event)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	record, err := m.toRecord(db.User(ctx), event)
+	if err != nil {
+		return "", err
+	}
+
+	if id, ok := m.findEventId(record.userId, record.date, record.venueId); ok {
+		log.Debugf("Skipped adding event because it already existed as %+v, %v", event, id)
+		return id, nil
+	}
+
+	id := m.newId()
+	record.version = 1
+	m.events[id] = record
+	log.Infof("Created new event %+v", id)
+	return id, nil
+}
+
+// Requires that all the artists and the venue already exist
+func (repo *EventRepo) Update(ctx context.Context, id string, event Event) error {
+	log.Debug("Attempting to update event", id, event)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	existing, ok := m.events[id]
+	if !ok || existing.deletedAt != nil || !db.CanAccessEvent(ctx, existing.userId) {
+		log.Errorf("Failed to find existing event while updating %+v", id)
+		return notFound("event", id)
+	}
+	if err := db.CheckVersion("event", id, event.Version, existing.version); err != nil {
+		log.Errorf("Failed to update event %v, %v", id, err)
+		return err
+	}
+
+	record, err := m.toRecord(existing.userId, event)
+	if err != nil {
+		return err
+	}
+
+	if existingId, ok := m.findEventId(record.userId, record.date, record.venueId); ok && existingId != id {
+		log.Errorf("Failed to update event %v, another event %v exists for the same date and venue", id, existingId)
+		return fmt.Errorf("event %s already exists for the same date and venue", existingId)
+	}
+
+	record.version = existing.version + 1
+	m.events[id] = record
+	log.Info("Successfully updated event", id)
+	return nil
+}
+
+// The references are resolved among the artists and venues the owner can see.
+// must be called while holding the mutex
+func (m *Memory) toRecord(owner string, event Event) (eventRecord, error) {
+	mainActId := ""
+	if event.MainAct.Populated() {
+		id, ok := m.findArtistId(owner, event.MainAct.Name)
+		if !ok {
+			log.Errorf("Failed to find existing artist %v for event %v", event.MainAct.Name, event)
+			return eventRecord{}, fmt.Errorf("artist %s not found", event.MainAct.Name)
+		}
+		mainActId = id
+	}
+
+	openerIds := []string{}
+	for _, opener := range event.Openers {
+		id, ok := m.findArtistId(owner, opener.Name)
+		if !ok {
+			log.Errorf("Failed to find existing opening artist %v for event %v", opener.Name, event)
+			return eventRecord{}, fmt.Errorf("artist %s not found", opener.Name)
+		}
+		openerIds = append(openerIds, id)
+	}
+
+	venueId, ok := m.findVenueId(owner, event.Venue.Name, event.Venue.City, event.Venue.State)
+	if !ok {
+		log.Errorf("Failed to find existing venue %+v for event", event.Venue)
+		return eventRecord{}, fmt.Errorf("venue %s not found", event.Venue.Name)
+	}
+
+	return eventRecord{
+		mainActId:  mainActId,
+		openerIds:  openerIds,
+		venueId:    venueId,
+		date:       normalizeDate(event.Date),
+		purchased:  event.Purchased,
+		tmId:       event.TmId,
+		userId:     owner,
+		archivedAt: event.ArchivedAt,
+	}, nil
+}
+
+func (repo *EventRepo) Delete(ctx context.Context, id string) error {
+	log.Debug("Attempting to delete event", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	e, ok := m.events[id]
+	if !ok || e.deletedAt != nil || !db.CanAccessEvent(ctx, e.userId) {
+		log.Errorf("Failed to find existing event while removing %+v", id)
+		return notFound("event", id)
+	}
+	now := time.Now().UTC()
+	e.deletedAt = &now
+	m.events[id] = e
+	log.Infof("Successfully deleted event %+v", id)
+	return nil
+}
+
+func (repo *EventRepo) FindDeleted(ctx context.Context) ([]Event, error) {
+	log.Debug("Finding all deleted events")
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	events := []Event{}
+	for id, e := range m.events {
+		if e.deletedAt == nil || !db.CanAccessEvent(ctx, e.userId) {
+			continue
+		}
+		inspection := m.inspect(id, e)
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid deleted event %v, %v", id, inspection.problems)
+			continue
+		}
+		events = append(events, inspection.event)
+	}
+	log.Debugf("Returning %d deleted events", len(events))
+	return events, nil
+}
+
+// Events can only be restored once their artists and venue are out of the trash
+func (repo *EventRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore event", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	e, ok := m.events[id]
+	if !ok || e.deletedAt == nil || !db.CanAccessEvent(ctx, e.userId) {
+		log.Errorf("Failed to find deleted event while restoring %+v", id)
+		return notFound("deleted event", id)
+	}
+	inspection := m.inspect(id, e)
+	if len(inspection.problems) > 0 {
+		log.Errorf("Unable to restore invalid event %v, %v", id, inspection.problems)
+		return fmt.Errorf("event %s can't be restored, %v", id, inspection.problems)
+	}
+	if trashed := inspection.event.TrashedReferences(); len(trashed) > 0 {
+		log.Errorf("Unable to restore event %v before its references, %v", id, trashed)
+		return fmt.Errorf("event %s can't be restored until its %s are restored", id, strings.Join(trashed, ", "))
+	}
+	if existingId, ok := m.findEventId(e.userId, e.date, e.venueId); ok {
+		log.Errorf("Failed to restore event %v, event %v exists for the same date and venue", id, existingId)
+		return fmt.Errorf("event %s already exists for the same date and venue", existingId)
+	}
+
+	e.deletedAt = nil
+	m.events[id] = e
+	log.Infof("Successfully restored event %+v", id)
+	return nil
+}
+
+func (repo *EventRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge event", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	if e, ok := m.events[id]; !ok || e.deletedAt == nil || !db.CanAccessEvent(ctx, e.userId) {
+		log.Errorf("Failed to find deleted event while purging %+v", id)
+		return notFound("deleted event", id)
+	}
+	delete(m.events, id)
+	log.Infof("Successfully purged event %+v", id)
+	return nil
+}
+
+func (repo *EventRepo) Exists(ctx context.Context, event Event) (bool, error) {
+	log.Debug("Checking for existence of event", event)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	owner := db.User(ctx)
+	venueId, ok := m.findVenueId(owner, event.Venue.Name, event.Venue.City, event.Venue.State)
+	if !ok {
+		return false, nil
+	}
+	_, ok = m.findEventId(owner, event.Date, venueId)
+	return ok, nil
+}
+
+// Also finds events in the trash. Invalid events only hold the references that still exist
+func (repo *EventRepo) FindById(ctx context.Context, id string) (Event, error) {
+	log.Debug("Finding event", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	e, ok := m.events[id]
+	if !ok || !db.CanAccessEvent(ctx, e.userId) {
+		return Event{}, notFound("event", id)
+	}
+	return m.inspect(id, e).event, nil
+}
+
+func (repo *EventRepo) FindAll(ctx context.Context) ([]Event, error) {
+	log.Debug("Finding all events")
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	events := []Event{}
+	for id, e := range m.events {
+		if e.deletedAt != nil || !db.CanAccessEvent(ctx, e.userId) {
+			continue
+		}
+		inspection := m.inspect(id, e)
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid event %v, %v", id, inspection.problems)
+			continue
+		}
+		events = append(events, inspection.event)
+	}
+	log.Debugf("Returning %d constructed events", len(events))
+	return events, nil
+}
+
+func (repo *EventRepo) Query(ctx context.Context, query data.EventQuery) (data.EventPage, error) {
+	log.Debugf("Querying events %+v", query)
+	var cursor *util.EventCursor
+	if query.Cursor != "" {
+		c, err := util.DecodeEventCursor(query.Cursor)
+		if err != nil {
+			return data.EventPage{}, err
+		}
+		cursor = &c
+	}
+
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	type match struct {
+		ts    time.Time
+		event Event
+	}
+	matches := []match{}
+	for id, e := range m.events {
+		ts := util.Timestamp(e.date)
+		if e.deletedAt != nil || !db.CanAccessEvent(ctx, e.userId) ||
+			query.From != "" && ts.Before(util.Timestamp(query.From)) ||
+			query.To != "" && ts.After(util.Timestamp(query.To)) ||
+			query.Purchased != nil && e.purchased != *query.Purchased ||
+			query.VenueId != "" && e.venueId != query.VenueId ||
+			query.ArtistId != "" && e.mainActId != query.ArtistId && !slices.Contains(e.openerIds, query.ArtistId) ||
+			cursor != nil && !cursor.Precedes(ts, id) {
+			continue
+		}
+		inspection := m.inspect(id, e)
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid event %v, %v", id, inspection.problems)
+			continue
+		}
+		matches = append(matches, match{ts, inspection.event})
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		if c := a.ts.Compare(b.ts); c != 0 {
+			return c
+		}
+		return strings.Compare(a.event.Id, b.event.Id)
+	})
+
+	page := data.EventPage{Events: []Event{}}
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+		last := matches[len(matches)-1]
+		page.NextCursor = util.NewEventCursor(last.ts, last.event.Id).Encode()
+	}
+	for _, match := range matches {
+		page.Events = append(page.Events, match.event)
+	}
+	log.Debugf("Returning %d queried events", len(page.Events))
+	return page, nil
+}
+
+func (repo *EventRepo) FindIntegrityIssues(ctx context.Context) ([]data.IntegrityIssue, error) {
+	log.Debug("Checking integrity of all events")
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	issues := []data.IntegrityIssue{}
+	for id, e := range m.events {
+		if e.deletedAt != nil || !db.CanAccessEvent(ctx, e.userId) {
+			continue
+		}
+		inspection := m.inspect(id, e)
+		if len(inspection.problems) > 0 {
+			issues = append(issues, data.IntegrityIssue{
+				Entity:     "event",
+				Id:         id,
+				Problems:   inspection.problems,
+				Repairable: inspection.repairable(),
+			})
+		}
+	}
+	log.Debugf("Found %d events with integrity issues", len(issues))
+	return issues, nil
+}
+
+// Drops the dangling artist references of an invalid event. Events without a
+// valid venue or any remaining artist can't be repaired and have to be deleted instead.
+func (repo *EventRepo) Repair(ctx context.Context, id string) error {
+	log.Debug("Attempting to repair event", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	e, ok := m.events[id]
+	if !ok || e.deletedAt != nil || !db.CanAccessEvent(ctx, e.userId) {
+		log.Errorf("Failed to find existing event while repairing %+v", id)
+		return notFound("event", id)
+	}
+	inspection := m.inspect(id, e)
+	if len(inspection.problems) == 0 {
+		log.Debug("Skipped repairing event because it has no integrity issues", id)
+		return nil
+	}
+	if !inspection.repairable() {
+		log.Errorf("Unable to repair event %v, %v", id, inspection.problems)
+		return fmt.Errorf("event %s can't be repaired, %v", id, inspection.fatal)
+	}
+
+	inspection.record.version++
+	m.events[id] = inspection.record
+	log.Info("Successfully repaired event", id)
+	return nil
+}
+
+type eventInspection struct {
+	event    Event
+	record   eventRecord
+	problems []string
+	fatal    []string
+}
+
+func (i *eventInspection) repairable() bool {
+	return len(i.fatal) == 0
+}
+
+func (i *eventInspection) problem(fatal bool, format string, args ...any) {
+	problem := fmt.Sprintf(format, args...)
+	i.problems = append(i.problems, problem)
+	if fatal {
+		i.fatal = append(i.fatal, problem)
+	}
+}
+
+// Resolves the references of a stored event. The event and record of the
+// inspection only hold the references that still exist. Trashed artists and
+// venues only count as existing for events that are in the trash too.
+// must be called while holding the mutex
+func (m *Memory) inspect(id string, e eventRecord) eventInspection {
+	i := eventInspection{
+		event: Event{Openers: []Artist{}, Date: e.date, Purchased: e.purchased, TmId: e.tmId, Id: id,
+			Version: e.version, DeletedAt: e.deletedAt, UserId: e.userId, ArchivedAt: e.archivedAt},
+		record: eventRecord{openerIds: []string{}, date: e.date, purchased: e.purchased, tmId: e.tmId,
+			version: e.version, deletedAt: e.deletedAt, userId: e.userId, archivedAt: e.archivedAt},
+	}
+	visible := func(deletedAt *time.Time) bool {
+		return deletedAt == nil || e.deletedAt != nil
+	}
+	if e.mainActId != "" {
+		if mainAct, ok := m.artists[e.mainActId]; ok && visible(mainAct.DeletedAt) {
+			i.event.MainAct = mainAct
+			i.record.mainActId = e.mainActId
+		} else {
+			i.problem(false, "main act %s does not exist", e.mainActId)
+		}
+	}
+	for _, openerId := range e.openerIds {
+		if opener, ok := m.artists[openerId]; ok && visible(opener.DeletedAt) {
+			i.event.Openers = append(i.event.Openers, opener)
+			i.record.openerIds = append(i.record.openerIds, openerId)
+		} else {
+			i.problem(false, "opener %s does not exist", openerId)
+		}
+	}
+	if i.record.mainActId == "" && len(i.record.openerIds) == 0 {
+		i.problem(true, "event has no valid artists")
+	}
+	if venue, ok := m.venues[e.venueId]; ok && visible(venue.DeletedAt) {
+		i.event.Venue = venue
+		i.record.venueId = e.venueId
+	} else {
+		i.problem(true, "venue %s does not exist", e.venueId)
+	}
+	return i
+}
+
+// only finds records of the owner outside of the trash, must be called while holding the mutex
+func (m *Memory) findEventId(owner string, date string, venueId string) (string, bool) {
+	date = normalizeDate(date)
+	for id, e := range m.events {
+		if e.venueId == venueId && e.date == date && e.deletedAt == nil && e.userId == owner {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// the same day can be written with or without leading zeros, so store it the way Firestore returns it
+func normalizeDate(date string) string {
+	return util.Date(util.Timestamp(date))
+}
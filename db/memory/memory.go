@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"concert-manager/data"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Keeps all records in process memory. Nothing survives a restart, so this is
+// mostly useful for tests and for trying out the app without any database
+type Memory struct {
+	mutex   sync.Mutex
+	artists map[string]Artist
+	venues  map[string]Venue
+	events  map[string]eventRecord
+	audit   []data.AuditEntry
+	lastId  int
+}
+
+// events only hold references, the same way the persistent backends store them
+type eventRecord struct {
+	mainActId  string
+	openerIds  []string
+	venueId    string
+	date       string
+	purchased  bool
+	tmId       string
+	version    int
+	deletedAt  *time.Time
+	userId     string
+	archivedAt *time.Time
+}
+
+func Setup() *Memory {
+	return &Memory{
+		artists: map[string]Artist{},
+		venues:  map[string]Venue{},
+		events:  map[string]eventRecord{},
+	}
+}
+
+// must be called while holding the mutex
+func (m *Memory) newId() string {
+	m.lastId++
+	return strconv.Itoa(m.lastId)
+}
+
+func notFound(entity string, id string) error {
+	return fmt.Errorf("%s %s not found", entity, id)
+}
+
+type txKey struct{}
+
+// Runs f while holding the lock for the whole store, so other callers never see partial writes.
+// If f returns an error, every change made through the given context is reverted
+func (m *Memory) RunTransaction(ctx context.Context, f func(context.Context) error) error {
+	if ctx.Value(txKey{}) == m {
+		return f(ctx)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	artists := maps.Clone(m.artists)
+	venues := maps.Clone(m.venues)
+	events := maps.Clone(m.events)
+	audit := slices.Clone(m.audit)
+
+	if err := f(context.WithValue(ctx, txKey{}, m)); err != nil {
+		m.artists, m.venues, m.events, m.audit = artists, venues, events, audit
+		return err
+	}
+	return nil
+}
+
+// locks the store unless the context belongs to a transaction that already holds the lock
+func (m *Memory) lock(ctx context.Context) func() {
+	if ctx.Value(txKey{}) == m {
+		return func() {}
+	}
+	m.mutex.Lock()
+	return m.mutex.Unlock
+}
@@ -0,0 +1,19 @@
+package memory
+
+import (
+	"concert-manager/db/repotest"
+	"testing"
+)
+
+func TestRepositoryConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		m := Setup()
+		return repotest.Repos{
+			VenueRepo:  &VenueRepo{Connection: m},
+			ArtistRepo: &ArtistRepo{Connection: m},
+			EventRepo:  &EventRepo{Connection: m},
+			Transactor: m,
+			AuditRepo:  &AuditRepo{Connection: m},
+		}
+	})
+}
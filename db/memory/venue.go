@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"time"
+)
+
+type VenueRepo struct {
+	Connection *Memory
+}
+
+type Venue = data.Venue
+
+func (repo *VenueRepo) Add(ctx context.Context, venue Venue) (string, error) {
+	log.Debug("Attempting to add venue", venue)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	owner := db.User(ctx)
+	if id, ok := m.findVenueId(owner, venue.Name, venue.City, venue.State); ok {
+		log.Debugf("Skipping adding venue because it already exists %+v, %v", venue, id)
+		return id, nil
+	}
+
+	id := m.newId()
+	venue.Id = id
+	venue.Version = 1
+	if venue.UserId != db.SharedOwner {
+		venue.UserId = owner
+	}
+	m.venues[id] = venue
+	log.Infof("Created new venue %+v", id)
+	return id, nil
+}
+
+func (repo *VenueRepo) Update(ctx context.Context, id string, venue Venue) error {
+	log.Debug("Attempting to update venue", id, venue)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	existing, ok := m.venues[id]
+	if !ok || existing.DeletedAt != nil || !db.CanAccessCatalog(ctx, existing.UserId) {
+		log.Errorf("Failed to find existing venue while updating %+v", id)
+		return notFound("venue", id)
+	}
+	if err := db.CheckVersion("venue", id, venue.Version, existing.Version); err != nil {
+		log.Errorf("Failed to update venue %v, %v", id, err)
+		return err
+	}
+	venue.Id = id
+	venue.Version = existing.Version + 1
+	venue.UserId = existing.UserId
+	m.venues[id] = venue
+	log.Info("Successfully updated venue", id)
+	return nil
+}
+
+func (repo *VenueRepo) Delete(ctx context.Context, id string) error {
+	log.Debug("Attempting to delete venue", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	venue, ok := m.venues[id]
+	if !ok || venue.DeletedAt != nil || !db.CanAccessCatalog(ctx, venue.UserId) {
+		log.Errorf("Failed to find existing venue while deleting %+v", id)
+		return notFound("venue", id)
+	}
+	now := time.Now().UTC()
+	venue.DeletedAt = &now
+	m.venues[id] = venue
+	log.Infof("Successfully deleted venue %+v", id)
+	return nil
+}
+
+func (repo *VenueRepo) FindDeleted(ctx context.Context) ([]Venue, error) {
+	log.Debug("Finding all deleted venues")
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	venues := []Venue{}
+	for _, r := range m.venues {
+		if r.DeletedAt != nil && db.CanAccessCatalog(ctx, r.UserId) {
+			venues = append(venues, r)
+		}
+	}
+	log.Debugf("Found %d deleted venues", len(venues))
+	return venues, nil
+}
+
+func (repo *VenueRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore venue", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	venue, ok := m.venues[id]
+	if !ok || venue.DeletedAt == nil || !db.CanAccessCatalog(ctx, venue.UserId) {
+		log.Errorf("Failed to find deleted venue while restoring %+v", id)
+		return notFound("deleted venue", id)
+	}
+	if existingId, ok := m.findVenueId(venue.UserId, venue.Name, venue.City, venue.State); ok {
+		log.Errorf("Failed to restore venue %v, venue %v has the same name and location", id, existingId)
+		return fmt.Errorf("venue %s already exists with the same name and location", existingId)
+	}
+	venue.DeletedAt = nil
+	m.venues[id] = venue
+	log.Infof("Successfully restored venue %+v", id)
+	return nil
+}
+
+func (repo *VenueRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge venue", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	if venue, ok := m.venues[id]; !ok || venue.DeletedAt == nil || !db.CanAccessCatalog(ctx, venue.UserId) {
+		log.Errorf("Failed to find deleted venue while purging %+v", id)
+		return notFound("deleted venue", id)
+	}
+	delete(m.venues, id)
+	log.Infof("Successfully purged venue %+v", id)
+	return nil
+}
+
+func (repo *VenueRepo) Exists(ctx context.Context, venue Venue) (bool, error) {
+	log.Debug("Checking for existence of venue", venue)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	_, ok := m.findVenueId(db.User(ctx), venue.Name, venue.City, venue.State)
+	return ok, nil
+}
+
+// also finds venues in the trash
+func (repo *VenueRepo) FindById(ctx context.Context, id string) (Venue, error) {
+	log.Debug("Finding venue", id)
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	venue, ok := m.venues[id]
+	if !ok || !db.CanAccessCatalog(ctx, venue.UserId) {
+		return Venue{}, notFound("venue", id)
+	}
+	return venue, nil
+}
+
+func (repo *VenueRepo) FindAll(ctx context.Context) ([]Venue, error) {
+	log.Debug("Finding all venues")
+	m := repo.Connection
+	defer m.lock(ctx)()
+
+	venues := []Venue{}
+	for _, v := range m.venues {
+		if v.DeletedAt == nil && db.CanAccessCatalog(ctx, v.UserId) {
+			venues = append(venues, v)
+		}
+	}
+	log.Debugf("Found %d venues", len(venues))
+	return venues, nil
+}
+
+// only finds records outside of the trash that are shared or belong to the owner,
+// must be called while holding the mutex
+func (m *Memory) findVenueId(owner string, name string, city string, state string) (string, bool) {
+	for id, v := range m.venues {
+		if v.Name == name && v.City == city && v.State == state && v.DeletedAt == nil &&
+			(v.UserId == db.SharedOwner || v.UserId == owner) {
+			return id, true
+		}
+	}
+	return "", false
+}
@@ -3,46 +3,131 @@ package db
 import (
 	"concert-manager/data"
 	"concert-manager/log"
+	"concert-manager/util"
 	"context"
 	"errors"
+	"fmt"
 )
 
+// Returned when an update was made with a version older than the stored record
+var ErrVersionConflict = errors.New("record was modified since it was read")
+
+// Returned by a Transactor when nothing was written and the whole transaction can be run again,
+// like when the database became unreachable and later writes go somewhere else
+var ErrRetryTransaction = errors.New("transaction can be retried")
+
+// Version 0 skips the check, for writes that should always overwrite the stored record
+func CheckVersion(entity string, id string, expected int, actual int) error {
+	if expected == 0 || expected == actual {
+		return nil
+	}
+	return fmt.Errorf("%w, %s %s is at version %d but the update expected %d",
+		ErrVersionConflict, entity, id, actual, expected)
+}
+
 type (
+	// Delete moves a record to the trash, hiding it from every other method until it's restored.
+	// Only trashed records can be purged, which removes them for good
 	VenueRepo interface {
 		Add(context.Context, data.Venue) (string, error)
 		Update(context.Context, string, data.Venue) error
 		Delete(context.Context, string) error
+		FindDeleted(context.Context) ([]data.Venue, error)
+		Restore(context.Context, string) error
+		Purge(context.Context, string) error
 		Exists(context.Context, data.Venue) (bool, error)
+		FindById(context.Context, string) (data.Venue, error)
 		FindAll(context.Context) ([]data.Venue, error)
 	}
 	ArtistRepo interface {
 		Add(context.Context, data.Artist) (string, error)
 		Update(context.Context, string, data.Artist) error
 		Delete(context.Context, string) error
+		FindDeleted(context.Context) ([]data.Artist, error)
+		Restore(context.Context, string) error
+		Purge(context.Context, string) error
 		Exists(context.Context, data.Artist) (bool, error)
+		FindById(context.Context, string) (data.Artist, error)
 		FindAll(context.Context) ([]data.Artist, error)
 	}
 	EventRepo interface {
 		Add(context.Context, data.Event) (string, error)
+		Update(context.Context, string, data.Event) error
 		Delete(context.Context, string) error
+		FindDeleted(context.Context) ([]data.Event, error)
+		Restore(context.Context, string) error
+		Purge(context.Context, string) error
 		Exists(context.Context, data.Event) (bool, error)
+		FindById(context.Context, string) (data.Event, error)
 		FindAll(context.Context) ([]data.Event, error)
+		Query(context.Context, data.EventQuery) (data.EventPage, error)
+		FindIntegrityIssues(context.Context) ([]data.IntegrityIssue, error)
+		Repair(context.Context, string) error
+	}
+	// Entries can only be added, never changed or removed
+	AuditRepo interface {
+		Add(context.Context, data.AuditEntry) error
+		Find(context.Context, string, string) ([]data.AuditEntry, error)
+	}
+	// Makes every repository call made with the context passed to the function
+	// part of a single unit of work that commits or rolls back as a whole
+	Transactor interface {
+		RunTransaction(context.Context, func(context.Context) error) error
 	}
 	DatabaseRepository struct {
 		VenueRepo  VenueRepo
 		ArtistRepo ArtistRepo
 		EventRepo  EventRepo
+		Transactor Transactor
+		AuditRepo  AuditRepo
+		// Keeps the artists and venues added by each user private to them,
+		// instead of sharing them with every user of the deployment
+		PrivateCatalog bool
 	}
 )
 
+// The owner given to new artists and venues
+func (r *DatabaseRepository) catalogOwner(ctx context.Context) string {
+	if r.PrivateCatalog {
+		return User(ctx)
+	}
+	return SharedOwner
+}
+
+func (r *DatabaseRepository) RunTransaction(ctx context.Context, f func(context.Context) error) error {
+	if r.Transactor == nil {
+		log.Debug("No transaction support configured, running writes individually")
+		return f(ctx)
+	}
+	err := r.Transactor.RunTransaction(ctx, f)
+	if err != nil {
+		log.Error("Transaction failed,", err)
+		return err
+	}
+	return nil
+}
+
 func (r *DatabaseRepository) AddVenue(ctx context.Context, venue data.Venue) (string, error) {
 	log.Debug("Request to add venue", venue)
 	if !venue.Populated() {
 		log.Debug("Skipping adding venue because required fields are missing", venue)
 		return "", errors.New("failed to create venue due to empty fields")
 	}
+	venue.UserId = r.catalogOwner(ctx)
 
-	id, err := r.VenueRepo.Add(ctx, venue)
+	var id string
+	err := r.audit(ctx, "venue", AuditCreate, func(ctx context.Context) (auditChange, error) {
+		exists, err := r.VenueRepo.Exists(ctx, venue)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if id, err = r.VenueRepo.Add(ctx, venue); err != nil || exists {
+			return auditChange{skip: true}, err
+		}
+		created := venue
+		created.Id, created.Version = id, 1
+		return auditChange{id: id, after: created}, nil
+	})
 	if err != nil {
 		log.Errorf("Error while adding venue %v, %v\n", venue, err)
 		return "", err
@@ -52,7 +137,18 @@ func (r *DatabaseRepository) AddVenue(ctx context.Context, venue data.Venue) (st
 
 func (r *DatabaseRepository) UpdateVenue(ctx context.Context, id string, venue data.Venue) error {
 	log.Debug("Request to update venue", id, venue)
-	err := r.VenueRepo.Update(ctx, id, venue)
+	err := r.audit(ctx, "venue", AuditUpdate, func(ctx context.Context) (auditChange, error) {
+		before, err := r.VenueRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := r.VenueRepo.Update(ctx, id, venue); err != nil {
+			return auditChange{}, err
+		}
+		after := venue
+		after.Id, after.Version = id, before.Version+1
+		return auditChange{id: id, before: before, after: after}, nil
+	})
 	if err != nil {
 		log.Errorf("Error while updating venue %v, %v\n", id, err)
 		return err
@@ -62,7 +158,13 @@ func (r *DatabaseRepository) UpdateVenue(ctx context.Context, id string, venue d
 
 func (r *DatabaseRepository) DeleteVenue(ctx context.Context, id string) error {
 	log.Debug("Request to delete venue", id)
-	err := r.VenueRepo.Delete(ctx, id)
+	err := r.audit(ctx, "venue", AuditDelete, func(ctx context.Context) (auditChange, error) {
+		before, err := r.VenueRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{id: id, before: before}, r.VenueRepo.Delete(ctx, id)
+	})
 	if err != nil {
 		log.Errorf("Error while deleting venue %v, %v\n", id, err)
 		return err
@@ -70,6 +172,61 @@ func (r *DatabaseRepository) DeleteVenue(ctx context.Context, id string) error {
 	return nil
 }
 
+func (r *DatabaseRepository) ListDeletedVenues(ctx context.Context) ([]data.Venue, error) {
+	log.Debug("Request to list all deleted venues")
+	venues, err := r.VenueRepo.FindDeleted(ctx)
+	if err != nil {
+		log.Error("Error while listing deleted venues,", err)
+		return nil, err
+	}
+	return venues, nil
+}
+
+func (r *DatabaseRepository) RestoreVenue(ctx context.Context, id string) error {
+	log.Debug("Request to restore venue", id)
+	err := r.audit(ctx, "venue", AuditRestore, func(ctx context.Context) (auditChange, error) {
+		before, err := r.VenueRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		after := before
+		after.DeletedAt = nil
+		return auditChange{id: id, before: before, after: after}, r.VenueRepo.Restore(ctx, id)
+	})
+	if err != nil {
+		log.Errorf("Error while restoring venue %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
+
+func (r *DatabaseRepository) PurgeVenue(ctx context.Context, id string) error {
+	log.Debug("Request to purge venue", id)
+	err := r.audit(ctx, "venue", AuditPurge, func(ctx context.Context) (auditChange, error) {
+		before, err := r.VenueRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{id: id, before: before}, r.VenueRepo.Purge(ctx, id)
+	})
+	if err != nil {
+		log.Errorf("Error while purging venue %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
+
+// Also finds venues in the trash
+func (r *DatabaseRepository) GetVenue(ctx context.Context, id string) (data.Venue, error) {
+	log.Debug("Request to get venue", id)
+	venue, err := r.VenueRepo.FindById(ctx, id)
+	if err != nil {
+		log.Errorf("Error while getting venue %v, %v", id, err)
+		return data.Venue{}, err
+	}
+	return venue, nil
+}
+
 func (r *DatabaseRepository) ListVenues(ctx context.Context) ([]data.Venue, error) {
 	log.Debug("Request to list all venues")
     venues, err := r.VenueRepo.FindAll(ctx)
@@ -86,8 +243,21 @@ func (r *DatabaseRepository) AddArtist(ctx context.Context, artist data.Artist)
 		log.Debug("Skipping adding artist because required fields are missing", artist)
 		return "", errors.New("failed to create artist due to empty fields")
 	}
+	artist.UserId = r.catalogOwner(ctx)
 
-	id, err := r.ArtistRepo.Add(ctx, artist)
+	var id string
+	err := r.audit(ctx, "artist", AuditCreate, func(ctx context.Context) (auditChange, error) {
+		exists, err := r.ArtistRepo.Exists(ctx, artist)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if id, err = r.ArtistRepo.Add(ctx, artist); err != nil || exists {
+			return auditChange{skip: true}, err
+		}
+		created := artist
+		created.Id, created.Version = id, 1
+		return auditChange{id: id, after: created}, nil
+	})
 	if err != nil {
 		log.Errorf("Error while adding artist %v, %v\n", artist, err)
 		return "", err
@@ -97,7 +267,18 @@ func (r *DatabaseRepository) AddArtist(ctx context.Context, artist data.Artist)
 
 func (r *DatabaseRepository) UpdateArtist(ctx context.Context, id string, artist data.Artist) error {
 	log.Debug("Request to update artist", id, artist)
-	err := r.ArtistRepo.Update(ctx, id, artist)
+	err := r.audit(ctx, "artist", AuditUpdate, func(ctx context.Context) (auditChange, error) {
+		before, err := r.ArtistRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := r.ArtistRepo.Update(ctx, id, artist); err != nil {
+			return auditChange{}, err
+		}
+		after := artist
+		after.Id, after.Version = id, before.Version+1
+		return auditChange{id: id, before: before, after: after}, nil
+	})
 	if err != nil {
 		log.Errorf("Error while updating artist %v, %v\n", id, err)
 		return err
@@ -107,7 +288,13 @@ func (r *DatabaseRepository) UpdateArtist(ctx context.Context, id string, artist
 
 func (r *DatabaseRepository) DeleteArtist(ctx context.Context, id string) error {
 	log.Debug("Request to delete artist", id)
-	err := r.ArtistRepo.Delete(ctx, id)
+	err := r.audit(ctx, "artist", AuditDelete, func(ctx context.Context) (auditChange, error) {
+		before, err := r.ArtistRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{id: id, before: before}, r.ArtistRepo.Delete(ctx, id)
+	})
 	if err != nil {
 		log.Errorf("Error while deleting artist %v, %v\n", id, err)
 		return err
@@ -115,6 +302,61 @@ func (r *DatabaseRepository) DeleteArtist(ctx context.Context, id string) error
 	return nil
 }
 
+func (r *DatabaseRepository) ListDeletedArtists(ctx context.Context) ([]data.Artist, error) {
+	log.Debug("Request to list all deleted artists")
+	artists, err := r.ArtistRepo.FindDeleted(ctx)
+	if err != nil {
+		log.Error("Error while listing deleted artists,", err)
+		return nil, err
+	}
+	return artists, nil
+}
+
+func (r *DatabaseRepository) RestoreArtist(ctx context.Context, id string) error {
+	log.Debug("Request to restore artist", id)
+	err := r.audit(ctx, "artist", AuditRestore, func(ctx context.Context) (auditChange, error) {
+		before, err := r.ArtistRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		after := before
+		after.DeletedAt = nil
+		return auditChange{id: id, before: before, after: after}, r.ArtistRepo.Restore(ctx, id)
+	})
+	if err != nil {
+		log.Errorf("Error while restoring artist %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
+
+func (r *DatabaseRepository) PurgeArtist(ctx context.Context, id string) error {
+	log.Debug("Request to purge artist", id)
+	err := r.audit(ctx, "artist", AuditPurge, func(ctx context.Context) (auditChange, error) {
+		before, err := r.ArtistRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{id: id, before: before}, r.ArtistRepo.Purge(ctx, id)
+	})
+	if err != nil {
+		log.Errorf("Error while purging artist %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
+
+// Also finds artists in the trash
+func (r *DatabaseRepository) GetArtist(ctx context.Context, id string) (data.Artist, error) {
+	log.Debug("Request to get artist", id)
+	artist, err := r.ArtistRepo.FindById(ctx, id)
+	if err != nil {
+		log.Errorf("Error while getting artist %v, %v", id, err)
+		return data.Artist{}, err
+	}
+	return artist, nil
+}
+
 func (r *DatabaseRepository) ListArtists(ctx context.Context) ([]data.Artist, error) {
 	log.Debug("Request to list all artists")
     artists, err := r.ArtistRepo.FindAll(ctx)
@@ -132,8 +374,21 @@ func (r *DatabaseRepository) AddEvent(ctx context.Context, event data.Event) (st
 		log.Debug("Skipping adding event because required fields are missing", event)
 		return "", errors.New("failed to create event due to empty fields")
 	}
+	event.UserId = User(ctx)
 
-	id, err := r.EventRepo.Add(ctx, event)
+	var id string
+	err := r.audit(ctx, "event", AuditCreate, func(ctx context.Context) (auditChange, error) {
+		exists, err := r.EventRepo.Exists(ctx, event)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if id, err = r.EventRepo.Add(ctx, event); err != nil || exists {
+			return auditChange{skip: true}, err
+		}
+		created := event
+		created.Id, created.Version = id, 1
+		return auditChange{id: id, after: created}, nil
+	})
 	if err != nil {
 		log.Errorf("Error while adding event %v, %v\n", event, err)
 		return "", err
@@ -141,9 +396,42 @@ func (r *DatabaseRepository) AddEvent(ctx context.Context, event data.Event) (st
 	return id, nil
 }
 
+// Requires that all the artists and the venue already exist
+func (r *DatabaseRepository) UpdateEvent(ctx context.Context, id string, event data.Event) error {
+	log.Debug("Request to update event", id, event)
+	if !event.Populated() {
+		log.Debug("Skipping updating event because required fields are missing", event)
+		return errors.New("failed to update event due to empty fields")
+	}
+
+	err := r.audit(ctx, "event", AuditUpdate, func(ctx context.Context) (auditChange, error) {
+		before, err := r.EventRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := r.EventRepo.Update(ctx, id, event); err != nil {
+			return auditChange{}, err
+		}
+		after := event
+		after.Id, after.Version = id, before.Version+1
+		return auditChange{id: id, before: before, after: after}, nil
+	})
+	if err != nil {
+		log.Errorf("Error while updating event %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
+
 func (r *DatabaseRepository) DeleteEvent(ctx context.Context, id string) error {
 	log.Debug("Request to delete event", id)
-    err := r.EventRepo.Delete(ctx, id)
+	err := r.audit(ctx, "event", AuditDelete, func(ctx context.Context) (auditChange, error) {
+		before, err := r.EventRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{id: id, before: before}, r.EventRepo.Delete(ctx, id)
+	})
 	if err != nil {
 		log.Errorf("Error while deleting event %v, %v\n", id, err)
 		return err
@@ -151,6 +439,61 @@ func (r *DatabaseRepository) DeleteEvent(ctx context.Context, id string) error {
 	return nil
 }
 
+func (r *DatabaseRepository) ListDeletedEvents(ctx context.Context) ([]data.Event, error) {
+	log.Debug("Request to list all deleted events")
+	events, err := r.EventRepo.FindDeleted(ctx)
+	if err != nil {
+		log.Error("Error while listing deleted events,", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *DatabaseRepository) RestoreEvent(ctx context.Context, id string) error {
+	log.Debug("Request to restore event", id)
+	err := r.audit(ctx, "event", AuditRestore, func(ctx context.Context) (auditChange, error) {
+		before, err := r.EventRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		after := before
+		after.DeletedAt = nil
+		return auditChange{id: id, before: before, after: after}, r.EventRepo.Restore(ctx, id)
+	})
+	if err != nil {
+		log.Errorf("Error while restoring event %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
+
+func (r *DatabaseRepository) PurgeEvent(ctx context.Context, id string) error {
+	log.Debug("Request to purge event", id)
+	err := r.audit(ctx, "event", AuditPurge, func(ctx context.Context) (auditChange, error) {
+		before, err := r.EventRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{id: id, before: before}, r.EventRepo.Purge(ctx, id)
+	})
+	if err != nil {
+		log.Errorf("Error while purging event %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
+
+// Also finds events in the trash
+func (r *DatabaseRepository) GetEvent(ctx context.Context, id string) (data.Event, error) {
+	log.Debug("Request to get event", id)
+	event, err := r.EventRepo.FindById(ctx, id)
+	if err != nil {
+		log.Errorf("Error while getting event %v, %v", id, err)
+		return data.Event{}, err
+	}
+	return event, nil
+}
+
 func (r *DatabaseRepository) ListEvents(ctx context.Context) ([]data.Event, error) {
 	log.Debug("Request to list all events")
     events, err := r.EventRepo.FindAll(ctx)
@@ -160,3 +503,53 @@ func (r *DatabaseRepository) ListEvents(ctx context.Context) ([]data.Event, erro
 	}
 	return events, nil
 }
+
+func (r *DatabaseRepository) QueryEvents(ctx context.Context, query data.EventQuery) (data.EventPage, error) {
+	log.Debug("Request to query events", query)
+	if query.From != "" && !util.ValidDate(query.From) || query.To != "" && !util.ValidDate(query.To) {
+		log.Debug("Skipping querying events because of an invalid date", query)
+		return data.EventPage{}, errors.New("failed to query events due to invalid date")
+	}
+	if query.Limit < 0 {
+		log.Debug("Skipping querying events because of a negative limit", query)
+		return data.EventPage{}, errors.New("failed to query events due to negative limit")
+	}
+
+	page, err := r.EventRepo.Query(ctx, query)
+	if err != nil {
+		log.Errorf("Error while querying events %+v, %v\n", query, err)
+		return data.EventPage{}, err
+	}
+	return page, nil
+}
+
+func (r *DatabaseRepository) ListIntegrityIssues(ctx context.Context) ([]data.IntegrityIssue, error) {
+	log.Debug("Request to list all integrity issues")
+	issues, err := r.EventRepo.FindIntegrityIssues(ctx)
+	if err != nil {
+		log.Error("Error while listing integrity issues,", err)
+		return nil, err
+	}
+	return issues, nil
+}
+
+func (r *DatabaseRepository) RepairEvent(ctx context.Context, id string) error {
+	log.Debug("Request to repair event", id)
+	err := r.audit(ctx, "event", AuditRepair, func(ctx context.Context) (auditChange, error) {
+		before, err := r.EventRepo.FindById(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := r.EventRepo.Repair(ctx, id); err != nil {
+			return auditChange{}, err
+		}
+		after := before
+		after.Version++
+		return auditChange{id: id, before: before, after: after}, nil
+	})
+	if err != nil {
+		log.Errorf("Error while repairing event %v, %v\n", id, err)
+		return err
+	}
+	return nil
+}
@@ -1,179 +1,228 @@
 package db
 
 import (
+	"concert-manager/data"
 	"context"
 	"errors"
 	"testing"
-	"time"
 )
 
 type venueRepo struct{}
-func (venueRepo) Add(context.Context, Venue) (string, error) {
-    return "", nil
+func (venueRepo) Add(context.Context, data.Venue) (string, error) {
+    return "id", nil
 }
-func (venueRepo) Delete(context.Context, Venue) error {
+func (venueRepo) Update(context.Context, string, data.Venue) error {
     return nil
 }
-func (venueRepo) Exists(context.Context, Venue) (bool, error) {
+func (venueRepo) Delete(context.Context, string) error {
+    return nil
+}
+func (venueRepo) Exists(context.Context, data.Venue) (bool, error) {
     return true, nil
 }
-func (venueRepo) FindAll(context.Context) (*[]Venue, error) {
+func (venueRepo) FindAll(context.Context) ([]data.Venue, error) {
+    return nil, nil
+}
+func (venueRepo) FindById(_ context.Context, id string) (data.Venue, error) {
+    return data.Venue{Id: id, Version: 1}, nil
+}
+func (venueRepo) FindDeleted(context.Context) ([]data.Venue, error) {
     return nil, nil
 }
+func (venueRepo) Restore(context.Context, string) error {
+    return nil
+}
+func (venueRepo) Purge(context.Context, string) error {
+    return nil
+}
 
 type artistRepo struct{}
-func (artistRepo) Add(context.Context, Artist) (string, error) {
-    return "", nil
+func (artistRepo) Add(context.Context, data.Artist) (string, error) {
+    return "id", nil
+}
+func (artistRepo) Update(context.Context, string, data.Artist) error {
+    return nil
 }
-func (artistRepo) Delete(context.Context, Artist) error {
+func (artistRepo) Delete(context.Context, string) error {
     return nil
 }
-func (artistRepo) Exists(context.Context, Artist) (bool, error) {
+func (artistRepo) Exists(context.Context, data.Artist) (bool, error) {
     return true, nil
 }
-func (artistRepo) FindAll(context.Context) (*[]Artist, error) {
+func (artistRepo) FindAll(context.Context) ([]data.Artist, error) {
     return nil, nil
 }
+func (artistRepo) FindById(_ context.Context, id string) (data.Artist, error) {
+    return data.Artist{Id: id, Version: 1}, nil
+}
+func (artistRepo) FindDeleted(context.Context) ([]data.Artist, error) {
+    return nil, nil
+}
+func (artistRepo) Restore(context.Context, string) error {
+    return nil
+}
+func (artistRepo) Purge(context.Context, string) error {
+    return nil
+}
 
 type eventRepo struct{}
-func (eventRepo) Add(context.Context, Event) (string, error) {
-    return "", nil
+func (eventRepo) Add(context.Context, data.Event) (string, error) {
+    return "id", nil
+}
+func (eventRepo) Update(context.Context, string, data.Event) error {
+    return nil
 }
-func (eventRepo) Delete(context.Context, Event) error {
+func (eventRepo) Delete(context.Context, string) error {
     return nil
 }
-func (eventRepo) Exists(context.Context, Event) (bool, error) {
+func (eventRepo) Exists(context.Context, data.Event) (bool, error) {
     return true, nil
 }
-func (eventRepo) FindAll(context.Context) (*[]Event, error) {
+func (eventRepo) FindAll(context.Context) ([]data.Event, error) {
+    return nil, nil
+}
+func (eventRepo) FindById(_ context.Context, id string) (data.Event, error) {
+    return data.Event{Id: id, Version: 1}, nil
+}
+func (eventRepo) FindDeleted(context.Context) ([]data.Event, error) {
+    return nil, nil
+}
+func (eventRepo) Restore(context.Context, string) error {
+    return nil
+}
+func (eventRepo) Purge(context.Context, string) error {
+    return nil
+}
+func (eventRepo) Query(context.Context, data.EventQuery) (data.EventPage, error) {
+    return data.EventPage{}, nil
+}
+func (eventRepo) FindIntegrityIssues(context.Context) ([]data.IntegrityIssue, error) {
     return nil, nil
 }
+func (eventRepo) Repair(context.Context, string) error {
+    return nil
+}
 
 func TestAddVenueValid(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
-	venue := Venue{Name: "name", City: "city", State: "state", Country: "country", Outside: true}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
 
-	if err := interactor.AddVenue(context.Background(), venue); err != nil {
+	if _, err := interactor.AddVenue(context.Background(), venue); err != nil {
 		t.Error("enexpected error:", err)
 	}
 }
 
 func TestAddVenueInvalid(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
-	venue := Venue{City: "city", State: "state", Country: "country", Outside: true}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+	venue := data.Venue{City: "city", State: "state"}
 
-	if err := interactor.AddVenue(context.Background(), venue); err == nil {
+	if _, err := interactor.AddVenue(context.Background(), venue); err == nil {
 		t.Error("error expected")
 	}
 }
 
 func TestAddArtistValid(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
-	artist := Artist{Name: "name", Genre: "genre"}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+	artist := data.Artist{Name: "name", Genre: "genre"}
 
-	if err := interactor.AddArtist(context.Background(), artist); err != nil {
+	if _, err := interactor.AddArtist(context.Background(), artist); err != nil {
 		t.Error("enexpected error:", err)
 	}
 }
 
 func TestAddArtistInvalid(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
-	artist := Artist{Genre: "genre"}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+	artist := data.Artist{Genre: "genre"}
 
-	if err := interactor.AddArtist(context.Background(), artist); err == nil {
+	if _, err := interactor.AddArtist(context.Background(), artist); err == nil {
 		t.Error("error expected")
 	}
 }
 
 func TestAddEventValid(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
-	venue := Venue{Name: "name", City: "city", State: "state", Country: "country", Outside: true}
-	artist := Artist{Name: "name", Genre: "genre"}
-	event := Event{MainAct: artist, Openers: []Artist{artist}, Venue: venue, Date: time.Now()}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
+	artist := data.Artist{Name: "name", Genre: "genre"}
+	event := data.Event{MainAct: artist, Openers: []data.Artist{artist}, Venue: venue, Date: "1/1/2024"}
 
-	if err := interactor.AddEvent(context.Background(), event); err != nil {
+	if _, err := interactor.AddEvent(context.Background(), event); err != nil {
 		t.Error("enexpected error:", err)
 	}
 }
 
 func TestAddEventInvalid(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
-	venue := Venue{Name: "name", City: "city", State: "state", Country: "country", Outside: true}
-	artist := Artist{Name: "name", Genre: "genre"}
- 	event := Event{Openers: []Artist{artist}, Venue: venue, Date: time.Now()}
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
+	artist := data.Artist{Genre: "genre"}
+ 	event := data.Event{Openers: []data.Artist{artist}, Venue: venue, Date: "1/1/2024"}
 
-	if err := interactor.AddEvent(context.Background(), event); err == nil {
+	if _, err := interactor.AddEvent(context.Background(), event); err == nil {
 		t.Error("error expected")
 	}
 }
 
-type venueRepoErr struct{}
-func (venueRepoErr) Add(context.Context, Venue) (string, error) {
+type venueRepoErr struct{ venueRepo }
+func (venueRepoErr) Add(context.Context, data.Venue) (string, error) {
     return "", errors.New("")
 }
-func (venueRepoErr) Delete(context.Context, Venue) error {
-    return nil
-}
-func (venueRepoErr) Exists(context.Context, Venue) (bool, error) {
-    return true, nil
-}
-func (venueRepoErr) FindAll(context.Context) (*[]Venue, error) {
-    return nil, nil
-}
 
-type artistRepoErr struct{}
-func (artistRepoErr) Add(context.Context, Artist) (string, error) {
+type artistRepoErr struct{ artistRepo }
+func (artistRepoErr) Add(context.Context, data.Artist) (string, error) {
     return "", errors.New("")
 }
-func (artistRepoErr) Delete(context.Context, Artist) error {
-    return nil
-}
-func (artistRepoErr) Exists(context.Context, Artist) (bool, error) {
-    return true, nil
-}
-func (artistRepoErr) FindAll(context.Context) (*[]Artist, error) {
-    return nil, nil
-}
 
-type eventRepoErr struct{}
-func (eventRepoErr) Add(context.Context, Event) (string, error) {
+type eventRepoErr struct{ eventRepo }
+func (eventRepoErr) Add(context.Context, data.Event) (string, error) {
     return "", errors.New("")
 }
-func (eventRepoErr) Delete(context.Context, Event) error {
-    return nil
-}
-func (eventRepoErr) Exists(context.Context, Event) (bool, error) {
-    return true, nil
-}
-func (eventRepoErr) FindAll(context.Context) (*[]Event, error) {
-    return nil, nil
-}
 
 func TestAddVenueErr(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepoErr{}, ArtistRepo: artistRepoErr{}, EventRepo: eventRepoErr{}}
-	venue := Venue{Name: "name", City: "city", State: "state", Country: "country", Outside: true}
+	interactor := &DatabaseRepository{VenueRepo: venueRepoErr{}, ArtistRepo: artistRepoErr{}, EventRepo: eventRepoErr{}}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
 
-	if err := interactor.AddVenue(context.Background(), venue); err == nil {
+	if _, err := interactor.AddVenue(context.Background(), venue); err == nil {
 		t.Error("expected error")
 	}
 }
 
 func TestAddArtistErr(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepoErr{}, ArtistRepo: artistRepoErr{}, EventRepo: eventRepoErr{}}
-	artist := Artist{Name: "name", Genre: "genre"}
+	interactor := &DatabaseRepository{VenueRepo: venueRepoErr{}, ArtistRepo: artistRepoErr{}, EventRepo: eventRepoErr{}}
+	artist := data.Artist{Name: "name", Genre: "genre"}
 
-	if err := interactor.AddArtist(context.Background(), artist); err == nil {
+	if _, err := interactor.AddArtist(context.Background(), artist); err == nil {
 		t.Error("expected error")
 	}
 }
 
 func TestAddEventError(t *testing.T) {
-	interactor := &EventInteractor{VenueRepo: venueRepoErr{}, ArtistRepo: artistRepoErr{}, EventRepo: eventRepoErr{}}
-	venue := Venue{Name: "name", City: "city", State: "state", Country: "country", Outside: true}
-	artist := Artist{Name: "name", Genre: "genre"}
-	event := Event{MainAct: artist, Openers: []Artist{artist}, Venue: venue, Date: time.Now()}
+	interactor := &DatabaseRepository{VenueRepo: venueRepoErr{}, ArtistRepo: artistRepoErr{}, EventRepo: eventRepoErr{}}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
+	artist := data.Artist{Name: "name", Genre: "genre"}
+	event := data.Event{MainAct: artist, Openers: []data.Artist{artist}, Venue: venue, Date: "1/1/2024"}
 
-	if err := interactor.AddEvent(context.Background(), event); err == nil {
+	if _, err := interactor.AddEvent(context.Background(), event); err == nil {
 		t.Error("expected error")
 	}
 }
+
+func TestUpdateEventInvalid(t *testing.T) {
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+	venue := data.Venue{Name: "name", City: "city", State: "state"}
+	artist := data.Artist{Name: "name", Genre: "genre"}
+	event := data.Event{MainAct: artist, Venue: venue}
+
+	if err := interactor.UpdateEvent(context.Background(), "id", event); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestQueryEventsInvalid(t *testing.T) {
+	interactor := &DatabaseRepository{VenueRepo: venueRepo{}, ArtistRepo: artistRepo{}, EventRepo: eventRepo{}}
+
+	if _, err := interactor.QueryEvents(context.Background(), data.EventQuery{From: "2023"}); err == nil {
+		t.Error("error expected for invalid date")
+	}
+	if _, err := interactor.QueryEvents(context.Background(), data.EventQuery{Limit: -1}); err == nil {
+		t.Error("error expected for negative limit")
+	}
+}
@@ -0,0 +1,1337 @@
+// Package repotest is a conformance suite for the db repository interfaces. Every backend
+// runs it from its own tests so they all share the same Add/Update/Delete/Exists/FindAll behavior
+package repotest
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+type Repos struct {
+	VenueRepo  db.VenueRepo
+	ArtistRepo db.ArtistRepo
+	EventRepo  db.EventRepo
+	Transactor db.Transactor
+	AuditRepo  db.AuditRepo
+}
+
+// must return repositories backed by a new, empty data store on every call
+type Factory func(t *testing.T) Repos
+
+func Run(t *testing.T, newRepos Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, Repos)
+	}{
+		{"VenueAdd", testVenueAdd},
+		{"VenueAddDuplicate", testVenueAddDuplicate},
+		{"VenueUpdate", testVenueUpdate},
+		{"VenueUpdateMissing", testVenueUpdateMissing},
+		{"VenueUpdateStale", testVenueUpdateStale},
+		{"VenueDelete", testVenueDelete},
+		{"VenueDeleteMissing", testVenueDeleteMissing},
+		{"VenueExists", testVenueExists},
+		{"VenueFindById", testVenueFindById},
+		{"VenueTrash", testVenueTrash},
+		{"VenueRestoreConflict", testVenueRestoreConflict},
+		{"ArtistAdd", testArtistAdd},
+		{"ArtistAddDuplicate", testArtistAddDuplicate},
+		{"ArtistUpdate", testArtistUpdate},
+		{"ArtistUpdateMissing", testArtistUpdateMissing},
+		{"ArtistUpdateStale", testArtistUpdateStale},
+		{"ArtistDelete", testArtistDelete},
+		{"ArtistDeleteMissing", testArtistDeleteMissing},
+		{"ArtistExists", testArtistExists},
+		{"ArtistFindById", testArtistFindById},
+		{"ArtistTrash", testArtistTrash},
+		{"ArtistRestoreConflict", testArtistRestoreConflict},
+		{"EventAdd", testEventAdd},
+		{"EventAddDuplicate", testEventAddDuplicate},
+		{"EventAddMissingVenue", testEventAddMissingVenue},
+		{"EventAddMissingArtist", testEventAddMissingArtist},
+		{"EventAddOnlyOpeners", testEventAddOnlyOpeners},
+		{"EventUpdate", testEventUpdate},
+		{"EventUpdateMissing", testEventUpdateMissing},
+		{"EventUpdateConflict", testEventUpdateConflict},
+		{"EventUpdateStale", testEventUpdateStale},
+		{"EventArchive", testEventArchive},
+		{"EventDelete", testEventDelete},
+		{"EventDeleteMissing", testEventDeleteMissing},
+		{"EventExists", testEventExists},
+		{"EventFindById", testEventFindById},
+		{"EventTrash", testEventTrash},
+		{"EventRestoreTrashedReference", testEventRestoreTrashedReference},
+		{"EventQuerySkipsTrash", testEventQuerySkipsTrash},
+		{"EventFindAllFollowsUpdates", testEventFindAllFollowsUpdates},
+		{"EventQueryDateRange", testEventQueryDateRange},
+		{"EventQueryFilters", testEventQueryFilters},
+		{"EventQueryPages", testEventQueryPages},
+		{"EventQueryInvalidCursor", testEventQueryInvalidCursor},
+		{"EventQueryPagesSkipDanglingReferences", testEventQueryPagesSkipDanglingReferences},
+		{"EventFindAllSkipsDanglingReferences", testEventFindAllSkipsDanglingReferences},
+		{"EventIntegrityIssuesEmpty", testEventIntegrityIssuesEmpty},
+		{"EventRepair", testEventRepair},
+		{"EventRepairUnrepairable", testEventRepairUnrepairable},
+		{"EventRepairMissing", testEventRepairMissing},
+		{"FindAllEmpty", testFindAllEmpty},
+		{"TransactionCommit", testTransactionCommit},
+		{"TransactionRollback", testTransactionRollback},
+		{"TransactionRepeatedWrites", testTransactionRepeatedWrites},
+		{"AuditFind", testAuditFind},
+		{"AuditRollback", testAuditRollback},
+		{"UserEventsArePrivate", testUserEventsArePrivate},
+		{"UserSharedCatalog", testUserSharedCatalog},
+		{"UserPrivateCatalog", testUserPrivateCatalog},
+		{"UserAllUsers", testUserAllUsers},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepos(t))
+		})
+	}
+}
+
+var (
+	venue   = data.Venue{Name: "The Eastern", City: "Atlanta", State: "GA"}
+	mainAct = data.Artist{Name: "Khruangbin", Genre: "Psychedelic"}
+	opener  = data.Artist{Name: "Men I Trust", Genre: "Indie"}
+)
+
+func testEvent() data.Event {
+	return data.Event{
+		MainAct:   mainAct,
+		Openers:   []data.Artist{opener},
+		Venue:     venue,
+		Date:      "6/14/2023",
+		Purchased: true,
+		TmId:      "tm123",
+	}
+}
+
+func mustAddVenue(t *testing.T, r Repos, v data.Venue) string {
+	t.Helper()
+	id, err := r.VenueRepo.Add(context.Background(), v)
+	if err != nil {
+		t.Fatalf("failed to add venue %v: %v", v, err)
+	}
+	if id == "" {
+		t.Fatalf("empty ID returned when adding venue %v", v)
+	}
+	return id
+}
+
+func mustAddArtist(t *testing.T, r Repos, a data.Artist) string {
+	t.Helper()
+	id, err := r.ArtistRepo.Add(context.Background(), a)
+	if err != nil {
+		t.Fatalf("failed to add artist %v: %v", a, err)
+	}
+	if id == "" {
+		t.Fatalf("empty ID returned when adding artist %v", a)
+	}
+	return id
+}
+
+// adds the event along with all the artists and the venue it requires
+func mustAddEvent(t *testing.T, r Repos, e data.Event) string {
+	t.Helper()
+	if e.MainAct.Populated() {
+		mustAddArtist(t, r, e.MainAct)
+	}
+	for _, o := range e.Openers {
+		mustAddArtist(t, r, o)
+	}
+	mustAddVenue(t, r, e.Venue)
+	id, err := r.EventRepo.Add(context.Background(), e)
+	if err != nil {
+		t.Fatalf("failed to add event %v: %v", e, err)
+	}
+	if id == "" {
+		t.Fatalf("empty ID returned when adding event %v", e)
+	}
+	return id
+}
+
+func mustFindVenues(t *testing.T, r Repos) []data.Venue {
+	t.Helper()
+	venues, err := r.VenueRepo.FindAll(context.Background())
+	if err != nil {
+		t.Fatal("failed to find venues:", err)
+	}
+	return venues
+}
+
+func mustFindArtists(t *testing.T, r Repos) []data.Artist {
+	t.Helper()
+	artists, err := r.ArtistRepo.FindAll(context.Background())
+	if err != nil {
+		t.Fatal("failed to find artists:", err)
+	}
+	return artists
+}
+
+func mustFindEvents(t *testing.T, r Repos) []data.Event {
+	t.Helper()
+	events, err := r.EventRepo.FindAll(context.Background())
+	if err != nil {
+		t.Fatal("failed to find events:", err)
+	}
+	return events
+}
+
+func testVenueAdd(t *testing.T, r Repos) {
+	id := mustAddVenue(t, r, venue)
+	venues := mustFindVenues(t, r)
+	expected := venue
+	expected.Id = id
+	expected.Version = 1
+	if len(venues) != 1 || venues[0] != expected {
+		t.Errorf("Incorrect venues, expected: %v, actual: %v", []data.Venue{expected}, venues)
+	}
+}
+
+func testVenueAddDuplicate(t *testing.T, r Repos) {
+	id := mustAddVenue(t, r, venue)
+	dupeId := mustAddVenue(t, r, venue)
+	if id != dupeId {
+		t.Errorf("Duplicate venue returned a new ID, expected: %v, actual: %v", id, dupeId)
+	}
+	otherCity := venue
+	otherCity.City = "Athens"
+	if otherId := mustAddVenue(t, r, otherCity); otherId == id {
+		t.Error("Venue in a different city was treated as a duplicate")
+	}
+	if venues := mustFindVenues(t, r); len(venues) != 2 {
+		t.Errorf("Incorrect number of venues, expected: %v, actual: %v", 2, len(venues))
+	}
+}
+
+func testVenueUpdate(t *testing.T, r Repos) {
+	id := mustAddVenue(t, r, venue)
+	updated := data.Venue{Name: "Terminal West", City: "Atlanta", State: "GA"}
+	if err := r.VenueRepo.Update(context.Background(), id, updated); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	updated.Id = id
+	updated.Version = 2
+	if venues := mustFindVenues(t, r); len(venues) != 1 || venues[0] != updated {
+		t.Errorf("Incorrect venues, expected: %v, actual: %v", []data.Venue{updated}, venues)
+	}
+}
+
+func testVenueUpdateMissing(t *testing.T, r Repos) {
+	if err := r.VenueRepo.Update(context.Background(), "missing", venue); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testVenueUpdateStale(t *testing.T, r Repos) {
+	id := mustAddVenue(t, r, venue)
+	current := venue
+	current.Version = 1
+	current.City = "Decatur"
+	if err := r.VenueRepo.Update(context.Background(), id, current); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	stale := venue
+	stale.Version = 1
+	if err := r.VenueRepo.Update(context.Background(), id, stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, actual: %v", err)
+	}
+	if venues := mustFindVenues(t, r); len(venues) != 1 || venues[0].City != "Decatur" || venues[0].Version != 2 {
+		t.Errorf("Stale update modified the venue: %v", venues)
+	}
+}
+
+func testVenueDelete(t *testing.T, r Repos) {
+	id := mustAddVenue(t, r, venue)
+	if err := r.VenueRepo.Delete(context.Background(), id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if venues := mustFindVenues(t, r); len(venues) != 0 {
+		t.Errorf("Venue not deleted, remaining: %v", venues)
+	}
+}
+
+func testVenueDeleteMissing(t *testing.T, r Repos) {
+	if err := r.VenueRepo.Delete(context.Background(), "missing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testVenueExists(t *testing.T, r Repos) {
+	exists, err := r.VenueRepo.Exists(context.Background(), venue)
+	if err != nil || exists {
+		t.Errorf("Venue should not exist yet, exists: %v, err: %v", exists, err)
+	}
+	mustAddVenue(t, r, venue)
+	exists, err = r.VenueRepo.Exists(context.Background(), venue)
+	if err != nil || !exists {
+		t.Errorf("Venue should exist, exists: %v, err: %v", exists, err)
+	}
+}
+
+func testVenueFindById(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddVenue(t, r, venue)
+	if err := r.VenueRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	found, err := r.VenueRepo.FindById(ctx, id)
+	if err != nil || found.Id != id || !found.Equals(venue) || found.Version != 1 || found.DeletedAt == nil {
+		t.Errorf("Venue in the trash should be found by ID, actual: %+v, err: %v", found, err)
+	}
+	if _, err := r.VenueRepo.FindById(ctx, "missing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testVenueTrash(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddVenue(t, r, venue)
+	if err := r.VenueRepo.Purge(ctx, id); err == nil {
+		t.Error("expected error when purging a venue that isn't in the trash")
+	}
+	if err := r.VenueRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := r.VenueRepo.Delete(ctx, id); err == nil {
+		t.Error("expected error when deleting a venue that is already in the trash")
+	}
+	deleted, err := r.VenueRepo.FindDeleted(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0].Id != id || deleted[0].DeletedAt == nil {
+		t.Fatalf("Deleted venue should be in the trash, actual: %+v, err: %v", deleted, err)
+	}
+	if exists, err := r.VenueRepo.Exists(ctx, venue); err != nil || exists {
+		t.Errorf("Venue in the trash should not exist, exists: %v, err: %v", exists, err)
+	}
+
+	if err := r.VenueRepo.Restore(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if venues := mustFindVenues(t, r); len(venues) != 1 || venues[0].Id != id || venues[0].DeletedAt != nil {
+		t.Errorf("Restored venue should be found, actual: %+v", venues)
+	}
+	if err := r.VenueRepo.Restore(ctx, id); err == nil {
+		t.Error("expected error when restoring a venue that isn't in the trash")
+	}
+
+	if err := r.VenueRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := r.VenueRepo.Purge(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if deleted, err := r.VenueRepo.FindDeleted(ctx); err != nil || len(deleted) != 0 {
+		t.Errorf("Purged venue should be gone, actual: %+v, err: %v", deleted, err)
+	}
+}
+
+func testVenueRestoreConflict(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddVenue(t, r, venue)
+	if err := r.VenueRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	otherId := mustAddVenue(t, r, venue)
+	if otherId == id {
+		t.Fatal("Adding a venue should not reuse one in the trash")
+	}
+	if err := r.VenueRepo.Restore(ctx, id); err == nil {
+		t.Error("expected error when restoring over an existing venue")
+	}
+}
+
+func testArtistAdd(t *testing.T, r Repos) {
+	id := mustAddArtist(t, r, mainAct)
+	artists := mustFindArtists(t, r)
+	expected := mainAct
+	expected.Id = id
+	expected.Version = 1
+	if len(artists) != 1 || artists[0] != expected {
+		t.Errorf("Incorrect artists, expected: %v, actual: %v", []data.Artist{expected}, artists)
+	}
+}
+
+func testArtistAddDuplicate(t *testing.T, r Repos) {
+	id := mustAddArtist(t, r, mainAct)
+	otherGenre := mainAct
+	otherGenre.Genre = "Funk"
+	dupeId := mustAddArtist(t, r, otherGenre)
+	if id != dupeId {
+		t.Errorf("Artists are deduplicated by name, expected: %v, actual: %v", id, dupeId)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 1 || artists[0].Genre != mainAct.Genre {
+		t.Errorf("Duplicate artist modified the existing record: %v", artists)
+	}
+}
+
+func testArtistUpdate(t *testing.T, r Repos) {
+	id := mustAddArtist(t, r, mainAct)
+	updated := data.Artist{Name: mainAct.Name, Genre: "Funk"}
+	if err := r.ArtistRepo.Update(context.Background(), id, updated); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	updated.Id = id
+	updated.Version = 2
+	if artists := mustFindArtists(t, r); len(artists) != 1 || artists[0] != updated {
+		t.Errorf("Incorrect artists, expected: %v, actual: %v", []data.Artist{updated}, artists)
+	}
+}
+
+func testArtistUpdateMissing(t *testing.T, r Repos) {
+	if err := r.ArtistRepo.Update(context.Background(), "missing", mainAct); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testArtistUpdateStale(t *testing.T, r Repos) {
+	id := mustAddArtist(t, r, mainAct)
+	current := mainAct
+	current.Version = 1
+	current.Genre = "Funk"
+	if err := r.ArtistRepo.Update(context.Background(), id, current); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	stale := mainAct
+	stale.Version = 1
+	if err := r.ArtistRepo.Update(context.Background(), id, stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, actual: %v", err)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 1 || artists[0].Genre != "Funk" || artists[0].Version != 2 {
+		t.Errorf("Stale update modified the artist: %v", artists)
+	}
+}
+
+func testArtistDelete(t *testing.T, r Repos) {
+	id := mustAddArtist(t, r, mainAct)
+	if err := r.ArtistRepo.Delete(context.Background(), id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 0 {
+		t.Errorf("Artist not deleted, remaining: %v", artists)
+	}
+}
+
+func testArtistDeleteMissing(t *testing.T, r Repos) {
+	if err := r.ArtistRepo.Delete(context.Background(), "missing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testArtistExists(t *testing.T, r Repos) {
+	exists, err := r.ArtistRepo.Exists(context.Background(), mainAct)
+	if err != nil || exists {
+		t.Errorf("Artist should not exist yet, exists: %v, err: %v", exists, err)
+	}
+	mustAddArtist(t, r, mainAct)
+	exists, err = r.ArtistRepo.Exists(context.Background(), mainAct)
+	if err != nil || !exists {
+		t.Errorf("Artist should exist, exists: %v, err: %v", exists, err)
+	}
+}
+
+func testArtistFindById(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddArtist(t, r, mainAct)
+	found, err := r.ArtistRepo.FindById(ctx, id)
+	if err != nil || found.Id != id || !found.Equals(mainAct) || found.Version != 1 || found.DeletedAt != nil {
+		t.Errorf("Incorrect artist found by ID, actual: %+v, err: %v", found, err)
+	}
+	if _, err := r.ArtistRepo.FindById(ctx, "missing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testArtistTrash(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddArtist(t, r, mainAct)
+	if err := r.ArtistRepo.Purge(ctx, id); err == nil {
+		t.Error("expected error when purging an artist that isn't in the trash")
+	}
+	if err := r.ArtistRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	deleted, err := r.ArtistRepo.FindDeleted(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0].Id != id || deleted[0].DeletedAt == nil {
+		t.Fatalf("Deleted artist should be in the trash, actual: %+v, err: %v", deleted, err)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 0 {
+		t.Errorf("Artist in the trash should not be found, actual: %v", artists)
+	}
+	if exists, err := r.ArtistRepo.Exists(ctx, mainAct); err != nil || exists {
+		t.Errorf("Artist in the trash should not exist, exists: %v, err: %v", exists, err)
+	}
+
+	if err := r.ArtistRepo.Restore(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 1 || artists[0].Id != id || artists[0].DeletedAt != nil {
+		t.Errorf("Restored artist should be found, actual: %+v", artists)
+	}
+
+	if err := r.ArtistRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := r.ArtistRepo.Purge(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if deleted, err := r.ArtistRepo.FindDeleted(ctx); err != nil || len(deleted) != 0 {
+		t.Errorf("Purged artist should be gone, actual: %+v, err: %v", deleted, err)
+	}
+}
+
+func testArtistRestoreConflict(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddArtist(t, r, mainAct)
+	if err := r.ArtistRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	mustAddArtist(t, r, mainAct)
+	if err := r.ArtistRepo.Restore(ctx, id); err == nil {
+		t.Error("expected error when restoring over an existing artist")
+	}
+}
+
+func testEventAdd(t *testing.T, r Repos) {
+	event := testEvent()
+	id := mustAddEvent(t, r, event)
+
+	events := mustFindEvents(t, r)
+	if len(events) != 1 {
+		t.Fatalf("Incorrect number of events, expected: %v, actual: %v", 1, len(events))
+	}
+	found := events[0]
+	if found.Id != id {
+		t.Errorf("Incorrect event ID, expected: %v, actual: %v", id, found.Id)
+	}
+	if !found.Equals(event) || found.Purchased != event.Purchased || found.TmId != event.TmId {
+		t.Errorf("Incorrect event, expected: %+v, actual: %+v", event, found)
+	}
+	if found.MainAct.Id == "" || found.Venue.Id == "" {
+		t.Errorf("Event references were not resolved to IDs: %+v", found)
+	}
+	if len(found.Openers) != 1 || !found.Openers[0].Equals(opener) || found.Openers[0].Id == "" {
+		t.Errorf("Incorrect openers, expected: %v, actual: %v", event.Openers, found.Openers)
+	}
+}
+
+func testEventAddDuplicate(t *testing.T, r Repos) {
+	event := testEvent()
+	id := mustAddEvent(t, r, event)
+
+	// events are deduplicated by date and venue only
+	dupe := testEvent()
+	dupe.Date = "06/14/2023"
+	dupe.MainAct = opener
+	dupe.Openers = []data.Artist{}
+	dupeId, err := r.EventRepo.Add(context.Background(), dupe)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if id != dupeId {
+		t.Errorf("Duplicate event returned a new ID, expected: %v, actual: %v", id, dupeId)
+	}
+	if events := mustFindEvents(t, r); len(events) != 1 {
+		t.Errorf("Incorrect number of events, expected: %v, actual: %v", 1, len(events))
+	}
+}
+
+func testEventAddMissingVenue(t *testing.T, r Repos) {
+	event := testEvent()
+	mustAddArtist(t, r, mainAct)
+	mustAddArtist(t, r, opener)
+	if _, err := r.EventRepo.Add(context.Background(), event); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testEventAddMissingArtist(t *testing.T, r Repos) {
+	event := testEvent()
+	mustAddArtist(t, r, mainAct)
+	mustAddVenue(t, r, venue)
+	if _, err := r.EventRepo.Add(context.Background(), event); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testEventAddOnlyOpeners(t *testing.T, r Repos) {
+	event := testEvent()
+	event.MainAct = data.Artist{}
+	mustAddEvent(t, r, event)
+	events := mustFindEvents(t, r)
+	if len(events) != 1 || events[0].MainAct.Populated() || len(events[0].Openers) != 1 {
+		t.Errorf("Incorrect event without a main act: %+v", events)
+	}
+}
+
+func testEventUpdate(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	newOpener := data.Artist{Name: "Toro y Moi", Genre: "Chillwave"}
+	mustAddArtist(t, r, newOpener)
+
+	updated := testEvent()
+	updated.Openers = []data.Artist{newOpener, opener}
+	updated.Date = "6/15/2023"
+	updated.Purchased = false
+	if err := r.EventRepo.Update(context.Background(), id, updated); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	events := mustFindEvents(t, r)
+	if len(events) != 1 {
+		t.Fatalf("Incorrect number of events, expected: %v, actual: %v", 1, len(events))
+	}
+	found := events[0]
+	if found.Id != id {
+		t.Errorf("Updated event changed ID, expected: %v, actual: %v", id, found.Id)
+	}
+	if !found.Equals(updated) || found.Purchased || found.Version != 2 {
+		t.Errorf("Incorrect event, expected: %+v, actual: %+v", updated, found)
+	}
+	if len(found.Openers) != 2 || !found.Openers[0].Equals(newOpener) || !found.Openers[1].Equals(opener) {
+		t.Errorf("Incorrect openers, expected: %v, actual: %v", updated.Openers, found.Openers)
+	}
+}
+
+func testEventArchive(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	archived := testEvent()
+	archivedAt := time.Date(2023, 7, 14, 0, 0, 0, 0, time.UTC)
+	archived.ArchivedAt = &archivedAt
+	if err := r.EventRepo.Update(context.Background(), id, archived); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := r.EventRepo.FindById(context.Background(), id)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found.ArchivedAt == nil || !found.ArchivedAt.Equal(archivedAt) || found.DeletedAt != nil {
+		t.Errorf("Archived event should be kept outside of the trash, actual: %+v", found)
+	}
+	if trash, err := r.EventRepo.FindDeleted(context.Background()); err != nil || len(trash) != 0 {
+		t.Errorf("Archived event should not be in the trash, actual: %v, %v", trash, err)
+	}
+}
+
+func testEventUpdateMissing(t *testing.T, r Repos) {
+	event := testEvent()
+	mustAddArtist(t, r, mainAct)
+	mustAddArtist(t, r, opener)
+	mustAddVenue(t, r, venue)
+	if err := r.EventRepo.Update(context.Background(), "missing", event); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testEventUpdateStale(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	current := testEvent()
+	current.Version = 1
+	current.Purchased = false
+	if err := r.EventRepo.Update(context.Background(), id, current); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	stale := testEvent()
+	stale.Version = 1
+	if err := r.EventRepo.Update(context.Background(), id, stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, actual: %v", err)
+	}
+	if events := mustFindEvents(t, r); len(events) != 1 || events[0].Purchased || events[0].Version != 2 {
+		t.Errorf("Stale update modified the event: %v", events)
+	}
+}
+
+func testEventUpdateConflict(t *testing.T, r Repos) {
+	mustAddEvent(t, r, testEvent())
+	other := testEvent()
+	other.Date = "6/15/2023"
+	otherId := mustAddEvent(t, r, other)
+
+	if err := r.EventRepo.Update(context.Background(), otherId, testEvent()); err == nil {
+		t.Error("expected error when updating onto the date and venue of another event")
+	}
+}
+
+func testEventDelete(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	if err := r.EventRepo.Delete(context.Background(), id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := mustFindEvents(t, r); len(events) != 0 {
+		t.Errorf("Event not deleted, remaining: %v", events)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 2 {
+		t.Errorf("Deleting an event should leave its artists, remaining: %v", artists)
+	}
+}
+
+func testEventDeleteMissing(t *testing.T, r Repos) {
+	if err := r.EventRepo.Delete(context.Background(), "missing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testEventExists(t *testing.T, r Repos) {
+	event := testEvent()
+	exists, err := r.EventRepo.Exists(context.Background(), event)
+	if err != nil || exists {
+		t.Errorf("Event should not exist yet, exists: %v, err: %v", exists, err)
+	}
+	mustAddEvent(t, r, event)
+	exists, err = r.EventRepo.Exists(context.Background(), event)
+	if err != nil || !exists {
+		t.Errorf("Event should exist, exists: %v, err: %v", exists, err)
+	}
+	other := testEvent()
+	other.Date = "6/15/2023"
+	exists, err = r.EventRepo.Exists(context.Background(), other)
+	if err != nil || exists {
+		t.Errorf("Event on another date should not exist, exists: %v, err: %v", exists, err)
+	}
+}
+
+func testEventFindById(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddEvent(t, r, testEvent())
+	if err := r.ArtistRepo.Delete(ctx, mustAddArtist(t, r, opener)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	found, err := r.EventRepo.FindById(ctx, id)
+	if err != nil || found.Id != id || !found.Equals(testEvent()) || found.Version != 1 || len(found.Openers) != 0 {
+		t.Errorf("Invalid event should be found without the trashed opener, actual: %+v, err: %v", found, err)
+	}
+	if _, err := r.EventRepo.FindById(ctx, "missing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testEventTrash(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddEvent(t, r, testEvent())
+	if err := r.EventRepo.Purge(ctx, id); err == nil {
+		t.Error("expected error when purging an event that isn't in the trash")
+	}
+	if err := r.EventRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	deleted, err := r.EventRepo.FindDeleted(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0].Id != id || deleted[0].DeletedAt == nil || !deleted[0].Equals(testEvent()) {
+		t.Fatalf("Deleted event should be in the trash, actual: %+v, err: %v", deleted, err)
+	}
+	if exists, err := r.EventRepo.Exists(ctx, testEvent()); err != nil || exists {
+		t.Errorf("Event in the trash should not exist, exists: %v, err: %v", exists, err)
+	}
+	if issues := mustFindIntegrityIssues(t, r); len(issues) != 0 {
+		t.Errorf("Events in the trash should not be checked, actual: %v", issues)
+	}
+
+	if err := r.EventRepo.Restore(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := mustFindEvents(t, r); len(events) != 1 || events[0].Id != id || len(events[0].Openers) != 1 {
+		t.Errorf("Restored event should be found with its references, actual: %+v", events)
+	}
+
+	if err := r.EventRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := r.EventRepo.Purge(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if deleted, err := r.EventRepo.FindDeleted(ctx); err != nil || len(deleted) != 0 {
+		t.Errorf("Purged event should be gone, actual: %+v, err: %v", deleted, err)
+	}
+}
+
+func testEventRestoreTrashedReference(t *testing.T, r Repos) {
+	ctx := context.Background()
+	id := mustAddEvent(t, r, testEvent())
+	if err := r.EventRepo.Delete(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	artistId := mustAddArtist(t, r, opener)
+	if err := r.ArtistRepo.Delete(ctx, artistId); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted, err := r.EventRepo.FindDeleted(ctx); err != nil || len(deleted) != 1 || len(deleted[0].Openers) != 1 {
+		t.Errorf("Trashed events should keep trashed references, actual: %+v, err: %v", deleted, err)
+	}
+	if err := r.EventRepo.Restore(ctx, id); err == nil {
+		t.Error("expected error when restoring an event before its opener")
+	}
+	if err := r.ArtistRepo.Restore(ctx, artistId); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := r.EventRepo.Restore(ctx, id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func testEventQuerySkipsTrash(t *testing.T, r Repos) {
+	ids := addQueryEvents(t, r)
+	if err := r.EventRepo.Delete(context.Background(), ids[1]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	expected := []string{ids[0], ids[2], ids[3]}
+	if page := mustQueryEvents(t, r, data.EventQuery{}); !slices.Equal(pageIds(page), expected) {
+		t.Errorf("Query should skip events in the trash, expected: %v, actual: %v", expected, pageIds(page))
+	}
+}
+
+func testEventFindAllFollowsUpdates(t *testing.T, r Repos) {
+	mustAddEvent(t, r, testEvent())
+	venueId := mustAddVenue(t, r, venue)
+	updatedVenue := data.Venue{Name: "Terminal West", City: "Atlanta", State: "GA"}
+	if err := r.VenueRepo.Update(context.Background(), venueId, updatedVenue); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	events := mustFindEvents(t, r)
+	if len(events) != 1 || !events[0].Venue.Equals(updatedVenue) {
+		t.Errorf("Event did not reflect the updated venue, expected: %v, actual: %v", updatedVenue, events)
+	}
+}
+
+// adds events on 6/14/2023, 12/31/2023, 1/1/2024 and 3/2/2024, alternating between two venues
+func addQueryEvents(t *testing.T, r Repos) []string {
+	t.Helper()
+	otherVenue := data.Venue{Name: "Terminal West", City: "Atlanta", State: "GA"}
+	ids := []string{}
+	for i, date := range []string{"6/14/2023", "12/31/2023", "1/1/2024", "3/2/2024"} {
+		e := testEvent()
+		e.Date = date
+		e.Purchased = i%2 == 0
+		if i%2 == 1 {
+			e.Venue = otherVenue
+			e.Openers = []data.Artist{}
+		}
+		ids = append(ids, mustAddEvent(t, r, e))
+	}
+	return ids
+}
+
+func mustQueryEvents(t *testing.T, r Repos, query data.EventQuery) data.EventPage {
+	t.Helper()
+	page, err := r.EventRepo.Query(context.Background(), query)
+	if err != nil {
+		t.Fatalf("failed to query events %+v: %v", query, err)
+	}
+	return page
+}
+
+func pageIds(page data.EventPage) []string {
+	ids := []string{}
+	for _, e := range page.Events {
+		ids = append(ids, e.Id)
+	}
+	return ids
+}
+
+func testEventQueryDateRange(t *testing.T, r Repos) {
+	ids := addQueryEvents(t, r)
+
+	page := mustQueryEvents(t, r, data.EventQuery{From: "12/31/2023", To: "1/1/2024"})
+	if expected := ids[1:3]; !slices.Equal(pageIds(page), expected) || page.NextCursor != "" {
+		t.Errorf("Incorrect events in range, expected: %v, actual: %v", expected, page)
+	}
+	page = mustQueryEvents(t, r, data.EventQuery{})
+	if !slices.Equal(pageIds(page), ids) {
+		t.Errorf("Events should be ordered by date, expected: %v, actual: %v", ids, pageIds(page))
+	}
+	if !page.Events[0].Equals(testEvent()) || len(page.Events[0].Openers) != 1 {
+		t.Errorf("Queried event is missing its references: %+v", page.Events[0])
+	}
+}
+
+func testEventQueryFilters(t *testing.T, r Repos) {
+	ids := addQueryEvents(t, r)
+	purchased := true
+	venueId := mustAddVenue(t, r, venue)
+	openerId := mustAddArtist(t, r, opener)
+	mainActId := mustAddArtist(t, r, mainAct)
+
+	cases := []struct {
+		query    data.EventQuery
+		expected []string
+	}{
+		{data.EventQuery{Purchased: &purchased}, []string{ids[0], ids[2]}},
+		{data.EventQuery{VenueId: venueId}, []string{ids[0], ids[2]}},
+		{data.EventQuery{ArtistId: openerId}, []string{ids[0], ids[2]}},
+		{data.EventQuery{ArtistId: mainActId}, ids},
+		{data.EventQuery{ArtistId: mainActId, From: "1/1/2024"}, ids[2:]},
+		{data.EventQuery{VenueId: "missing"}, []string{}},
+	}
+	for _, c := range cases {
+		if page := mustQueryEvents(t, r, c.query); !slices.Equal(pageIds(page), c.expected) {
+			t.Errorf("Incorrect events for %+v, expected: %v, actual: %v", c.query, c.expected, pageIds(page))
+		}
+	}
+}
+
+func testEventQueryPages(t *testing.T, r Repos) {
+	ids := addQueryEvents(t, r)
+
+	found := []string{}
+	query := data.EventQuery{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatal("Paging did not stop, found:", found)
+		}
+		page := mustQueryEvents(t, r, query)
+		if len(page.Events) > query.Limit {
+			t.Errorf("Page exceeded limit %v: %v", query.Limit, pageIds(page))
+		}
+		found = append(found, pageIds(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if !slices.Equal(found, ids) {
+		t.Errorf("Incorrect paged events, expected: %v, actual: %v", ids, found)
+	}
+}
+
+// invalid events are left out before pages are cut, so they can't leave a page short
+func testEventQueryPagesSkipDanglingReferences(t *testing.T, r Repos) {
+	ids := addQueryEvents(t, r)
+	if err := r.ArtistRepo.Delete(context.Background(), mustAddArtist(t, r, opener)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	page := mustQueryEvents(t, r, data.EventQuery{Limit: 1})
+	if !slices.Equal(pageIds(page), ids[1:2]) || page.NextCursor == "" {
+		t.Fatalf("First page should hold the first valid event, expected: %v, actual: %+v", ids[1:2], page)
+	}
+	page = mustQueryEvents(t, r, data.EventQuery{Limit: 1, Cursor: page.NextCursor})
+	if !slices.Equal(pageIds(page), ids[3:]) || page.NextCursor != "" {
+		t.Errorf("Last page should hold the last valid event, expected: %v, actual: %+v", ids[3:], page)
+	}
+}
+
+func testEventQueryInvalidCursor(t *testing.T, r Repos) {
+	if _, err := r.EventRepo.Query(context.Background(), data.EventQuery{Cursor: "not a cursor"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func mustFindIntegrityIssues(t *testing.T, r Repos) []data.IntegrityIssue {
+	t.Helper()
+	issues, err := r.EventRepo.FindIntegrityIssues(context.Background())
+	if err != nil {
+		t.Fatal("failed to find integrity issues:", err)
+	}
+	return issues
+}
+
+func testEventFindAllSkipsDanglingReferences(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	other := testEvent()
+	other.Date = "6/15/2023"
+	otherId := mustAddEvent(t, r, other)
+	if err := r.ArtistRepo.Delete(context.Background(), mustAddArtist(t, r, opener)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	mustAddEvent(t, r, data.Event{MainAct: mainAct, Venue: venue, Date: "6/16/2023"})
+
+	events := mustFindEvents(t, r)
+	if len(events) != 1 || events[0].Date != "6/16/2023" {
+		t.Errorf("Events with a dangling opener should be skipped, actual: %v", events)
+	}
+	issues := mustFindIntegrityIssues(t, r)
+	if len(issues) != 2 {
+		t.Fatalf("Incorrect number of integrity issues, expected: %v, actual: %v", 2, issues)
+	}
+	for _, issue := range issues {
+		if issue.Id != id && issue.Id != otherId {
+			t.Errorf("Unexpected event reported, expected one of %v, actual: %v", []string{id, otherId}, issue.Id)
+		}
+		if issue.Entity != "event" || len(issue.Problems) != 1 || !issue.Repairable {
+			t.Errorf("Incorrect integrity issue, actual: %+v", issue)
+		}
+	}
+}
+
+func testEventIntegrityIssuesEmpty(t *testing.T, r Repos) {
+	mustAddEvent(t, r, testEvent())
+	if issues := mustFindIntegrityIssues(t, r); issues == nil || len(issues) != 0 {
+		t.Errorf("Expected no integrity issues, actual: %#v", issues)
+	}
+	if err := r.EventRepo.Repair(context.Background(), mustFindEvents(t, r)[0].Id); err != nil {
+		t.Error("Repairing a valid event should do nothing, err:", err)
+	}
+}
+
+func testEventRepair(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	if err := r.ArtistRepo.Delete(context.Background(), mustAddArtist(t, r, opener)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := r.EventRepo.Repair(context.Background(), id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	events := mustFindEvents(t, r)
+	if len(events) != 1 || events[0].Id != id || !events[0].Equals(testEvent()) || len(events[0].Openers) != 0 {
+		t.Errorf("Repaired event should be found without the missing opener, actual: %+v", events)
+	}
+	if issues := mustFindIntegrityIssues(t, r); len(issues) != 0 {
+		t.Errorf("Expected no integrity issues after repair, actual: %v", issues)
+	}
+}
+
+func testEventRepairUnrepairable(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	if err := r.VenueRepo.Delete(context.Background(), mustAddVenue(t, r, venue)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	issues := mustFindIntegrityIssues(t, r)
+	if len(issues) != 1 || issues[0].Id != id || issues[0].Repairable {
+		t.Fatalf("Event without a venue should be reported as unrepairable, actual: %+v", issues)
+	}
+	if err := r.EventRepo.Repair(context.Background(), id); err == nil {
+		t.Error("expected error")
+	}
+	if err := r.EventRepo.Delete(context.Background(), id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if issues := mustFindIntegrityIssues(t, r); len(issues) != 0 {
+		t.Errorf("Expected no integrity issues after delete, actual: %v", issues)
+	}
+}
+
+func testEventRepairMissing(t *testing.T, r Repos) {
+	if err := r.EventRepo.Repair(context.Background(), "missing"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testFindAllEmpty(t *testing.T, r Repos) {
+	if venues := mustFindVenues(t, r); venues == nil || len(venues) != 0 {
+		t.Errorf("Expected empty venues, actual: %#v", venues)
+	}
+	if artists := mustFindArtists(t, r); artists == nil || len(artists) != 0 {
+		t.Errorf("Expected empty artists, actual: %#v", artists)
+	}
+	if events := mustFindEvents(t, r); events == nil || len(events) != 0 {
+		t.Errorf("Expected empty events, actual: %#v", events)
+	}
+}
+
+// adds the event along with all the artists and the venue it requires, without failing the test
+func addEventWithReferences(ctx context.Context, r Repos, e data.Event) (string, error) {
+	if _, err := r.ArtistRepo.Add(ctx, e.MainAct); err != nil {
+		return "", err
+	}
+	for _, o := range e.Openers {
+		if _, err := r.ArtistRepo.Add(ctx, o); err != nil {
+			return "", err
+		}
+	}
+	if _, err := r.VenueRepo.Add(ctx, e.Venue); err != nil {
+		return "", err
+	}
+	return r.EventRepo.Add(ctx, e)
+}
+
+func testTransactionCommit(t *testing.T, r Repos) {
+	var id string
+	err := r.Transactor.RunTransaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		id, err = addEventWithReferences(ctx, r, testEvent())
+		return err
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	events := mustFindEvents(t, r)
+	if len(events) != 1 || events[0].Id != id || !events[0].Equals(testEvent()) {
+		t.Errorf("Committed event not found, expected ID %v, actual: %+v", id, events)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 2 {
+		t.Errorf("Incorrect number of committed artists, expected: %v, actual: %v", 2, len(artists))
+	}
+	if venues := mustFindVenues(t, r); len(venues) != 1 {
+		t.Errorf("Incorrect number of committed venues, expected: %v, actual: %v", 1, len(venues))
+	}
+}
+
+func testTransactionRollback(t *testing.T, r Repos) {
+	existingId := mustAddArtist(t, r, mainAct)
+	failure := errors.New("failure after writes")
+	err := r.Transactor.RunTransaction(context.Background(), func(ctx context.Context) error {
+		if _, err := addEventWithReferences(ctx, r, testEvent()); err != nil {
+			return err
+		}
+		if err := r.ArtistRepo.Update(ctx, existingId, data.Artist{Name: mainAct.Name, Genre: "Funk"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the transaction error to be returned, actual: %v", err)
+	}
+
+	if events := mustFindEvents(t, r); len(events) != 0 {
+		t.Errorf("Rolled back event was saved: %v", events)
+	}
+	if venues := mustFindVenues(t, r); len(venues) != 0 {
+		t.Errorf("Rolled back venue was saved: %v", venues)
+	}
+	expected := mainAct
+	expected.Id = existingId
+	expected.Version = 1
+	if artists := mustFindArtists(t, r); len(artists) != 1 || artists[0] != expected {
+		t.Errorf("Rolled back artist changes were saved, expected: %v, actual: %v", []data.Artist{expected}, artists)
+	}
+}
+
+// Writes made earlier in a transaction are seen by the later ones, even before it commits
+func testTransactionRepeatedWrites(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	var artistId string
+	err := r.Transactor.RunTransaction(context.Background(), func(ctx context.Context) error {
+		notPurchased := testEvent()
+		notPurchased.Purchased = false
+		notPurchased.Version = 1
+		if err := r.EventRepo.Update(ctx, id, notPurchased); err != nil {
+			return err
+		}
+		if event, err := r.EventRepo.FindById(ctx, id); err != nil || event.Version != 2 || event.Purchased {
+			return fmt.Errorf("updated event not found in the transaction, %+v, %v", event, err)
+		}
+		moved := notPurchased
+		moved.Date = "6/15/2023"
+		moved.Version = 2
+		if err := r.EventRepo.Update(ctx, id, moved); err != nil {
+			return err
+		}
+
+		var err error
+		artistId, err = r.ArtistRepo.Add(ctx, data.Artist{Name: "Toro y Moi", Genre: "Indie"})
+		if err != nil {
+			return err
+		}
+		return r.ArtistRepo.Update(ctx, artistId, data.Artist{Name: "Toro y Moi", Genre: "Chillwave", Version: 1})
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	events := mustFindEvents(t, r)
+	if len(events) != 1 || events[0].Date != "6/15/2023" || events[0].Purchased || events[0].Version != 3 {
+		t.Errorf("Both updates should be committed, actual: %+v", events)
+	}
+	artist, err := r.ArtistRepo.FindById(context.Background(), artistId)
+	if err != nil || artist.Genre != "Chillwave" || artist.Version != 2 {
+		t.Errorf("Artist added and updated in the transaction should be committed, actual: %+v, %v", artist, err)
+	}
+}
+
+func auditEntry(entityId string, action string, timestamp time.Time) data.AuditEntry {
+	return data.AuditEntry{
+		Entity:    "venue",
+		EntityId:  entityId,
+		Action:    action,
+		Actor:     "tui",
+		Timestamp: timestamp,
+		After:     json.RawMessage(`{"name":"The Eastern"}`),
+	}
+}
+
+func mustFindAuditEntries(t *testing.T, r Repos, entity string, id string) []data.AuditEntry {
+	t.Helper()
+	entries, err := r.AuditRepo.Find(context.Background(), entity, id)
+	if err != nil {
+		t.Fatal("failed to find audit entries:", err)
+	}
+	return entries
+}
+
+func testAuditFind(t *testing.T, r Repos) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 2, 20, 0, 0, 0, time.UTC)
+	entries := []data.AuditEntry{
+		auditEntry("1", "create", start),
+		auditEntry("2", "create", start.Add(time.Minute)),
+		auditEntry("1", "update", start.Add(time.Hour)),
+	}
+	entries[2].Before = entries[0].After
+	for _, entry := range entries {
+		if err := r.AuditRepo.Add(ctx, entry); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	found := mustFindAuditEntries(t, r, "venue", "1")
+	if len(found) != 2 || found[0].Action != "create" || found[1].Action != "update" {
+		t.Fatalf("Entries should be found in order, actual: %+v", found)
+	}
+	if found[0].Id == "" || found[0].Actor != "tui" || !found[0].Timestamp.Equal(start) {
+		t.Errorf("Incorrect audit entry, actual: %+v", found[0])
+	}
+	if found[0].Before != nil || string(found[1].Before) != string(entries[0].After) {
+		t.Errorf("Incorrect snapshots, actual: %s and %s", found[0].Before, found[1].Before)
+	}
+	if found := mustFindAuditEntries(t, r, "venue", ""); len(found) != 3 {
+		t.Errorf("Expected every venue entry, actual: %+v", found)
+	}
+	if found := mustFindAuditEntries(t, r, "artist", "1"); len(found) != 0 {
+		t.Errorf("Expected no artist entries, actual: %+v", found)
+	}
+}
+
+func testAuditRollback(t *testing.T, r Repos) {
+	err := r.Transactor.RunTransaction(context.Background(), func(ctx context.Context) error {
+		if err := r.AuditRepo.Add(ctx, auditEntry("1", "create", time.Now().UTC())); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if found := mustFindAuditEntries(t, r, "venue", "1"); len(found) != 0 {
+		t.Errorf("Rolled back entries should not be found, actual: %+v", found)
+	}
+}
+
+func testUserEventsArePrivate(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	alice := db.WithUser(context.Background(), "alice")
+
+	events, err := r.EventRepo.FindAll(alice)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Events of another user should not be found, actual: %v", events)
+	}
+	if _, err := r.EventRepo.FindById(alice, id); err == nil {
+		t.Error("expected error when finding the event of another user")
+	}
+	if err := r.EventRepo.Delete(alice, id); err == nil {
+		t.Error("expected error when deleting the event of another user")
+	}
+	if exists, err := r.EventRepo.Exists(alice, testEvent()); err != nil || exists {
+		t.Errorf("Event of another user should not exist, actual: %v, %v", exists, err)
+	}
+	page, err := r.EventRepo.Query(alice, data.EventQuery{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(page.Events) != 0 {
+		t.Errorf("Query should not find the events of another user, actual: %v", page.Events)
+	}
+
+	aliceId, err := r.EventRepo.Add(alice, testEvent())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if aliceId == id {
+		t.Error("The same event saved by another user should be a separate record")
+	}
+	found, err := r.EventRepo.FindById(alice, aliceId)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found.UserId != "alice" {
+		t.Errorf("Incorrect event owner, expected: %v, actual: %v", "alice", found.UserId)
+	}
+	if events := mustFindEvents(t, r); len(events) != 1 || events[0].Id != id || events[0].UserId != db.DefaultUser {
+		t.Errorf("Default user should only find their own event, actual: %+v", events)
+	}
+}
+
+func testUserSharedCatalog(t *testing.T, r Repos) {
+	artistId := mustAddArtist(t, r, mainAct)
+	venueId := mustAddVenue(t, r, venue)
+	alice := db.WithUser(context.Background(), "alice")
+
+	artists, err := r.ArtistRepo.FindAll(alice)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(artists) != 1 || artists[0].Id != artistId || artists[0].UserId != db.SharedOwner {
+		t.Errorf("Shared artist should be found by every user, actual: %+v", artists)
+	}
+	if id, err := r.ArtistRepo.Add(alice, data.Artist{Name: mainAct.Name, Genre: mainAct.Genre, UserId: "alice"}); err != nil || id != artistId {
+		t.Errorf("Adding a shared artist should reuse it, expected: %v, actual: %v, %v", artistId, id, err)
+	}
+	if _, err := r.VenueRepo.FindById(alice, venueId); err != nil {
+		t.Error("Shared venue should be found by every user:", err)
+	}
+}
+
+func testUserPrivateCatalog(t *testing.T, r Repos) {
+	alice := db.WithUser(context.Background(), "alice")
+	private := mainAct
+	private.UserId = "alice"
+	aliceId, err := r.ArtistRepo.Add(alice, private)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := r.ArtistRepo.FindById(alice, aliceId)
+	if err != nil || found.UserId != "alice" {
+		t.Errorf("Private artist should belong to its user, actual: %+v, %v", found, err)
+	}
+	if artists := mustFindArtists(t, r); len(artists) != 0 {
+		t.Errorf("Private artists of another user should not be found, actual: %v", artists)
+	}
+	if err := r.ArtistRepo.Delete(context.Background(), aliceId); err == nil {
+		t.Error("expected error when deleting the private artist of another user")
+	}
+	if sharedId := mustAddArtist(t, r, mainAct); sharedId == aliceId {
+		t.Error("Private artist of another user should not be reused")
+	}
+}
+
+func testUserAllUsers(t *testing.T, r Repos) {
+	id := mustAddEvent(t, r, testEvent())
+	alice := db.WithUser(context.Background(), "alice")
+	if _, err := r.EventRepo.Add(alice, testEvent()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	all := db.WithAllUsers(context.Background())
+	events, err := r.EventRepo.FindAll(all)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Incorrect number of events for all users, expected: %v, actual: %v", 2, len(events))
+	}
+	if err := r.EventRepo.Delete(db.WithAllUsers(alice), id); err != nil {
+		t.Error("All users should reach the events of every user:", err)
+	}
+
+	aliceEvents, err := r.EventRepo.FindAll(alice)
+	if err != nil || len(aliceEvents) != 1 {
+		t.Fatalf("Expected the event of alice, actual: %v, %v", aliceEvents, err)
+	}
+	updated := aliceEvents[0]
+	updated.Purchased = false
+	if err := r.EventRepo.Update(all, updated.Id, updated); err != nil {
+		t.Fatal("All users should update the events of every user:", err)
+	}
+	found, err := r.EventRepo.FindById(alice, updated.Id)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found.Purchased || found.UserId != "alice" || len(found.Openers) != len(updated.Openers) {
+		t.Errorf("Update for all users should be kept for the owner, expected: %+v, actual: %+v", updated, found)
+	}
+}
@@ -0,0 +1,251 @@
+package sqlite
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type ArtistRepo struct {
+	Connection *SQLite
+}
+
+type Artist = data.Artist
+
+func (repo *ArtistRepo) Add(ctx context.Context, artist Artist) (string, error) {
+	log.Debug("Attempting to add artist", artist)
+	owner := db.User(ctx)
+	existingId, err := repo.findId(ctx, owner, artist.Name)
+	if err == nil {
+		log.Debugf("Skipping adding artist because it already exists %+v, %v", artist, existingId)
+		return existingId, nil
+	}
+	if err != sql.ErrNoRows {
+		log.Errorf("Error occurred while checking if artist %v already exists, %v", artist, err)
+		return "", err
+	}
+
+	id, err := newId()
+	if err != nil {
+		log.Errorf("Failed to generate ID for new artist %+v, %v", artist, err)
+		return "", err
+	}
+	if artist.UserId == db.SharedOwner {
+		owner = db.SharedOwner
+	}
+	_, err = repo.Connection.querier(ctx).ExecContext(ctx,
+		"INSERT INTO artists (id, name, genre, user_id) VALUES (?, ?, ?, ?)",
+		id, artist.Name, artist.Genre, owner)
+	if err != nil {
+		log.Errorf("Failed to add new artist %+v, %v", artist, err)
+		return "", err
+	}
+	log.Infof("Created new artist %+v", id)
+	return id, nil
+}
+
+func (repo *ArtistRepo) Update(ctx context.Context, id string, artist Artist) error {
+	log.Debug("Attempting to update artist", id, artist)
+	condition, args := scope(ctx, "artists")
+	result, err := repo.Connection.querier(ctx).ExecContext(ctx,
+		"UPDATE artists SET name = ?, genre = ?, version = version + 1"+
+			" WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?) AND "+condition,
+		append([]any{artist.Name, artist.Genre, id, artist.Version, artist.Version}, args...)...)
+	if err == nil {
+		err = repo.Connection.expectUpdated(ctx, result, "artists", "artist", id, artist.Version)
+	}
+	if err != nil {
+		log.Errorf("Failed to update artist %+v to %v, %v", id, artist, err)
+		return err
+	}
+	log.Info("Successfully updated artist", id)
+	return nil
+}
+
+func (repo *ArtistRepo) Delete(ctx context.Context, id string) error {
+	log.Debug("Attempting to delete artist", id)
+	err := repo.Connection.trash(ctx, "artists", "artist", id)
+	if err != nil {
+		log.Error("Failed to delete artist", id, err)
+		return err
+	}
+	log.Infof("Successfully deleted artist %+v", id)
+	return nil
+}
+
+func (repo *ArtistRepo) Exists(ctx context.Context, artist Artist) (bool, error) {
+	log.Debug("Checking for existence of artist", artist)
+	id, err := repo.findId(ctx, db.User(ctx), artist.Name)
+	if err == sql.ErrNoRows {
+		log.Debug("No existing artist found for", artist)
+		return false, nil
+	}
+	if err != nil {
+		log.Errorf("Error while checking existence of artist %v, %v", artist, err)
+		return false, err
+	}
+	log.Debugf("Found artist %v with ID %v", artist, id)
+	return true, nil
+}
+
+// also finds artists in the trash
+func (repo *ArtistRepo) FindById(ctx context.Context, id string) (Artist, error) {
+	log.Debug("Finding artist", id)
+	condition, args := scope(ctx, "artists")
+	artists, err := repo.findAllRows(ctx, selectArtists+" WHERE id = ? AND "+condition, append([]any{id}, args...)...)
+	if err != nil {
+		log.Errorf("Error while finding artist %v, %v", id, err)
+		return Artist{}, err
+	}
+	if len(artists) == 0 {
+		return Artist{}, fmt.Errorf("artist %s not found", id)
+	}
+	return artists[0], nil
+}
+
+func (repo *ArtistRepo) FindAll(ctx context.Context) ([]Artist, error) {
+	log.Debug("Finding all artists")
+	condition, args := scope(ctx, "artists")
+	artists, err := repo.findAllRows(ctx, selectArtists+" WHERE deleted_at IS NULL AND "+condition, args...)
+	if err != nil {
+		log.Error("Error while finding all artists,", err)
+		return nil, err
+	}
+	log.Debugf("Found %d artists", len(artists))
+	return artists, nil
+}
+
+func (repo *ArtistRepo) FindDeleted(ctx context.Context) ([]Artist, error) {
+	log.Debug("Finding all deleted artists")
+	condition, args := scope(ctx, "artists")
+	artists, err := repo.findAllRows(ctx, selectArtists+" WHERE deleted_at IS NOT NULL AND "+condition, args...)
+	if err != nil {
+		log.Error("Error while finding all deleted artists,", err)
+		return nil, err
+	}
+	log.Debugf("Found %d deleted artists", len(artists))
+	return artists, nil
+}
+
+func (repo *ArtistRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore artist", id)
+	err := repo.Connection.RunTransaction(ctx, func(ctx context.Context) error {
+		condition, args := scope(ctx, "artists")
+		var name, owner string
+		err := repo.Connection.querier(ctx).QueryRowContext(ctx,
+			"SELECT name, user_id FROM artists WHERE id = ? AND deleted_at IS NOT NULL AND "+condition,
+			append([]any{id}, args...)...).
+			Scan(&name, &owner)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("deleted artist %s not found", id)
+		}
+		if err != nil {
+			return err
+		}
+		existingId, err := repo.findId(ctx, owner, name)
+		if err == nil {
+			return fmt.Errorf("artist %s already exists with the same name", existingId)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		return repo.Connection.restore(ctx, "artists", "artist", id)
+	})
+	if err != nil {
+		log.Errorf("Failed to restore artist %v, %v", id, err)
+		return err
+	}
+	log.Infof("Successfully restored artist %+v", id)
+	return nil
+}
+
+func (repo *ArtistRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge artist", id)
+	err := repo.Connection.purge(ctx, "artists", "artist", id)
+	if err != nil {
+		log.Error("Failed to purge artist", id, err)
+		return err
+	}
+	log.Infof("Successfully purged artist %+v", id)
+	return nil
+}
+
+// only finds artists outside of the trash that are shared or belong to the owner
+func (repo *ArtistRepo) findId(ctx context.Context, owner string, name string) (string, error) {
+	var id string
+	err := repo.Connection.querier(ctx).QueryRowContext(ctx,
+		"SELECT id FROM artists WHERE name = ? AND deleted_at IS NULL AND user_id IN ('', ?) LIMIT 1", name, owner).
+		Scan(&id)
+	return id, err
+}
+
+const selectArtists = "SELECT id, name, genre, version, deleted_at, user_id FROM artists"
+
+func (repo *ArtistRepo) findAllRows(ctx context.Context, query string, args ...any) ([]Artist, error) {
+	rows, err := repo.Connection.querier(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artists := []Artist{}
+	for rows.Next() {
+		var artist Artist
+		var deletedAt sql.NullString
+		if err := rows.Scan(&artist.Id, &artist.Name, &artist.Genre, &artist.Version, &deletedAt, &artist.UserId); err != nil {
+			return nil, err
+		}
+		if artist.DeletedAt, err = toDeletedAt(deletedAt); err != nil {
+			return nil, err
+		}
+		artists = append(artists, artist)
+	}
+	return artists, rows.Err()
+}
+
+// finds the artists with the IDs the query selects, including the trashed artists and those of every user
+func (repo *ArtistRepo) findAllById(ctx context.Context, selected string, args ...any) (map[string]Artist, error) {
+	artists, err := repo.findAllRows(ctx, selectArtists+" WHERE id IN ("+selected+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	artistsById := make(map[string]Artist)
+	for _, a := range artists {
+		artistsById[a.Id] = a
+	}
+	return artistsById, nil
+}
+
+func expectOneRow(result sql.Result, entity string, id string) error {
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s %s not found", entity, id)
+	}
+	return nil
+}
+
+// Updates only match rows at the expected version, so when nothing was
+// updated this finds out whether the record is missing or has moved on
+func (s *SQLite) expectUpdated(ctx context.Context, result sql.Result, table string, entity string, id string, expected int) error {
+	count, err := result.RowsAffected()
+	if err != nil || count > 0 {
+		return err
+	}
+	var actual int
+	condition, args := scope(ctx, table)
+	err = s.querier(ctx).QueryRowContext(ctx, "SELECT version FROM "+table+" WHERE id = ? AND deleted_at IS NULL AND "+condition,
+		append([]any{id}, args...)...).Scan(&actual)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%s %s not found", entity, id)
+	}
+	if err != nil {
+		return err
+	}
+	return db.CheckVersion(entity, id, expected, actual)
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type AuditRepo struct {
+	Connection *SQLite
+}
+
+// Timestamps are stored with a fixed number of fractional digits so they sort as text
+const auditTimestampFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+func (repo *AuditRepo) Add(ctx context.Context, entry data.AuditEntry) error {
+	log.Debugf("Recording %s of %s %v", entry.Action, entry.Entity, entry.EntityId)
+	id, err := newId()
+	if err != nil {
+		return err
+	}
+	_, err = repo.Connection.querier(ctx).ExecContext(ctx,
+		"INSERT INTO audit_log (id, entity, entity_id, action, actor, timestamp, before, after) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		id, entry.Entity, entry.EntityId, entry.Action, entry.Actor, entry.Timestamp.UTC().Format(auditTimestampFormat),
+		toNullString(entry.Before), toNullString(entry.After))
+	if err != nil {
+		log.Errorf("Failed to record %s of %s %v, %v", entry.Action, entry.Entity, entry.EntityId, err)
+	}
+	return err
+}
+
+func (repo *AuditRepo) Find(ctx context.Context, entity string, id string) ([]data.AuditEntry, error) {
+	log.Debug("Finding audit entries", entity, id)
+	rows, err := repo.Connection.querier(ctx).QueryContext(ctx,
+		"SELECT id, entity, entity_id, action, actor, timestamp, before, after FROM audit_log "+
+			"WHERE entity = ? AND (? = '' OR entity_id = ?) ORDER BY timestamp, rowid", entity, id, id)
+	if err != nil {
+		log.Error("Error while finding audit entries,", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []data.AuditEntry{}
+	for rows.Next() {
+		var entry data.AuditEntry
+		var timestamp string
+		var before, after sql.NullString
+		err := rows.Scan(&entry.Id, &entry.Entity, &entry.EntityId, &entry.Action, &entry.Actor, &timestamp, &before, &after)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Timestamp, err = time.Parse(auditTimestampFormat, timestamp); err != nil {
+			return nil, err
+		}
+		if before.Valid {
+			entry.Before = []byte(before.String)
+		}
+		if after.Valid {
+			entry.After = []byte(after.String)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func toNullString(snapshot []byte) sql.NullString {
+	return sql.NullString{String: string(snapshot), Valid: snapshot != nil}
+}
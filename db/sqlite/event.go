@@ -0,0 +1,625 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"concert-manager/util"
+)
+
+// ISO dates sort lexically, which keeps the date column usable in range queries
+const dateFmt = "2006-01-02"
+
+type EventRepo struct {
+	Connection *SQLite
+	VenueRepo  *VenueRepo
+	ArtistRepo *ArtistRepo
+}
+
+type Event = data.Event
+
+type eventRefs struct {
+	mainActId sql.NullString
+	openerIds []string
+	venueId   string
+}
+
+func (repo *EventRepo) Add(ctx context.Context, event Event) (string, error) {
+	log.Debug("Attempting to add event", event)
+	owner := db.User(ctx)
+	refs, err := repo.findRefs(ctx, owner, event)
+	if err != nil {
+		return "", err
+	}
+
+	existingId, err := repo.findId(ctx, owner, event.Date, refs.venueId)
+	if err == nil {
+		log.Debugf("Skipped adding event because it already existed as %+v, %v", event, existingId)
+		return existingId, nil
+	}
+	if err != sql.ErrNoRows {
+		log.Errorf("Error occurred while checking if event %v already exists, %v", event, err)
+		return "", err
+	}
+
+	id, err := newId()
+	if err != nil {
+		log.Errorf("Failed to generate ID for new event %+v, %v", event, err)
+		return "", err
+	}
+	err = repo.write(ctx, id, refs, func(ctx context.Context) error {
+		_, err := repo.Connection.querier(ctx).ExecContext(ctx,
+			"INSERT INTO events (id, main_act_id, venue_id, date, purchased, tm_id, user_id, archived_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			id, refs.mainActId, refs.venueId, toDateColumn(event.Date), event.Purchased, event.TmId, owner,
+			toArchivedColumn(event.ArchivedAt))
+		return err
+	})
+	if err != nil {
+		log.Errorf("Failed to add event %+v, %v", event, err)
+		return "", err
+	}
+	log.Infof("Created new event %+v", id)
+	return id, nil
+}
+
+// Requires that all the artists and the venue already exist, and that the event belongs to the user of the context
+func (repo *EventRepo) Update(ctx context.Context, id string, event Event) error {
+	log.Debug("Attempting to update event", id, event)
+	// under all users the event keeps its owner, so the references are resolved for them
+	condition, args := scope(ctx, "events")
+	var owner string
+	err := repo.Connection.querier(ctx).QueryRowContext(ctx,
+		"SELECT user_id FROM events WHERE id = ? AND deleted_at IS NULL AND "+condition,
+		append([]any{id}, args...)...).Scan(&owner)
+	if err == sql.ErrNoRows {
+		log.Errorf("Failed to find existing event while updating %+v", id)
+		return fmt.Errorf("event %s not found", id)
+	}
+	if err != nil {
+		log.Errorf("Failed to find existing event while updating %+v, %v", id, err)
+		return err
+	}
+
+	refs, err := repo.findRefs(ctx, owner, event)
+	if err != nil {
+		return err
+	}
+
+	existingId, err := repo.findId(ctx, owner, event.Date, refs.venueId)
+	if err == nil && existingId != id {
+		log.Errorf("Failed to update event %v, another event %v exists for the same date and venue", id, existingId)
+		return fmt.Errorf("event %s already exists for the same date and venue", existingId)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("Error occurred while checking for conflicting events when updating %v, %v", id, err)
+		return err
+	}
+
+	err = repo.write(ctx, id, refs, func(ctx context.Context) error {
+		result, err := repo.Connection.querier(ctx).ExecContext(ctx,
+			"UPDATE events SET main_act_id = ?, venue_id = ?, date = ?, purchased = ?, tm_id = ?, archived_at = ?,"+
+				" version = version + 1 WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?) AND "+condition,
+			append([]any{refs.mainActId, refs.venueId, toDateColumn(event.Date), event.Purchased, event.TmId,
+				toArchivedColumn(event.ArchivedAt), id, event.Version, event.Version}, args...)...)
+		if err != nil {
+			return err
+		}
+		if err := repo.Connection.expectUpdated(ctx, result, "events", "event", id, event.Version); err != nil {
+			return err
+		}
+		_, err = repo.Connection.querier(ctx).ExecContext(ctx, "DELETE FROM event_openers WHERE event_id = ?", id)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Failed to update event %+v to %v, %v", id, event, err)
+		return err
+	}
+	log.Info("Successfully updated event", id)
+	return nil
+}
+
+// resolves the references among the artists and venues the owner can see
+func (repo *EventRepo) findRefs(ctx context.Context, owner string, event Event) (eventRefs, error) {
+	refs := eventRefs{openerIds: []string{}}
+	if event.MainAct.Populated() {
+		id, err := repo.ArtistRepo.findId(ctx, owner, event.MainAct.Name)
+		if err != nil {
+			log.Errorf("Failed to find existing artist %v for event %v", event.MainAct.Name, event)
+			return refs, err
+		}
+		log.Debugf("Found existing artist %v with ID %v for event", event.MainAct.Name, id)
+		refs.mainActId = sql.NullString{String: id, Valid: true}
+	}
+
+	for _, opener := range event.Openers {
+		id, err := repo.ArtistRepo.findId(ctx, owner, opener.Name)
+		if err != nil {
+			log.Errorf("Failed to find existing opening artist %v for event %v", opener.Name, event)
+			return refs, err
+		}
+		log.Debugf("Found existing artist %v with ID %v for event", opener.Name, id)
+		refs.openerIds = append(refs.openerIds, id)
+	}
+
+	venueId, err := repo.VenueRepo.findId(ctx, owner, event.Venue.Name, event.Venue.City, event.Venue.State)
+	if err != nil {
+		log.Errorf("Failed to find existing venue %+v for event", event.Venue)
+		return refs, err
+	}
+	log.Debugf("Found existing venue %v with ID %v for event", event.Venue, venueId)
+	refs.venueId = venueId
+	return refs, nil
+}
+
+// runs the event row statement and then (re)writes the openers in a single transaction
+func (repo *EventRepo) write(ctx context.Context, id string, refs eventRefs, writeEvent func(context.Context) error) error {
+	return repo.Connection.RunTransaction(ctx, func(ctx context.Context) error {
+		if err := writeEvent(ctx); err != nil {
+			return err
+		}
+		for i, openerId := range refs.openerIds {
+			_, err := repo.Connection.querier(ctx).ExecContext(ctx,
+				"INSERT INTO event_openers (event_id, artist_id, position) VALUES (?, ?, ?)",
+				id, openerId, i)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (repo *EventRepo) Delete(ctx context.Context, id string) error {
+	log.Debug("Attempting to delete event", id)
+	err := repo.Connection.trash(ctx, "events", "event", id)
+	if err != nil {
+		log.Error("Failed to delete event", id, err)
+		return err
+	}
+	log.Infof("Successfully deleted event %+v", id)
+	return nil
+}
+
+func (repo *EventRepo) FindDeleted(ctx context.Context) ([]Event, error) {
+	log.Debug("Finding all deleted events")
+	condition, args := scope(ctx, "events")
+	inspections, err := repo.inspectRows(ctx, selectEvents+" WHERE deleted_at IS NOT NULL AND "+condition, args...)
+	if err != nil {
+		log.Error("Error while finding all deleted events,", err)
+		return nil, err
+	}
+
+	events := []Event{}
+	for _, inspection := range inspections {
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid deleted event %v, %v", inspection.event.Id, inspection.problems)
+			continue
+		}
+		events = append(events, inspection.event)
+	}
+	log.Debugf("Returning %d deleted events", len(events))
+	return events, nil
+}
+
+// Events can only be restored once their artists and venue are out of the trash
+func (repo *EventRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore event", id)
+	err := repo.Connection.RunTransaction(ctx, func(ctx context.Context) error {
+		condition, args := scope(ctx, "events")
+		inspections, err := repo.inspectRows(ctx, selectEvents+" WHERE id = ? AND deleted_at IS NOT NULL AND "+condition,
+			append([]any{id}, args...)...)
+		if err != nil {
+			return err
+		}
+		if len(inspections) == 0 {
+			return fmt.Errorf("deleted event %s not found", id)
+		}
+		inspection := inspections[0]
+		if len(inspection.problems) > 0 {
+			return fmt.Errorf("event %s can't be restored, %v", id, inspection.problems)
+		}
+		if trashed := inspection.event.TrashedReferences(); len(trashed) > 0 {
+			return fmt.Errorf("event %s can't be restored until its %s are restored", id, strings.Join(trashed, ", "))
+		}
+		existingId, err := repo.findId(ctx, inspection.event.UserId, inspection.event.Date, inspection.refs.venueId)
+		if err == nil {
+			return fmt.Errorf("event %s already exists for the same date and venue", existingId)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		return repo.Connection.restore(ctx, "events", "event", id)
+	})
+	if err != nil {
+		log.Errorf("Failed to restore event %v, %v", id, err)
+		return err
+	}
+	log.Infof("Successfully restored event %+v", id)
+	return nil
+}
+
+func (repo *EventRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge event", id)
+	err := repo.Connection.RunTransaction(ctx, func(ctx context.Context) error {
+		if err := repo.Connection.purge(ctx, "events", "event", id); err != nil {
+			return err
+		}
+		_, err := repo.Connection.querier(ctx).ExecContext(ctx, "DELETE FROM event_openers WHERE event_id = ?", id)
+		return err
+	})
+	if err != nil {
+		log.Error("Failed to purge event", id, err)
+		return err
+	}
+	log.Infof("Successfully purged event %+v", id)
+	return nil
+}
+
+func (repo *EventRepo) Exists(ctx context.Context, event Event) (bool, error) {
+	log.Debug("Checking for existence of event", event)
+	owner := db.User(ctx)
+	venueId, err := repo.VenueRepo.findId(ctx, owner, event.Venue.Name, event.Venue.City, event.Venue.State)
+	if err == sql.ErrNoRows {
+		log.Debugf("No existing venue found while checking for event existence %+v", event)
+		return false, nil
+	}
+	if err != nil {
+		log.Errorf("Error while checking existence of event venue %v, %v", event.Venue, err)
+		return false, err
+	}
+
+	id, err := repo.findId(ctx, owner, event.Date, venueId)
+	if err == sql.ErrNoRows {
+		log.Debug("No existing event found for", event)
+		return false, nil
+	}
+	if err != nil {
+		log.Errorf("Error while checking existence of event %v, %v", event, err)
+		return false, err
+	}
+	log.Debugf("Found event %v with ID %v", event, id)
+	return true, nil
+}
+
+// Also finds events in the trash. Invalid events only hold the references that still exist
+func (repo *EventRepo) FindById(ctx context.Context, id string) (Event, error) {
+	log.Debug("Finding event", id)
+	condition, args := scope(ctx, "events")
+	inspections, err := repo.inspectRows(ctx, selectEvents+" WHERE id = ? AND "+condition, append([]any{id}, args...)...)
+	if err != nil {
+		log.Errorf("Error while finding event %v, %v", id, err)
+		return Event{}, err
+	}
+	if len(inspections) == 0 {
+		return Event{}, fmt.Errorf("event %s not found", id)
+	}
+	return inspections[0].event, nil
+}
+
+func (repo *EventRepo) FindAll(ctx context.Context) ([]Event, error) {
+	log.Debug("Finding all events")
+	inspections, err := repo.inspectAll(ctx)
+	if err != nil {
+		log.Error("Error while finding all events,", err)
+		return nil, err
+	}
+
+	events := []Event{}
+	for _, inspection := range inspections {
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid event %v, %v", inspection.event.Id, inspection.problems)
+			continue
+		}
+		events = append(events, inspection.event)
+	}
+
+	log.Debugf("Returning %d constructed events", len(events))
+	return events, nil
+}
+
+// Filters and pages in SQL, so only the matching event rows are read
+func (repo *EventRepo) Query(ctx context.Context, query data.EventQuery) (data.EventPage, error) {
+	log.Debugf("Querying events %+v", query)
+	condition, args := scope(ctx, "events")
+	where := []string{"deleted_at IS NULL", condition, validEvent}
+	if query.From != "" {
+		where = append(where, "date >= ?")
+		args = append(args, toDateColumn(query.From))
+	}
+	if query.To != "" {
+		where = append(where, "date <= ?")
+		args = append(args, toDateColumn(query.To))
+	}
+	if query.Purchased != nil {
+		where = append(where, "purchased = ?")
+		args = append(args, *query.Purchased)
+	}
+	if query.VenueId != "" {
+		where = append(where, "venue_id = ?")
+		args = append(args, query.VenueId)
+	}
+	if query.ArtistId != "" {
+		where = append(where, "(main_act_id = ? OR id IN (SELECT event_id FROM event_openers WHERE artist_id = ?))")
+		args = append(args, query.ArtistId, query.ArtistId)
+	}
+	if query.Cursor != "" {
+		cursor, err := util.DecodeEventCursor(query.Cursor)
+		if err != nil {
+			return data.EventPage{}, err
+		}
+		where = append(where, "(date > ? OR (date = ? AND id > ?))")
+		args = append(args, cursor.Date, cursor.Date, cursor.Id)
+	}
+
+	statement := selectEvents + " WHERE " + strings.Join(where, " AND ")
+	statement += " ORDER BY date, id"
+	if query.Limit > 0 {
+		// one extra row shows whether there is another page
+		statement += " LIMIT ?"
+		args = append(args, query.Limit+1)
+	}
+
+	inspections, err := repo.inspectRows(ctx, statement, args...)
+	if err != nil {
+		log.Error("Error while querying events,", err)
+		return data.EventPage{}, err
+	}
+
+	page := data.EventPage{Events: []Event{}}
+	if query.Limit > 0 && len(inspections) > query.Limit {
+		inspections = inspections[:query.Limit]
+		last := inspections[len(inspections)-1]
+		page.NextCursor = util.EventCursor{Date: last.column, Id: last.event.Id}.Encode()
+	}
+	for _, inspection := range inspections {
+		if len(inspection.problems) > 0 {
+			log.Errorf("Skipping invalid event %v, %v", inspection.event.Id, inspection.problems)
+			continue
+		}
+		page.Events = append(page.Events, inspection.event)
+	}
+	log.Debugf("Returning %d queried events", len(page.Events))
+	return page, nil
+}
+
+func (repo *EventRepo) FindIntegrityIssues(ctx context.Context) ([]data.IntegrityIssue, error) {
+	log.Debug("Checking integrity of all events")
+	inspections, err := repo.inspectAll(ctx)
+	if err != nil {
+		log.Error("Error while checking integrity of all events,", err)
+		return nil, err
+	}
+
+	issues := []data.IntegrityIssue{}
+	for _, inspection := range inspections {
+		if len(inspection.problems) > 0 {
+			issues = append(issues, inspection.issue())
+		}
+	}
+	log.Debugf("Found %d events with integrity issues", len(issues))
+	return issues, nil
+}
+
+// Rewrites an invalid event without its dangling artist references. Events
+// without a valid venue, date or any remaining artist can't be repaired and
+// have to be deleted instead.
+func (repo *EventRepo) Repair(ctx context.Context, id string) error {
+	log.Debug("Attempting to repair event", id)
+	inspections, err := repo.inspectAll(ctx)
+	if err != nil {
+		log.Errorf("Failed to inspect events while repairing %v, %v", id, err)
+		return err
+	}
+	idx := slices.IndexFunc(inspections, func(i eventInspection) bool {
+		return i.event.Id == id
+	})
+	if idx == -1 {
+		log.Errorf("Failed to find existing event while repairing %v", id)
+		return fmt.Errorf("event %s not found", id)
+	}
+
+	inspection := inspections[idx]
+	if len(inspection.problems) == 0 {
+		log.Debug("Skipped repairing event because it has no integrity issues", id)
+		return nil
+	}
+	if !inspection.repairable() {
+		log.Errorf("Unable to repair event %v, %v", id, inspection.problems)
+		return fmt.Errorf("event %s can't be repaired, %v", id, inspection.fatal)
+	}
+
+	err = repo.write(ctx, id, inspection.refs, func(ctx context.Context) error {
+		_, err := repo.Connection.querier(ctx).ExecContext(ctx,
+			"UPDATE events SET main_act_id = ?, version = version + 1 WHERE id = ?", inspection.refs.mainActId, id)
+		if err != nil {
+			return err
+		}
+		_, err = repo.Connection.querier(ctx).ExecContext(ctx, "DELETE FROM event_openers WHERE event_id = ?", id)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Failed to repair event %v, %v", id, err)
+		return err
+	}
+	log.Info("Successfully repaired event", id)
+	return nil
+}
+
+type eventInspection struct {
+	event    Event
+	refs     eventRefs
+	column   string
+	problems []string
+	fatal    []string
+}
+
+func (i *eventInspection) repairable() bool {
+	return len(i.fatal) == 0
+}
+
+func (i *eventInspection) issue() data.IntegrityIssue {
+	return data.IntegrityIssue{
+		Entity:     "event",
+		Id:         i.event.Id,
+		Problems:   i.problems,
+		Repairable: i.repairable(),
+	}
+}
+
+func (i *eventInspection) problem(fatal bool, format string, args ...any) {
+	problem := fmt.Sprintf(format, args...)
+	i.problems = append(i.problems, problem)
+	if fatal {
+		i.fatal = append(i.fatal, problem)
+	}
+}
+
+const selectEvents = "SELECT id, main_act_id, venue_id, date, purchased, tm_id, version, deleted_at, user_id, archived_at FROM events"
+
+// Matches the events outside of the trash that inspectRows finds no problems with, so invalid
+// events can be left out before a page is cut instead of leaving the page short
+const validEvent = `venue_id IN (SELECT id FROM venues WHERE deleted_at IS NULL)
+	AND (main_act_id IS NULL OR main_act_id IN (SELECT id FROM artists WHERE deleted_at IS NULL))
+	AND (main_act_id IS NOT NULL OR EXISTS (SELECT 1 FROM event_openers WHERE event_id = events.id))
+	AND NOT EXISTS (SELECT 1 FROM event_openers WHERE event_id = events.id
+		AND artist_id NOT IN (SELECT id FROM artists WHERE deleted_at IS NULL))
+	AND date(date) IS date`
+
+// only inspects the events outside of the trash
+func (repo *EventRepo) inspectAll(ctx context.Context) ([]eventInspection, error) {
+	condition, args := scope(ctx, "events")
+	return repo.inspectRows(ctx, selectEvents+" WHERE deleted_at IS NULL AND "+condition, args...)
+}
+
+// Reads the event rows selected by the query along with the problems that would make them
+// unsafe to return. The event and refs of each inspection only hold the valid parts.
+// Trashed artists and venues only count as valid for events that are in the trash too.
+func (repo *EventRepo) inspectRows(ctx context.Context, query string, args ...any) ([]eventInspection, error) {
+	// only the references of the selected rows are read
+	selected := "SELECT id FROM (" + query + ")"
+	artists, err := repo.ArtistRepo.findAllById(ctx,
+		"SELECT main_act_id FROM ("+query+") UNION SELECT artist_id FROM event_openers WHERE event_id IN ("+selected+")",
+		append(slices.Clone(args), args...)...)
+	if err != nil {
+		return nil, err
+	}
+	venues, err := repo.VenueRepo.findAllById(ctx, "SELECT venue_id FROM ("+query+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	openers, err := repo.findOpenerIds(ctx, selected, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.Connection.querier(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inspections := []eventInspection{}
+	for rows.Next() {
+		var id, venueId, date, tmId, userId string
+		var mainActId sql.NullString
+		var purchased bool
+		var version int
+		var deletedAtColumn, archivedAtColumn sql.NullString
+		if err := rows.Scan(&id, &mainActId, &venueId, &date, &purchased, &tmId, &version, &deletedAtColumn, &userId,
+			&archivedAtColumn); err != nil {
+			return nil, err
+		}
+		deletedAt, err := toDeletedAt(deletedAtColumn)
+		if err != nil {
+			return nil, err
+		}
+		// both columns hold timestamps in the same format
+		archivedAt, err := toDeletedAt(archivedAtColumn)
+		if err != nil {
+			return nil, err
+		}
+		visible := func(refDeletedAt *time.Time) bool {
+			return refDeletedAt == nil || deletedAt != nil
+		}
+
+		i := eventInspection{
+			event: Event{Openers: []Artist{}, Purchased: purchased, TmId: tmId, Id: id, Version: version,
+				DeletedAt: deletedAt, UserId: userId, ArchivedAt: archivedAt},
+			refs:   eventRefs{openerIds: []string{}},
+			column: date,
+		}
+		if mainActId.Valid {
+			if mainAct, ok := artists[mainActId.String]; ok && visible(mainAct.DeletedAt) {
+				i.event.MainAct = mainAct
+				i.refs.mainActId = mainActId
+			} else {
+				i.problem(false, "main act %s does not exist", mainActId.String)
+			}
+		}
+		for _, openerId := range openers[id] {
+			if opener, ok := artists[openerId]; ok && visible(opener.DeletedAt) {
+				i.event.Openers = append(i.event.Openers, opener)
+				i.refs.openerIds = append(i.refs.openerIds, openerId)
+			} else {
+				i.problem(false, "opener %s does not exist", openerId)
+			}
+		}
+		if !i.refs.mainActId.Valid && len(i.refs.openerIds) == 0 {
+			i.problem(true, "event has no valid artists")
+		}
+		if venue, ok := venues[venueId]; ok && visible(venue.DeletedAt) {
+			i.event.Venue = venue
+			i.refs.venueId = venueId
+		} else {
+			i.problem(true, "venue %s does not exist", venueId)
+		}
+		if ts, err := time.Parse(dateFmt, date); err == nil {
+			i.event.Date = util.Date(ts)
+		} else {
+			i.problem(true, "date %s is invalid", date)
+		}
+		inspections = append(inspections, i)
+	}
+	return inspections, rows.Err()
+}
+
+// only finds events of the owner outside of the trash
+func (repo *EventRepo) findId(ctx context.Context, owner string, date string, venueId string) (string, error) {
+	var id string
+	err := repo.Connection.querier(ctx).QueryRowContext(ctx,
+		"SELECT id FROM events WHERE date = ? AND venue_id = ? AND deleted_at IS NULL AND user_id = ? LIMIT 1",
+		toDateColumn(date), venueId, owner).
+		Scan(&id)
+	return id, err
+}
+
+// returns the ordered opener artist IDs for the events with the selected IDs, keyed by event ID
+func (repo *EventRepo) findOpenerIds(ctx context.Context, selected string, args ...any) (map[string][]string, error) {
+	rows, err := repo.Connection.querier(ctx).QueryContext(ctx,
+		"SELECT event_id, artist_id FROM event_openers WHERE event_id IN ("+selected+") ORDER BY event_id, position", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	openers := make(map[string][]string)
+	for rows.Next() {
+		var eventId, artistId string
+		if err := rows.Scan(&eventId, &artistId); err != nil {
+			return nil, err
+		}
+		openers[eventId] = append(openers[eventId], artistId)
+	}
+	return openers, rows.Err()
+}
+
+func toDateColumn(date string) string {
+	return util.Timestamp(date).Format(dateFmt)
+}
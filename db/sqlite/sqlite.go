@@ -0,0 +1,297 @@
+package sqlite
+
+import (
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	pathEnv     = "CM_SQLITE_PATH"
+	defaultPath = "/.concert_manager/concert_manager.db"
+	driverName  = "sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS artists (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	genre      TEXT NOT NULL,
+	version    INTEGER NOT NULL DEFAULT 1,
+	deleted_at TEXT,
+	user_id    TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS artists_name ON artists (name);
+
+CREATE TABLE IF NOT EXISTS venues (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	city       TEXT NOT NULL,
+	state      TEXT NOT NULL,
+	version    INTEGER NOT NULL DEFAULT 1,
+	deleted_at TEXT,
+	user_id    TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS venues_name_city_state ON venues (name, city, state);
+
+CREATE TABLE IF NOT EXISTS events (
+	id          TEXT PRIMARY KEY,
+	main_act_id TEXT,
+	venue_id    TEXT NOT NULL,
+	date        TEXT NOT NULL,
+	purchased   INTEGER NOT NULL,
+	tm_id       TEXT NOT NULL DEFAULT '',
+	version     INTEGER NOT NULL DEFAULT 1,
+	deleted_at  TEXT,
+	user_id     TEXT NOT NULL DEFAULT 'default',
+	archived_at TEXT
+);
+CREATE INDEX IF NOT EXISTS events_date_venue ON events (date, venue_id);
+CREATE INDEX IF NOT EXISTS events_venue_date ON events (venue_id, date);
+CREATE INDEX IF NOT EXISTS events_main_act_date ON events (main_act_id, date);
+
+CREATE TABLE IF NOT EXISTS event_openers (
+	event_id  TEXT NOT NULL,
+	artist_id TEXT NOT NULL,
+	position  INTEGER NOT NULL,
+	PRIMARY KEY (event_id, position)
+);
+CREATE INDEX IF NOT EXISTS event_openers_artist ON event_openers (artist_id);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id        TEXT PRIMARY KEY,
+	entity    TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	action    TEXT NOT NULL,
+	actor     TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	before    TEXT,
+	after     TEXT
+);
+CREATE INDEX IF NOT EXISTS audit_log_entity ON audit_log (entity, entity_id, timestamp);
+`
+
+// CREATE TABLE IF NOT EXISTS leaves tables from older versions of the schema alone,
+// so columns added since then have to be added to existing databases here
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"artists", "version", "INTEGER NOT NULL DEFAULT 1"},
+	{"venues", "version", "INTEGER NOT NULL DEFAULT 1"},
+	{"events", "version", "INTEGER NOT NULL DEFAULT 1"},
+	{"artists", "deleted_at", "TEXT"},
+	{"venues", "deleted_at", "TEXT"},
+	{"events", "deleted_at", "TEXT"},
+	// existing artists and venues become shared, while existing events go to the default user
+	{"artists", "user_id", "TEXT NOT NULL DEFAULT ''"},
+	{"venues", "user_id", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "user_id", "TEXT NOT NULL DEFAULT '" + db.DefaultUser + "'"},
+	{"events", "archived_at", "TEXT"},
+}
+
+// indexes on added columns can only be created once the columns exist
+const addedIndexes = `
+CREATE INDEX IF NOT EXISTS events_user_date ON events (user_id, date);
+`
+
+type SQLite struct {
+	DB *sql.DB
+}
+
+func Setup() (*SQLite, error) {
+	path := os.Getenv(pathEnv)
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = homeDir + defaultPath
+	}
+	return Open(path)
+}
+
+// Opens (and creates, if needed) the database file at the given path.
+// The special path ":memory:" creates a private in-memory database
+func Open(path string) (*SQLite, error) {
+	log.Debug("Opening SQLite database at", path)
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open(driverName, path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer, and an in-memory database only lives as long as its connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addMissingColumns(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(addedIndexes); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Info("Successfully initialized database")
+	return &SQLite{db}, nil
+}
+
+func addMissingColumns(db *sql.DB) error {
+	for _, c := range addedColumns {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).
+			Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		log.Infof("Adding column %s to table %s", c.column, c.table)
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	idChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	idLength = 20
+)
+
+// matches the shape of the auto-generated Firestore document IDs
+func newId() (string, error) {
+	id := make([]byte, idLength)
+	max := big.NewInt(int64(len(idChars)))
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = idChars[n.Int64()]
+	}
+	return string(id), nil
+}
+
+type txKey struct{}
+
+type querier interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+// Runs f so that every statement made through the repositories with the given context is part of a
+// single database transaction, committed once f returns or rolled back if f returns an error.
+// Nested calls join the outer transaction
+func (s *SQLite) RunTransaction(ctx context.Context, f func(context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return f(ctx)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := f(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		log.Debug("Rolling back transaction due to error,", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// the connection pool only holds a single connection, so everything inside
+// a transaction has to go through the transaction to avoid deadlocking
+func (s *SQLite) querier(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.DB
+}
+
+// deleted_at holds when a record was moved to the trash, and is NULL for every other record
+func toDeletedAt(column sql.NullString) (*time.Time, error) {
+	if !column.Valid {
+		return nil, nil
+	}
+	deletedAt, err := time.Parse(time.RFC3339Nano, column.String)
+	if err != nil {
+		return nil, err
+	}
+	return &deletedAt, nil
+}
+
+// archived_at holds when a passed event was archived, and is NULL for every other event
+func toArchivedColumn(archivedAt *time.Time) sql.NullString {
+	if archivedAt == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: archivedAt.UTC().Format(time.RFC3339Nano), Valid: true}
+}
+
+// Restricts statements to the rows of the table the context can reach. Events
+// belong to a single user, while artists and venues can also be shared
+func scope(ctx context.Context, table string) (string, []any) {
+	if db.AllUsers(ctx) {
+		return "TRUE", nil
+	}
+	if table == "events" {
+		return "user_id = ?", []any{db.User(ctx)}
+	}
+	return "user_id IN ('', ?)", []any{db.User(ctx)}
+}
+
+func (s *SQLite) trash(ctx context.Context, table string, entity string, id string) error {
+	condition, args := scope(ctx, table)
+	result, err := s.querier(ctx).ExecContext(ctx,
+		"UPDATE "+table+" SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL AND "+condition,
+		append([]any{time.Now().UTC().Format(time.RFC3339Nano), id}, args...)...)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, entity, id)
+}
+
+func (s *SQLite) restore(ctx context.Context, table string, entity string, id string) error {
+	condition, args := scope(ctx, table)
+	result, err := s.querier(ctx).ExecContext(ctx,
+		"UPDATE "+table+" SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL AND "+condition,
+		append([]any{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, "deleted "+entity, id)
+}
+
+func (s *SQLite) purge(ctx context.Context, table string, entity string, id string) error {
+	condition, args := scope(ctx, table)
+	result, err := s.querier(ctx).ExecContext(ctx,
+		"DELETE FROM "+table+" WHERE id = ? AND deleted_at IS NOT NULL AND "+condition,
+		append([]any{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, "deleted "+entity, id)
+}
@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"concert-manager/db/repotest"
+	"testing"
+)
+
+func TestRepositoryConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		conn, err := Open(":memory:")
+		if err != nil {
+			t.Fatal("failed to open database:", err)
+		}
+		t.Cleanup(func() { conn.DB.Close() })
+
+		venueRepo := &VenueRepo{Connection: conn}
+		artistRepo := &ArtistRepo{Connection: conn}
+		return repotest.Repos{
+			VenueRepo:  venueRepo,
+			ArtistRepo: artistRepo,
+			EventRepo:  &EventRepo{Connection: conn, VenueRepo: venueRepo, ArtistRepo: artistRepo},
+			Transactor: conn,
+			AuditRepo:  &AuditRepo{Connection: conn},
+		}
+	})
+}
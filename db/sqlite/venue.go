@@ -0,0 +1,221 @@
+package sqlite
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type VenueRepo struct {
+	Connection *SQLite
+}
+
+type Venue = data.Venue
+
+func (repo *VenueRepo) Add(ctx context.Context, venue Venue) (string, error) {
+	log.Debug("Attempting to add venue", venue)
+	owner := db.User(ctx)
+	existingId, err := repo.findId(ctx, owner, venue.Name, venue.City, venue.State)
+	if err == nil {
+		log.Debugf("Skipping adding venue because it already exists %+v, %v", venue, existingId)
+		return existingId, nil
+	}
+	if err != sql.ErrNoRows {
+		log.Errorf("Error occurred while checking if venue %v already exists, %v", venue, err)
+		return "", err
+	}
+
+	id, err := newId()
+	if err != nil {
+		log.Errorf("Failed to generate ID for new venue %+v, %v", venue, err)
+		return "", err
+	}
+	if venue.UserId == db.SharedOwner {
+		owner = db.SharedOwner
+	}
+	_, err = repo.Connection.querier(ctx).ExecContext(ctx,
+		"INSERT INTO venues (id, name, city, state, user_id) VALUES (?, ?, ?, ?, ?)",
+		id, venue.Name, venue.City, venue.State, owner)
+	if err != nil {
+		log.Errorf("Failed to add new venue %+v, %v", venue, err)
+		return "", err
+	}
+	log.Infof("Created new venue %+v", id)
+	return id, nil
+}
+
+func (repo *VenueRepo) Update(ctx context.Context, id string, venue Venue) error {
+	log.Debug("Attempting to update venue", id, venue)
+	condition, args := scope(ctx, "venues")
+	result, err := repo.Connection.querier(ctx).ExecContext(ctx,
+		"UPDATE venues SET name = ?, city = ?, state = ?, version = version + 1"+
+			" WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?) AND "+condition,
+		append([]any{venue.Name, venue.City, venue.State, id, venue.Version, venue.Version}, args...)...)
+	if err == nil {
+		err = repo.Connection.expectUpdated(ctx, result, "venues", "venue", id, venue.Version)
+	}
+	if err != nil {
+		log.Errorf("Failed to update venue %+v to %v, %v", id, venue, err)
+		return err
+	}
+	log.Info("Successfully updated venue", id)
+	return nil
+}
+
+func (repo *VenueRepo) Delete(ctx context.Context, id string) error {
+	log.Debug("Attempting to delete venue", id)
+	err := repo.Connection.trash(ctx, "venues", "venue", id)
+	if err != nil {
+		log.Error("Failed to delete venue", id, err)
+		return err
+	}
+	log.Infof("Successfully deleted venue %+v", id)
+	return nil
+}
+
+func (repo *VenueRepo) Exists(ctx context.Context, venue Venue) (bool, error) {
+	log.Debug("Checking for existence of venue", venue)
+	id, err := repo.findId(ctx, db.User(ctx), venue.Name, venue.City, venue.State)
+	if err == sql.ErrNoRows {
+		log.Debug("No existing venue found for", venue)
+		return false, nil
+	}
+	if err != nil {
+		log.Errorf("Error while checking existence of venue %v, %v", venue, err)
+		return false, err
+	}
+	log.Debugf("Found venue %v with ID %v", venue, id)
+	return true, nil
+}
+
+// also finds venues in the trash
+func (repo *VenueRepo) FindById(ctx context.Context, id string) (Venue, error) {
+	log.Debug("Finding venue", id)
+	condition, args := scope(ctx, "venues")
+	venues, err := repo.findAllRows(ctx, selectVenues+" WHERE id = ? AND "+condition, append([]any{id}, args...)...)
+	if err != nil {
+		log.Errorf("Error while finding venue %v, %v", id, err)
+		return Venue{}, err
+	}
+	if len(venues) == 0 {
+		return Venue{}, fmt.Errorf("venue %s not found", id)
+	}
+	return venues[0], nil
+}
+
+func (repo *VenueRepo) FindAll(ctx context.Context) ([]Venue, error) {
+	log.Debug("Finding all venues")
+	condition, args := scope(ctx, "venues")
+	venues, err := repo.findAllRows(ctx, selectVenues+" WHERE deleted_at IS NULL AND "+condition, args...)
+	if err != nil {
+		log.Error("Error while finding all venues,", err)
+		return nil, err
+	}
+	log.Debugf("Found %d venues", len(venues))
+	return venues, nil
+}
+
+func (repo *VenueRepo) FindDeleted(ctx context.Context) ([]Venue, error) {
+	log.Debug("Finding all deleted venues")
+	condition, args := scope(ctx, "venues")
+	venues, err := repo.findAllRows(ctx, selectVenues+" WHERE deleted_at IS NOT NULL AND "+condition, args...)
+	if err != nil {
+		log.Error("Error while finding all deleted venues,", err)
+		return nil, err
+	}
+	log.Debugf("Found %d deleted venues", len(venues))
+	return venues, nil
+}
+
+func (repo *VenueRepo) Restore(ctx context.Context, id string) error {
+	log.Debug("Attempting to restore venue", id)
+	err := repo.Connection.RunTransaction(ctx, func(ctx context.Context) error {
+		condition, args := scope(ctx, "venues")
+		var name, city, state, owner string
+		err := repo.Connection.querier(ctx).QueryRowContext(ctx,
+			"SELECT name, city, state, user_id FROM venues WHERE id = ? AND deleted_at IS NOT NULL AND "+condition,
+			append([]any{id}, args...)...).
+			Scan(&name, &city, &state, &owner)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("deleted venue %s not found", id)
+		}
+		if err != nil {
+			return err
+		}
+		existingId, err := repo.findId(ctx, owner, name, city, state)
+		if err == nil {
+			return fmt.Errorf("venue %s already exists with the same name and location", existingId)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		return repo.Connection.restore(ctx, "venues", "venue", id)
+	})
+	if err != nil {
+		log.Errorf("Failed to restore venue %v, %v", id, err)
+		return err
+	}
+	log.Infof("Successfully restored venue %+v", id)
+	return nil
+}
+
+func (repo *VenueRepo) Purge(ctx context.Context, id string) error {
+	log.Debug("Attempting to purge venue", id)
+	err := repo.Connection.purge(ctx, "venues", "venue", id)
+	if err != nil {
+		log.Error("Failed to purge venue", id, err)
+		return err
+	}
+	log.Infof("Successfully purged venue %+v", id)
+	return nil
+}
+
+// only finds venues outside of the trash that are shared or belong to the owner
+func (repo *VenueRepo) findId(ctx context.Context, owner string, name string, city string, state string) (string, error) {
+	var id string
+	err := repo.Connection.querier(ctx).QueryRowContext(ctx,
+		"SELECT id FROM venues WHERE name = ? AND city = ? AND state = ? AND deleted_at IS NULL AND user_id IN ('', ?) LIMIT 1",
+		name, city, state, owner).
+		Scan(&id)
+	return id, err
+}
+
+const selectVenues = "SELECT id, name, city, state, version, deleted_at, user_id FROM venues"
+
+func (repo *VenueRepo) findAllRows(ctx context.Context, query string, args ...any) ([]Venue, error) {
+	rows, err := repo.Connection.querier(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	venues := []Venue{}
+	for rows.Next() {
+		var venue Venue
+		var deletedAt sql.NullString
+		if err := rows.Scan(&venue.Id, &venue.Name, &venue.City, &venue.State, &venue.Version, &deletedAt, &venue.UserId); err != nil {
+			return nil, err
+		}
+		if venue.DeletedAt, err = toDeletedAt(deletedAt); err != nil {
+			return nil, err
+		}
+		venues = append(venues, venue)
+	}
+	return venues, rows.Err()
+}
+
+// finds the venues with the IDs the query selects, including the trashed venues and those of every user
+func (repo *VenueRepo) findAllById(ctx context.Context, selected string, args ...any) (map[string]Venue, error) {
+	venues, err := repo.findAllRows(ctx, selectVenues+" WHERE id IN ("+selected+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	venuesById := make(map[string]Venue)
+	for _, v := range venues {
+		venuesById[v.Id] = v
+	}
+	return venuesById, nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"regexp"
+)
+
+// Owns every event that was saved before there were users
+const DefaultUser = "default"
+
+// The owner of artists and venues that every user can see
+const SharedOwner = ""
+
+var userIdPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+type (
+	userKey     struct{}
+	allUsersKey struct{}
+)
+
+// Scopes the repositories to the records of the user. Events always belong to a single user,
+// while artists and venues are either shared with everyone or private to the user that added them
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+func User(ctx context.Context) string {
+	if user, ok := ctx.Value(userKey{}).(string); ok && user != "" {
+		return user
+	}
+	return DefaultUser
+}
+
+// Lets reads and deletes reach the records of every user, for backups and maintenance.
+// Records are still added for the user of the context
+func WithAllUsers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allUsersKey{}, true)
+}
+
+func AllUsers(ctx context.Context) bool {
+	all, _ := ctx.Value(allUsersKey{}).(bool)
+	return all
+}
+
+// Whether the context can reach an event owned by the user
+func CanAccessEvent(ctx context.Context, owner string) bool {
+	return AllUsers(ctx) || owner == User(ctx)
+}
+
+// Whether the context can reach an artist or venue owned by the user
+func CanAccessCatalog(ctx context.Context, owner string) bool {
+	return owner == SharedOwner || CanAccessEvent(ctx, owner)
+}
+
+func ValidUserId(user string) bool {
+	return userIdPattern.MatchString(user)
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"concert-manager/data"
 	"concert-manager/log"
+	"concert-manager/util"
 	"context"
 	"errors"
 	"fmt"
@@ -14,7 +15,7 @@ import (
 const minColumns = 7
 
 type eventCache interface {
-	AddSavedEvent(data.Event) (*data.Event, error)
+	AddSavedEvents(context.Context, []data.Event) ([]data.Event, error)
 }
 
 type Loader struct {
@@ -43,25 +44,15 @@ func (l *Loader) Upload(ctx context.Context, file io.ReadCloser) (int, error) {
 		events = append(events, event)
 	}
 
-	hasErr := false
-	successCount := 0
-	for i, event := range events {
-		log.Debugf("Starting upload for event %v", event)
-		if _, err := l.Cache.AddSavedEvent(event); err != nil {
-			log.Errorf("Failed to add event at row %d, %+v, %v", i+2, event, err)
-			hasErr = true
-		} else {
-			successCount++
-			log.Debugf("Event successfully uploaded %v", event)
-		}
+	// rows are saved all together so a bad row can't leave a partially uploaded file behind
+	savedEvents, err := l.Cache.AddSavedEvents(ctx, events)
+	if err != nil {
+		log.Errorf("Failed to upload events, all %d rows were rolled back, %v", len(events), err)
+		return 0, fmt.Errorf("no rows were uploaded, %v", err)
 	}
 
-	log.Infof("Successfully uploaded %d event rows", successCount)
-	log.Errorf("Failed to upload %d event rows", len(events) - successCount)
-	if hasErr {
-		return successCount, errors.New("failed to add at least one row. check logs for more details")
-	}
-	return successCount, nil
+	log.Infof("Successfully uploaded %d event rows", len(savedEvents))
+	return len(savedEvents), nil
 }
 
 func toEvent(row string) (data.Event, error) {
@@ -78,6 +69,9 @@ func toEvent(row string) (data.Event, error) {
 		return data.Event{}, errors.New("invalid main act")
 	}
 	date := strings.TrimSpace(parts[2])
+	if !util.ValidDate(date) {
+		return data.Event{}, errors.New("invalid date")
+	}
 	venue := data.Venue{
 		Name: strings.TrimSpace(parts[3]),
 		City: strings.TrimSpace(parts[4]),
@@ -127,11 +127,15 @@ func Debugf(format string, v ...any) {
 }
 
 func Error(v ...any) {
-	errorLog.Println(v...)
+	if nil != errorLog {
+		errorLog.Println(v...)
+	}
 }
 
 func Errorf(format string, v ...any) {
-	errorLog.Printf(format, v...)
+	if nil != errorLog {
+		errorLog.Printf(format, v...)
+	}
 }
 
 func Display(v ...any) {
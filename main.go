@@ -1,18 +1,30 @@
 package main
 
 import (
+	"concert-manager/backup"
 	"concert-manager/cache"
 	"concert-manager/db"
 	"concert-manager/db/firestore"
+	"concert-manager/db/memory"
+	"concert-manager/db/sqlite"
 	"concert-manager/finder"
 	"concert-manager/loader"
 	"concert-manager/log"
+	"concert-manager/offline"
 	"concert-manager/ranker"
+	"concert-manager/replication"
+	"concert-manager/scheduler"
 	"concert-manager/server"
 	"concert-manager/spotify"
 	"concert-manager/ui"
+	"context"
+	"fmt"
+	"maps"
 	"os"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -20,27 +32,42 @@ func main() {
 		log.Fatal("Failed to set up logger:", err)
 	}
 
-	dbConnection, err := firestore.Setup()
+	if slices.Contains(os.Args, "--migrate") {
+		runMigrations()
+		return
+	}
+
+	interactor, err := setupDatabase()
 	if err != nil {
 		log.Fatal("Failed to set up database:", err)
 	}
+	interactor.PrivateCatalog = privateCatalog()
+	dbBackup := &backup.Backup{Database: interactor}
 
-	venueRepo := &firestore.VenueRepo{Connection: dbConnection}
-	artistRepo := &firestore.ArtistRepo{Connection: dbConnection}
-	eventRepo := &firestore.EventRepo{
-		Connection: dbConnection,
-		VenueRepo:  venueRepo,
-		ArtistRepo: artistRepo,
+	if path, ok := argValue("--backup"); ok {
+		runBackup(dbBackup, path)
+		return
+	}
+	if path, ok := argValue("--restore"); ok {
+		runRestore(dbBackup, path)
+		return
 	}
-	interactor := &db.DatabaseRepository{
-		VenueRepo:  venueRepo,
-		ArtistRepo: artistRepo,
-		EventRepo:  eventRepo,
+	if backend, ok := argValue("--replicate"); ok {
+		runReplication(interactor, backend)
+		return
 	}
 
-	savedCache := &cache.SavedEventCache{}
-	savedCache.Database = interactor
-	savedCache.LoadCaches()
+	var cacheDatabase cache.Database = interactor
+	offlineDatabase := setupOffline(interactor)
+	if offlineDatabase != nil {
+		cacheDatabase = offlineDatabase
+	}
+	userCaches := &cache.UserCaches{Database: cacheDatabase}
+	savedCache, err := userCaches.For(tuiUser())
+	if err != nil {
+		log.Fatal("Failed to initialize saved event cache:", err)
+	}
+	startTrashPurger(savedCache)
 
 	eventFinder := finder.NewEventFinder()
 	artistRanker := ranker.ArtistRanker{MusicSvc: spotify.NewClient()}
@@ -49,16 +76,31 @@ func main() {
 	upcomingCache := cache.NewUpcomingEventCache()
 	upcomingCache.Finder = eventFinder
 	upcomingCache.Ranker = eventRanker
+	// without the persisted events the first page waits on a full crawl, which is slow but works
+	if err := upcomingCache.Persist(); err != nil {
+		log.Error("Failed to load persisted upcoming events,", err)
+	}
 
-	loader := &loader.Loader{Cache: savedCache}
+	loader := &loader.Loader{Cache: userCaches}
 
 	server := server.Server{}
 	server.Loader = loader
-	server.SavedEventCache = savedCache
-	server.ArtistCache = savedCache
-	server.VenueCache = savedCache
+	server.Backup = dbBackup
+	server.Caches = userCaches
+	if offlineDatabase != nil {
+		offlineDatabase.OnSync = func() {
+			if err := userCaches.RefreshAll(); err != nil {
+				log.Error("Failed to refresh caches after syncing offline writes,", err)
+			}
+		}
+		offlineDatabase.StartSync(offlineSyncInterval)
+		server.Offline = offlineDatabase
+	}
+	server.AuditLog = interactor
 	server.UpcomingEventsCache = upcomingCache
 	server.RecommendationCache = upcomingCache
+	server.Scheduler = startScheduler(userCaches, upcomingCache, &eventRanker.ArtistRanker)
+	server.ProxyToken = os.Getenv(proxyTokenEnv)
 
 	if slices.Contains(os.Args, "--tui") {
 		go server.StartServer()
@@ -67,3 +109,374 @@ func main() {
 		server.StartServer()
 	}
 }
+
+// returns the argument following the flag, like the file in --backup file.json
+func argValue(flag string) (string, bool) {
+	i := slices.Index(os.Args, flag)
+	if i == -1 || i+1 >= len(os.Args) {
+		return "", false
+	}
+	return os.Args[i+1], true
+}
+
+func runBackup(dbBackup *backup.Backup, path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatal("Failed to create backup file:", err)
+	}
+	defer file.Close()
+	if err := dbBackup.Write(db.WithActor(context.Background(), db.ActorCLI), file); err != nil {
+		log.Fatal("Failed to back up database:", err)
+	}
+	fmt.Println("Backed up database to", path)
+}
+
+func runRestore(dbBackup *backup.Backup, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal("Failed to open backup file:", err)
+	}
+	defer file.Close()
+	archive, err := backup.Read(file)
+	if err != nil {
+		log.Fatal("Failed to read backup file:", err)
+	}
+	summary, err := dbBackup.Restore(db.WithActor(context.Background(), db.ActorCLI), archive)
+	if err != nil {
+		log.Fatal("Failed to restore database:", err)
+	}
+	fmt.Printf("Restored %d venues, %d artists and %d events from %s\n", summary.Venues, summary.Artists, summary.Events, path)
+}
+
+const (
+	replicationStateEnv   = "CM_REPLICATION_STATE"
+	defaultReplicationDir = "/.concert_manager/"
+)
+
+// Replicates the database of CM_DB_BACKEND with the backend following --replicate, like a local SQLite
+// replica of Firestore. Conflicts are only reported unless --prefer primary or --prefer replica settles
+// them, and --dry-run prints the changes without writing them
+func runReplication(primary *db.DatabaseRepository, backend string) {
+	primaryBackend := os.Getenv(dbBackendEnv)
+	if primaryBackend == "" {
+		primaryBackend = "firestore"
+	}
+	if backend == primaryBackend {
+		log.Fatalf("Can't replicate the %s database with itself", backend)
+	}
+	replica, err := setupBackend(backend)
+	if err != nil {
+		log.Fatal("Failed to set up replica database:", err)
+	}
+	replica.PrivateCatalog = primary.PrivateCatalog
+
+	statePath := os.Getenv(replicationStateEnv)
+	if statePath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatal("Failed to find replication state directory:", err)
+		}
+		statePath = fmt.Sprintf("%s%sreplication_%s_%s.json", homeDir, defaultReplicationDir, primaryBackend, backend)
+	}
+	replicator := &replication.Replicator{Left: primary, Right: replica, StatePath: statePath}
+	if prefer, ok := argValue("--prefer"); ok {
+		switch prefer {
+		case "primary":
+			replicator.Policy = replication.PreferLeft
+		case "replica":
+			replicator.Policy = replication.PreferRight
+		default:
+			log.Fatalf("Invalid --prefer value: %s, expected primary or replica", prefer)
+		}
+	}
+
+	ctx := db.WithActor(context.Background(), db.ActorCLI)
+	var report replication.Report
+	if slices.Contains(os.Args, "--dry-run") {
+		report, err = replicator.Diff(ctx)
+	} else {
+		report, err = replicator.Sync(ctx)
+	}
+	if err != nil {
+		log.Fatal("Failed to replicate database:", err)
+	}
+	for _, change := range report.Changes {
+		fmt.Printf("%s %s on the %s (primary %s, replica %s)\n",
+			change.Op, change.Entity, sideName(change.Target), change.LeftId, change.RightId)
+	}
+	for _, conflict := range report.Conflicts {
+		fmt.Printf("conflict on %s (primary %s, replica %s): %s\n",
+			conflict.Entity, conflict.LeftId, conflict.RightId, conflict.Reason)
+	}
+	for _, failure := range report.Failed {
+		fmt.Println("failed to", failure)
+	}
+	fmt.Printf("Replicated %s with %s: %d changes, %d conflicts, %d failures\n",
+		primaryBackend, backend, len(report.Changes), len(report.Conflicts), len(report.Failed))
+}
+
+func sideName(side string) string {
+	if side == replication.SideLeft {
+		return "primary"
+	}
+	return "replica"
+}
+
+// SQLite creates its schema when it opens the database and memory has none to migrate
+func runMigrations() {
+	if backend := os.Getenv(dbBackendEnv); backend != "" && backend != "firestore" {
+		log.Fatalf("Migrations only apply to the firestore backend, %s is %s", dbBackendEnv, backend)
+	}
+	dbConnection, err := firestore.Setup()
+	if err != nil {
+		log.Fatal("Failed to set up database:", err)
+	}
+	from, to, err := dbConnection.Migrate(context.Background())
+	if err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+	fmt.Printf("Migrated database schema from version %d to %d\n", from, to)
+}
+
+const (
+	trashRetentionEnv         = "CM_TRASH_RETENTION_DAYS"
+	defaultTrashRetentionDays = 30
+)
+
+// Deleted records stay in the trash for 30 days unless CM_TRASH_RETENTION_DAYS says otherwise,
+// CM_TRASH_RETENTION_DAYS=0 keeps them until they are purged by hand
+func startTrashPurger(savedCache *cache.SavedEventCache) {
+	days := defaultTrashRetentionDays
+	if value := os.Getenv(trashRetentionEnv); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Fatalf("Invalid %s value: %s", trashRetentionEnv, value)
+		}
+		days = parsed
+	}
+	if days == 0 {
+		log.Info("Trash retention is disabled, records stay in the trash until they are purged")
+		return
+	}
+	savedCache.StartTrashPurger(time.Duration(days) * 24 * time.Hour)
+}
+
+const (
+	scheduleEnv         = "CM_SCHEDULE"
+	watchedLocationsEnv = "CM_WATCHED_LOCATIONS"
+	upcomingJob         = "upcoming"
+	ranksJob            = "ranks"
+	savedJob            = "saved"
+	archiveJob          = "archive"
+	// events that passed this long ago without being marked as attended are archived
+	passedEventArchiveAge = 30 * 24 * time.Hour
+)
+
+var defaultJobIntervals = map[string]time.Duration{
+	upcomingJob: 6 * time.Hour,
+	ranksJob:    24 * time.Hour,
+	savedJob:    6 * time.Hour,
+	// archiving changes saved events, so it only runs when it's asked for
+	archiveJob: 0,
+}
+
+// Refreshes upcoming events for the watched locations, Spotify artist ranks and the saved event caches in
+// the background, and archives passed events. CM_SCHEDULE overrides the interval of any job, like
+// CM_SCHEDULE=upcoming=12h,archive=24h, where 0 disables it. CM_WATCHED_LOCATIONS lists the locations
+// to keep refreshed, like CM_WATCHED_LOCATIONS="Atlanta,GA;Nashville,TN", and defaults to Atlanta
+func startScheduler(userCaches *cache.UserCaches, upcomingCache *cache.UpcomingEventCache, artistRanker *ranker.ArtistRanker) *scheduler.Scheduler {
+	intervals := maps.Clone(defaultJobIntervals)
+	overrides, err := scheduler.ParseIntervals(os.Getenv(scheduleEnv), []string{upcomingJob, ranksJob, savedJob, archiveJob})
+	if err != nil {
+		log.Fatalf("Invalid %s value, %v", scheduleEnv, err)
+	}
+	maps.Copy(intervals, overrides)
+	locations := watchedLocations()
+
+	jobs := &scheduler.Scheduler{}
+	jobs.Add(scheduler.Job{Name: upcomingJob, Interval: intervals[upcomingJob], Run: func(context.Context) (string, error) {
+		refreshed := 0
+		for _, loc := range locations {
+			ok, err := upcomingCache.RefreshStale(loc, intervals[upcomingJob])
+			if err != nil {
+				return "", fmt.Errorf("failed to refresh upcoming events for %s, %w", loc, err)
+			}
+			if ok {
+				refreshed++
+			}
+		}
+		return fmt.Sprintf("refreshed %d of %d locations", refreshed, len(locations)), nil
+	}})
+	jobs.Add(scheduler.Job{Name: ranksJob, Interval: intervals[ranksJob], Run: func(context.Context) (string, error) {
+		if err := artistRanker.Refresh(); err != nil {
+			return "", err
+		}
+		return "refreshed artist ranks", nil
+	}})
+	jobs.Add(scheduler.Job{Name: savedJob, Interval: intervals[savedJob], Run: func(context.Context) (string, error) {
+		if err := userCaches.RefreshAll(); err != nil {
+			return "", err
+		}
+		return "reloaded saved events", nil
+	}})
+	jobs.Add(scheduler.Job{Name: archiveJob, Interval: intervals[archiveJob], Run: func(ctx context.Context) (string, error) {
+		archived, err := userCaches.ArchivePassedEvents(db.WithActor(ctx, db.ActorSystem), time.Now().Add(-passedEventArchiveAge))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("archived %d passed events", archived), nil
+	}})
+	jobs.Start(context.Background())
+	return jobs
+}
+
+func watchedLocations() []cache.Location {
+	value := os.Getenv(watchedLocationsEnv)
+	if value == "" {
+		return []cache.Location{cache.DefaultLocation()}
+	}
+	locations := []cache.Location{}
+	for _, entry := range strings.Split(value, ";") {
+		city, state, ok := strings.Cut(entry, ",")
+		city, state = strings.TrimSpace(city), strings.TrimSpace(state)
+		if !ok || city == "" || len(state) != 2 {
+			log.Fatalf("Invalid %s value: %s, expected locations like Atlanta,GA;Nashville,TN", watchedLocationsEnv, value)
+		}
+		locations = append(locations, cache.Location{City: city, StateCode: strings.ToUpper(state)})
+	}
+	return locations
+}
+
+const (
+	userEnv           = "CM_USER"
+	privateCatalogEnv = "CM_PRIVATE_CATALOG"
+	// The server only serves other users than the default one behind an authenticating proxy, which sends
+	// the user in the X-User header and this token in the X-Proxy-Token header
+	proxyTokenEnv = "CM_PROXY_TOKEN"
+)
+
+// The terminal UI works with the events of CM_USER, or of the default user when it isn't set
+func tuiUser() string {
+	user := os.Getenv(userEnv)
+	if user == "" {
+		return db.DefaultUser
+	}
+	if !db.ValidUserId(user) {
+		log.Fatalf("Invalid %s value: %s", userEnv, user)
+	}
+	return user
+}
+
+// Artists and venues are shared by every user unless CM_PRIVATE_CATALOG=true
+func privateCatalog() bool {
+	value := os.Getenv(privateCatalogEnv)
+	if value == "" {
+		return false
+	}
+	private, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid %s value: %s", privateCatalogEnv, value)
+	}
+	return private
+}
+
+const (
+	offlineModeEnv      = "CM_OFFLINE_MODE"
+	offlineSyncInterval = time.Minute
+	schemaCheckTimeout  = 15 * time.Second
+)
+
+// Firestore is the only backend that can be out of reach, so offline mode wraps it unless CM_OFFLINE_MODE=false
+func setupOffline(interactor *db.DatabaseRepository) *offline.Database {
+	if backend := os.Getenv(dbBackendEnv); backend != "" && backend != "firestore" {
+		return nil
+	}
+	if value := os.Getenv(offlineModeEnv); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("Invalid %s value: %s", offlineModeEnv, value)
+		}
+		if !enabled {
+			return nil
+		}
+	}
+	offlineDatabase, err := offline.Setup(interactor)
+	if err != nil {
+		log.Fatal("Failed to set up offline mode:", err)
+	}
+	return offlineDatabase
+}
+
+const dbBackendEnv = "CM_DB_BACKEND"
+
+// Firestore is the default backend, set CM_DB_BACKEND=sqlite to use a local database file instead,
+// or CM_DB_BACKEND=memory for a throwaway database that only lives as long as the process
+func setupDatabase() (*db.DatabaseRepository, error) {
+	return setupBackend(os.Getenv(dbBackendEnv))
+}
+
+func setupBackend(backend string) (*db.DatabaseRepository, error) {
+	switch backend {
+	case "", "firestore":
+		dbConnection, err := firestore.Setup()
+		if err != nil {
+			return nil, err
+		}
+		// offline mode lets the app start without reaching the database, so an unknown version can only warn.
+		// Records written before a migration don't match the queries of the latest schema, so serving them
+		// from an older one would hide them
+		ctx, cancel := context.WithTimeout(context.Background(), schemaCheckTimeout)
+		defer cancel()
+		version, err := dbConnection.CheckSchemaVersion(ctx)
+		if err != nil {
+			log.Error("Failed to check the database schema version,", err)
+		} else if version < firestore.LatestSchemaVersion() {
+			return nil, fmt.Errorf("database schema is at version %d but the latest is %d, run with --migrate to upgrade it",
+				version, firestore.LatestSchemaVersion())
+		}
+		venueRepo := &firestore.VenueRepo{Connection: dbConnection}
+		artistRepo := &firestore.ArtistRepo{Connection: dbConnection}
+		eventRepo := &firestore.EventRepo{
+			Connection: dbConnection,
+			VenueRepo:  venueRepo,
+			ArtistRepo: artistRepo,
+		}
+		return &db.DatabaseRepository{
+			VenueRepo:  venueRepo,
+			ArtistRepo: artistRepo,
+			EventRepo:  eventRepo,
+			Transactor: dbConnection,
+			AuditRepo:  &firestore.AuditRepo{Connection: dbConnection},
+		}, nil
+	case "sqlite":
+		dbConnection, err := sqlite.Setup()
+		if err != nil {
+			return nil, err
+		}
+		venueRepo := &sqlite.VenueRepo{Connection: dbConnection}
+		artistRepo := &sqlite.ArtistRepo{Connection: dbConnection}
+		eventRepo := &sqlite.EventRepo{
+			Connection: dbConnection,
+			VenueRepo:  venueRepo,
+			ArtistRepo: artistRepo,
+		}
+		return &db.DatabaseRepository{
+			VenueRepo:  venueRepo,
+			ArtistRepo: artistRepo,
+			EventRepo:  eventRepo,
+			Transactor: dbConnection,
+			AuditRepo:  &sqlite.AuditRepo{Connection: dbConnection},
+		}, nil
+	case "memory":
+		dbConnection := memory.Setup()
+		return &db.DatabaseRepository{
+			VenueRepo:  &memory.VenueRepo{Connection: dbConnection},
+			ArtistRepo: &memory.ArtistRepo{Connection: dbConnection},
+			EventRepo:  &memory.EventRepo{Connection: dbConnection},
+			Transactor: dbConnection,
+			AuditRepo:  &memory.AuditRepo{Connection: dbConnection},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database backend: %s", backend)
+	}
+}
@@ -0,0 +1,215 @@
+package offline
+
+import (
+	"bufio"
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/util"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	opAdd     = "add"
+	opUpdate  = "update"
+	opDelete  = "delete"
+	opRestore = "restore"
+	opPurge   = "purge"
+	opRepair  = "repair"
+
+	localIdPrefix = "local-"
+)
+
+// A write made while the database couldn't be reached. RecordId is the ID handed out for added
+// records, which stays local until the entry is replayed, and the ID of the changed record otherwise.
+// Entries made in a single transaction share a batch and replay in a single transaction too.
+// AllUsers entries were made for the records of every user, like a merge moving their events
+type Entry struct {
+	Op        string       `json:"op"`
+	Entity    string       `json:"entity"`
+	RecordId  string       `json:"recordId"`
+	User      string       `json:"user"`
+	AllUsers  bool         `json:"allUsers,omitempty"`
+	Actor     string       `json:"actor"`
+	Batch     string       `json:"batch,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+	Event     *data.Event  `json:"event,omitempty"`
+	Artist    *data.Artist `json:"artist,omitempty"`
+	Venue     *data.Venue  `json:"venue,omitempty"`
+}
+
+// An entry that couldn't be replayed, because the database changed in a way the write didn't expect
+type Conflict struct {
+	Entry      Entry     `json:"entry"`
+	Reason     string    `json:"reason"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+func newEntry(ctx context.Context, op string, entity string, recordId string) Entry {
+	return Entry{
+		Op:        op,
+		Entity:    entity,
+		RecordId:  recordId,
+		User:      db.User(ctx),
+		AllUsers:  db.AllUsers(ctx),
+		Actor:     db.Actor(ctx),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// Records are added for the user of the context even for every user, while other writes can reach
+// the records every user loaded
+func (e Entry) appliesTo(user string) bool {
+	return e.User == user || e.AllUsers && e.Op != opAdd
+}
+
+func newLocalId() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		// crypto/rand never fails on the supported platforms
+		panic(err)
+	}
+	return localIdPrefix + hex.EncodeToString(id)
+}
+
+func isLocalId(id string) bool {
+	return strings.HasPrefix(id, localIdPrefix)
+}
+
+// The number of entries at the start that belong to the same batch
+func batchLength(entries []Entry) int {
+	if entries[0].Batch == "" {
+		return 1
+	}
+	n := 1
+	for n < len(entries) && entries[n].Batch == entries[0].Batch {
+		n++
+	}
+	return n
+}
+
+// Points the entries at the IDs their local records got once they were replayed
+func replaceIds(entries []Entry, ids map[string]string) {
+	replace := func(id *string) {
+		if replacement, ok := ids[*id]; ok {
+			*id = replacement
+		}
+	}
+	for i := range entries {
+		replace(&entries[i].RecordId)
+		if event := entries[i].Event; event != nil {
+			replace(&event.Id)
+			replace(&event.MainAct.Id)
+			replace(&event.Venue.Id)
+			for j := range event.Openers {
+				replace(&event.Openers[j].Id)
+			}
+		}
+		if artist := entries[i].Artist; artist != nil {
+			replace(&artist.Id)
+		}
+		if venue := entries[i].Venue; venue != nil {
+			replace(&venue.Id)
+		}
+	}
+}
+
+func cloneEntry(entry Entry) Entry {
+	if entry.Event != nil {
+		event := util.CloneEvent(*entry.Event)
+		entry.Event = &event
+	}
+	if entry.Artist != nil {
+		artist := *entry.Artist
+		entry.Artist = &artist
+	}
+	if entry.Venue != nil {
+		venue := *entry.Venue
+		entry.Venue = &venue
+	}
+	return entry
+}
+
+// Reads a file of JSON lines, which is empty when the file doesn't exist yet
+func readLines[T any](path string) ([]T, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []T{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := []T{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var value T
+		if err := json.Unmarshal(scanner.Bytes(), &value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, scanner.Err()
+}
+
+// Appends the values and syncs the file, so they survive the process being killed right after
+func appendLines[T any](path string, values ...T) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := encodeLines(file, values); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Replaces the whole file, going through a temporary file so a crash leaves either the old or the new contents
+func writeLines[T any](path string, values []T) error {
+	return writeFile(path, func(file *os.File) error {
+		return encodeLines(file, values)
+	})
+}
+
+func encodeLines[T any](file *os.File, values []T) error {
+	encoder := json.NewEncoder(file)
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, write func(*os.File) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
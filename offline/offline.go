@@ -0,0 +1,621 @@
+// Package offline keeps the saved event cache working while the database can't be reached. Reads fall
+// back to a local snapshot of what each user last loaded, and writes go to a durable local journal
+// that is replayed against the database once it's reachable again
+package offline
+
+import (
+	"concert-manager/cache"
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"concert-manager/util"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	dirEnv         = "CM_OFFLINE_DIR"
+	defaultDir     = "/.concert_manager/offline"
+	snapshotFile   = "snapshot.json"
+	journalFile    = "journal.jsonl"
+	conflictsFile  = "conflicts.jsonl"
+	defaultTimeout = 15 * time.Second
+)
+
+// Returned by calls that need the database while it can't be reached
+var ErrOffline = errors.New("database is unreachable")
+
+// Wraps the database of the saved event caches. Every call that isn't overridden here
+// goes straight to the wrapped database, and fails while it can't be reached
+type Database struct {
+	cache.Database
+	// How long a single call waits for the database before treating it as unreachable. Transactions
+	// and syncs make many calls, so they aren't limited as a whole, only each call they make
+	Timeout time.Duration
+	// Called after the journal was replayed, since the records added offline got new IDs
+	OnSync func()
+
+	dir       string
+	mutex     sync.Mutex
+	syncMutex sync.Mutex
+	offline   bool
+	pending   []Entry
+	conflicts []Conflict
+	snapshots map[string]*Snapshot
+	lastSync  *time.Time
+}
+
+type Status struct {
+	Offline   bool       `json:"offline"`
+	Pending   int        `json:"pending"`
+	Conflicts []Conflict `json:"conflicts"`
+	LastSync  *time.Time `json:"lastSync,omitempty"`
+}
+
+func Setup(database cache.Database) (*Database, error) {
+	dir := os.Getenv(dirEnv)
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = homeDir + defaultDir
+	}
+	return Open(database, dir)
+}
+
+// Loads the snapshot and any writes still waiting to be replayed from the directory, creating it if needed
+func Open(database cache.Database, dir string) (*Database, error) {
+	log.Debug("Opening offline journal at", dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	snapshots, err := readSnapshots(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offline snapshot, %w", err)
+	}
+	pending, err := readLines[Entry](filepath.Join(dir, journalFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offline journal, %w", err)
+	}
+	conflicts, err := readLines[Conflict](filepath.Join(dir, conflictsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offline conflicts, %w", err)
+	}
+	if len(pending) > 0 {
+		log.Infof("Found %d offline writes waiting to be synced", len(pending))
+	}
+	return &Database{
+		Database:  database,
+		dir:       dir,
+		pending:   pending,
+		conflicts: conflicts,
+		snapshots: snapshots,
+	}, nil
+}
+
+func (d *Database) Status() Status {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return Status{
+		Offline:   d.offline,
+		Pending:   len(d.pending),
+		Conflicts: append([]Conflict{}, d.conflicts...),
+		LastSync:  d.lastSync,
+	}
+}
+
+func (d *Database) ClearConflicts() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := writeLines(filepath.Join(d.dir, conflictsFile), []Conflict{}); err != nil {
+		return err
+	}
+	d.conflicts = []Conflict{}
+	return nil
+}
+
+// Writes keep going to the journal until it's empty, so they always reach the database in order
+func (d *Database) journaling() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.offline || len(d.pending) > 0
+}
+
+func (d *Database) goOffline(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.offline {
+		log.Error("Database is unreachable, switching to offline mode,", err)
+	}
+	d.offline = true
+}
+
+// Firestore reports connection problems as gRPC errors, and the timeout of a call shows up as its deadline
+func unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrOffline) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+// Runs a single database call, which counts as unreachable once it takes longer than the timeout
+func (d *Database) call(ctx context.Context, f func(context.Context) error) error {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return d.watch(ctx, f)
+}
+
+// Runs f under the context of the caller, for work made of calls that each have their own timeout
+func (d *Database) watch(ctx context.Context, f func(context.Context) error) error {
+	err := f(ctx)
+	if unreachable(err) {
+		d.goOffline(err)
+	}
+	return err
+}
+
+// Whether the read can go to the database, which is false when it has to come from the snapshot
+func (d *Database) read(ctx context.Context, f func(context.Context) error) (bool, error) {
+	if d.journaling() {
+		return false, nil
+	}
+	err := d.call(ctx, f)
+	if unreachable(err) {
+		return false, nil
+	}
+	return true, err
+}
+
+// Saves what the user just loaded from the database
+func (d *Database) remember(ctx context.Context, update func(*Snapshot)) {
+	if db.AllUsers(ctx) {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	user := db.User(ctx)
+	snapshot, ok := d.snapshots[user]
+	if !ok {
+		snapshot = &Snapshot{}
+		d.snapshots[user] = snapshot
+	}
+	update(snapshot)
+	snapshot.LoadedAt = time.Now().UTC()
+	if err := writeSnapshots(filepath.Join(d.dir, snapshotFile), d.snapshots); err != nil {
+		log.Error("Failed to save offline snapshot,", err)
+	}
+}
+
+// The snapshot of the user with their writes that haven't been replayed yet
+func (d *Database) view(ctx context.Context) (*Snapshot, error) {
+	user := db.User(ctx)
+	if db.AllUsers(ctx) {
+		return nil, fmt.Errorf("%w, and there is no local snapshot of every user", ErrOffline)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	snapshot, ok := d.snapshots[user]
+	if !ok {
+		return nil, fmt.Errorf("%w, and there is no local snapshot for user %s", ErrOffline, user)
+	}
+	return d.viewOf(user, snapshot), nil
+}
+
+// Must be called while holding the mutex
+func (d *Database) viewOf(user string, snapshot *Snapshot) *Snapshot {
+	view := snapshot.clone()
+	for _, entry := range d.pending {
+		if entry.appliesTo(user) {
+			view.apply(entry)
+		}
+	}
+	return view
+}
+
+// The events of the user, or of every user that has a snapshot when the context is for all users
+func (d *Database) viewEvents(ctx context.Context) ([]data.Event, error) {
+	if !db.AllUsers(ctx) {
+		view, err := d.view(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return view.Events, nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	events := []data.Event{}
+	for user, snapshot := range d.snapshots {
+		events = append(events, d.viewOf(user, snapshot).Events...)
+	}
+	return events, nil
+}
+
+func (d *Database) ListEvents(ctx context.Context) ([]data.Event, error) {
+	var events []data.Event
+	online, err := d.read(ctx, func(ctx context.Context) (err error) {
+		events, err = d.Database.ListEvents(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		d.remember(ctx, func(s *Snapshot) { s.Events = util.CloneEvents(events) })
+		return events, nil
+	}
+	view, err := d.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return view.Events, nil
+}
+
+func (d *Database) ListArtists(ctx context.Context) ([]data.Artist, error) {
+	var artists []data.Artist
+	online, err := d.read(ctx, func(ctx context.Context) (err error) {
+		artists, err = d.Database.ListArtists(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		d.remember(ctx, func(s *Snapshot) { s.Artists = util.CloneArtists(artists) })
+		return artists, nil
+	}
+	view, err := d.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return view.Artists, nil
+}
+
+func (d *Database) ListVenues(ctx context.Context) ([]data.Venue, error) {
+	var venues []data.Venue
+	online, err := d.read(ctx, func(ctx context.Context) (err error) {
+		venues, err = d.Database.ListVenues(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		d.remember(ctx, func(s *Snapshot) { s.Venues = util.CloneVenues(venues) })
+		return venues, nil
+	}
+	view, err := d.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return view.Venues, nil
+}
+
+func (d *Database) ListDeletedEvents(ctx context.Context) ([]data.Event, error) {
+	var events []data.Event
+	online, err := d.read(ctx, func(ctx context.Context) (err error) {
+		events, err = d.Database.ListDeletedEvents(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		d.remember(ctx, func(s *Snapshot) { s.Trash.Events = util.CloneEvents(events) })
+		return events, nil
+	}
+	view, err := d.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return view.Trash.Events, nil
+}
+
+func (d *Database) ListDeletedArtists(ctx context.Context) ([]data.Artist, error) {
+	var artists []data.Artist
+	online, err := d.read(ctx, func(ctx context.Context) (err error) {
+		artists, err = d.Database.ListDeletedArtists(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		d.remember(ctx, func(s *Snapshot) { s.Trash.Artists = util.CloneArtists(artists) })
+		return artists, nil
+	}
+	view, err := d.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return view.Trash.Artists, nil
+}
+
+func (d *Database) ListDeletedVenues(ctx context.Context) ([]data.Venue, error) {
+	var venues []data.Venue
+	online, err := d.read(ctx, func(ctx context.Context) (err error) {
+		venues, err = d.Database.ListDeletedVenues(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		d.remember(ctx, func(s *Snapshot) { s.Trash.Venues = util.CloneVenues(venues) })
+		return venues, nil
+	}
+	view, err := d.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return view.Trash.Venues, nil
+}
+
+// Offline queries are filtered over the snapshots, which only hold the users that loaded their events
+// here, and the matching events are returned in a single page
+func (d *Database) QueryEvents(ctx context.Context, query data.EventQuery) (data.EventPage, error) {
+	var page data.EventPage
+	online, err := d.read(ctx, func(ctx context.Context) (err error) {
+		page, err = d.Database.QueryEvents(ctx, query)
+		return err
+	})
+	if err != nil || online {
+		return page, err
+	}
+	if query.Cursor != "" {
+		return data.EventPage{}, fmt.Errorf("%w, queries can't continue from a cursor until the offline writes are synced", ErrOffline)
+	}
+	events, err := d.viewEvents(ctx)
+	if err != nil {
+		return data.EventPage{}, err
+	}
+	return data.EventPage{Events: filterEvents(events, query), NextCursor: ""}, nil
+}
+
+func filterEvents(events []data.Event, query data.EventQuery) []data.Event {
+	matches := []data.Event{}
+	for _, e := range events {
+		ts := util.Timestamp(e.Date)
+		if query.From != "" && ts.Before(util.Timestamp(query.From)) ||
+			query.To != "" && ts.After(util.Timestamp(query.To)) ||
+			query.Purchased != nil && e.Purchased != *query.Purchased ||
+			query.VenueId != "" && e.Venue.Id != query.VenueId ||
+			query.ArtistId != "" && e.MainAct.Id != query.ArtistId &&
+				!slices.ContainsFunc(e.Openers, func(o data.Artist) bool { return o.Id == query.ArtistId }) {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	slices.SortFunc(matches, func(a, b data.Event) int {
+		if c := util.Timestamp(a.Date).Compare(util.Timestamp(b.Date)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+	return matches
+}
+
+type batchKey struct{}
+
+// The writes of a transaction, which either all go to the database or all go to the journal
+type batch struct {
+	id      string
+	online  bool
+	entries []Entry
+}
+
+// Transactions that find the database unreachable ask to be retried, and the retry goes to the journal
+func (d *Database) RunTransaction(ctx context.Context, f func(context.Context) error) error {
+	if _, ok := ctx.Value(batchKey{}).(*batch); ok {
+		return f(ctx)
+	}
+	if d.journaling() {
+		b := &batch{id: newLocalId()}
+		if err := f(context.WithValue(ctx, batchKey{}, b)); err != nil {
+			return err
+		}
+		return d.journal(b.entries...)
+	}
+
+	err := d.watch(ctx, func(ctx context.Context) error {
+		return d.Database.RunTransaction(context.WithValue(ctx, batchKey{}, &batch{online: true}), f)
+	})
+	if unreachable(err) {
+		return fmt.Errorf("%w, %v", db.ErrRetryTransaction, err)
+	}
+	return err
+}
+
+// Runs the write against the database, or saves it to the journal when the database can't be reached
+func (d *Database) write(ctx context.Context, entry Entry, f func(context.Context) error) (bool, error) {
+	if b, ok := ctx.Value(batchKey{}).(*batch); ok {
+		if b.online {
+			return false, d.call(ctx, f)
+		}
+		entry.Batch = b.id
+		b.entries = append(b.entries, cloneEntry(entry))
+		return true, nil
+	}
+	if !d.journaling() {
+		err := d.call(ctx, f)
+		if !unreachable(err) {
+			return false, err
+		}
+	}
+	return true, d.journal(cloneEntry(entry))
+}
+
+func (d *Database) journal(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := appendLines(filepath.Join(d.dir, journalFile), entries...); err != nil {
+		log.Error("Failed to save writes to the offline journal,", err)
+		return err
+	}
+	d.pending = append(d.pending, entries...)
+	log.Infof("Saved %d writes to the offline journal, %d waiting to be synced", len(entries), len(d.pending))
+	return nil
+}
+
+func (d *Database) add(ctx context.Context, entry Entry, f func(context.Context) (string, error)) (string, error) {
+	entry.RecordId = newLocalId()
+	var id string
+	journaled, err := d.write(ctx, entry, func(ctx context.Context) (err error) {
+		id, err = f(ctx)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if journaled {
+		return entry.RecordId, nil
+	}
+	return id, nil
+}
+
+func (d *Database) AddEvent(ctx context.Context, event data.Event) (string, error) {
+	entry := newEntry(ctx, opAdd, "event", "")
+	entry.Event = &event
+	return d.add(ctx, entry, func(ctx context.Context) (string, error) {
+		return d.Database.AddEvent(ctx, event)
+	})
+}
+
+func (d *Database) UpdateEvent(ctx context.Context, id string, event data.Event) error {
+	entry := newEntry(ctx, opUpdate, "event", id)
+	entry.Event = &event
+	_, err := d.write(ctx, entry, func(ctx context.Context) error {
+		return d.Database.UpdateEvent(ctx, id, event)
+	})
+	return err
+}
+
+func (d *Database) DeleteEvent(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opDelete, "event", id), func(ctx context.Context) error {
+		return d.Database.DeleteEvent(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) AddArtist(ctx context.Context, artist data.Artist) (string, error) {
+	entry := newEntry(ctx, opAdd, "artist", "")
+	entry.Artist = &artist
+	return d.add(ctx, entry, func(ctx context.Context) (string, error) {
+		return d.Database.AddArtist(ctx, artist)
+	})
+}
+
+func (d *Database) UpdateArtist(ctx context.Context, id string, artist data.Artist) error {
+	entry := newEntry(ctx, opUpdate, "artist", id)
+	entry.Artist = &artist
+	_, err := d.write(ctx, entry, func(ctx context.Context) error {
+		return d.Database.UpdateArtist(ctx, id, artist)
+	})
+	return err
+}
+
+func (d *Database) DeleteArtist(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opDelete, "artist", id), func(ctx context.Context) error {
+		return d.Database.DeleteArtist(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) AddVenue(ctx context.Context, venue data.Venue) (string, error) {
+	entry := newEntry(ctx, opAdd, "venue", "")
+	entry.Venue = &venue
+	return d.add(ctx, entry, func(ctx context.Context) (string, error) {
+		return d.Database.AddVenue(ctx, venue)
+	})
+}
+
+func (d *Database) UpdateVenue(ctx context.Context, id string, venue data.Venue) error {
+	entry := newEntry(ctx, opUpdate, "venue", id)
+	entry.Venue = &venue
+	_, err := d.write(ctx, entry, func(ctx context.Context) error {
+		return d.Database.UpdateVenue(ctx, id, venue)
+	})
+	return err
+}
+
+func (d *Database) DeleteVenue(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opDelete, "venue", id), func(ctx context.Context) error {
+		return d.Database.DeleteVenue(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) RestoreEvent(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opRestore, "event", id), func(ctx context.Context) error {
+		return d.Database.RestoreEvent(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) PurgeEvent(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opPurge, "event", id), func(ctx context.Context) error {
+		return d.Database.PurgeEvent(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) RepairEvent(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opRepair, "event", id), func(ctx context.Context) error {
+		return d.Database.RepairEvent(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) RestoreArtist(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opRestore, "artist", id), func(ctx context.Context) error {
+		return d.Database.RestoreArtist(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) PurgeArtist(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opPurge, "artist", id), func(ctx context.Context) error {
+		return d.Database.PurgeArtist(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) RestoreVenue(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opRestore, "venue", id), func(ctx context.Context) error {
+		return d.Database.RestoreVenue(ctx, id)
+	})
+	return err
+}
+
+func (d *Database) PurgeVenue(ctx context.Context, id string) error {
+	_, err := d.write(ctx, newEntry(ctx, opPurge, "venue", id), func(ctx context.Context) error {
+		return d.Database.PurgeVenue(ctx, id)
+	})
+	return err
+}
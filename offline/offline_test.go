@@ -0,0 +1,414 @@
+package offline
+
+import (
+	"concert-manager/cache"
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fails every call the offline database makes while it's down, the way Firestore does without a connection
+type network struct {
+	cache.Database
+	down bool
+	// how long each add takes, which fails with the deadline of its context if that comes first
+	latency time.Duration
+}
+
+func (n *network) check() error {
+	if n.down {
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+	return nil
+}
+
+func (n *network) respond(ctx context.Context) error {
+	if err := n.check(); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(n.latency):
+		return nil
+	}
+}
+
+func (n *network) AddEvent(ctx context.Context, event data.Event) (string, error) {
+	if err := n.respond(ctx); err != nil {
+		return "", err
+	}
+	return n.Database.AddEvent(ctx, event)
+}
+
+func (n *network) AddArtist(ctx context.Context, artist data.Artist) (string, error) {
+	if err := n.respond(ctx); err != nil {
+		return "", err
+	}
+	return n.Database.AddArtist(ctx, artist)
+}
+
+func (n *network) AddVenue(ctx context.Context, venue data.Venue) (string, error) {
+	if err := n.respond(ctx); err != nil {
+		return "", err
+	}
+	return n.Database.AddVenue(ctx, venue)
+}
+
+func (n *network) RunTransaction(ctx context.Context, f func(context.Context) error) error {
+	if err := n.check(); err != nil {
+		return err
+	}
+	return n.Database.RunTransaction(ctx, f)
+}
+
+func (n *network) ListEvents(ctx context.Context) ([]data.Event, error) {
+	if err := n.check(); err != nil {
+		return nil, err
+	}
+	return n.Database.ListEvents(ctx)
+}
+
+func (n *network) ListArtists(ctx context.Context) ([]data.Artist, error) {
+	if err := n.check(); err != nil {
+		return nil, err
+	}
+	return n.Database.ListArtists(ctx)
+}
+
+func (n *network) ListVenues(ctx context.Context) ([]data.Venue, error) {
+	if err := n.check(); err != nil {
+		return nil, err
+	}
+	return n.Database.ListVenues(ctx)
+}
+
+func (n *network) UpdateArtist(ctx context.Context, id string, artist data.Artist) error {
+	if err := n.check(); err != nil {
+		return err
+	}
+	return n.Database.UpdateArtist(ctx, id, artist)
+}
+
+func (n *network) QueryEvents(ctx context.Context, query data.EventQuery) (data.EventPage, error) {
+	if err := n.check(); err != nil {
+		return data.EventPage{}, err
+	}
+	return n.Database.QueryEvents(ctx, query)
+}
+
+func (n *network) DeleteEvent(ctx context.Context, id string) error {
+	if err := n.check(); err != nil {
+		return err
+	}
+	return n.Database.DeleteEvent(ctx, id)
+}
+
+func (n *network) ListDeletedEvents(ctx context.Context) ([]data.Event, error) {
+	if err := n.check(); err != nil {
+		return nil, err
+	}
+	return n.Database.ListDeletedEvents(ctx)
+}
+
+func newTestDatabase() *db.DatabaseRepository {
+	conn := memory.Setup()
+	return &db.DatabaseRepository{
+		VenueRepo:  &memory.VenueRepo{Connection: conn},
+		ArtistRepo: &memory.ArtistRepo{Connection: conn},
+		EventRepo:  &memory.EventRepo{Connection: conn},
+		Transactor: conn,
+	}
+}
+
+func mustOpen(t *testing.T, database cache.Database, dir string) *Database {
+	t.Helper()
+	offline, err := Open(database, dir)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return offline
+}
+
+var testEvent = data.Event{
+	MainAct: data.Artist{Name: "Khruangbin", Genre: "Psychedelic"},
+	Openers: []data.Artist{{Name: "Men I Trust", Genre: "Indie"}},
+	Venue:   data.Venue{Name: "The Eastern", City: "Atlanta", State: "GA"},
+	Date:    "6/14/2023",
+}
+
+func TestOfflineWritesReplay(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase()
+	net := &network{Database: database}
+	dir := t.TempDir()
+	offline := mustOpen(t, net, dir)
+	savedCache := &cache.SavedEventCache{Database: offline}
+	savedCache.LoadCaches()
+
+	net.down = true
+	saved, err := savedCache.AddSavedEvent(ctx, testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if status := offline.Status(); !status.Offline || status.Pending != 4 {
+		t.Errorf("Event and its references should be journaled, actual: %+v", status)
+	}
+
+	// a restart while still offline loads the journaled event on top of the snapshot
+	reopened := mustOpen(t, net, dir)
+	events, err := reopened.ListEvents(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(events) != 1 || events[0].Id != saved.Id || !events[0].Equals(testEvent) {
+		t.Errorf("Journaled event should be loaded offline, actual: %+v", events)
+	}
+
+	net.down = false
+	replayed, err := reopened.Sync(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if replayed != 4 {
+		t.Errorf("Incorrect number of replayed writes, expected: %v, actual: %v", 4, replayed)
+	}
+	events, err = database.ListEvents(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(events) != 1 || !events[0].Equals(testEvent) || isLocalId(events[0].Id) {
+		t.Errorf("Journaled event should be saved to the database, actual: %+v", events)
+	}
+	if status := reopened.Status(); status.Offline || status.Pending != 0 || len(status.Conflicts) != 0 {
+		t.Errorf("Sync should leave the journal empty, actual: %+v", status)
+	}
+	if reopened := mustOpen(t, net, dir); reopened.Status().Pending != 0 {
+		t.Error("Replayed writes should be removed from the journal file")
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase()
+	id, err := database.AddArtist(ctx, testEvent.MainAct)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	net := &network{Database: database}
+	offline := mustOpen(t, net, t.TempDir())
+	savedCache := &cache.SavedEventCache{Database: offline}
+	savedCache.LoadCaches()
+
+	net.down = true
+	offlineChange := savedCache.GetArtists()[0]
+	offlineChange.Genre = "Funk"
+	if err := savedCache.UpdateArtist(ctx, id, offlineChange); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// another instance changed the artist while this one was offline
+	onlineChange := data.Artist{Name: testEvent.MainAct.Name, Genre: "Soul", Version: 1}
+	if err := database.UpdateArtist(ctx, id, onlineChange); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	net.down = false
+	if _, err := offline.Sync(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	status := offline.Status()
+	if status.Pending != 0 || len(status.Conflicts) != 1 || status.Conflicts[0].Entry.RecordId != id {
+		t.Fatalf("Stale update should be recorded as a conflict, actual: %+v", status)
+	}
+	artists, err := database.ListArtists(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(artists) != 1 || artists[0].Genre != "Soul" {
+		t.Errorf("Conflicting write should not overwrite the database, actual: %+v", artists)
+	}
+}
+
+func TestOfflineWithoutSnapshot(t *testing.T) {
+	net := &network{Database: newTestDatabase(), down: true}
+	offline := mustOpen(t, net, t.TempDir())
+	if _, err := offline.ListEvents(context.Background()); !errors.Is(err, ErrOffline) {
+		t.Errorf("Expected an offline error without a snapshot, actual: %v", err)
+	}
+}
+
+func TestOfflineDeleteArtist(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase()
+	net := &network{Database: database}
+	offline := mustOpen(t, net, t.TempDir())
+	savedCache := &cache.SavedEventCache{Database: offline}
+	savedCache.LoadCaches()
+	saved, err := savedCache.AddSavedEvent(ctx, testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	net.down = true
+	err = savedCache.DeleteArtist(ctx, saved.Openers[0].Id, cache.DeleteOptions{})
+	var refErr *cache.ReferenceError
+	if !errors.As(err, &refErr) {
+		t.Errorf("Referenced artist should still be refused offline, actual: %v", err)
+	}
+	if err := savedCache.DeleteArtist(ctx, saved.Openers[0].Id, cache.DeleteOptions{Mode: cache.DeleteCascade}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if status := offline.Status(); !status.Offline || status.Pending != 2 {
+		t.Errorf("Event and artist deletes should be journaled, actual: %+v", status)
+	}
+
+	net.down = false
+	if _, err := offline.Sync(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if artists, err := database.ListArtists(ctx); err != nil || len(artists) != 1 {
+		t.Errorf("Deleted artist should be deleted from the database, actual: %+v, %v", artists, err)
+	}
+	if events, err := database.ListEvents(ctx); err != nil || len(events) != 0 {
+		t.Errorf("Cascaded event should be deleted from the database, actual: %+v, %v", events, err)
+	}
+}
+
+func TestOfflineMergeArtistsOfOtherUsers(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase()
+	net := &network{Database: database}
+	offline := mustOpen(t, net, t.TempDir())
+	caches := &cache.UserCaches{Database: offline}
+	alice, err := caches.For("alice")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	bob, err := caches.For("bob")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	saved, err := alice.AddSavedEvent(ctx, testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	survivor, err := bob.AddArtist(ctx, data.Artist{Name: "Khruangbín", Genre: "Psychedelic"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// the event of alice is only found in her snapshot while offline
+	net.down = true
+	if err := bob.MergeArtists(ctx, survivor.Id, []string{saved.MainAct.Id}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := alice.GetSavedEvents(); len(events) != 1 || events[0].MainAct.Id != survivor.Id {
+		t.Errorf("Event of the other user should be moved offline, actual: %+v", events)
+	}
+
+	net.down = false
+	if _, err := offline.Sync(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if status := offline.Status(); status.Pending != 0 || len(status.Conflicts) != 0 {
+		t.Fatalf("Merge should replay without conflicts, actual: %+v", status)
+	}
+	events, err := database.ListEvents(db.WithUser(ctx, "alice"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(events) != 1 || events[0].MainAct.Id != survivor.Id {
+		t.Errorf("Merged event should be saved to the database, actual: %+v", events)
+	}
+}
+
+func TestOfflineTrashRestore(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase()
+	net := &network{Database: database}
+	offline := mustOpen(t, net, t.TempDir())
+	savedCache := &cache.SavedEventCache{Database: offline}
+	savedCache.LoadCaches()
+	saved, err := savedCache.AddSavedEvent(ctx, testEvent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	// the snapshot holds what was last loaded, including the trash
+	if err := savedCache.RefreshSavedEvents(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := savedCache.GetTrash(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	net.down = true
+	if err := savedCache.DeleteSavedEvent(ctx, saved.Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	trash, err := savedCache.GetTrash()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(trash.Events) != 1 || trash.Events[0].Id != saved.Id {
+		t.Errorf("Deleted event should be in the trash offline, actual: %+v", trash.Events)
+	}
+	if err := savedCache.RestoreEvent(ctx, saved.Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events := savedCache.GetSavedEvents(); len(events) != 1 || events[0].Id != saved.Id {
+		t.Errorf("Restored event should be back offline, actual: %+v", events)
+	}
+
+	net.down = false
+	if _, err := offline.Sync(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if events, err := database.ListEvents(ctx); err != nil || len(events) != 1 {
+		t.Errorf("Restored event should be kept in the database, actual: %+v, %v", events, err)
+	}
+}
+
+func TestSlowTransactionsStayOnline(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase()
+	net := &network{Database: database}
+	offline := mustOpen(t, net, t.TempDir())
+	offline.Timeout = 100 * time.Millisecond
+	savedCache := &cache.SavedEventCache{Database: offline}
+	savedCache.LoadCaches()
+
+	net.down = true
+	if _, err := savedCache.AddSavedEvent(ctx, testEvent); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	net.down = false
+	// every add is well within the timeout, but the four of a saved event together aren't
+	net.latency = 40 * time.Millisecond
+	if _, err := offline.Sync(ctx); err != nil {
+		t.Fatal("Slow sync should replay the journal, unexpected error:", err)
+	}
+
+	later := testEvent
+	later.Date = "6/15/2023"
+	if _, err := savedCache.AddSavedEvents(ctx, []data.Event{later}); err != nil {
+		t.Fatal("Slow transaction should be written, unexpected error:", err)
+	}
+	if status := offline.Status(); status.Offline || status.Pending != 0 {
+		t.Errorf("Slow transactions shouldn't take the database offline, actual: %+v", status)
+	}
+	events, err := database.ListEvents(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Both events should be saved to the database, actual: %+v", events)
+	}
+}
@@ -0,0 +1,154 @@
+package offline
+
+import (
+	"concert-manager/data"
+	"concert-manager/util"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"time"
+)
+
+// What a user last loaded from the database
+type Snapshot struct {
+	Events   []data.Event  `json:"events"`
+	Artists  []data.Artist `json:"artists"`
+	Venues   []data.Venue  `json:"venues"`
+	Trash    data.Trash    `json:"trash"`
+	LoadedAt time.Time     `json:"loadedAt"`
+}
+
+func (s *Snapshot) clone() *Snapshot {
+	return &Snapshot{
+		Events:  util.CloneEvents(s.Events),
+		Artists: util.CloneArtists(s.Artists),
+		Venues:  util.CloneVenues(s.Venues),
+		Trash: data.Trash{
+			Events:  util.CloneEvents(s.Trash.Events),
+			Artists: util.CloneArtists(s.Trash.Artists),
+			Venues:  util.CloneVenues(s.Trash.Venues),
+		},
+		LoadedAt: s.LoadedAt,
+	}
+}
+
+// Changes the snapshot the same way replaying the entry changes the database. Repairs only drop references
+// the snapshot never loaded, and updates for every user skip the records of other users
+func (s *Snapshot) apply(entry Entry) {
+	switch entry.Op {
+	case opRepair:
+		return
+	case opDelete, opRestore, opPurge:
+		s.applyTrash(entry)
+		return
+	}
+
+	switch entry.Entity {
+	case "event":
+		idx := slices.IndexFunc(s.Events, func(e data.Event) bool { return e.Id == entry.RecordId })
+		if idx < 0 && entry.Op == opUpdate && entry.AllUsers {
+			return
+		}
+		event := util.CloneEvent(*entry.Event)
+		event.Id = entry.RecordId
+		if idx >= 0 {
+			event.Version = max(event.Version, s.Events[idx].Version) + 1
+			event.UserId = s.Events[idx].UserId
+			s.Events[idx] = event
+			return
+		}
+		event.Version, event.UserId = 1, entry.User
+		s.Events = append(s.Events, event)
+	case "artist":
+		idx := slices.IndexFunc(s.Artists, func(a data.Artist) bool { return a.Id == entry.RecordId })
+		if idx < 0 && entry.Op == opUpdate && entry.AllUsers {
+			return
+		}
+		artist := *entry.Artist
+		artist.Id = entry.RecordId
+		if idx >= 0 {
+			artist.Version = max(artist.Version, s.Artists[idx].Version) + 1
+			artist.UserId = s.Artists[idx].UserId
+			s.Artists[idx] = artist
+			return
+		}
+		artist.Version = 1
+		s.Artists = append(s.Artists, artist)
+	case "venue":
+		idx := slices.IndexFunc(s.Venues, func(v data.Venue) bool { return v.Id == entry.RecordId })
+		if idx < 0 && entry.Op == opUpdate && entry.AllUsers {
+			return
+		}
+		venue := *entry.Venue
+		venue.Id = entry.RecordId
+		if idx >= 0 {
+			venue.Version = max(venue.Version, s.Venues[idx].Version) + 1
+			venue.UserId = s.Venues[idx].UserId
+			s.Venues[idx] = venue
+			return
+		}
+		venue.Version = 1
+		s.Venues = append(s.Venues, venue)
+	}
+}
+
+func (s *Snapshot) applyTrash(entry Entry) {
+	switch entry.Entity {
+	case "event":
+		moveToTrash(&s.Events, &s.Trash.Events, entry,
+			func(e data.Event) string { return e.Id }, func(e *data.Event, at *time.Time) { e.DeletedAt = at })
+	case "artist":
+		moveToTrash(&s.Artists, &s.Trash.Artists, entry,
+			func(a data.Artist) string { return a.Id }, func(a *data.Artist, at *time.Time) { a.DeletedAt = at })
+	case "venue":
+		moveToTrash(&s.Venues, &s.Trash.Venues, entry,
+			func(v data.Venue) string { return v.Id }, func(v *data.Venue, at *time.Time) { v.DeletedAt = at })
+	}
+}
+
+// Deletes move the record into the trash, restores move it back out and purges drop it from the trash
+func moveToTrash[T any](live *[]T, trash *[]T, entry Entry, id func(T) string, setDeletedAt func(*T, *time.Time)) {
+	from, to := live, trash
+	var deletedAt *time.Time
+	switch entry.Op {
+	case opDelete:
+		timestamp := entry.Timestamp
+		deletedAt = &timestamp
+	case opRestore:
+		from, to = trash, live
+	case opPurge:
+		from, to = trash, nil
+	}
+	idx := slices.IndexFunc(*from, func(record T) bool { return id(record) == entry.RecordId })
+	if idx < 0 {
+		return
+	}
+	record := (*from)[idx]
+	*from = slices.Delete(*from, idx, idx+1)
+	if to != nil {
+		setDeletedAt(&record, deletedAt)
+		*to = append(*to, record)
+	}
+}
+
+func readSnapshots(path string) (map[string]*Snapshot, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]*Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshots := map[string]*Snapshot{}
+	if err := json.Unmarshal(contents, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func writeSnapshots(path string, snapshots map[string]*Snapshot) error {
+	return writeFile(path, func(file *os.File) error {
+		return json.NewEncoder(file).Encode(snapshots)
+	})
+}
@@ -0,0 +1,219 @@
+package offline
+
+import (
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Replays the journal against the database in the order it was written, one batch at a time. Writes
+// the database rejects, like updates to records that changed since they were loaded, are recorded as
+// conflicts and skipped. Returns the number of replayed entries, and stops early if the database is
+// still unreachable, leaving the rest of the journal for the next sync
+func (d *Database) Sync(ctx context.Context) (int, error) {
+	d.syncMutex.Lock()
+	defer d.syncMutex.Unlock()
+
+	d.mutex.Lock()
+	wasOffline := d.offline
+	d.mutex.Unlock()
+
+	if !d.hasPending() {
+		// nothing to replay, but the database has to answer before going back online
+		err := d.call(ctx, func(ctx context.Context) error {
+			_, err := d.Database.ListVenues(db.WithUser(ctx, db.DefaultUser))
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		d.goOnline(wasOffline)
+		return 0, nil
+	}
+
+	log.Info("Syncing offline writes to the database")
+	replayed := 0
+	for d.hasPending() {
+		d.mutex.Lock()
+		n := batchLength(d.pending)
+		entries := make([]Entry, n)
+		for i := range entries {
+			entries[i] = cloneEntry(d.pending[i])
+		}
+		d.mutex.Unlock()
+
+		ids, err := d.replay(ctx, entries)
+		if unreachable(err) {
+			log.Infof("Database is still unreachable after syncing %d offline writes, %v", replayed, err)
+			return replayed, err
+		}
+		if err != nil {
+			// the transaction was rolled back, so none of its records got an ID
+			ids = nil
+		}
+		if err := d.finishBatch(entries, ids, err); err != nil {
+			return replayed, err
+		}
+		replayed += n
+	}
+
+	log.Infof("Synced %d offline writes to the database", replayed)
+	d.goOnline(true)
+	return replayed, nil
+}
+
+func (d *Database) hasPending() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return len(d.pending) > 0
+}
+
+func (d *Database) goOnline(changed bool) {
+	d.mutex.Lock()
+	now := time.Now().UTC()
+	d.offline = false
+	d.lastSync = &now
+	d.mutex.Unlock()
+
+	if changed && d.OnSync != nil {
+		d.OnSync()
+	}
+}
+
+// Runs the batch as a single transaction, returning the IDs the database gave to the records added offline
+func (d *Database) replay(ctx context.Context, entries []Entry) (map[string]string, error) {
+	ids := map[string]string{}
+	err := d.watch(ctx, func(ctx context.Context) error {
+		return d.Database.RunTransaction(ctx, func(ctx context.Context) error {
+			clear(ids)
+			for _, entry := range entries {
+				err := d.call(ctx, func(ctx context.Context) error {
+					return d.replayEntry(ctx, entry, ids)
+				})
+				if err != nil {
+					return fmt.Errorf("failed to %s %s %s, %w", entry.Op, entry.Entity, entry.RecordId, err)
+				}
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
+
+func (d *Database) replayEntry(ctx context.Context, entry Entry, ids map[string]string) error {
+	ctx = db.WithActor(db.WithUser(ctx, entry.User), entry.Actor)
+	if entry.AllUsers {
+		ctx = db.WithAllUsers(ctx)
+	}
+	replaceIds([]Entry{entry}, ids)
+	if entry.Op != opAdd && isLocalId(entry.RecordId) {
+		return fmt.Errorf("record %s was never synced", entry.RecordId)
+	}
+
+	var id string
+	var err error
+	switch entry.Entity + " " + entry.Op {
+	case "event add":
+		id, err = d.Database.AddEvent(ctx, *entry.Event)
+	case "event update":
+		err = d.Database.UpdateEvent(ctx, entry.RecordId, *entry.Event)
+	case "event delete":
+		err = d.Database.DeleteEvent(ctx, entry.RecordId)
+	case "event restore":
+		err = d.Database.RestoreEvent(ctx, entry.RecordId)
+	case "event purge":
+		err = d.Database.PurgeEvent(ctx, entry.RecordId)
+	case "event repair":
+		err = d.Database.RepairEvent(ctx, entry.RecordId)
+	case "artist add":
+		id, err = d.Database.AddArtist(ctx, *entry.Artist)
+	case "artist update":
+		err = d.Database.UpdateArtist(ctx, entry.RecordId, *entry.Artist)
+	case "artist delete":
+		err = d.Database.DeleteArtist(ctx, entry.RecordId)
+	case "artist restore":
+		err = d.Database.RestoreArtist(ctx, entry.RecordId)
+	case "artist purge":
+		err = d.Database.PurgeArtist(ctx, entry.RecordId)
+	case "venue add":
+		id, err = d.Database.AddVenue(ctx, *entry.Venue)
+	case "venue update":
+		err = d.Database.UpdateVenue(ctx, entry.RecordId, *entry.Venue)
+	case "venue delete":
+		err = d.Database.DeleteVenue(ctx, entry.RecordId)
+	case "venue restore":
+		err = d.Database.RestoreVenue(ctx, entry.RecordId)
+	case "venue purge":
+		err = d.Database.PurgeVenue(ctx, entry.RecordId)
+	default:
+		err = fmt.Errorf("unknown journal entry %s %s", entry.Op, entry.Entity)
+	}
+	if err != nil {
+		return err
+	}
+	if entry.Op == opAdd {
+		ids[entry.RecordId] = id
+	}
+	return nil
+}
+
+// Removes the replayed batch from the journal, either applying it to the snapshot or recording it as a conflict
+func (d *Database) finishBatch(entries []Entry, ids map[string]string, replayErr error) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if replayErr != nil {
+		log.Error("Offline writes conflict with the database,", replayErr)
+		conflicts := []Conflict{}
+		for _, entry := range entries {
+			conflicts = append(conflicts, Conflict{Entry: entry, Reason: replayErr.Error(), DetectedAt: time.Now().UTC()})
+		}
+		if err := appendLines(filepath.Join(d.dir, conflictsFile), conflicts...); err != nil {
+			log.Error("Failed to save offline conflicts,", err)
+			return err
+		}
+		d.conflicts = append(d.conflicts, conflicts...)
+	} else {
+		replaceIds(entries, ids)
+		for _, entry := range entries {
+			for user, snapshot := range d.snapshots {
+				if entry.appliesTo(user) {
+					snapshot.apply(entry)
+				}
+			}
+		}
+		if err := writeSnapshots(filepath.Join(d.dir, snapshotFile), d.snapshots); err != nil {
+			log.Error("Failed to save offline snapshot,", err)
+		}
+	}
+
+	remaining := d.pending[len(entries):]
+	replaceIds(remaining, ids)
+	if err := writeLines(filepath.Join(d.dir, journalFile), remaining); err != nil {
+		log.Error("Failed to save offline journal,", err)
+		return err
+	}
+	d.pending = remaining
+	return nil
+}
+
+// Tries to sync every interval for as long as the process runs, whenever the database was unreachable
+// or there are writes waiting in the journal
+func (d *Database) StartSync(interval time.Duration) {
+	log.Infof("Syncing offline writes every %v", interval)
+	ctx := db.WithActor(context.Background(), db.ActorSystem)
+	go func() {
+		for {
+			time.Sleep(interval)
+			if !d.journaling() {
+				continue
+			}
+			if _, err := d.Sync(ctx); err != nil {
+				log.Debug("Offline sync didn't finish,", err)
+			}
+		}
+	}()
+}
@@ -70,10 +70,15 @@ func (r *ArtistRanker) Rank(artist data.Artist) data.ArtistRank {
 }
 
 func (r *ArtistRanker) DoRefresh() {
+	r.Refresh()
+}
+
+// Like DoRefresh, but returns why the refresh failed. Does nothing when a refresh is already running
+func (r *ArtistRanker) Refresh() error {
 	r.refreshMutex.Lock()
 	if r.refreshing {
 		r.refreshMutex.Unlock()
-		return
+		return nil
 	}
 	r.refreshing = true
 	r.refreshMutex.Unlock()
@@ -91,6 +96,7 @@ func (r *ArtistRanker) DoRefresh() {
 	r.refreshMutex.Lock()
 	r.refreshing = false
 	r.refreshMutex.Unlock()
+	return err
 }
 
 func (r *ArtistRanker) RefreshRanks() error {
@@ -0,0 +1,208 @@
+package replication
+
+const (
+	OpAdd    = "add"
+	OpUpdate = "update"
+	OpDelete = "delete"
+
+	SideLeft  = "left"
+	SideRight = "right"
+)
+
+// How replication settles a record that changed differently on both sides since the last replication
+type Policy string
+
+const (
+	// Leaves both sides as they are and reports the conflict
+	ReportConflicts Policy = ""
+	// Makes the right side match the left side, even if that undoes changes on the right
+	PreferLeft Policy = SideLeft
+	// Makes the left side match the right side, even if that undoes changes on the left
+	PreferRight Policy = SideRight
+)
+
+// A write replication makes to bring one side up to date with the other
+type Change struct {
+	Entity string `json:"entity"`
+	Op     string `json:"op"`
+	// The side the change is written to
+	Target  string `json:"target"`
+	LeftId  string `json:"leftId,omitempty"`
+	RightId string `json:"rightId,omitempty"`
+
+	source  *record
+	current *record
+	link    link
+}
+
+// A record that changed differently on both sides, which neither side was overwritten for
+type Conflict struct {
+	Entity  string `json:"entity"`
+	LeftId  string `json:"leftId,omitempty"`
+	RightId string `json:"rightId,omitempty"`
+	Reason  string `json:"reason"`
+	Left    any    `json:"left,omitempty"`
+	Right   any    `json:"right,omitempty"`
+}
+
+// The changes and conflicts between the two sides for a single kind of record,
+// along with the links that stay as they are
+type plan struct {
+	policy    Policy
+	changes   []Change
+	conflicts []Conflict
+	links     []link
+}
+
+// Works out what changed on each side since the last replication. Records already linked are compared
+// against the content they had when they were last in sync, so a change on one side is copied to the
+// other and a record missing on one side was deleted there. Records that aren't linked yet are matched
+// up by the identity both backends dedupe on, and copied to the other side when there's no match
+func diff(entity string, links []link, policy Policy, left []record, right []record) plan {
+	p := plan{policy: policy}
+	leftById, rightById := byId(left), byId(right)
+
+	for _, l := range links {
+		if l.Entity != entity {
+			continue
+		}
+		leftRecord, rightRecord := leftById[l.LeftId], rightById[l.RightId]
+		delete(leftById, l.LeftId)
+		delete(rightById, l.RightId)
+		p.linked(l, leftRecord, rightRecord)
+	}
+
+	unmatched := map[string]*record{}
+	for i := range right {
+		if _, ok := rightById[right[i].id]; ok {
+			unmatched[right[i].key] = &right[i]
+		}
+	}
+	for i := range left {
+		leftRecord := &left[i]
+		if _, ok := leftById[leftRecord.id]; !ok {
+			continue
+		}
+		l := link{Entity: entity, LeftId: leftRecord.id}
+		rightRecord, ok := unmatched[leftRecord.key]
+		if !ok {
+			p.copy(SideRight, l, leftRecord, nil)
+			continue
+		}
+		delete(unmatched, leftRecord.key)
+		delete(rightById, rightRecord.id)
+		l.RightId = rightRecord.id
+		if leftRecord.content == rightRecord.content {
+			l.Content = leftRecord.content
+			p.links = append(p.links, l)
+			continue
+		}
+		p.conflict(l, leftRecord, rightRecord, "added on both sides with different content")
+	}
+	for i := range right {
+		if _, ok := rightById[right[i].id]; ok {
+			p.copy(SideLeft, link{Entity: entity, RightId: right[i].id}, &right[i], nil)
+		}
+	}
+	return p
+}
+
+func byId(records []record) map[string]*record {
+	ids := map[string]*record{}
+	for i := range records {
+		ids[records[i].id] = &records[i]
+	}
+	return ids
+}
+
+func (p *plan) linked(l link, left *record, right *record) {
+	switch {
+	case left == nil && right == nil:
+		// deleted on both sides, so there's nothing left to link
+	case left != nil && right != nil:
+		switch {
+		case left.content == right.content:
+			l.Content = left.content
+			p.links = append(p.links, l)
+		case right.content == l.Content:
+			p.copy(SideRight, l, left, right)
+		case left.content == l.Content:
+			p.copy(SideLeft, l, right, left)
+		default:
+			p.conflict(l, left, right, "changed on both sides")
+		}
+	case left != nil:
+		if left.content == l.Content {
+			p.remove(SideLeft, l, left)
+		} else {
+			p.conflict(l, left, nil, "changed on the left but deleted on the right")
+		}
+	default:
+		if right.content == l.Content {
+			p.remove(SideRight, l, right)
+		} else {
+			p.conflict(l, nil, right, "changed on the right but deleted on the left")
+		}
+	}
+}
+
+// Writes the source record to the target side, adding it there unless it already has a current record
+func (p *plan) copy(target string, l link, source *record, current *record) {
+	op := OpAdd
+	if current != nil {
+		op = OpUpdate
+	}
+	p.changes = append(p.changes, Change{
+		Entity:  source.entity,
+		Op:      op,
+		Target:  target,
+		LeftId:  l.LeftId,
+		RightId: l.RightId,
+		source:  source,
+		current: current,
+		link:    l,
+	})
+}
+
+func (p *plan) remove(target string, l link, current *record) {
+	p.changes = append(p.changes, Change{
+		Entity:  current.entity,
+		Op:      OpDelete,
+		Target:  target,
+		LeftId:  l.LeftId,
+		RightId: l.RightId,
+		current: current,
+		link:    l,
+	})
+}
+
+// Settles the conflict when the policy prefers a side, and reports it otherwise. The link of a
+// reported conflict is kept, so the record is compared again by the next replication
+func (p *plan) conflict(l link, left *record, right *record, reason string) {
+	switch p.policy {
+	case PreferLeft:
+		if left != nil {
+			p.copy(SideRight, l, left, right)
+		} else {
+			p.remove(SideRight, l, right)
+		}
+		return
+	case PreferRight:
+		if right != nil {
+			p.copy(SideLeft, l, right, left)
+		} else {
+			p.remove(SideLeft, l, left)
+		}
+		return
+	}
+
+	conflict := Conflict{Reason: reason, LeftId: l.LeftId, RightId: l.RightId}
+	if left != nil {
+		conflict.Entity, conflict.Left = left.entity, left.value
+	}
+	if right != nil {
+		conflict.Entity, conflict.Right = right.entity, right.value
+	}
+	p.conflicts = append(p.conflicts, conflict)
+	p.links = append(p.links, l)
+}
@@ -0,0 +1,100 @@
+package replication
+
+import (
+	"concert-manager/data"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	entityVenue  = "venue"
+	entityArtist = "artist"
+	entityEvent  = "event"
+)
+
+// A record of either backend, reduced to what replication compares. Key is the identity both
+// backends dedupe on, and content is everything a change can touch, neither of which includes the
+// backend's own IDs and versions
+type record struct {
+	entity  string
+	id      string
+	owner   string
+	key     string
+	content string
+	version int
+	value   any
+}
+
+func naturalKey(parts ...string) string {
+	return strings.Join(parts, "\x1f")
+}
+
+func venueKey(venue data.Venue, owner string) string {
+	return naturalKey(owner, venue.Name, venue.City, venue.State)
+}
+
+func toContent(value any) string {
+	// marshalling plain structs of strings and bools can't fail
+	content, _ := json.Marshal(value)
+	return string(content)
+}
+
+func venueRecord(venue data.Venue) record {
+	return record{
+		entity:  entityVenue,
+		id:      venue.Id,
+		owner:   venue.UserId,
+		key:     venueKey(venue, venue.UserId),
+		content: toContent([]string{venue.Name, venue.City, venue.State}),
+		version: venue.Version,
+		value:   venue,
+	}
+}
+
+func artistRecord(artist data.Artist) record {
+	return record{
+		entity:  entityArtist,
+		id:      artist.Id,
+		owner:   artist.UserId,
+		key:     naturalKey(artist.UserId, artist.Name),
+		content: toContent([]string{artist.Name, artist.Genre}),
+		version: artist.Version,
+		value:   artist,
+	}
+}
+
+// Events point at their artists and venue by name, since the IDs differ between the backends
+func eventRecord(event data.Event) record {
+	openers := []string{}
+	for _, opener := range event.Openers {
+		openers = append(openers, opener.Name)
+	}
+	// left out until it's set, so the content of events linked before archiving existed doesn't change
+	content := struct {
+		MainAct    string
+		Openers    []string
+		Venue      []string
+		Date       string
+		Purchased  bool
+		TmId       string
+		ArchivedAt *time.Time `json:",omitempty"`
+	}{
+		MainAct:    event.MainAct.Name,
+		Openers:    openers,
+		Venue:      []string{event.Venue.Name, event.Venue.City, event.Venue.State},
+		Date:       event.Date,
+		Purchased:  event.Purchased,
+		TmId:       event.TmId,
+		ArchivedAt: event.ArchivedAt,
+	}
+	return record{
+		entity:  entityEvent,
+		id:      event.Id,
+		owner:   event.UserId,
+		key:     naturalKey(event.UserId, event.Date, venueKey(event.Venue, "")),
+		content: toContent(content),
+		version: event.Version,
+		value:   event,
+	}
+}
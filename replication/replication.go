@@ -0,0 +1,279 @@
+// Package replication keeps two databases consistent with each other, like a local SQLite copy and
+// the Firestore primary. Every backend gives records its own IDs, so the records of both sides are
+// linked up in a local state file, which also remembers what each record looked like when both sides
+// were last in sync. That's how a replication tells which side changed a record, and copies the
+// change to the other side in either direction
+package replication
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Database interface {
+	AddVenue(context.Context, data.Venue) (string, error)
+	UpdateVenue(context.Context, string, data.Venue) error
+	DeleteVenue(context.Context, string) error
+	ListVenues(context.Context) ([]data.Venue, error)
+	GetVenue(context.Context, string) (data.Venue, error)
+	AddArtist(context.Context, data.Artist) (string, error)
+	UpdateArtist(context.Context, string, data.Artist) error
+	DeleteArtist(context.Context, string) error
+	ListArtists(context.Context) ([]data.Artist, error)
+	GetArtist(context.Context, string) (data.Artist, error)
+	AddEvent(context.Context, data.Event) (string, error)
+	UpdateEvent(context.Context, string, data.Event) error
+	DeleteEvent(context.Context, string) error
+	ListEvents(context.Context) ([]data.Event, error)
+	GetEvent(context.Context, string) (data.Event, error)
+}
+
+type Replicator struct {
+	Left  Database
+	Right Database
+	// Where the links between the records of both sides are kept between replications
+	StatePath string
+	// How records that changed differently on both sides are settled, they are only reported by default
+	Policy Policy
+
+	mutex sync.Mutex
+}
+
+type Report struct {
+	Changes   []Change   `json:"changes"`
+	Conflicts []Conflict `json:"conflicts"`
+	// Changes that were planned but couldn't be written, they are planned again by the next replication
+	Failed []string `json:"failed,omitempty"`
+}
+
+// Works out the changes a replication would make without writing anything
+func (r *Replicator) Diff(ctx context.Context) (Report, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, err := readState(r.StatePath)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to read replication state, %w", err)
+	}
+	plans, err := r.plan(ctx, s)
+	if err != nil {
+		return Report{}, err
+	}
+	report := Report{Changes: []Change{}, Conflicts: []Conflict{}}
+	for _, p := range plans {
+		report.Changes = append(report.Changes, p.changes...)
+		report.Conflicts = append(report.Conflicts, p.conflicts...)
+	}
+	return report, nil
+}
+
+// Brings both sides up to date with each other. Venues and artists are written before the events
+// that reference them, and deleted after. A change that fails is reported and left for the next
+// replication, while the rest of the changes still go through
+func (r *Replicator) Sync(ctx context.Context) (Report, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, err := readState(r.StatePath)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to read replication state, %w", err)
+	}
+	plans, err := r.plan(ctx, s)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Changes: []Change{}, Conflicts: []Conflict{}}
+	links := []link{}
+	applied := func(change Change, err error) {
+		if err != nil {
+			log.Errorf("Failed to replicate %s %s to the %s side, %v", change.Op, change.Entity, change.Target, err)
+			report.Failed = append(report.Failed, fmt.Sprintf("%s %s on the %s side: %v", change.Op, change.Entity, change.Target, err))
+			if change.Op != OpAdd {
+				// keeps comparing the record against the last content both sides agreed on
+				links = append(links, change.link)
+			}
+			return
+		}
+		report.Changes = append(report.Changes, change)
+		if change.Op != OpDelete {
+			links = append(links, change.link)
+		}
+	}
+	for _, p := range plans {
+		report.Conflicts = append(report.Conflicts, p.conflicts...)
+		links = append(links, p.links...)
+		for _, change := range p.changes {
+			if change.Op != OpDelete {
+				applied(r.apply(ctx, change))
+			}
+		}
+	}
+	for i := len(plans) - 1; i >= 0; i-- {
+		for _, change := range plans[i].changes {
+			if change.Op == OpDelete {
+				applied(r.apply(ctx, change))
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	if err := writeState(r.StatePath, &state{Links: links, LastSync: &now}); err != nil {
+		return report, fmt.Errorf("failed to save replication state, %w", err)
+	}
+	log.Infof("Replicated %d changes with %d conflicts and %d failures",
+		len(report.Changes), len(report.Conflicts), len(report.Failed))
+	return report, nil
+}
+
+// Plans venues, artists and events in that order, which is the order their additions are written in
+func (r *Replicator) plan(ctx context.Context, s *state) ([]plan, error) {
+	ctx = db.WithAllUsers(ctx)
+	left, err := listRecords(ctx, r.Left)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the left side, %w", err)
+	}
+	right, err := listRecords(ctx, r.Right)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the right side, %w", err)
+	}
+	plans := []plan{}
+	for _, entity := range []string{entityVenue, entityArtist, entityEvent} {
+		plans = append(plans, diff(entity, s.Links, r.Policy, left[entity], right[entity]))
+	}
+	return plans, nil
+}
+
+func listRecords(ctx context.Context, database Database) (map[string][]record, error) {
+	venues, err := database.ListVenues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	artists, err := database.ListArtists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := database.ListEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := map[string][]record{}
+	for _, venue := range venues {
+		records[entityVenue] = append(records[entityVenue], venueRecord(venue))
+	}
+	for _, artist := range artists {
+		records[entityArtist] = append(records[entityArtist], artistRecord(artist))
+	}
+	for _, event := range events {
+		records[entityEvent] = append(records[entityEvent], eventRecord(event))
+	}
+	return records, nil
+}
+
+// Writes the change to its target side, returning it with the link it leaves behind
+func (r *Replicator) apply(ctx context.Context, change Change) (Change, error) {
+	target := r.Left
+	if change.Target == SideRight {
+		target = r.Right
+	}
+
+	if change.Op == OpAdd {
+		// records are added for their owner, while the other changes can reach the records of every user
+		ctx = db.WithUser(ctx, change.source.owner)
+		id, err := add(ctx, target, change.source)
+		if err != nil {
+			return change, err
+		}
+		if change.Target == SideRight {
+			change.RightId, change.link.RightId = id, id
+		} else {
+			change.LeftId, change.link.LeftId = id, id
+		}
+		change.link.Content = change.source.content
+		return change, nil
+	}
+
+	ctx = db.WithAllUsers(ctx)
+	if change.Op == OpDelete {
+		return change, remove(ctx, target, change.current)
+	}
+	if err := update(ctx, target, change.source, change.current); err != nil {
+		return change, err
+	}
+	// an update the target skipped without an error would otherwise be linked as synced and never retried
+	written, err := find(ctx, target, change.current)
+	if err != nil {
+		return change, err
+	}
+	if written.content != change.source.content {
+		return change, fmt.Errorf("%s %s still differs after the update", change.current.entity, change.current.id)
+	}
+	change.link.Content = change.source.content
+	return change, nil
+}
+
+func add(ctx context.Context, target Database, source *record) (string, error) {
+	switch value := source.value.(type) {
+	case data.Venue:
+		value.Id, value.Version = "", 0
+		return target.AddVenue(ctx, value)
+	case data.Artist:
+		value.Id, value.Version = "", 0
+		return target.AddArtist(ctx, value)
+	case data.Event:
+		value.Id, value.Version = "", 0
+		return target.AddEvent(ctx, value)
+	}
+	return "", fmt.Errorf("unknown record %T", source.value)
+}
+
+// Updates the current record of the target side, failing with a version conflict if it changed
+// since the replication listed it
+func update(ctx context.Context, target Database, source *record, current *record) error {
+	switch value := source.value.(type) {
+	case data.Venue:
+		value.Id, value.Version = current.id, current.version
+		return target.UpdateVenue(ctx, current.id, value)
+	case data.Artist:
+		value.Id, value.Version = current.id, current.version
+		return target.UpdateArtist(ctx, current.id, value)
+	case data.Event:
+		value.Id, value.Version = current.id, current.version
+		return target.UpdateEvent(ctx, current.id, value)
+	}
+	return fmt.Errorf("unknown record %T", source.value)
+}
+
+// Reads the current record back from the target side
+func find(ctx context.Context, target Database, current *record) (record, error) {
+	switch current.entity {
+	case entityVenue:
+		venue, err := target.GetVenue(ctx, current.id)
+		return venueRecord(venue), err
+	case entityArtist:
+		artist, err := target.GetArtist(ctx, current.id)
+		return artistRecord(artist), err
+	case entityEvent:
+		event, err := target.GetEvent(ctx, current.id)
+		return eventRecord(event), err
+	}
+	return record{}, fmt.Errorf("unknown record %s", current.entity)
+}
+
+func remove(ctx context.Context, target Database, current *record) error {
+	switch current.entity {
+	case entityVenue:
+		return target.DeleteVenue(ctx, current.id)
+	case entityArtist:
+		return target.DeleteArtist(ctx, current.id)
+	case entityEvent:
+		return target.DeleteEvent(ctx, current.id)
+	}
+	return fmt.Errorf("unknown record %s", current.entity)
+}
@@ -0,0 +1,253 @@
+package replication
+
+import (
+	"concert-manager/data"
+	"concert-manager/db"
+	"concert-manager/db/memory"
+	"concert-manager/db/sqlite"
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newMemoryDatabase() *db.DatabaseRepository {
+	conn := memory.Setup()
+	return &db.DatabaseRepository{
+		VenueRepo:  &memory.VenueRepo{Connection: conn},
+		ArtistRepo: &memory.ArtistRepo{Connection: conn},
+		EventRepo:  &memory.EventRepo{Connection: conn},
+		Transactor: conn,
+	}
+}
+
+func newSQLiteDatabase(t *testing.T) *db.DatabaseRepository {
+	conn, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatal("failed to open database:", err)
+	}
+	t.Cleanup(func() { conn.DB.Close() })
+	venueRepo := &sqlite.VenueRepo{Connection: conn}
+	artistRepo := &sqlite.ArtistRepo{Connection: conn}
+	return &db.DatabaseRepository{
+		VenueRepo:  venueRepo,
+		ArtistRepo: artistRepo,
+		EventRepo:  &sqlite.EventRepo{Connection: conn, VenueRepo: venueRepo, ArtistRepo: artistRepo},
+		Transactor: conn,
+	}
+}
+
+var testEvent = data.Event{
+	MainAct: data.Artist{Name: "Khruangbin", Genre: "Psychedelic"},
+	Openers: []data.Artist{{Name: "Men I Trust", Genre: "Indie"}},
+	Venue:   data.Venue{Name: "The Eastern", City: "Atlanta", State: "GA"},
+	Date:    "6/14/2023",
+}
+
+func addEvent(t *testing.T, ctx context.Context, database *db.DatabaseRepository, event data.Event) string {
+	t.Helper()
+	if _, err := database.AddVenue(ctx, event.Venue); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, artist := range append([]data.Artist{event.MainAct}, event.Openers...) {
+		if _, err := database.AddArtist(ctx, artist); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	id, err := database.AddEvent(ctx, event)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return id
+}
+
+func mustSync(t *testing.T, replicator *Replicator) Report {
+	t.Helper()
+	report, err := replicator.Sync(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(report.Failed) != 0 {
+		t.Fatalf("Replication should not fail, actual: %v", report.Failed)
+	}
+	return report
+}
+
+func mustListEvents(t *testing.T, database *db.DatabaseRepository) []data.Event {
+	t.Helper()
+	events, err := database.ListEvents(db.WithAllUsers(context.Background()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return events
+}
+
+func TestReplicateBothWays(t *testing.T) {
+	ctx := context.Background()
+	left, right := newMemoryDatabase(), newSQLiteDatabase(t)
+	replicator := &Replicator{Left: left, Right: right, StatePath: filepath.Join(t.TempDir(), "state.json")}
+
+	addEvent(t, ctx, left, testEvent)
+	other := testEvent
+	other.Date = "7/1/2023"
+	addEvent(t, db.WithUser(ctx, "alice"), right, other)
+
+	report := mustSync(t, replicator)
+	// the shared artists and venue are matched up, so only the events are missing
+	if len(report.Changes) != 2 || len(report.Conflicts) != 0 {
+		t.Errorf("Each side should get the events it's missing, actual: %+v", report)
+	}
+	for _, database := range []*db.DatabaseRepository{left, right} {
+		events := mustListEvents(t, database)
+		if len(events) != 2 {
+			t.Fatalf("Both sides should have both events, actual: %+v", events)
+		}
+		for _, event := range events {
+			if event.UserId == "alice" && !event.Equals(other) || event.UserId == db.DefaultUser && !event.Equals(testEvent) {
+				t.Errorf("Replicated event should keep its content and owner, actual: %+v", event)
+			}
+		}
+	}
+	if report := mustSync(t, replicator); len(report.Changes) != 0 {
+		t.Errorf("Replicating again should not change anything, actual: %+v", report.Changes)
+	}
+
+	// a change on one side is copied to the other by the record it's linked to
+	artists, err := right.ListArtists(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	changed := artists[0]
+	changed.Genre = "Funk"
+	if err := right.UpdateArtist(ctx, changed.Id, changed); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	events := mustListEvents(t, left)
+	if err := left.DeleteEvent(db.WithAllUsers(ctx), events[0].Id); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	report = mustSync(t, replicator)
+	if len(report.Changes) != 2 {
+		t.Errorf("Expected an update and a delete, actual: %+v", report.Changes)
+	}
+	if events := mustListEvents(t, right); len(events) != 1 {
+		t.Errorf("Deleted event should be deleted on the other side, actual: %+v", events)
+	}
+	leftArtists, err := left.ListArtists(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(leftArtists) != 2 || !slices.ContainsFunc(leftArtists, func(a data.Artist) bool { return a.Equals(changed) }) {
+		t.Errorf("Changed artist should be updated on the other side, actual: %+v", leftArtists)
+	}
+}
+
+func TestReplicationConflict(t *testing.T) {
+	ctx := context.Background()
+	left, right := newMemoryDatabase(), newSQLiteDatabase(t)
+	replicator := &Replicator{Left: left, Right: right, StatePath: filepath.Join(t.TempDir(), "state.json")}
+	leftId, err := left.AddArtist(ctx, testEvent.MainAct)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	mustSync(t, replicator)
+	rightArtists, err := right.ListArtists(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	leftChange := data.Artist{Name: testEvent.MainAct.Name, Genre: "Funk", Version: 1}
+	if err := left.UpdateArtist(ctx, leftId, leftChange); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	rightChange := data.Artist{Name: testEvent.MainAct.Name, Genre: "Soul", Version: 1}
+	if err := right.UpdateArtist(ctx, rightArtists[0].Id, rightChange); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	diff, err := replicator.Diff(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	report := mustSync(t, replicator)
+	for _, report := range []Report{diff, report} {
+		if len(report.Changes) != 0 || len(report.Conflicts) != 1 || report.Conflicts[0].LeftId != leftId {
+			t.Errorf("Artist changed on both sides should be reported as a conflict, actual: %+v", report)
+		}
+	}
+
+	replicator.Policy = PreferLeft
+	if report := mustSync(t, replicator); len(report.Changes) != 1 || len(report.Conflicts) != 0 {
+		t.Errorf("Preferring a side should settle the conflict, actual: %+v", report)
+	}
+	rightArtists, err = right.ListArtists(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(rightArtists) != 1 || rightArtists[0].Genre != "Funk" {
+		t.Errorf("Right side should match the left side, actual: %+v", rightArtists)
+	}
+}
+
+// Drops event updates while reporting them as successful
+type ignoringDatabase struct {
+	*db.DatabaseRepository
+}
+
+func (ignoringDatabase) UpdateEvent(context.Context, string, data.Event) error {
+	return nil
+}
+
+func TestReplicateUpdateOfOtherUser(t *testing.T) {
+	alice := db.WithUser(context.Background(), "alice")
+	left, right := newMemoryDatabase(), newSQLiteDatabase(t)
+	replicator := &Replicator{Left: left, Right: right, StatePath: filepath.Join(t.TempDir(), "state.json")}
+	id := addEvent(t, alice, left, testEvent)
+	mustSync(t, replicator)
+
+	changed := testEvent
+	changed.Purchased = true
+	changed.Version = 1
+	if err := left.UpdateEvent(alice, id, changed); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if report := mustSync(t, replicator); len(report.Changes) != 1 {
+		t.Errorf("Expected the event to be updated, actual: %+v", report)
+	}
+	events := mustListEvents(t, right)
+	if len(events) != 1 || !events[0].Purchased || events[0].UserId != "alice" {
+		t.Errorf("Update should be replicated for the owner of the event, actual: %+v", events)
+	}
+}
+
+func TestReplicateSkippedUpdateIsRetried(t *testing.T) {
+	ctx := context.Background()
+	left, right := newMemoryDatabase(), newSQLiteDatabase(t)
+	ignoring := ignoringDatabase{right}
+	replicator := &Replicator{Left: left, Right: ignoring, StatePath: filepath.Join(t.TempDir(), "state.json")}
+	id := addEvent(t, ctx, left, testEvent)
+	mustSync(t, replicator)
+
+	changed := testEvent
+	changed.Purchased = true
+	changed.Version = 1
+	if err := left.UpdateEvent(ctx, id, changed); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	report, err := replicator.Sync(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(report.Failed) != 1 || len(report.Changes) != 0 {
+		t.Errorf("Skipped update should be reported as failed, actual: %+v", report)
+	}
+
+	replicator.Right = right
+	if report := mustSync(t, replicator); len(report.Changes) != 1 {
+		t.Errorf("Skipped update should be planned again, actual: %+v", report)
+	}
+	if events := mustListEvents(t, right); len(events) != 1 || !events[0].Purchased {
+		t.Errorf("Retried update should be replicated, actual: %+v", events)
+	}
+}
@@ -0,0 +1,63 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Pairs up a record of the left backend with the same record of the right backend, along with the
+// content both had when they were last in sync, which tells which side changed since
+type link struct {
+	Entity  string `json:"entity"`
+	LeftId  string `json:"leftId"`
+	RightId string `json:"rightId"`
+	Content string `json:"content"`
+}
+
+type state struct {
+	Links    []link     `json:"links"`
+	LastSync *time.Time `json:"lastSync,omitempty"`
+}
+
+// Reads the state of the last replication, which is empty before the first one
+func readState(path string) (*state, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &state{Links: []link{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &state{}
+	if err := json.Unmarshal(contents, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Replaces the state file through a temporary file, so a crash leaves either the old or the new state
+func writeState(path string, s *state) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,148 @@
+// Package scheduler runs periodic background jobs, so work that would otherwise happen lazily on the first
+// request after something expired is already done by the time anyone asks
+package scheduler
+
+import (
+	"concert-manager/log"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Run reports what the job did, like how many records it changed
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(context.Context) (string, error)
+}
+
+type Status struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval"`
+	// disabled jobs have no interval and never run
+	Enabled      bool       `json:"enabled"`
+	Running      bool       `json:"running"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	LastResult   string     `json:"lastResult,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+}
+
+type Scheduler struct {
+	mutex  sync.Mutex
+	jobs   []*Job
+	status map[string]*Status
+}
+
+// Jobs added after the scheduler was started never run. A job with an interval of zero is disabled
+func (s *Scheduler) Add(job Job) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status == nil {
+		s.status = make(map[string]*Status)
+	}
+	s.jobs = append(s.jobs, &job)
+	s.status[job.Name] = &Status{Name: job.Name, Interval: job.Interval.String(), Enabled: job.Interval > 0}
+}
+
+// Runs every enabled job once right away and then once per interval, until the context is done.
+// A job never overlaps with itself, a run that takes longer than the interval delays the next one
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.jobs {
+		if job.Interval <= 0 {
+			log.Infof("Scheduled job %s is disabled", job.Name)
+			continue
+		}
+		log.Infof("Scheduling job %s every %v", job.Name, job.Interval)
+		go s.schedule(ctx, job)
+	}
+}
+
+func (s *Scheduler) schedule(ctx context.Context, job *Job) {
+	for {
+		s.run(ctx, job)
+		next := time.Now().Add(job.Interval)
+		s.update(job.Name, func(status *Status) { status.NextRun = &next })
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(job.Interval):
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job *Job) {
+	start := time.Now()
+	s.update(job.Name, func(status *Status) {
+		status.Running = true
+		status.NextRun = nil
+	})
+	log.Debug("Running scheduled job", job.Name)
+	result, err := job.Run(ctx)
+	if err != nil {
+		log.Errorf("Scheduled job %s failed, %v", job.Name, err)
+	} else {
+		log.Infof("Scheduled job %s finished: %s", job.Name, result)
+	}
+
+	s.update(job.Name, func(status *Status) {
+		status.Running = false
+		status.Runs++
+		status.LastRun = &start
+		status.LastDuration = time.Since(start).Round(time.Millisecond).String()
+		status.LastResult = result
+		status.LastError = ""
+		if err != nil {
+			status.Failures++
+			status.LastError = err.Error()
+		}
+	})
+}
+
+func (s *Scheduler) update(name string, f func(*Status)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f(s.status[name])
+}
+
+// The status of every job, in the order they were added
+func (s *Scheduler) Status() []Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	statuses := []Status{}
+	for _, job := range s.jobs {
+		statuses = append(statuses, *s.status[job.Name])
+	}
+	return statuses
+}
+
+// Parses intervals like "upcoming=6h,ranks=24h,archive=0", where zero disables the job.
+// Only the named jobs are allowed, and jobs that aren't given keep their default
+func ParseIntervals(value string, jobs []string) (map[string]time.Duration, error) {
+	intervals := map[string]time.Duration{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, interval, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !slices.Contains(jobs, name) {
+			return nil, fmt.Errorf("invalid job interval %q, expected one of %v followed by =duration", entry, jobs)
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid interval for job %s: %s", name, interval)
+		}
+		intervals[name] = duration
+	}
+	return intervals, nil
+}
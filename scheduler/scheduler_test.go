@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduledJobs(t *testing.T) {
+	var runs, failures, disabledRuns atomic.Int32
+	s := &Scheduler{}
+	s.Add(Job{Name: "counter", Interval: 10 * time.Millisecond, Run: func(context.Context) (string, error) {
+		runs.Add(1)
+		return "counted", nil
+	}})
+	s.Add(Job{Name: "failing", Interval: time.Hour, Run: func(context.Context) (string, error) {
+		failures.Add(1)
+		return "", errors.New("unreachable")
+	}})
+	s.Add(Job{Name: "disabled", Run: func(context.Context) (string, error) {
+		disabledRuns.Add(1)
+		return "", nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if runs.Load() < 3 {
+		t.Errorf("Job should run once per interval, actual runs: %d", runs.Load())
+	}
+	if failures.Load() != 1 {
+		t.Errorf("Job should run once right away, actual runs: %d", failures.Load())
+	}
+	if disabledRuns.Load() != 0 {
+		t.Error("Disabled job should never run")
+	}
+
+	statuses := s.Status()
+	if len(statuses) != 3 || statuses[0].Name != "counter" || statuses[1].Name != "failing" || statuses[2].Name != "disabled" {
+		t.Fatalf("Expected the status of every job in order, actual: %+v", statuses)
+	}
+	if counter := statuses[0]; !counter.Enabled || counter.Runs < 3 || counter.LastResult != "counted" || counter.LastRun == nil {
+		t.Errorf("Incorrect status, actual: %+v", counter)
+	}
+	if failing := statuses[1]; failing.Failures != 1 || failing.LastError != "unreachable" || failing.NextRun == nil {
+		t.Errorf("Incorrect status, actual: %+v", failing)
+	}
+	if disabled := statuses[2]; disabled.Enabled || disabled.Runs != 0 || disabled.NextRun != nil {
+		t.Errorf("Incorrect status, actual: %+v", disabled)
+	}
+}
+
+func TestParseIntervals(t *testing.T) {
+	jobs := []string{"upcoming", "archive"}
+	intervals, err := ParseIntervals(" upcoming=6h, archive=0 ,", jobs)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(intervals) != 2 || intervals["upcoming"] != 6*time.Hour || intervals["archive"] != 0 {
+		t.Errorf("Incorrect intervals, actual: %v", intervals)
+	}
+
+	for _, invalid := range []string{"ranks=1h", "upcoming", "upcoming=often", "upcoming=-1h"} {
+		if _, err := ParseIntervals(invalid, jobs); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"concert-manager/backup"
+	"concert-manager/cache"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func (s *Server) handleIntegrity(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	pathParts := strings.Split(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet:
+		issues, err := savedCache.GetIntegrityIssues()
+		if err != nil {
+			errMsg := fmt.Sprintf("failed to check integrity: %v", err)
+			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		}
+		return issues, 0, nil
+	case http.MethodPost:
+		if len(pathParts) != 6 || len(pathParts[4]) == 0 || pathParts[5] != "repair" {
+			return nil, http.StatusBadRequest, errors.New("expected path /v1/admin/integrity/{id}/repair")
+		}
+		if err := savedCache.RepairEvent(r.Context(), pathParts[4]); err != nil {
+			errMsg := fmt.Sprintf("failed to repair event: %v", err)
+			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		}
+		return nil, 0, nil
+	case http.MethodDelete:
+		if len(pathParts) != 5 || len(pathParts[4]) == 0 {
+			return nil, http.StatusBadRequest, errors.New("missing event ID in path")
+		}
+		if err := savedCache.DeleteInvalidEvent(r.Context(), pathParts[4]); err != nil {
+			errMsg := fmt.Sprintf("failed to delete event: %v", err)
+			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		}
+		return nil, 0, nil
+	}
+	return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+}
+
+// GET /v1/trash, POST /v1/trash/{events|artists|venues}/{id}/restore and DELETE /v1/trash/{events|artists|venues}/{id}
+func (s *Server) handleTrash(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	pathParts := strings.Split(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet:
+		trash, err := savedCache.GetTrash()
+		if err != nil {
+			errMsg := fmt.Sprintf("failed to retrieve trash: %v", err)
+			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		}
+		return trash, 0, nil
+	case http.MethodPost:
+		if len(pathParts) != 6 || len(pathParts[4]) == 0 || pathParts[5] != "restore" {
+			return nil, http.StatusBadRequest, errors.New("expected path /v1/trash/{entity}/{id}/restore")
+		}
+		restore := map[string]func(context.Context, string) error{
+			"events":  savedCache.RestoreEvent,
+			"artists": savedCache.RestoreArtist,
+			"venues":  savedCache.RestoreVenue,
+		}[pathParts[3]]
+		if restore == nil {
+			return nil, http.StatusBadRequest, errors.New("entity must be one of events, artists or venues")
+		}
+		if err := restore(r.Context(), pathParts[4]); err != nil {
+			errMsg := fmt.Sprintf("failed to restore from trash: %v", err)
+			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		}
+		return nil, 0, nil
+	case http.MethodDelete:
+		if len(pathParts) != 5 || len(pathParts[4]) == 0 {
+			return nil, http.StatusBadRequest, errors.New("expected path /v1/trash/{entity}/{id}")
+		}
+		purge := map[string]func(context.Context, string) error{
+			"events":  savedCache.PurgeEvent,
+			"artists": savedCache.PurgeArtist,
+			"venues":  savedCache.PurgeVenue,
+		}[pathParts[3]]
+		if purge == nil {
+			return nil, http.StatusBadRequest, errors.New("entity must be one of events, artists or venues")
+		}
+		if err := purge(r.Context(), pathParts[4]); err != nil {
+			errMsg := fmt.Sprintf("failed to purge from trash: %v", err)
+			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		}
+		return nil, 0, nil
+	}
+	return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+}
+
+// GET /v1/audit?entity={event|artist|venue}&id={id}, leaving out the id lists every change to the entity
+func (s *Server) getAuditEntries(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+	params := r.URL.Query()
+	entity := params.Get("entity")
+	if entity != "event" && entity != "artist" && entity != "venue" {
+		return nil, http.StatusBadRequest, errors.New("entity must be one of event, artist or venue")
+	}
+	entries, err := s.AuditLog.ListAuditEntries(r.Context(), entity, params.Get("id"))
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to retrieve audit log: %v", err)
+		return nil, http.StatusInternalServerError, errors.New(errMsg)
+	}
+	return entries, 0, nil
+}
+
+type mergeRequest struct {
+	SurvivorId   string   `json:"survivorId"`
+	DuplicateIds []string `json:"duplicateIds"`
+}
+
+func (s *Server) handleDuplicateArtists(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return savedCache.FindDuplicateArtists(), 0, nil
+	case http.MethodPost:
+		merge, err := decodeMergeRequest(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if err := savedCache.MergeArtists(r.Context(), merge.SurvivorId, merge.DuplicateIds); err != nil {
+			return mergeFailure("artists", err)
+		}
+		return nil, 0, nil
+	}
+	return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+}
+
+func (s *Server) handleDuplicateVenues(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return savedCache.FindDuplicateVenues(), 0, nil
+	case http.MethodPost:
+		merge, err := decodeMergeRequest(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if err := savedCache.MergeVenues(r.Context(), merge.SurvivorId, merge.DuplicateIds); err != nil {
+			return mergeFailure("venues", err)
+		}
+		return nil, 0, nil
+	}
+	return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+}
+
+func mergeFailure(entity string, err error) (any, int, error) {
+	var refErr *cache.ReferenceError
+	if errors.As(err, &refErr) {
+		return referenceConflict{refErr.Error(), refErr.Events}, http.StatusConflict, err
+	}
+	errMsg := fmt.Sprintf("failed to merge %s: %v", entity, err)
+	return nil, http.StatusInternalServerError, errors.New(errMsg)
+}
+
+func decodeMergeRequest(r *http.Request) (mergeRequest, error) {
+	var merge mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		return merge, errors.New("invalid body")
+	}
+	if merge.SurvivorId == "" || len(merge.DuplicateIds) == 0 {
+		return merge, errors.New("survivorId and duplicateIds are required")
+	}
+	return merge, nil
+}
+
+func (s *Server) getBackup(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+	archive, err := s.Backup.Export(r.Context())
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to back up database: %v", err)
+		return nil, http.StatusInternalServerError, errors.New(errMsg)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=concert_manager_backup.json")
+	return archive, 0, nil
+}
+
+func (s *Server) restoreBackup(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if r.Method != http.MethodPost {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+	archive, err := backup.Read(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	summary, err := s.Backup.Restore(r.Context(), archive)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to restore database: %v", err)
+		return nil, http.StatusInternalServerError, errors.New(errMsg)
+	}
+
+	// the restore skips the caches, so reload everything it may have added
+	if err := s.Caches.RefreshAll(); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("restored, but failed to refresh the caches: %v", err)
+	}
+	return summary, 0, nil
+}
+
+// GET reports whether the database is reachable and how many offline writes are waiting, POST syncs them right away
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if s.Offline == nil {
+		return nil, http.StatusNotFound, errors.New("offline mode is disabled")
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return s.Offline.Status(), 0, nil
+	case http.MethodPost:
+		if _, err := s.Offline.Sync(r.Context()); err != nil {
+			errMsg := fmt.Sprintf("failed to sync offline writes: %v", err)
+			return s.Offline.Status(), http.StatusServiceUnavailable, errors.New(errMsg)
+		}
+		return s.Offline.Status(), 0, nil
+	}
+	return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+}
+
+func (s *Server) clearSyncConflicts(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if s.Offline == nil {
+		return nil, http.StatusNotFound, errors.New("offline mode is disabled")
+	}
+	if r.Method != http.MethodDelete {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+	if err := s.Offline.ClearConflicts(); err != nil {
+		errMsg := fmt.Sprintf("failed to clear sync conflicts: %v", err)
+		return nil, http.StatusInternalServerError, errors.New(errMsg)
+	}
+	return nil, 0, nil
+}
+
+// GET /v1/admin/jobs lists every background job with the result of its last run
+func (s *Server) getJobs(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if s.Scheduler == nil {
+		return nil, http.StatusNotFound, errors.New("background jobs are disabled")
+	}
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+	return s.Scheduler.Status(), 0, nil
+}
@@ -1,26 +1,35 @@
 package server
 
 import (
+	"concert-manager/cache"
 	"concert-manager/data"
+	"concert-manager/db"
 	"concert-manager/log"
+	"concert-manager/util"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func (s *Server) handleVenues(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 	switch r.Method {
     case http.MethodGet:
-		venues := s.VenueCache.GetVenues()
+		venues := savedCache.GetVenues()
 		return venues, 0, nil
 	case http.MethodPost:
 		var venue data.Venue
 		if err := json.NewDecoder(r.Body).Decode(&venue); err != nil {
 			return nil, http.StatusBadRequest, errors.New("invalid body")
 		}
-		savedVenue, err := s.VenueCache.AddVenue(venue)
+		savedVenue, err := savedCache.AddVenue(r.Context(), venue)
 		if err != nil {
 			errMsg := fmt.Sprintf("failed to save venue: %v", err)
 			return nil, http.StatusInternalServerError, errors.New(errMsg)
@@ -39,10 +48,12 @@ func (s *Server) handleVenues(w http.ResponseWriter, r *http.Request) (any, int,
 		if err := json.NewDecoder(r.Body).Decode(&venue); err != nil {
 			return nil, http.StatusBadRequest, errors.New("invalid body")
 		}
-		err := s.VenueCache.UpdateVenue(id, venue)
+		if err := ifMatchVersion(r, &venue.Version); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		err := savedCache.UpdateVenue(r.Context(), id, venue)
 		if err != nil {
-			errMsg := fmt.Sprintf("failed to update venue: %v", err)
-			return nil, http.StatusInternalServerError, errors.New(errMsg)
+			return updateFailure("venue", err)
 		}
 		return nil, 0, nil
 	case http.MethodDelete:
@@ -54,9 +65,12 @@ func (s *Server) handleVenues(w http.ResponseWriter, r *http.Request) (any, int,
 		if len(id) == 0 {
 			return nil, http.StatusBadRequest, errors.New("missing venue ID in path")
 		}
-		if err := s.VenueCache.DeleteVenue(id); err != nil {
-			errMsg := fmt.Sprintf("failed to delete venue: %v", err)
-			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		opts, err := deleteOptions(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if err := savedCache.DeleteVenue(r.Context(), id, opts); err != nil {
+			return deleteFailure("venue", err)
 		}
 		return nil, 0, nil
 	}
@@ -64,16 +78,20 @@ func (s *Server) handleVenues(w http.ResponseWriter, r *http.Request) (any, int,
 }
 
 func (s *Server) handleArtists(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 	switch r.Method {
     case http.MethodGet:
-		artists := s.ArtistCache.GetArtists()
+		artists := savedCache.GetArtists()
 		return artists, 0, nil
 	case http.MethodPost:
 		var artist data.Artist
 		if err := json.NewDecoder(r.Body).Decode(&artist); err != nil {
 			return nil, http.StatusBadRequest, errors.New("invalid body")
 		}
-		savedArtist, err := s.ArtistCache.AddArtist(artist)
+		savedArtist, err := savedCache.AddArtist(r.Context(), artist)
 		if err != nil {
 			errMsg := fmt.Sprintf("failed to save artist: %v", err)
 			return nil, http.StatusInternalServerError, errors.New(errMsg)
@@ -92,10 +110,12 @@ func (s *Server) handleArtists(w http.ResponseWriter, r *http.Request) (any, int
 		if err := json.NewDecoder(r.Body).Decode(&artist); err != nil {
 			return nil, http.StatusBadRequest, errors.New("invalid body")
 		}
-		err := s.ArtistCache.UpdateArtist(id, artist)
+		if err := ifMatchVersion(r, &artist.Version); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		err := savedCache.UpdateArtist(r.Context(), id, artist)
 		if err != nil {
-			errMsg := fmt.Sprintf("failed to update artist: %v", err)
-			return nil, http.StatusInternalServerError, errors.New(errMsg)
+			return updateFailure("artist", err)
 		}
 		return nil, 0, nil
 	case http.MethodDelete:
@@ -107,41 +127,104 @@ func (s *Server) handleArtists(w http.ResponseWriter, r *http.Request) (any, int
 		if len(id) == 0 {
 			return nil, http.StatusBadRequest, errors.New("missing artist ID in path")
 		}
-		if err := s.ArtistCache.DeleteArtist(id); err != nil {
-			errMsg := fmt.Sprintf("failed to delete artist: %v", err)
-			return nil, http.StatusInternalServerError, errors.New(errMsg)
+		opts, err := deleteOptions(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if err := savedCache.DeleteArtist(r.Context(), id, opts); err != nil {
+			return deleteFailure("artist", err)
 		}
 		return nil, 0, nil
 	}
 	return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
 }
 
+// GET supports one of the id, artistId or venueId query params, or from and to, which are answered
+// from the cache. The query endpoint filters in the database instead
 func (s *Server) handleSavedEvents(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 	switch r.Method {
     case http.MethodGet:
-		events := s.SavedEventCache.GetSavedEvents()
-		id := r.URL.Query().Get("id")
-		if id == "" {
-			return events, 0, nil
-		}
-		for _, event := range events {
-			if event.Id == id {
-				return []data.Event{event}, 0, nil
+		params := r.URL.Query()
+		if id := params.Get("id"); id != "" {
+			event, ok := savedCache.GetSavedEvent(id)
+			if !ok {
+				errMsg := fmt.Sprintf("event with ID %s not found", id)
+				return nil, http.StatusNotFound, errors.New(errMsg)
+			}
+			return []data.Event{event}, 0, nil
+		}
+		if artistId := params.Get("artistId"); artistId != "" {
+			return savedCache.EventsForArtist(artistId), 0, nil
+		}
+		if venueId := params.Get("venueId"); venueId != "" {
+			return savedCache.EventsAtVenue(venueId), 0, nil
+		}
+		if params.Has("from") || params.Has("to") {
+			from, to := params.Get("from"), params.Get("to")
+			if from != "" && !util.ValidDate(from) || to != "" && !util.ValidDate(to) {
+				return nil, http.StatusBadRequest, errors.New("invalid from or to query param, expected m/d/yyyy")
+			}
+			var fromTime, toTime time.Time
+			if from != "" {
+				fromTime = util.Timestamp(from)
 			}
+			if to != "" {
+				toTime = util.Timestamp(to)
+			}
+			return savedCache.EventsBetween(fromTime, toTime), 0, nil
 		}
-		errMsg := fmt.Sprintf("event with ID %s not found", id)
-		return nil, http.StatusNotFound, errors.New(errMsg)
+		return savedCache.GetSavedEvents(), 0, nil
 	case http.MethodPost:
 		var event data.Event
 		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
 			return nil, http.StatusBadRequest, errors.New("invalid body")
 		}
-		savedEvent, err := s.SavedEventCache.AddSavedEvent(event)
+		// checked here since the database layer expects a valid date and would panic on anything else
+		if !util.ValidDate(event.Date) {
+			return nil, http.StatusBadRequest, errors.New("invalid event date, expected m/d/yyyy")
+		}
+		savedEvent, err := savedCache.AddSavedEvent(r.Context(), event)
 		if err != nil {
 			errMsg := fmt.Sprintf("failed to save event: %v", err)
 			return nil, http.StatusInternalServerError, errors.New(errMsg)
 		}
 		return savedEvent, 0, nil
+	case http.MethodPut, http.MethodPatch:
+		pathParts := strings.Split(r.URL.Path, "/")
+		if len(pathParts) != 5 {
+			return nil, http.StatusBadRequest, errors.New("missing event ID in path")
+		}
+		id := pathParts[4]
+		if len(id) == 0 {
+			return nil, http.StatusBadRequest, errors.New("missing event ID in path")
+		}
+		// PATCH only overwrites the fields present in the body, PUT replaces the whole event
+		var event data.Event
+		if r.Method == http.MethodPatch {
+			cached, ok := savedCache.GetSavedEvent(id)
+			if !ok {
+				errMsg := fmt.Sprintf("event with ID %s not found", id)
+				return nil, http.StatusNotFound, errors.New(errMsg)
+			}
+			event = cached
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			return nil, http.StatusBadRequest, errors.New("invalid body")
+		}
+		if !util.ValidDate(event.Date) {
+			return nil, http.StatusBadRequest, errors.New("invalid event date, expected m/d/yyyy")
+		}
+		if err := ifMatchVersion(r, &event.Version); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if err := savedCache.UpdateSavedEvent(r.Context(), id, event); err != nil {
+			return updateFailure("event", err)
+		}
+		return nil, 0, nil
 	case http.MethodDelete:
 		pathParts := strings.Split(r.URL.Path, "/")
 		if len(pathParts) != 5 {
@@ -151,7 +234,7 @@ func (s *Server) handleSavedEvents(w http.ResponseWriter, r *http.Request) (any,
 		if len(id) == 0 {
 			return nil, http.StatusBadRequest, errors.New("missing event ID in path")
 		}
-		if err := s.SavedEventCache.DeleteSavedEvent(id); err != nil {
+		if err := savedCache.DeleteSavedEvent(r.Context(), id); err != nil {
 			errMsg := fmt.Sprintf("failed to delete event: %v", err)
 			return nil, http.StatusInternalServerError, errors.New(errMsg)
 		}
@@ -160,12 +243,66 @@ func (s *Server) handleSavedEvents(w http.ResponseWriter, r *http.Request) (any,
 	return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
 }
 
+// Supports the from, to, purchased, venueId, artistId, cursor and limit query params
+func (s *Server) querySavedEvents(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+
+	params := r.URL.Query()
+	query := data.EventQuery{
+		From:     params.Get("from"),
+		To:       params.Get("to"),
+		VenueId:  params.Get("venueId"),
+		ArtistId: params.Get("artistId"),
+		Cursor:   params.Get("cursor"),
+	}
+	if purchasedParam := params.Get("purchased"); purchasedParam != "" {
+		purchased, err := strconv.ParseBool(purchasedParam)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("invalid purchased query param, expected true or false")
+		}
+		query.Purchased = &purchased
+	}
+	if limitParam := params.Get("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 0 {
+			return nil, http.StatusBadRequest, errors.New("invalid limit query param")
+		}
+		query.Limit = limit
+	}
+
+	if query.From != "" && !util.ValidDate(query.From) || query.To != "" && !util.ValidDate(query.To) {
+		return nil, http.StatusBadRequest, errors.New("invalid from or to query param, expected m/d/yyyy")
+	}
+	if query.Cursor != "" {
+		if _, err := util.DecodeEventCursor(query.Cursor); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+
+	page, err := savedCache.QuerySavedEvents(query)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to query saved events: %v", err)
+		return nil, http.StatusInternalServerError, errors.New(errMsg)
+	}
+	return page, 0, nil
+}
+
 func (s *Server) refreshSavedEvents(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
     if r.Method != http.MethodPost {
 		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
 	}
 
-	err := s.SavedEventCache.RefreshSavedEvents()
+	err = savedCache.RefreshSavedEvents()
 	if err != nil {
 		log.Errorf("Failed to refresh saved events %v", err)
 		return nil, http.StatusInternalServerError, errors.New("failed to refresh saved event cache")
@@ -174,11 +311,15 @@ func (s *Server) refreshSavedEvents(w http.ResponseWriter, r *http.Request) (any
 }
 
 func (s *Server) refreshArtists(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
     if r.Method != http.MethodPost {
 		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
 	}
 
-	err := s.ArtistCache.RefreshArtists()
+	err = savedCache.RefreshArtists()
 	if err != nil {
 		log.Errorf("Failed to refresh artists %v", err)
 		return nil, http.StatusInternalServerError, errors.New("failed to refresh artists cache")
@@ -187,11 +328,15 @@ func (s *Server) refreshArtists(w http.ResponseWriter, r *http.Request) (any, in
 }
 
 func (s *Server) refreshVenues(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
     if r.Method != http.MethodPost {
 		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
 	}
 
-	err := s.VenueCache.RefreshVenues()
+	err = savedCache.RefreshVenues()
 	if err != nil {
 		log.Errorf("Failed to refresh venues %v", err)
 		return nil, http.StatusInternalServerError, errors.New("failed to refresh venues cache")
@@ -217,3 +362,59 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) (any, int,
 	}
 	return fmt.Sprintf("Successfully uploaded %d rows", rows), 0, nil
 }
+
+// Reads the version the client last saw from an If-Match header, either as a plain or weak ETag
+// like "3" or W/"3". Without the header (or with *) the version from the body is left as is
+func ifMatchVersion(r *http.Request, version *int) error {
+	header := r.Header.Get("If-Match")
+	if header == "" || header == "*" {
+		return nil
+	}
+	etag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	v, err := strconv.Atoi(etag)
+	if err != nil || v < 1 {
+		return errors.New("invalid If-Match header, expected a record version")
+	}
+	*version = v
+	return nil
+}
+
+func updateFailure(entity string, err error) (any, int, error) {
+	errMsg := fmt.Sprintf("failed to update %s: %v", entity, err)
+	if errors.Is(err, db.ErrVersionConflict) {
+		return nil, http.StatusPreconditionFailed, errors.New(errMsg)
+	}
+	return nil, http.StatusInternalServerError, errors.New(errMsg)
+}
+
+type referenceConflict struct {
+	Error  string       `json:"error"`
+	Events []data.Event `json:"events"`
+}
+
+// Reads the optional mode=cascade|reassign and reassignTo query params of an artist or venue delete
+func deleteOptions(r *http.Request) (cache.DeleteOptions, error) {
+	query := r.URL.Query()
+	switch query.Get("mode") {
+	case "", "restrict":
+		return cache.DeleteOptions{Mode: cache.DeleteRestrict}, nil
+	case "cascade":
+		return cache.DeleteOptions{Mode: cache.DeleteCascade}, nil
+	case "reassign":
+		reassignTo := query.Get("reassignTo")
+		if reassignTo == "" {
+			return cache.DeleteOptions{}, errors.New("missing reassignTo query param")
+		}
+		return cache.DeleteOptions{Mode: cache.DeleteReassign, ReassignTo: reassignTo}, nil
+	}
+	return cache.DeleteOptions{}, errors.New("invalid mode query param, expected restrict, cascade or reassign")
+}
+
+func deleteFailure(entity string, err error) (any, int, error) {
+	var refErr *cache.ReferenceError
+	if errors.As(err, &refErr) {
+		return referenceConflict{refErr.Error(), refErr.Events}, http.StatusConflict, err
+	}
+	errMsg := fmt.Sprintf("failed to delete %s: %v", entity, err)
+	return nil, http.StatusInternalServerError, errors.New(errMsg)
+}
@@ -1,11 +1,18 @@
 package server
 
 import (
+	"concert-manager/backup"
 	"concert-manager/cache"
 	"concert-manager/data"
+	"concert-manager/db"
 	"concert-manager/log"
+	"concert-manager/offline"
+	"concert-manager/scheduler"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -13,50 +20,111 @@ import (
 
 type Server struct {
     Loader loader
-	SavedEventCache savedEventCache
-	ArtistCache artistCache
-	VenueCache venueCache
+	Backup backupService
+	Caches userCaches
+	AuditLog auditLog
+	Offline offlineDatabase
 	UpcomingEventsCache upcomingEventsCache
 	RecommendationCache recommendationCache
+	Scheduler jobScheduler
+	// Shared with the proxy in front of the server, which authenticates users and passes them on in the
+	// X-User header. When empty the header is rejected, and every request acts for the default user
+	ProxyToken string
 }
 
 type loader interface {
     Upload(context.Context, io.ReadCloser) (int, error)
 }
 
+type backupService interface {
+	Export(context.Context) (*backup.Archive, error)
+	Restore(context.Context, backup.Archive) (backup.Summary, error)
+}
+
+type userCaches interface {
+	For(string) (*cache.SavedEventCache, error)
+	RefreshAll() error
+}
+
+// Everything the handlers need from the saved event cache of a single user
+type userCache interface {
+	savedEventCache
+	artistCache
+	venueCache
+	trashCache
+}
+
 type savedEventCache interface {
     GetSavedEvents() []data.Event
 	GetPassedSavedEvents() []data.Event
-	AddSavedEvent(data.Event) (*data.Event, error)
-	DeleteSavedEvent(string) error
+	GetSavedEvent(string) (data.Event, bool)
+	EventsForArtist(string) []data.Event
+	EventsAtVenue(string) []data.Event
+	EventsBetween(time.Time, time.Time) []data.Event
+	QuerySavedEvents(data.EventQuery) (data.EventPage, error)
+	AddSavedEvent(context.Context, data.Event) (*data.Event, error)
+	UpdateSavedEvent(context.Context, string, data.Event) error
+	DeleteSavedEvent(context.Context, string) error
 	RefreshSavedEvents() error
+	GetIntegrityIssues() ([]data.IntegrityIssue, error)
+	RepairEvent(context.Context, string) error
+	DeleteInvalidEvent(context.Context, string) error
+	Subscribe() (<-chan cache.Change, func())
 }
 
 type artistCache interface {
     GetArtists() []data.Artist
-	AddArtist(data.Artist) (*data.Artist, error)
-	UpdateArtist(string, data.Artist) error
-	DeleteArtist(string) error
+	AddArtist(context.Context, data.Artist) (*data.Artist, error)
+	UpdateArtist(context.Context, string, data.Artist) error
+	DeleteArtist(context.Context, string, cache.DeleteOptions) error
 	RefreshArtists() error
+	FindDuplicateArtists() [][]data.Artist
+	MergeArtists(context.Context, string, []string) error
 }
 
 type venueCache interface {
     GetVenues() []data.Venue
-	AddVenue(data.Venue) (*data.Venue, error)
-	UpdateVenue(string, data.Venue) error
-	DeleteVenue(string) error
+	AddVenue(context.Context, data.Venue) (*data.Venue, error)
+	UpdateVenue(context.Context, string, data.Venue) error
+	DeleteVenue(context.Context, string, cache.DeleteOptions) error
 	RefreshVenues() error
+	FindDuplicateVenues() [][]data.Venue
+	MergeVenues(context.Context, string, []string) error
+}
+
+type trashCache interface {
+	GetTrash() (data.Trash, error)
+	RestoreEvent(context.Context, string) error
+	PurgeEvent(context.Context, string) error
+	RestoreArtist(context.Context, string) error
+	PurgeArtist(context.Context, string) error
+	RestoreVenue(context.Context, string) error
+	PurgeVenue(context.Context, string) error
+}
+
+type offlineDatabase interface {
+	Status() offline.Status
+	Sync(context.Context) (int, error)
+	ClearConflicts() error
+}
+
+type auditLog interface {
+	ListAuditEntries(context.Context, string, string) ([]data.AuditEntry, error)
 }
 
 type upcomingEventsCache interface {
-    GetUpcomingEvents() []data.EventDetails
-	ChangeLocation(string, string)
-	GetLocation() cache.Location
-	RefreshUpcomingEvents() error
+    UpcomingEventsFor(cache.Location, bool) cache.UpcomingEvents
+	RefreshUpcomingEvents(cache.Location) error
+	AnnouncementsSince(cache.Location, time.Time) []cache.Announcement
+	Subscribe() (<-chan cache.Change, func())
 }
 
 type recommendationCache interface {
-    GetRecommendedEvents(cache.Threshold) []data.EventRank
+    RecommendedEventsFor(cache.Location, cache.Threshold, bool) cache.RecommendedEvents
+}
+
+type jobScheduler interface {
+	Status() []scheduler.Status
 }
 
 const port = ":3001"
@@ -66,16 +134,31 @@ func (s *Server) StartServer() {
 	http.HandleFunc("/v1/upload", s.handleRequest(s.handleUpload))
 	http.HandleFunc("/v1/events/upcoming", s.handleRequest(s.getUpcomingEvents))
 	http.HandleFunc("/v1/events/upcoming/refresh", s.handleRequest(s.refreshUpcomingEvents))
+	http.HandleFunc("/v1/events/upcoming/changes", s.handleRequest(s.getUpcomingChanges))
 	http.HandleFunc("/v1/events/recommended", s.handleRequest(s.getRecommendations))
 	http.HandleFunc("/v1/events/saved", s.handleRequest(s.handleSavedEvents))
 	http.HandleFunc("/v1/events/saved/", s.handleRequest(s.handleSavedEvents))
 	http.HandleFunc("/v1/events/saved/refresh", s.handleRequest(s.refreshSavedEvents))
+	http.HandleFunc("/v1/events/saved/query", s.handleRequest(s.querySavedEvents))
 	http.HandleFunc("/v1/venues", s.handleRequest(s.handleVenues))
 	http.HandleFunc("/v1/venues/", s.handleRequest(s.handleVenues))
 	http.HandleFunc("/v1/venues/refresh", s.handleRequest(s.refreshVenues))
 	http.HandleFunc("/v1/artists", s.handleRequest(s.handleArtists))
 	http.HandleFunc("/v1/artists/", s.handleRequest(s.handleArtists))
 	http.HandleFunc("/v1/artists/refresh", s.handleRequest(s.refreshArtists))
+	http.HandleFunc("/v1/admin/integrity", s.handleRequest(s.handleIntegrity))
+	http.HandleFunc("/v1/admin/integrity/", s.handleRequest(s.handleIntegrity))
+	http.HandleFunc("/v1/admin/duplicates/artists", s.handleRequest(s.handleDuplicateArtists))
+	http.HandleFunc("/v1/admin/duplicates/venues", s.handleRequest(s.handleDuplicateVenues))
+	http.HandleFunc("/v1/trash", s.handleRequest(s.handleTrash))
+	http.HandleFunc("/v1/trash/", s.handleRequest(s.handleTrash))
+	http.HandleFunc("/v1/audit", s.handleRequest(s.getAuditEntries))
+	http.HandleFunc("/v1/admin/sync", s.handleRequest(s.handleSync))
+	http.HandleFunc("/v1/admin/sync/conflicts", s.handleRequest(s.clearSyncConflicts))
+	http.HandleFunc("/v1/admin/backup", s.handleRequest(s.getBackup))
+	http.HandleFunc("/v1/admin/restore", s.handleRequest(s.restoreBackup))
+	http.HandleFunc("/v1/admin/jobs", s.handleRequest(s.getJobs))
+	http.HandleFunc("/v1/stream", s.handleRequest(s.streamChanges))
 //	http.Handle("/spotify/callback", &spotify.SpotifyAuthHandler{})
 
 	log.Info("Starting server on port", port)
@@ -89,10 +172,22 @@ func (s *Server) handleRequest(f handlerFunc) func(http.ResponseWriter, *http.Re
 		id := time.Now().Nanosecond()
 		log.Infof("Received request (%s) %s, assigned ID: %d", r.Method, r.URL, id)
 		startTs := time.Now()
+		user, status, err := s.requestUser(r)
+		if err != nil {
+			log.Errorf("Rejecting request ID %d, %v", id, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		r = r.WithContext(db.WithUser(db.WithActor(r.Context(), requestActor(r)), user))
 		body, status, err := f(w, r)
 		if err != nil {
 			log.Errorf("Error processing request ID %d: %v", id, err)
-			http.Error(w, err.Error(), status)
+			if body == nil {
+				http.Error(w, err.Error(), status)
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+			}
 		}
 		if body != nil {
 			json.NewEncoder(w).Encode(body)
@@ -100,3 +195,48 @@ func (s *Server) handleRequest(f handlerFunc) func(http.ResponseWriter, *http.Re
 		log.Infof("Finished processing request ID %d in %v ms", id, time.Since(startTs).Milliseconds())
 	}
 }
+
+const (
+	// Requests without the header act for the default user, which owns everything saved before there were users
+	userHeader       = "X-User"
+	proxyTokenHeader = "X-Proxy-Token"
+)
+
+// Anyone can set the user header, so it's only trusted from the proxy, and once a proxy is configured
+// every request has to come through it
+func (s *Server) requestUser(r *http.Request) (string, int, error) {
+	user := r.Header.Get(userHeader)
+	if s.ProxyToken == "" {
+		if user != "" {
+			return "", http.StatusForbidden, errors.New(userHeader + " header is only accepted from a trusted proxy")
+		}
+		return db.DefaultUser, 0, nil
+	}
+	token := r.Header.Get(proxyTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.ProxyToken)) != 1 {
+		return "", http.StatusUnauthorized, errors.New("missing or invalid " + proxyTokenHeader + " header")
+	}
+	if user == "" {
+		return db.DefaultUser, 0, nil
+	}
+	if !db.ValidUserId(user) {
+		return "", http.StatusBadRequest, fmt.Errorf("invalid %s header %q", userHeader, user)
+	}
+	return user, 0, nil
+}
+
+func (s *Server) userCache(r *http.Request) (userCache, error) {
+	savedCache, err := s.Caches.For(db.User(r.Context()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved events: %v", err)
+	}
+	return savedCache, nil
+}
+
+// Changes are attributed to the client address, along with the user agent when there is one
+func requestActor(r *http.Request) string {
+	if agent := r.UserAgent(); agent != "" {
+		return fmt.Sprintf("http %s (%s)", r.RemoteAddr, agent)
+	}
+	return "http " + r.RemoteAddr
+}
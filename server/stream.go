@@ -0,0 +1,79 @@
+package server
+
+import (
+	"concert-manager/cache"
+	"concert-manager/log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// How often an idle stream sends a comment, so proxies don't close it
+const streamKeepAlive = 30 * time.Second
+
+// GET /v1/stream pushes Server-Sent Events until the client disconnects. Each change to the saved
+// events, artists or venues of the user, and each finished upcoming events or recommendations refresh,
+// is sent as an event named after the change kind, with the change as JSON data
+func (s *Server) streamChanges(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, http.StatusInternalServerError, errors.New("streaming is not supported")
+	}
+	savedCache, err := s.userCache(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	savedChanges, cancelSaved := savedCache.Subscribe()
+	defer cancelSaved()
+	upcomingChanges, cancelUpcoming := s.UpcomingEventsCache.Subscribe()
+	defer cancelUpcoming()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var change cache.Change
+		select {
+		case <-r.Context().Done():
+			log.Debug("Client disconnected from change stream")
+			return nil, 0, nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil, 0, nil
+			}
+			flusher.Flush()
+			continue
+		case change, ok = <-savedChanges:
+		case change, ok = <-upcomingChanges:
+		}
+		if !ok {
+			return nil, 0, nil
+		}
+		if err := writeChange(w, change); err != nil {
+			log.Debug("Failed to write to change stream, closing it:", err)
+			return nil, 0, nil
+		}
+		flusher.Flush()
+		keepAlive.Reset(streamKeepAlive)
+	}
+}
+
+func writeChange(w http.ResponseWriter, change cache.Change) error {
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", change.Kind, body)
+	return err
+}
@@ -3,12 +3,18 @@ package server
 import (
 	"concert-manager/cache"
 	"concert-manager/log"
+	"concert-manager/util"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Set to true when expired events were returned while they are refreshed, which ?wait=true waits for instead
+const refreshingHeader = "X-Refreshing"
+
 var thresholdOpts = map[string]cache.Threshold{
 	"low": cache.LowThreshold,
 	"medium": cache.MediumThreshold,
@@ -28,9 +34,19 @@ func (s *Server) getRecommendations(w http.ResponseWriter, r *http.Request) (any
 		return nil, http.StatusBadRequest, errors.New(errMsg)
 	}
 
-	log.Info("Received GET recommendations request")
-	recs := s.RecommendationCache.GetRecommendedEvents(threshold)
-	return recs, 0, nil
+	loc, err := locationParams(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	wait, err := waitParam(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	log.Info("Received GET recommendations request for", loc)
+	recs := s.RecommendationCache.RecommendedEventsFor(loc, threshold, wait)
+	w.Header().Set(refreshingHeader, strconv.FormatBool(recs.Refreshing))
+	return recs.Ranks, 0, nil
 }
 
 func (s *Server) getUpcomingEvents(w http.ResponseWriter, r *http.Request) (any, int, error) {
@@ -38,8 +54,17 @@ func (s *Server) getUpcomingEvents(w http.ResponseWriter, r *http.Request) (any,
 		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
 	}
 
-	events := s.UpcomingEventsCache.GetUpcomingEvents()
-	return events, 0, nil
+	loc, err := locationParams(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	wait, err := waitParam(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	upcoming := s.UpcomingEventsCache.UpcomingEventsFor(loc, wait)
+	w.Header().Set(refreshingHeader, strconv.FormatBool(upcoming.Refreshing))
+	return upcoming.Events, 0, nil
 }
 
 func (s *Server) refreshUpcomingEvents(w http.ResponseWriter, r *http.Request) (any, int, error) {
@@ -47,10 +72,70 @@ func (s *Server) refreshUpcomingEvents(w http.ResponseWriter, r *http.Request) (
 		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
 	}
 
-	err := s.UpcomingEventsCache.RefreshUpcomingEvents()
+	loc, err := locationParams(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err = s.UpcomingEventsCache.RefreshUpcomingEvents(loc)
 	if err != nil {
 		log.Errorf("Failed to refresh upcoming events %v", err)
 		return nil, http.StatusInternalServerError, errors.New("failed to refresh upcoming event cache")
 	}
 	return nil, 0, nil
 }
+
+// Announcements default to the last week
+const defaultChangesPeriod = 7 * 24 * time.Hour
+
+// GET /v1/events/upcoming/changes lists the upcoming events that were announced, removed, rescheduled
+// or had their lineup changed since the since query param, newest first. It takes a timestamp like
+// 2024-05-01T15:04:05Z or a date like 5/1/2024, and defaults to a week ago
+func (s *Server) getUpcomingChanges(w http.ResponseWriter, r *http.Request) (any, int, error) {
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("unsupported method")
+	}
+	loc, err := locationParams(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	since := time.Now().Add(-defaultChangesPeriod)
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		if ts, err := time.Parse(time.RFC3339, sinceParam); err == nil {
+			since = ts
+		} else if util.ValidDate(sinceParam) {
+			since = util.Timestamp(sinceParam)
+		} else {
+			return nil, http.StatusBadRequest, errors.New("invalid since query param, expected an RFC 3339 timestamp or m/d/yyyy")
+		}
+	}
+	return s.UpcomingEventsCache.AnnouncementsSince(loc, since), 0, nil
+}
+
+// The city and state query params, which go together. Requests without them get the default location
+func locationParams(r *http.Request) (cache.Location, error) {
+	city := strings.TrimSpace(r.URL.Query().Get("city"))
+	state := strings.TrimSpace(r.URL.Query().Get("state"))
+	if city == "" && state == "" {
+		return cache.DefaultLocation(), nil
+	}
+	if city == "" || state == "" {
+		return cache.Location{}, errors.New("city and state must be given together")
+	}
+	if len(state) != 2 {
+		return cache.Location{}, fmt.Errorf("invalid state: %s. Expected a two letter state code", state)
+	}
+	return cache.Location{City: city, StateCode: strings.ToUpper(state)}, nil
+}
+
+func waitParam(r *http.Request) (bool, error) {
+	waitParam := r.URL.Query().Get("wait")
+	if waitParam == "" {
+		return false, nil
+	}
+	wait, err := strconv.ParseBool(waitParam)
+	if err != nil {
+		return false, errors.New("invalid wait query param, expected true or false")
+	}
+	return wait, nil
+}
@@ -32,6 +32,8 @@ func Start(savedCache *cache.SavedEventCache, upcomingCache *cache.UpcomingEvent
 	savedEventViewScreen.AddEventScreen = addScreen
 	savedEventViewScreen.SearchResultScreen = savedEventSearchResultScreen
 	savedEventViewScreen.Cache = savedCache
+	savedChanges, _ := savedCache.Subscribe()
+	savedEventViewScreen.Watch(savedChanges)
 
 	discoverySearchResultScreen := screens.NewDiscoverySearchResultScreen()
 	discoverySearchResultScreen.AddEventScreen = addScreen
@@ -40,22 +42,43 @@ func Start(savedCache *cache.SavedEventCache, upcomingCache *cache.UpcomingEvent
 	discoveryViewScreen.AddEventScreen = addScreen
 	discoveryViewScreen.SearchResultScreen = discoverySearchResultScreen
 	discoveryViewScreen.Cache = upcomingCache
+	upcomingChanges, _ := upcomingCache.Subscribe()
+	discoveryViewScreen.Watch(upcomingChanges)
 
 	recommendedViewScreen := screens.NewRecommendationScreen()
 	recommendedViewScreen.AddEventScreen = addScreen
 	recommendedViewScreen.RecommendationCache = upcomingCache
 	recommendedViewScreen.SavedCache = savedCache
+	recommendedViewScreen.Location = discoveryViewScreen.Location
+
+	announcementScreen := screens.NewAnnouncementScreen()
+	announcementScreen.AddEventScreen = addScreen
+	announcementScreen.Cache = upcomingCache
+	announcementScreen.Location = discoveryViewScreen.Location
 
 	discoveryMenuScreen := screens.NewDiscoveryMenu()
 	discoveryMenuScreen.DiscoveryViewScreen = discoveryViewScreen
 	discoveryMenuScreen.RecommendationViewScreen = recommendedViewScreen
+	discoveryMenuScreen.AnnouncementViewScreen = announcementScreen
 
 	passedEventsScreen := screens.NewPassedEventManager()
 	passedEventsScreen.Cache = savedCache
 	passedEventsScreen.AddEventScreen = addScreen
 
+	integrityScreen := screens.NewIntegrityManager()
+	integrityScreen.Cache = savedCache
+
+	duplicateScreen := screens.NewDuplicateMerger()
+	duplicateScreen.Cache = savedCache
+
+	trashScreen := screens.NewTrashManager()
+	trashScreen.Cache = savedCache
+
 	utilityMenuScreen := screens.NewUtilMenu()
 	utilityMenuScreen.PassedEventManager = passedEventsScreen
+	utilityMenuScreen.IntegrityManager = integrityScreen
+	utilityMenuScreen.DuplicateMerger = duplicateScreen
+	utilityMenuScreen.TrashManager = trashScreen
 
 	mainMenuScreen := screens.NewMainMenu()
 	mainMenuScreen.Children[1] = savedEventViewScreen
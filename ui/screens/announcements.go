@@ -0,0 +1,145 @@
+package screens
+
+import (
+	"concert-manager/cache"
+	"concert-manager/data"
+	"concert-manager/ui/input"
+	"concert-manager/ui/output"
+	"concert-manager/util"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type announcementCache interface {
+	AnnouncementsSince(cache.Location, time.Time) []cache.Announcement
+}
+
+type AnnouncementViewer struct {
+	AddEventScreen *EventAdder
+	Cache          announcementCache
+	// shared with the other discovery screens
+	Location      *cache.Location
+	actions       []string
+	announcements []cache.Announcement
+	days          int
+	page          int
+	loaded        bool
+}
+
+const (
+	nextAnnouncementPage = iota + 1
+	prevAnnouncementPage
+	saveAnnouncedEvent
+	changeAnnouncementPeriod
+	announcementsToMenu
+)
+
+const (
+	defaultAnnouncementDays = 7
+	maxAnnouncementDays     = 60
+)
+
+func NewAnnouncementScreen() *AnnouncementViewer {
+	view := AnnouncementViewer{}
+	view.actions = []string{"Next Page", "Prev Page", "Save Event", "Change Period", "Discovery Menu"}
+	view.days = defaultAnnouncementDays
+	location := cache.DefaultLocation()
+	view.Location = &location
+	return &view
+}
+
+func (v *AnnouncementViewer) Title() string {
+	return "New Announcements"
+}
+
+func (v *AnnouncementViewer) DisplayData() {
+	if !v.loaded {
+		since := time.Now().AddDate(0, 0, -v.days)
+		v.announcements = v.Cache.AnnouncementsSince(*v.Location, since)
+		v.page = 0
+		v.loaded = true
+	}
+
+	var announcementData strings.Builder
+	announcementData.WriteString(fmt.Sprintf("Changes in %s over the last %d days\n", *v.Location, v.days))
+	announcementData.WriteString(fmt.Sprintf("Page %d/%d\n", v.page+1, v.numPages()))
+	if len(v.announcements) == 0 {
+		announcementData.WriteString("(none)")
+		output.Displayln(announcementData.String())
+		return
+	}
+
+	start := v.page * pageSize
+	end := min(start+pageSize, len(v.announcements))
+	for _, announcement := range v.announcements[start:end] {
+		announcementData.WriteString(formatAnnouncementKind(announcement))
+		announcementData.WriteString(" ")
+		announcementData.WriteString(util.FormatEventDetails(announcement.Event))
+	}
+	output.Displayln(announcementData.String())
+}
+
+func formatAnnouncementKind(a cache.Announcement) string {
+	switch a.Kind {
+	case cache.Announced:
+		return "[NEW]"
+	case cache.Removed:
+		return "[REMOVED]"
+	case cache.Rescheduled:
+		if a.Previous != nil {
+			return fmt.Sprintf("[MOVED FROM %s]", util.FormatDate(a.Previous.Event.Date))
+		}
+		return "[MOVED]"
+	case cache.LineupChanged:
+		return "[LINEUP CHANGED]"
+	}
+	return "[CHANGED]"
+}
+
+func (v *AnnouncementViewer) Actions() []string {
+	return v.actions
+}
+
+func (v *AnnouncementViewer) NextScreen(i int) Screen {
+	switch i {
+	case nextAnnouncementPage:
+		if (v.page + 1) < v.numPages() {
+			v.page++
+		}
+	case prevAnnouncementPage:
+		if v.page > 0 {
+			v.page--
+		}
+	case saveAnnouncedEvent:
+		// removed events are likely cancelled, so they aren't worth saving
+		events := []data.EventDetails{}
+		for _, announcement := range v.announcements {
+			if announcement.Kind != cache.Removed {
+				events = append(events, announcement.Event)
+			}
+		}
+		selectScreen := &Selector[data.EventDetails]{
+			ScreenTitle: "Select Event",
+			Next:        v.AddEventScreen,
+			Options:     events,
+			HandleSelect: func(e data.EventDetails) {
+				v.AddEventScreen.newEvent = e.Event
+			},
+			Formatter: util.FormatEventDetailsShort,
+		}
+		return selectScreen
+	case changeAnnouncementPeriod:
+		v.days = input.PromptAndGetInputNumeric("number of days", 1, maxAnnouncementDays+1)
+		v.loaded = false
+	case announcementsToMenu:
+		v.loaded = false
+		return nil
+	}
+	return v
+}
+
+func (v *AnnouncementViewer) numPages() int {
+	return int(math.Ceil(float64(len(v.announcements)) / float64(pageSize)))
+}
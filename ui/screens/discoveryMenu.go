@@ -3,18 +3,20 @@ package screens
 type DiscoveryMenu struct {
 	DiscoveryViewScreen      Screen
 	RecommendationViewScreen Screen
+	AnnouncementViewScreen   Screen
 	actions                  []string
 }
 
 const (
 	viewAllUpcoming = iota + 1
 	viewRecommended
+	viewAnnouncements
 	discoveryMenuToMainMenu
 )
 
 func NewDiscoveryMenu() *DiscoveryMenu {
 	menu := DiscoveryMenu{}
-	menu.actions = []string{"All Upcoming Events", "Recommended Events", "Main Menu"}
+	menu.actions = []string{"All Upcoming Events", "Recommended Events", "New Announcements", "Main Menu"}
 	return &menu
 }
 
@@ -32,6 +34,8 @@ func (m DiscoveryMenu) NextScreen(i int) Screen {
 		return m.DiscoveryViewScreen
 	case viewRecommended:
 		return m.RecommendationViewScreen
+	case viewAnnouncements:
+		return m.AnnouncementViewScreen
 	case discoveryMenuToMainMenu:
 		return nil
 	}
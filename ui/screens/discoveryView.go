@@ -11,23 +11,26 @@ import (
 	"math"
 	"slices"
 	"strings"
+	"sync/atomic"
 )
 
 type eventRetrievalCache interface {
-	GetUpcomingEvents() []data.EventDetails
-	Invalidate()
-	ChangeLocation(string, string)
-	GetLocation() cache.Location
+	GetUpcomingEvents(cache.Location) []data.EventDetails
+	Invalidate(cache.Location)
 }
 
 type DiscoveryViewer struct {
 	SearchResultScreen *DiscoverySearchResult
 	AddEventScreen     *EventAdder
 	Cache              eventRetrievalCache
+	// shared with the recommendations and announcements, so changing it in one screen changes them all
+	Location           *cache.Location
 	actions            []string
 	events             []data.EventDetails
 	sortType           sortType
 	page               int
+	// set when upcoming events were refreshed after the events were read
+	stale              atomic.Bool
 }
 
 const (
@@ -47,24 +50,43 @@ func NewDiscoveryViewScreen() *DiscoveryViewer {
 	view.actions = []string{"Next Page", "Prev Page", "Goto Page", "Toggle Sort",
 		"Save Event", "Search Events", "Change Location", "Refresh Events", "Discovery Menu"}
 	view.sortType = dateAsc
+	location := cache.DefaultLocation()
+	view.Location = &location
 	return &view
 }
 
-func (v DiscoveryViewer) Title() string {
+func (v *DiscoveryViewer) Title() string {
 	return "All Upcoming Events"
 }
 
 func (v *DiscoveryViewer) Refresh() {
-	output.Displayf("Retrieving events for %s...", v.Cache.GetLocation())
-	v.events = v.Cache.GetUpcomingEvents() // ignore possible refresh, this view maintains its own state
+	output.Displayf("Retrieving events for %s...", *v.Location)
+	v.stale.Store(false)
+	v.events = v.Cache.GetUpcomingEvents(*v.Location)
 	v.sort()
 	v.page = 0
 	output.ClearCurrentLine()
 }
 
+// Marks the events as stale whenever upcoming events are refreshed, like by the HTTP API or an
+// expired cache, so they are read again before they are next displayed
+func (v *DiscoveryViewer) Watch(changes <-chan cache.Change) {
+	go func() {
+		for change := range changes {
+			if change.Kind == cache.UpcomingRefreshed {
+				v.stale.Store(true)
+			}
+		}
+	}()
+}
+
 func (v *DiscoveryViewer) DisplayData() {
 	if v.events == nil {
 		v.Refresh()
+	} else if v.stale.Load() {
+		page := v.page
+		v.Refresh()
+		v.page = min(page, max(v.numPages()-1, 0))
 	}
 
 	var eventData strings.Builder
@@ -89,7 +111,7 @@ func (v *DiscoveryViewer) DisplayData() {
 	output.Displayln(eventData.String())
 }
 
-func (v DiscoveryViewer) Actions() []string {
+func (v *DiscoveryViewer) Actions() []string {
 	return v.actions
 }
 
@@ -153,7 +175,7 @@ func (v *DiscoveryViewer) NextScreen(i int) Screen {
 	case changeLocation:
 		v.changeLocation()
 	case refreshEvents:
-		v.Cache.Invalidate()
+		v.Cache.Invalidate(*v.Location)
 		v.events = nil
 	case discoveryViewToMenu:
 		v.page = 0
@@ -165,11 +187,11 @@ func (v *DiscoveryViewer) NextScreen(i int) Screen {
 func (v *DiscoveryViewer) changeLocation() {
 	city := input.PromptAndGetInput("city", input.OnlyLettersOrSpacesValidation)
 	state := input.PromptAndGetInput("state code", input.StateValidation)
-	v.Cache.ChangeLocation(city, state)
+	*v.Location = cache.Location{City: city, StateCode: state}
 	v.events = nil
 }
 
-func (v DiscoveryViewer) numPages() int {
+func (v *DiscoveryViewer) numPages() int {
 	return int(math.Ceil(float64(len(v.events)) / float64(pageSize)))
 }
 
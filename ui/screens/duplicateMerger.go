@@ -0,0 +1,148 @@
+package screens
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"concert-manager/ui/output"
+	"concert-manager/util"
+	"context"
+)
+
+type duplicateCache interface {
+	FindDuplicateArtists() [][]data.Artist
+	FindDuplicateVenues() [][]data.Venue
+	MergeArtists(context.Context, string, []string) error
+	MergeVenues(context.Context, string, []string) error
+}
+
+type duplicateRecord struct {
+	id    string
+	label string
+}
+
+type duplicateGroup struct {
+	entity  string
+	records []duplicateRecord
+}
+
+type DuplicateMerger struct {
+	Cache        duplicateCache
+	actions      []string
+	groups       []duplicateGroup
+	currentGroup *duplicateGroup
+	loaded       bool
+}
+
+const (
+	mergeDuplicates = iota + 1
+	skipDuplicates
+	duplicatesToMenu
+)
+
+func NewDuplicateMerger() *DuplicateMerger {
+	template := DuplicateMerger{}
+	template.actions = []string{"Merge", "Skip", "Utility Menu"}
+	return &template
+}
+
+func (m DuplicateMerger) Title() string {
+	return "Merge Duplicates"
+}
+
+func (m *DuplicateMerger) DisplayData() {
+	if !m.loaded {
+		m.loadGroups()
+		m.loaded = true
+	}
+
+	m.currentGroup = nil
+	if len(m.groups) == 0 {
+		output.Displayln("No duplicates found")
+		return
+	}
+
+	m.currentGroup = &m.groups[len(m.groups)-1]
+	output.Displayf("Possible duplicate %ss (%d groups remaining)\n", m.currentGroup.entity, len(m.groups))
+	for _, record := range m.currentGroup.records {
+		output.Displayln(record.label)
+	}
+}
+
+func (m *DuplicateMerger) loadGroups() {
+	m.groups = []duplicateGroup{}
+	for _, artists := range m.Cache.FindDuplicateArtists() {
+		group := duplicateGroup{entity: "artist"}
+		for _, artist := range artists {
+			group.records = append(group.records, duplicateRecord{artist.Id, util.FormatArtist(artist)})
+		}
+		m.groups = append(m.groups, group)
+	}
+	for _, venues := range m.Cache.FindDuplicateVenues() {
+		group := duplicateGroup{entity: "venue"}
+		for _, venue := range venues {
+			group.records = append(group.records, duplicateRecord{venue.Id, util.FormatVenue(venue)})
+		}
+		m.groups = append(m.groups, group)
+	}
+}
+
+func (m DuplicateMerger) Actions() []string {
+	return m.actions
+}
+
+func (m *DuplicateMerger) NextScreen(i int) Screen {
+	switch i {
+	case mergeDuplicates:
+		if m.currentGroup == nil {
+			output.Displayln("No duplicates to merge")
+			return m
+		}
+
+		group := *m.currentGroup
+		return &Selector[duplicateRecord]{
+			ScreenTitle: "Select Record to Keep",
+			Next:        m,
+			Options:     group.records,
+			HandleSelect: func(survivor duplicateRecord) {
+				m.merge(group, survivor)
+			},
+			Formatter: func(records []duplicateRecord) []string {
+				labels := []string{}
+				for _, record := range records {
+					labels = append(labels, record.label)
+				}
+				return labels
+			},
+		}
+	case skipDuplicates:
+		if m.currentGroup != nil {
+			m.groups = m.groups[:len(m.groups)-1]
+		}
+	case duplicatesToMenu:
+		m.loaded = false
+		return nil
+	}
+	return m
+}
+
+func (m *DuplicateMerger) merge(group duplicateGroup, survivor duplicateRecord) {
+	duplicateIds := []string{}
+	for _, record := range group.records {
+		if record.id != survivor.id {
+			duplicateIds = append(duplicateIds, record.id)
+		}
+	}
+
+	var err error
+	if group.entity == "artist" {
+		err = m.Cache.MergeArtists(tuiContext, survivor.id, duplicateIds)
+	} else {
+		err = m.Cache.MergeVenues(tuiContext, survivor.id, duplicateIds)
+	}
+	if err != nil {
+		log.Errorf("Failed to merge %ss %v into %v, %v", group.entity, duplicateIds, survivor.id, err)
+		output.Displayf("Failed to merge %ss: %v\n", group.entity, err)
+		return
+	}
+	m.groups = m.groups[:len(m.groups)-1]
+}
@@ -6,11 +6,13 @@ import (
 	"concert-manager/ui/input"
 	"concert-manager/ui/output"
 	"concert-manager/util"
+	"context"
 	"slices"
 )
 
 type eventAddCache interface {
-	AddSavedEvent(data.Event) (*data.Event, error)
+	AddSavedEvent(context.Context, data.Event) (*data.Event, error)
+	UpdateSavedEvent(context.Context, string, data.Event) error
 }
 
 type artistEditor interface {
@@ -24,16 +26,17 @@ type venueEditor interface {
 }
 
 type EventAdder struct {
-	newEvent         data.Event
-	dateType         dateType
-	ArtistEditor     artistEditor
-	VenueEditor      venueEditor
-	Cache            eventAddCache
-	actions          []string
-	beforeSaveAction extraAction
+	newEvent        data.Event
+	editId          string
+	dateType        dateType
+	ArtistEditor    artistEditor
+	VenueEditor     venueEditor
+	Cache           eventAddCache
+	actions         []string
+	afterSaveAction extraAction
 }
 
-type extraAction func() error
+type extraAction func()
 
 const (
 	editMainAct = iota + 1
@@ -70,8 +73,20 @@ func NewEventAddScreen() *EventAdder {
 	return &a
 }
 
-func (a *EventAdder) WithBeforeSaveAction(action extraAction) {
-	a.beforeSaveAction = action
+// saving will update the existing event in place instead of adding a new one
+func (a *EventAdder) WithEditedEvent(event data.Event) {
+	a.newEvent = event
+	a.newEvent.Openers = slices.Clone(event.Openers)
+	a.editId = event.Id
+	if util.FutureDate(event.Date) {
+		a.dateType = future
+	} else {
+		a.dateType = past
+	}
+}
+
+func (a *EventAdder) WithAfterSaveAction(action extraAction) {
+	a.afterSaveAction = action
 }
 
 func (a EventAdder) Title() string {
@@ -136,22 +151,25 @@ func (a *EventAdder) NextScreen(i int) Screen {
 			a.newEvent.Purchased = !a.newEvent.Purchased
 		}
 	case saveEvent:
-		if a.beforeSaveAction != nil {
-			if err := a.beforeSaveAction(); err != nil {
-				log.Error("Before save action failed:", err)
+		if a.editId != "" {
+			if err := a.Cache.UpdateSavedEvent(tuiContext, a.editId, a.newEvent); err != nil {
+				log.Error("Failed to update edited event:", err)
 				output.Displayf("Failed to save event: %v\n", err)
 				return a
 			}
-		}
-		if _, err := a.Cache.AddSavedEvent(a.newEvent); err != nil {
+		} else if _, err := a.Cache.AddSavedEvent(tuiContext, a.newEvent); err != nil {
 			output.Displayf("Failed to save event: %v\n", err)
 			return a
 		}
+		if a.afterSaveAction != nil {
+			a.afterSaveAction()
+		}
 		fallthrough
 	case cancelAddEvent:
 		a.newEvent = data.Event{}
+		a.editId = ""
 		a.dateType = future
-		a.beforeSaveAction = nil
+		a.afterSaveAction = nil
 		return nil
 	}
 	return a
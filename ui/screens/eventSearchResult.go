@@ -5,6 +5,7 @@ import (
 	"concert-manager/ui/input"
 	"concert-manager/ui/output"
 	"concert-manager/util"
+	"context"
 	"fmt"
 	"math"
 	"slices"
@@ -12,7 +13,7 @@ import (
 )
 
 type eventSearchResultCache interface {
-	DeleteSavedEvent(string) error
+	DeleteSavedEvent(context.Context, string) error
 }
 
 type EventSearchResult struct {
@@ -101,7 +102,7 @@ func (s *EventSearchResult) NextScreen(i int) Screen {
 			Next:        s,
 			Options:     s.Events[startIdx : endIdx],
 			HandleSelect: func(e data.Event) {
-				if err := s.Cache.DeleteSavedEvent(e.Id); err != nil {
+				if err := s.Cache.DeleteSavedEvent(tuiContext, e.Id); err != nil {
 					output.Displayf("Failed to delete event: %v\n", err)
 				}
 				s.Events = slices.DeleteFunc(s.Events, e.Equals)
@@ -1,20 +1,25 @@
 package screens
 
 import (
+	"concert-manager/cache"
 	"concert-manager/data"
 	"concert-manager/log"
 	"concert-manager/ui/input"
 	"concert-manager/ui/output"
 	"concert-manager/util"
+	"context"
 	"fmt"
 	"math"
 	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type eventViewCache interface {
 	GetSavedEvents() []data.Event
-	DeleteSavedEvent(string) error
+	EventsBetween(time.Time, time.Time) []data.Event
+	DeleteSavedEvent(context.Context, string) error
 }
 
 type SavedEventViewer struct {
@@ -25,6 +30,8 @@ type SavedEventViewer struct {
 	sortType           sortType
 	events             []data.Event
 	page               int
+	// set when the cache changed after the events were read
+	stale              atomic.Bool
 }
 
 const (
@@ -33,6 +40,7 @@ const (
 	gotoEventPage
 	toggleEventSort
 	addEvent
+	editEvent
 	deleteEvent
 	searchSavedEvents
 	eventViewToMainMenu
@@ -41,21 +49,37 @@ const (
 func NewSavedEventViewScreen() *SavedEventViewer {
 	view := SavedEventViewer{}
 	view.actions = []string{"Next Page", "Prev Page", "Goto Page", "Toggle Sort", "Add Event",
-		"Delete Event", "Search Events", "Main Menu"}
+		"Edit Event", "Delete Event", "Search Events", "Main Menu"}
 	view.sortType = dateAsc
 	return &view
 }
 
-func (v SavedEventViewer) Title() string {
+func (v *SavedEventViewer) Title() string {
 	return "All Saved Events"
 }
 
 func (v *SavedEventViewer) Refresh() {
+	v.stale.Store(false)
 	v.events = v.Cache.GetSavedEvents()
 	v.sort()
 }
 
-func (v SavedEventViewer) DisplayData() {
+// Marks the events as stale whenever the cache changes, including changes made through the HTTP API,
+// so they are read again before they are next displayed
+func (v *SavedEventViewer) Watch(changes <-chan cache.Change) {
+	go func() {
+		for range changes {
+			v.stale.Store(true)
+		}
+	}()
+}
+
+func (v *SavedEventViewer) DisplayData() {
+	if v.stale.Load() {
+		v.Refresh()
+		v.page = min(v.page, max(v.numPages()-1, 0))
+	}
+
 	var eventData strings.Builder
 	pageIndicator := fmt.Sprintf("Page %d/%d\n", v.page+1, v.numPages())
 	eventData.WriteString(pageIndicator)
@@ -76,7 +100,7 @@ func (v SavedEventViewer) DisplayData() {
 	output.Displayln(eventData.String())
 }
 
-func (v SavedEventViewer) Actions() []string {
+func (v *SavedEventViewer) Actions() []string {
 	return v.actions
 }
 
@@ -102,6 +126,19 @@ func (v *SavedEventViewer) NextScreen(i int) Screen {
 		v.page = 0
 	case addEvent:
 		return v.AddEventScreen
+	case editEvent:
+		startIdx := v.page * pageSize
+		endIdx := int(math.Min(float64(startIdx + pageSize), float64(len(v.events))))
+		selectScreen := &Selector[data.Event]{
+			ScreenTitle: "Select Event to Edit",
+			Next:        v.AddEventScreen,
+			Options:     v.events[startIdx : endIdx],
+			HandleSelect: func(e data.Event) {
+				v.AddEventScreen.WithEditedEvent(e)
+			},
+			Formatter: util.FormatEventsShort,
+		}
+		return selectScreen
 	case deleteEvent:
 		startIdx := v.page * pageSize
 		endIdx := int(math.Min(float64(startIdx + pageSize), float64(len(v.events))))
@@ -110,7 +147,7 @@ func (v *SavedEventViewer) NextScreen(i int) Screen {
 			Next:        v,
 			Options:     v.events[startIdx : endIdx],
 			HandleSelect: func(e data.Event) {
-				if err := v.Cache.DeleteSavedEvent(e.Id); err != nil {
+				if err := v.Cache.DeleteSavedEvent(tuiContext, e.Id); err != nil {
 					output.Displayf("Failed to delete event: %v\n", err)
 				}
 			},
@@ -120,10 +157,11 @@ func (v *SavedEventViewer) NextScreen(i int) Screen {
 	case searchSavedEvents:
 		const searchByArtist = "Search by Artist"
 		const searchByVenue = "Search by Venue"
+		const searchByDate = "Search by Date"
 		selectScreen := &Selector[string]{
 			ScreenTitle: "Select Search Type",
 			Next:        v.SearchResultScreen,
-			Options:     []string{searchByArtist, searchByVenue},
+			Options:     []string{searchByArtist, searchByVenue, searchByDate},
 			HandleSelect: func(s string) {
 				switch s {
 				case searchByArtist:
@@ -132,6 +170,10 @@ func (v *SavedEventViewer) NextScreen(i int) Screen {
 				case searchByVenue:
 					name := input.PromptAndGetInput("venue name to search", input.NoValidation)
 					v.SearchResultScreen.Events = util.SearchEventsByVenue(name, v.Cache.GetSavedEvents(), util.NoMaxResults, util.LenientTolerance)
+				case searchByDate:
+					from := input.PromptAndGetInput("first date to search (mm/dd/yyyy)", input.DateValidation)
+					to := input.PromptAndGetInput("last date to search (mm/dd/yyyy)", input.DateValidation)
+					v.SearchResultScreen.Events = v.Cache.EventsBetween(util.Timestamp(from), util.Timestamp(to))
 				default:
 					output.Display("Internal error! Check the logs")
 					log.Error("Invalid search type selection:", s)
@@ -148,7 +190,7 @@ func (v *SavedEventViewer) NextScreen(i int) Screen {
 	return v
 }
 
-func (v SavedEventViewer) numPages() int {
+func (v *SavedEventViewer) numPages() int {
 	return int(math.Ceil(float64(len(v.events)) / float64(pageSize)))
 }
 
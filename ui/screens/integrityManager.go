@@ -0,0 +1,104 @@
+package screens
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"concert-manager/ui/output"
+	"context"
+	"strings"
+)
+
+type integrityCache interface {
+	GetIntegrityIssues() ([]data.IntegrityIssue, error)
+	RepairEvent(context.Context, string) error
+	DeleteInvalidEvent(context.Context, string) error
+}
+
+type IntegrityManager struct {
+	Cache        integrityCache
+	actions      []string
+	issues       []data.IntegrityIssue
+	currentIssue *data.IntegrityIssue
+	loaded       bool
+}
+
+const (
+	repairIssue = iota + 1
+	deleteIssue
+	integrityToMenu
+)
+
+func NewIntegrityManager() *IntegrityManager {
+	template := IntegrityManager{}
+	template.actions = []string{"Repair Event", "Delete Event", "Utility Menu"}
+	return &template
+}
+
+func (m IntegrityManager) Title() string {
+	return "Check Data Integrity"
+}
+
+func (m *IntegrityManager) DisplayData() {
+	if !m.loaded {
+		issues, err := m.Cache.GetIntegrityIssues()
+		if err != nil {
+			log.Error("Failed to check data integrity:", err)
+			output.Displayln("Failed to check data integrity")
+			return
+		}
+		m.issues = issues
+		m.loaded = true
+	}
+
+	m.currentIssue = nil
+	if len(m.issues) == 0 {
+		output.Displayln("No invalid records found")
+		return
+	}
+
+	m.currentIssue = &m.issues[len(m.issues)-1]
+	output.Displayf("Invalid %s %s (%d remaining)\n", m.currentIssue.Entity, m.currentIssue.Id, len(m.issues))
+	output.Displayln(strings.Join(m.currentIssue.Problems, "\n"))
+	if !m.currentIssue.Repairable {
+		output.Displayln("This record can't be repaired and has to be deleted")
+	}
+}
+
+func (m IntegrityManager) Actions() []string {
+	return m.actions
+}
+
+func (m *IntegrityManager) NextScreen(i int) Screen {
+	switch i {
+	case repairIssue:
+		if m.currentIssue == nil {
+			output.Displayln("No record to repair")
+			return m
+		}
+
+		if err := m.Cache.RepairEvent(tuiContext, m.currentIssue.Id); err != nil {
+			log.Error("Failed to repair invalid event:", err)
+			output.Displayln("Failed to repair event")
+			return m
+		}
+
+		m.issues = m.issues[:len(m.issues)-1]
+	case deleteIssue:
+		if m.currentIssue == nil {
+			output.Displayln("No record to delete")
+			return m
+		}
+
+		if err := m.Cache.DeleteInvalidEvent(tuiContext, m.currentIssue.Id); err != nil {
+			log.Error("Failed to delete invalid event:", err)
+			output.Displayln("Failed to delete event")
+			return m
+		}
+
+		m.issues = m.issues[:len(m.issues)-1]
+	case integrityToMenu:
+		m.loaded = false
+		return nil
+	}
+	return m
+}
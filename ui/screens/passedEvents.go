@@ -5,12 +5,13 @@ import (
 	"concert-manager/log"
 	"concert-manager/ui/output"
 	"concert-manager/util"
+	"context"
 )
 
 type passedEventCache interface {
 	GetPassedSavedEvents() []data.Event
-	AddSavedEvent(data.Event) (*data.Event, error)
-	DeleteSavedEvent(string) error
+	UpdateSavedEvent(context.Context, string, data.Event) error
+	DeleteSavedEvent(context.Context, string) error
 }
 
 type PassedEventManager struct {
@@ -67,13 +68,10 @@ func (m *PassedEventManager) NextScreen(i int) Screen {
 		}
 
 		m.currentEvent.Purchased = true
-		if err := m.Cache.DeleteSavedEvent(m.currentEvent.Id); err != nil {
-			log.Error("Failed to delete passed event:", err)
-			output.Displayln("Failed to update event")
-		}
-		if _, err := m.Cache.AddSavedEvent(m.currentEvent); err != nil {
-			log.Error("Failed to add passed event after delete:", err)
+		if err := m.Cache.UpdateSavedEvent(tuiContext, m.currentEvent.Id, m.currentEvent); err != nil {
+			log.Error("Failed to mark passed event as attended:", err)
 			output.Displayln("Failed to update event")
+			return m
 		}
 
 		m.passedEvents = m.passedEvents[:len(m.passedEvents)-1]
@@ -83,16 +81,11 @@ func (m *PassedEventManager) NextScreen(i int) Screen {
 			return m
 		}
 
-		m.AddEventScreen.WithBeforeSaveAction(func() error {
-			if err := m.Cache.DeleteSavedEvent(m.currentEvent.Id); err != nil {
-				return err
-			}
+		m.currentEvent.Purchased = true
+		m.AddEventScreen.WithEditedEvent(m.currentEvent)
+		m.AddEventScreen.WithAfterSaveAction(func() {
 			m.passedEvents = m.passedEvents[:len(m.passedEvents)-1]
-			m.AddEventScreen.newEvent.Purchased = true
-			return nil
 		})
-		m.currentEvent.Purchased = true
-		m.AddEventScreen.newEvent = m.currentEvent
 		return m.AddEventScreen
 	case removePassedEvent:
 		if !m.currentEvent.Populated() {
@@ -100,7 +93,7 @@ func (m *PassedEventManager) NextScreen(i int) Screen {
 			return m
 		}
 
-		if err := m.Cache.DeleteSavedEvent(m.currentEvent.Id); err != nil {
+		if err := m.Cache.DeleteSavedEvent(tuiContext, m.currentEvent.Id); err != nil {
 			log.Error("Failed to delete passed event:", err)
 			output.Displayln("Failed to update event")
 		}
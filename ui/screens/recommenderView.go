@@ -13,10 +13,8 @@ import (
 )
 
 type recommendationCache interface {
-	GetRecommendedEvents(cache.Threshold) []data.EventRank
-	ChangeLocation(string, string)
-	GetLocation() cache.Location
-	Invalidate()
+	GetRecommendedEvents(cache.Location, cache.Threshold) []data.EventRank
+	Invalidate(cache.Location)
 }
 
 type savedEventCache interface {
@@ -27,6 +25,7 @@ type RecommendationViewer struct {
 	AddEventScreen      *EventAdder
 	RecommendationCache recommendationCache
 	SavedCache          savedEventCache
+	Location            *cache.Location
 	actions             []string
 	date                time.Time
 	recs                map[string][]data.EventRank
@@ -50,6 +49,8 @@ func NewRecommendationScreen() *RecommendationViewer {
 	view := RecommendationViewer{}
 	view.actions = []string{"Next Date", "Prev Date", "Goto Date", "Save Event", "Change Recommendation Threshold", "Change Location", "Refresh Events", "Discovery Menu"}
 	view.threshold = cache.LowThreshold
+	location := cache.DefaultLocation()
+	view.Location = &location
 	return &view
 }
 
@@ -58,8 +59,8 @@ func (v RecommendationViewer) Title() string {
 }
 
 func (v *RecommendationViewer) Refresh() {
-	output.Displayf("Retrieving recommendations for %s...", v.RecommendationCache.GetLocation())
-	events := v.RecommendationCache.GetRecommendedEvents(v.threshold)
+	output.Displayf("Retrieving recommendations for %s...", *v.Location)
+	events := v.RecommendationCache.GetRecommendedEvents(*v.Location, v.threshold)
 	log.Debugf("Found %v recommendations for threshold %s\n", len(events), v.threshold.Level())
 	v.recs = map[string][]data.EventRank{}
 	for _, e := range events {
@@ -227,7 +228,7 @@ func (v *RecommendationViewer) NextScreen(i int) Screen {
 	case changeRecLocation:
 		v.changeLocation()
 	case refreshRecommendations:
-		v.RecommendationCache.Invalidate()
+		v.RecommendationCache.Invalidate(*v.Location)
 		v.recs = nil
 	case recToDiscoveryMenu:
 		v.date = time.Time{}
@@ -251,7 +252,7 @@ func (v RecommendationViewer) getSavedEventsForDate(date time.Time) []data.Event
 func (v *RecommendationViewer) changeLocation() {
 	city := input.PromptAndGetInput("city", input.OnlyLettersOrSpacesValidation)
 	stateCode := input.PromptAndGetInput("state code", input.StateValidation)
-	v.RecommendationCache.ChangeLocation(city, stateCode)
+	*v.Location = cache.Location{City: city, StateCode: stateCode}
 	v.recs = nil
 }
 
@@ -1,7 +1,15 @@
 package screens
 
+import (
+	"concert-manager/db"
+	"context"
+)
+
 const pageSize = 10
 
+// Changes made from the TUI are attributed to it in the audit log
+var tuiContext = db.WithActor(context.Background(), db.ActorTUI)
+
 type sortType int
 
 const (
@@ -0,0 +1,149 @@
+package screens
+
+import (
+	"concert-manager/data"
+	"concert-manager/log"
+	"concert-manager/ui/output"
+	"concert-manager/util"
+	"context"
+	"time"
+)
+
+type trashCache interface {
+	GetTrash() (data.Trash, error)
+	RestoreEvent(context.Context, string) error
+	PurgeEvent(context.Context, string) error
+	RestoreArtist(context.Context, string) error
+	PurgeArtist(context.Context, string) error
+	RestoreVenue(context.Context, string) error
+	PurgeVenue(context.Context, string) error
+}
+
+type trashRecord struct {
+	entity    string
+	id        string
+	label     string
+	deletedAt *time.Time
+}
+
+type TrashManager struct {
+	Cache         trashCache
+	actions       []string
+	records       []trashRecord
+	currentRecord *trashRecord
+	loaded        bool
+}
+
+const (
+	restoreTrash = iota + 1
+	purgeTrash
+	skipTrash
+	trashToMenu
+)
+
+func NewTrashManager() *TrashManager {
+	template := TrashManager{}
+	template.actions = []string{"Restore", "Delete Permanently", "Skip", "Utility Menu"}
+	return &template
+}
+
+func (m TrashManager) Title() string {
+	return "Trash"
+}
+
+func (m *TrashManager) DisplayData() {
+	if !m.loaded {
+		if err := m.loadRecords(); err != nil {
+			log.Error("Failed to load trash:", err)
+			output.Displayln("Failed to load trash")
+			return
+		}
+		m.loaded = true
+	}
+
+	m.currentRecord = nil
+	if len(m.records) == 0 {
+		output.Displayln("The trash is empty")
+		return
+	}
+
+	m.currentRecord = &m.records[len(m.records)-1]
+	output.Displayf("Deleted %s (%d remaining)\n", m.currentRecord.entity, len(m.records))
+	output.Displayln(m.currentRecord.label)
+	if m.currentRecord.deletedAt != nil {
+		output.Displayln("Deleted on", m.currentRecord.deletedAt.Local().Format("1/2/2006"))
+	}
+}
+
+// Events come last so they are shown first, artists and venues have to be restored before their events
+func (m *TrashManager) loadRecords() error {
+	trash, err := m.Cache.GetTrash()
+	if err != nil {
+		return err
+	}
+	m.records = []trashRecord{}
+	for _, venue := range trash.Venues {
+		m.records = append(m.records, trashRecord{"venue", venue.Id, util.FormatVenue(venue), venue.DeletedAt})
+	}
+	for _, artist := range trash.Artists {
+		m.records = append(m.records, trashRecord{"artist", artist.Id, util.FormatArtist(artist), artist.DeletedAt})
+	}
+	for _, event := range trash.Events {
+		m.records = append(m.records, trashRecord{"event", event.Id, util.FormatEvent(event), event.DeletedAt})
+	}
+	return nil
+}
+
+func (m TrashManager) Actions() []string {
+	return m.actions
+}
+
+func (m *TrashManager) NextScreen(i int) Screen {
+	switch i {
+	case restoreTrash:
+		if m.currentRecord == nil {
+			output.Displayln("No record to restore")
+			return m
+		}
+
+		restore := map[string]func(context.Context, string) error{
+			"event":  m.Cache.RestoreEvent,
+			"artist": m.Cache.RestoreArtist,
+			"venue":  m.Cache.RestoreVenue,
+		}[m.currentRecord.entity]
+		if err := restore(tuiContext, m.currentRecord.id); err != nil {
+			log.Errorf("Failed to restore %s %v, %v", m.currentRecord.entity, m.currentRecord.id, err)
+			output.Displayf("Failed to restore %s: %v\n", m.currentRecord.entity, err)
+			return m
+		}
+
+		m.records = m.records[:len(m.records)-1]
+	case purgeTrash:
+		if m.currentRecord == nil {
+			output.Displayln("No record to delete")
+			return m
+		}
+
+		purge := map[string]func(context.Context, string) error{
+			"event":  m.Cache.PurgeEvent,
+			"artist": m.Cache.PurgeArtist,
+			"venue":  m.Cache.PurgeVenue,
+		}[m.currentRecord.entity]
+		if err := purge(tuiContext, m.currentRecord.id); err != nil {
+			log.Errorf("Failed to purge %s %v, %v", m.currentRecord.entity, m.currentRecord.id, err)
+			output.Displayf("Failed to delete %s: %v\n", m.currentRecord.entity, err)
+			return m
+		}
+
+		// purging an artist or venue also purges the events that reference it
+		m.loaded = false
+	case skipTrash:
+		if m.currentRecord != nil {
+			m.records = m.records[:len(m.records)-1]
+		}
+	case trashToMenu:
+		m.loaded = false
+		return nil
+	}
+	return m
+}
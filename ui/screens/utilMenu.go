@@ -2,17 +2,23 @@ package screens
 
 type UtilMenu struct {
 	PassedEventManager     Screen
+	IntegrityManager       Screen
+	DuplicateMerger        Screen
+	TrashManager           Screen
 	actions                []string
 }
 
 const (
 	passedEvents = iota + 1
+	checkIntegrity
+	mergeDuplicateRecords
+	manageTrash
 	utilToMainMenu
 )
 
 func NewUtilMenu() *UtilMenu {
 	menu := UtilMenu{}
-	menu.actions = []string{"Manage Passed Events", "Main Menu"}
+	menu.actions = []string{"Manage Passed Events", "Check Data Integrity", "Merge Duplicates", "Trash", "Main Menu"}
 	return &menu
 }
 
@@ -28,6 +34,12 @@ func (m UtilMenu) NextScreen(i int) Screen {
 	switch i {
 	case passedEvents:
 		return m.PassedEventManager
+	case checkIntegrity:
+		return m.IntegrityManager
+	case mergeDuplicateRecords:
+		return m.DuplicateMerger
+	case manageTrash:
+		return m.TrashManager
 	case utilToMainMenu:
 		return nil
 	}
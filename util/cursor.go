@@ -0,0 +1,48 @@
+package util
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+const cursorDateFmt = "2006-01-02"
+
+// Points just past the last event of a page. Events are paged in date then ID order in every
+// backend, and the date is kept as yyyy-mm-dd so it sorts the same way as a string
+type EventCursor struct {
+	Date string
+	Id   string
+}
+
+func NewEventCursor(ts time.Time, id string) EventCursor {
+	return EventCursor{ts.Format(cursorDateFmt), id}
+}
+
+func DecodeEventCursor(cursor string) (EventCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return EventCursor{}, errors.New("invalid cursor")
+	}
+	date, id, found := strings.Cut(string(raw), "|")
+	if _, err := time.Parse(cursorDateFmt, date); !found || err != nil || id == "" {
+		return EventCursor{}, errors.New("invalid cursor")
+	}
+	return EventCursor{date, id}, nil
+}
+
+func (c EventCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Date + "|" + c.Id))
+}
+
+func (c EventCursor) Timestamp() time.Time {
+	ts, _ := time.Parse(cursorDateFmt, c.Date)
+	return ts
+}
+
+// Whether an event with the given date and ID belongs on a page after the cursor
+func (c EventCursor) Precedes(ts time.Time, id string) bool {
+	date := ts.Format(cursorDateFmt)
+	return date > c.Date || (date == c.Date && id > c.Id)
+}
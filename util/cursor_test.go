@@ -0,0 +1,36 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventCursorRoundTrip(t *testing.T) {
+	cursor := NewEventCursor(time.Date(2023, 6, 14, 0, 0, 0, 0, time.UTC), "abc")
+	decoded, err := DecodeEventCursor(cursor.Encode())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if decoded != cursor {
+		t.Errorf("Incorrect decoded cursor, expected: %v, actual: %v", cursor, decoded)
+	}
+}
+
+func TestEventCursorPrecedes(t *testing.T) {
+	cursor := EventCursor{Date: "2023-06-14", Id: "b"}
+	day := time.Date(2023, 6, 14, 0, 0, 0, 0, time.UTC)
+	if !cursor.Precedes(day, "c") || !cursor.Precedes(day.AddDate(0, 0, 1), "a") {
+		t.Error("Events after the cursor should be preceded by it")
+	}
+	if cursor.Precedes(day, "b") || cursor.Precedes(day.AddDate(0, 0, -1), "z") {
+		t.Error("Events up to the cursor should not be preceded by it")
+	}
+}
+
+func TestDecodeEventCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"", "not a cursor", NewEventCursor(time.Now(), "").Encode()} {
+		if _, err := DecodeEventCursor(cursor); err == nil {
+			t.Errorf("expected error for %q", cursor)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"concert-manager/data"
+	"strings"
+	"unicode"
+)
+
+// Groups options whose normalized names are within the tolerance of each other. Every option
+// ends up in at most one group, and options without any duplicates aren't returned
+func FindDuplicates[T any](options []T, tolerance float64, name func(T) string, comparable func(T, T) bool) [][]T {
+	grouped := make([]bool, len(options))
+	groups := [][]T{}
+	for i, option := range options {
+		if grouped[i] {
+			continue
+		}
+
+		candidates := []int{}
+		for j := i + 1; j < len(options); j++ {
+			if !grouped[j] && comparable(option, options[j]) {
+				candidates = append(candidates, j)
+			}
+		}
+		matches := SearchOptions(normalizeName(name(option)), candidates, NoMaxResults, tolerance, func(term string, j int) int {
+			return getLevenshteinDistance(term, normalizeName(name(options[j])))
+		})
+		if len(matches) == 0 {
+			continue
+		}
+
+		group := []T{option}
+		grouped[i] = true
+		for _, j := range matches {
+			group = append(group, options[j])
+			grouped[j] = true
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func FindDuplicateArtists(artists []data.Artist, tolerance float64) [][]data.Artist {
+	return FindDuplicates(artists, tolerance, func(a data.Artist) string {
+		return a.Name
+	}, func(_, _ data.Artist) bool {
+		return true
+	})
+}
+
+// Venues in different cities are never duplicates, even with the same name
+func FindDuplicateVenues(venues []data.Venue, tolerance float64) [][]data.Venue {
+	return FindDuplicates(venues, tolerance, func(v data.Venue) string {
+		return v.Name
+	}, func(a, b data.Venue) bool {
+		return strings.EqualFold(a.City, b.City) && strings.EqualFold(a.State, b.State)
+	})
+}
+
+// ignores case, punctuation and a leading "the", like "The Masquerade - Altar" and "Masquerade Altar"
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
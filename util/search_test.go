@@ -5,22 +5,9 @@ import (
 	"testing"
 )
 
-type MockCache struct {
-    artists []data.Artist
-	venues []data.Venue
-}
-
-func (c MockCache) GetArtists() []data.Artist {
-    return c.artists
-}
-
-func (c MockCache) GetVenues() []data.Venue {
-    return c.venues
-}
-
 var artists = []data.Artist{
 	{Name: "cat"},
-    {Name: "hat"},
+	{Name: "hat"},
 	{Name: "mat"},
 	{Name: "bat"},
 	{Name: "rat"},
@@ -32,12 +19,14 @@ var artists = []data.Artist{
 	{Name: "dt"},
 }
 
-func TestMaxCountArtistsReturned(t *testing.T) {
-	cache := MockCache{}
-	cache.artists = artists
-	search := Search{cache}
+const maxCount = 5
+
+// The allowed distance is the term length times the tolerance rounded down, so a two letter term
+// needs half of its length to allow a single edit
+const singleEditTolerance = 0.5
 
-	resp := search.FindFuzzyArtistMatchesByName("dat")
+func TestMaxCountArtistsReturned(t *testing.T) {
+	resp := SearchArtists("dat", artists, maxCount, LenientTolerance)
 	expectedLen := maxCount
 	if len(resp) != expectedLen {
 		t.Errorf("Incorrect number of returned artists, expected: %v, actual: %v", expectedLen, len(resp))
@@ -45,14 +34,10 @@ func TestMaxCountArtistsReturned(t *testing.T) {
 }
 
 func TestLessThanMaxCountArtistsReturned(t *testing.T) {
-	cache := MockCache{}
-	cache.artists = artists
-	search := Search{cache}
-
-	resp := search.FindFuzzyArtistMatchesByName("dt")
+	resp := SearchArtists("dt", artists, maxCount, singleEditTolerance)
 	expectedLen := 2
 	if len(resp) != expectedLen {
-		t.Errorf("Incorrect number of returned artists, expected: %v, actual: %v", expectedLen, len(resp))
+		t.Fatalf("Incorrect number of returned artists, expected: %v, actual: %v", expectedLen, len(resp))
 	}
 	expectedResp := []data.Artist{{Name: "dt"}, {Name: "at"}}
 	if resp[0] != expectedResp[0] || resp[1] != expectedResp[1] {
@@ -61,12 +46,31 @@ func TestLessThanMaxCountArtistsReturned(t *testing.T) {
 }
 
 func TestNoArtistsReturned(t *testing.T) {
-	cache := MockCache{}
-	search := Search{cache}
-
-	resp := search.FindFuzzyArtistMatchesByName("dat")
+	resp := SearchArtists("dat", []data.Artist{}, maxCount, LenientTolerance)
 	expectedLen := 0
 	if len(resp) != expectedLen {
 		t.Errorf("Incorrect number of returned artists, expected: %v, actual: %v", expectedLen, len(resp))
 	}
 }
+
+func TestFindDuplicateVenues(t *testing.T) {
+	venues := []data.Venue{
+		{Name: "The Masquerade - Altar", City: "Atlanta", State: "GA", Id: "1"},
+		{Name: "Cadence Bank Amphitheatre", City: "Atlanta", State: "GA", Id: "2"},
+		{Name: "Masquerade Altar", City: "Atlanta", State: "GA", Id: "3"},
+		{Name: "Cadence Bank Ampitheatre", City: "Atlanta", State: "GA", Id: "4"},
+		{Name: "The Eastern", City: "Atlanta", State: "GA", Id: "5"},
+		{Name: "Masquerade Altar", City: "Athens", State: "GA", Id: "6"},
+	}
+
+	groups := FindDuplicateVenues(venues, ModerateTolerance)
+	if len(groups) != 2 {
+		t.Fatalf("Incorrect number of duplicate groups, expected: %v, actual: %v", 2, groups)
+	}
+	if len(groups[0]) != 2 || groups[0][0].Id != "1" || groups[0][1].Id != "3" {
+		t.Errorf("Incorrect first group, actual: %v", groups[0])
+	}
+	if len(groups[1]) != 2 || groups[1][0].Id != "2" || groups[1][1].Id != "4" {
+		t.Errorf("Incorrect second group, actual: %v", groups[1])
+	}
+}